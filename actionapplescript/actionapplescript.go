@@ -0,0 +1,155 @@
+package actionapplescript
+
+import (
+	"MIDIRouter/logger"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Runs waiting for the previous ones to complete, later runs are dropped
+const queueLength = 8
+
+// Script running a Shortcut, given its name and input
+var shortcutScript = []string{
+	"on run argv",
+	"tell application \"Shortcuts Events\" to run shortcut (item 1 of argv) with input (item 2 of argv)",
+	"end run",
+}
+
+// Runs an AppleScript, or a Shortcut, with osascript. The transformed value is
+// passed as argument (as text), scripts reading it with "on run argv". Runs
+// happen in the background, one at a time, until Close.
+type ActionAppleScript struct {
+	name        string
+	args        []string // osascript arguments, the value being appended
+	runs        chan uint16
+	quit        chan struct{}
+	closeOnce   sync.Once
+	unavailable error // Run error when osascript is missing (not macOS)
+	log         *logger.Logger
+}
+
+type ActionAppleScriptConfig struct {
+	Script string // AppleScript code
+	File   string // Script file, relative to the configuration file directory
+}
+
+type ActionShortcutConfig struct {
+	Shortcut string // Name of the Shortcut
+}
+
+func New(settings json.RawMessage, configDir string) (*ActionAppleScript, error) {
+	var conf ActionAppleScriptConfig
+
+	err := json.Unmarshal([]byte(settings), &conf)
+	if err != nil {
+		return nil, errors.New("Failed to parse action settings :" + err.Error())
+	}
+
+	switch {
+	case (conf.Script != "") && (conf.File == ""):
+		var args []string
+		for _, line := range strings.Split(conf.Script, "\n") {
+			args = append(args, "-e", line)
+		}
+		return newAction("AppleScript", args)
+	case (conf.File != "") && (conf.Script == ""):
+		path := conf.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(configDir, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, errors.New("Failed to load AppleScript: " + err.Error())
+		}
+		return newAction("AppleScript "+conf.File, []string{path})
+	}
+	return nil, errors.New("AppleScript action requires either a Script or a File")
+}
+
+func NewShortcut(settings json.RawMessage) (*ActionAppleScript, error) {
+	var conf ActionShortcutConfig
+
+	err := json.Unmarshal([]byte(settings), &conf)
+	if err != nil {
+		return nil, errors.New("Failed to parse action settings :" + err.Error())
+	}
+	if conf.Shortcut == "" {
+		return nil, errors.New("Shortcut action requires a Shortcut name")
+	}
+
+	var args []string
+	for _, line := range shortcutScript {
+		args = append(args, "-e", line)
+	}
+	return newAction("Shortcut '"+conf.Shortcut+"'", append(args, conf.Shortcut))
+}
+
+// Configurations load on every OS, runs fail where osascript is missing
+func newAction(name string, args []string) (*ActionAppleScript, error) {
+	a := &ActionAppleScript{
+		name: name,
+		args: args,
+		runs: make(chan uint16, queueLength),
+		quit: make(chan struct{}),
+		log:  logger.New(logger.LevelInfo),
+	}
+	if _, err := exec.LookPath("osascript"); err != nil {
+		a.unavailable = errors.New(name + " actions require macOS: osascript not found")
+		return a, nil
+	}
+	go a.run()
+	return a, nil
+}
+
+func (a *ActionAppleScript) SetLogger(log *logger.Logger) {
+	a.log = log
+}
+
+func (a *ActionAppleScript) run() {
+	for {
+		select {
+		case value := <-a.runs:
+			cmd := exec.Command("osascript", append(a.args, strconv.Itoa(int(value)))...)
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				a.log.Error(a.name + " failed: " + err.Error())
+			}
+		case <-a.quit:
+			return
+		}
+	}
+}
+
+func (a *ActionAppleScript) Run(value uint16) error {
+	if a.unavailable != nil {
+		return a.unavailable
+	}
+	select {
+	case <-a.quit:
+		return errors.New(a.name + " stopped, run dropped")
+	default:
+	}
+	select {
+	case a.runs <- value:
+		return nil
+	default:
+		return errors.New(a.name + " still running, run dropped")
+	}
+}
+
+// Stop running scripts, once the one running completes. Waiting runs are
+// dropped.
+func (a *ActionAppleScript) Close() error {
+	a.closeOnce.Do(func() { close(a.quit) })
+	return nil
+}
+
+func (a *ActionAppleScript) String() string {
+	return a.name
+}
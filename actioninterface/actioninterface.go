@@ -0,0 +1,24 @@
+package actioninterface
+
+import "MIDIRouter/logger"
+
+// Something done outside of MIDI when a rule matches (keyboard shortcut,
+// script...), along with the messages the rule generates. Run is called with
+// the transformed value on the MIDI thread, and must return quickly: slow
+// actions carry on in the background.
+type ActionInterface interface {
+	Run(value uint16) error
+	String() string
+}
+
+// Optional interface for actions logging on their own (e.g. failures of
+// actions carried on in the background), with the logger of their router
+type LoggerActionInterface interface {
+	SetLogger(log *logger.Logger)
+}
+
+// Optional interface for actions running in the background, stopped when
+// their rule is dropped or the router stops
+type CloserActionInterface interface {
+	Close() error
+}
@@ -0,0 +1,82 @@
+package actionkeystroke
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Modifier flags of keyboard events (CGEventFlags)
+var modifiers = map[string]uint64{
+	"shift":   0x00020000,
+	"ctrl":    0x00040000,
+	"control": 0x00040000,
+	"alt":     0x00080000,
+	"option":  0x00080000,
+	"cmd":     0x00100000,
+	"command": 0x00100000,
+}
+
+// macOS virtual key codes (ANSI layout)
+var keys = map[string]uint16{
+	"a": 0x00, "s": 0x01, "d": 0x02, "f": 0x03, "h": 0x04, "g": 0x05, "z": 0x06, "x": 0x07,
+	"c": 0x08, "v": 0x09, "b": 0x0B, "q": 0x0C, "w": 0x0D, "e": 0x0E, "r": 0x0F, "y": 0x10,
+	"t": 0x11, "1": 0x12, "2": 0x13, "3": 0x14, "4": 0x15, "6": 0x16, "5": 0x17, "=": 0x18,
+	"9": 0x19, "7": 0x1A, "-": 0x1B, "8": 0x1C, "0": 0x1D, "]": 0x1E, "o": 0x1F, "u": 0x20,
+	"[": 0x21, "i": 0x22, "p": 0x23, "l": 0x25, "j": 0x26, "'": 0x27, "k": 0x28, ";": 0x29,
+	"\\": 0x2A, ",": 0x2B, "/": 0x2C, "n": 0x2D, "m": 0x2E, ".": 0x2F, "`": 0x32,
+
+	"return": 0x24, "enter": 0x24, "tab": 0x30, "space": 0x31, "delete": 0x33, "backspace": 0x33,
+	"escape": 0x35, "esc": 0x35, "forwarddelete": 0x75, "home": 0x73, "end": 0x77,
+	"pageup": 0x74, "pagedown": 0x79, "left": 0x7B, "right": 0x7C, "down": 0x7D, "up": 0x7E,
+
+	"f1": 0x7A, "f2": 0x78, "f3": 0x63, "f4": 0x76, "f5": 0x60, "f6": 0x61,
+	"f7": 0x62, "f8": 0x64, "f9": 0x65, "f10": 0x6D, "f11": 0x67, "f12": 0x6F,
+}
+
+// Types a keyboard shortcut, e.g. "cmd+shift+r", as if pressed on the
+// computer keyboard
+type ActionKeystroke struct {
+	shortcut string
+	key      uint16
+	flags    uint64
+}
+
+type ActionKeystrokeConfig struct {
+	Keys string // Modifiers and key separated by "+"
+}
+
+func New(settings json.RawMessage) (*ActionKeystroke, error) {
+	var a ActionKeystroke
+	var conf ActionKeystrokeConfig
+
+	err := json.Unmarshal([]byte(settings), &conf)
+	if err != nil {
+		return nil, errors.New("Failed to parse action settings :" + err.Error())
+	}
+
+	names := strings.Split(strings.ToLower(conf.Keys), "+")
+	for _, name := range names[:len(names)-1] {
+		flag, found := modifiers[strings.TrimSpace(name)]
+		if !found {
+			return nil, errors.New("Invalid modifier '" + name + "' in shortcut '" + conf.Keys + "': expected cmd, shift, alt or ctrl")
+		}
+		a.flags |= flag
+	}
+	key, found := keys[strings.TrimSpace(names[len(names)-1])]
+	if !found {
+		return nil, errors.New("Invalid key in shortcut '" + conf.Keys + "'")
+	}
+	a.key = key
+	a.shortcut = conf.Keys
+
+	return &a, nil
+}
+
+func (a *ActionKeystroke) Run(value uint16) error {
+	return post(a.key, a.flags)
+}
+
+func (a *ActionKeystroke) String() string {
+	return "Keystroke " + a.shortcut
+}
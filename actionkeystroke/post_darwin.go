@@ -0,0 +1,38 @@
+//go:build darwin
+
+package actionkeystroke
+
+/*
+#cgo LDFLAGS: -framework ApplicationServices
+#include <ApplicationServices/ApplicationServices.h>
+
+static int postKey(CGKeyCode key, CGEventFlags flags) {
+	CGEventRef down = CGEventCreateKeyboardEvent(NULL, key, true);
+	CGEventRef up = CGEventCreateKeyboardEvent(NULL, key, false);
+	int ok = (down != NULL) && (up != NULL);
+	if (ok) {
+		CGEventSetFlags(down, flags);
+		CGEventSetFlags(up, flags);
+		CGEventPost(kCGHIDEventTap, down);
+		CGEventPost(kCGHIDEventTap, up);
+	}
+	if (down != NULL) {
+		CFRelease(down);
+	}
+	if (up != NULL) {
+		CFRelease(up);
+	}
+	return ok;
+}
+*/
+import "C"
+
+import "errors"
+
+// Post the key down and up events to the system, as the HID keyboard would
+func post(key uint16, flags uint64) error {
+	if C.postKey(C.CGKeyCode(key), C.CGEventFlags(flags)) == 0 {
+		return errors.New("Failed to create keyboard event")
+	}
+	return nil
+}
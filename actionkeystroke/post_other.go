@@ -0,0 +1,9 @@
+//go:build !darwin
+
+package actionkeystroke
+
+import "errors"
+
+func post(key uint16, flags uint64) error {
+	return errors.New("Keystroke actions require macOS")
+}
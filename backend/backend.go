@@ -0,0 +1,47 @@
+package backend
+
+import "MIDIRouter/midi"
+
+// Access to the MIDI devices of a router: one source, one destination. The
+// router, rules, filters and generators only see midi.Packet, so that other
+// MIDI systems than CoreMIDI can be plugged in.
+type Backend interface {
+	// Names of the devices available as sources, as given to OpenSource
+	Sources() ([]string, error)
+	// Names of the devices available as destinations, as given to OpenDestination
+	Destinations() ([]string, error)
+	// Connect to the source device, receive being called for every incoming
+	// packet. The source opened before, if any, is disconnected.
+	OpenSource(name string, receive func(packet midi.Packet)) error
+	// Connect to the destination device, instead of the one opened before
+	OpenDestination(name string) error
+	// Send a packet to the destination device
+	Send(packet midi.Packet) error
+	// Disconnect from the devices
+	Close() error
+}
+
+// Backends listing devices that are unreachable, e.g. Bluetooth peripherals
+// out of range that CoreMIDI keeps listed
+type OfflineBackend interface {
+	// Whether the source (input) or destination named name is listed but
+	// unreachable
+	Offline(name string, input bool) (bool, error)
+}
+
+// Backends sending Universal MIDI Packets to MIDI 2.0 destination devices
+type UMPBackend interface {
+	// Send UMP data (32 bits big endian words, complete messages) to the
+	// destination device
+	SendUMP(packet midi.Packet) error
+}
+
+// Backends able to create their own endpoints, other applications connecting
+// to them instead of the router connecting to a device
+type VirtualBackend interface {
+	// Create a destination endpoint named name, receive being called for every
+	// packet other applications send to it
+	OpenVirtualSource(name string, receive func(packet midi.Packet)) error
+	// Create a source endpoint named name, that Send sends to
+	OpenVirtualDestination(name string) error
+}
@@ -0,0 +1,394 @@
+//go:build darwin
+
+package backend
+
+/*
+#cgo LDFLAGS: -framework CoreMIDI -framework CoreFoundation
+#include <CoreMIDI/CoreMIDI.h>
+
+// Endpoint i of the sources (input) or destinations: 1 when its device is
+// unreachable while still listed (Bluetooth peripheral out of range), 0 if
+// not, -1 if there is no such endpoint
+static int endpointOffline(int input, ItemCount i) {
+	MIDIEndpointRef endpoint = input ? MIDIGetSource(i) : MIDIGetDestination(i);
+	SInt32 offline = 0;
+	if (endpoint == 0) {
+		return -1;
+	}
+	if (MIDIObjectGetIntegerProperty(endpoint, kMIDIPropertyOffline, &offline) != noErr) {
+		return 0;
+	}
+	return offline != 0;
+}
+
+static MIDIClientRef umpClient;
+static MIDIPortRef umpPort;
+
+// Output port of the UMP event lists, on a client of its own: go-coremidi
+// does not expose its references
+static OSStatus umpOpenPort(void) {
+	OSStatus err = MIDIClientCreate(CFSTR("MIDIRouter UMP"), NULL, NULL, &umpClient);
+	if (err != noErr) {
+		return err;
+	}
+	return MIDIOutputPortCreate(umpClient, CFSTR("MIDIRouter UMP output port"), &umpPort);
+}
+
+static MIDIEndpointRef destinationAt(ItemCount i) {
+	return MIDIGetDestination(i);
+}
+
+// Words of the UMP message starting with word
+static int umpWordCount(UInt32 word) {
+	switch (word >> 28) {
+	case 0x0: case 0x1: case 0x2: case 0x6: case 0x7:
+		return 1;
+	case 0x3: case 0x4: case 0x8: case 0x9: case 0xA:
+		return 2;
+	case 0xB: case 0xC:
+		return 3;
+	}
+	return 4;
+}
+
+// Send words (complete UMP messages) to destination as MIDI 2.0 event lists
+// (MIDISendEventList, macOS 11): the MIDIPacket API only carries MIDI 1.0
+static OSStatus umpSend(MIDIEndpointRef destination, const UInt32 *words, int count, MIDITimeStamp timeStamp) {
+	Byte buffer[1024];
+	MIDIEventList *list = (MIDIEventList *)buffer;
+	MIDIEventPacket *packet = MIDIEventListInit(list, kMIDIProtocol_2_0);
+	OSStatus err;
+	int i = 0;
+
+	while (i < count) {
+		int n = umpWordCount(words[i]);
+		if (i + n > count) {
+			break;
+		}
+		MIDIEventPacket *next = MIDIEventListAdd(list, sizeof(buffer), packet, timeStamp, n, &words[i]);
+		if (next == NULL) {
+			//List full: send it and start another one
+			err = MIDISendEventList(umpPort, destination, list);
+			if (err != noErr) {
+				return err;
+			}
+			packet = MIDIEventListInit(list, kMIDIProtocol_2_0);
+			continue;
+		}
+		packet = next;
+		i += n;
+	}
+	if (list->numPackets == 0) {
+		return noErr;
+	}
+	return MIDISendEventList(umpPort, destination, list);
+}
+*/
+import "C"
+
+import (
+	"MIDIRouter/midi"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/youpy/go-coremidi"
+)
+
+// Maximum data length of a single CoreMIDI MIDIPacket
+const maxPacketDataLength = 256
+
+// macOS CoreMIDI devices
+type CoreMIDI struct {
+	client        coremidi.Client
+	mutex         sync.Mutex
+	receive       func(packet midi.Packet)
+	srcPort       *coremidi.InputPort  // Created on the first OpenSource, reused when opened again
+	srcDisconnect func()               // Disconnects the source from srcPort, nil if none
+	destPort      *coremidi.OutputPort // Created on the first OpenDestination
+	destination   coremidi.Destination
+	umpEndpoint   C.MIDIEndpointRef     // Destination of SendUMP, 0 if none
+	virtualOut    *coremidi.Source      // Endpoint created as destination, nil for devices
+	virtualIn     *coremidi.Destination // Endpoint created as source, nil for devices
+}
+
+// CoreMIDI on macOS
+func NewSystem() (Backend, error) {
+	return NewCoreMIDI()
+}
+
+func NewCoreMIDI() (*CoreMIDI, error) {
+	client, err := coremidi.NewClient("MIDIRouter")
+	if err != nil {
+		return nil, err
+	}
+	return &CoreMIDI{client: client}, nil
+}
+
+// Sources are named "<device>/<manufacturer>/<name>". Opening another source
+// (a Bluetooth peripheral back in range) disconnects the previous one, the
+// input port being reused.
+func (b *CoreMIDI) OpenSource(name string, receive func(packet midi.Packet)) error {
+	source, err := findSource(name)
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.receive = receive
+	if b.srcDisconnect != nil {
+		b.srcDisconnect()
+		b.srcDisconnect = nil
+	}
+	if b.srcPort == nil {
+		port, err := coremidi.NewInputPort(b.client, "MIDIRouter input port",
+			func(source coremidi.Source, packet coremidi.Packet) {
+				b.mutex.Lock()
+				receive := b.receive
+				b.mutex.Unlock()
+				receive(midi.NewPacket(packet.Data, packet.TimeStamp))
+			})
+		if err != nil {
+			return err
+		}
+		b.srcPort = &port
+	}
+
+	connection, err := b.srcPort.Connect(source)
+	if err != nil {
+		return err
+	}
+	b.srcDisconnect = connection.Disconnect
+	return nil
+}
+
+// Destinations are named "<manufacturer>/<name>". Opening another one replaces
+// the previous one, the output port being reused.
+func (b *CoreMIDI) OpenDestination(name string) error {
+	destination, err := findDestination(name)
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.destPort == nil {
+		port, err := coremidi.NewOutputPort(b.client, "MIDIRouter output port")
+		if err != nil {
+			return err
+		}
+		b.destPort = &port
+	}
+	b.destination = destination
+	b.umpEndpoint = destinationRef(name)
+	return nil
+}
+
+// UMP output port, created on first use
+var (
+	umpPortOnce   sync.Once
+	umpPortStatus C.OSStatus
+)
+
+// Send MIDI 2.0 data to the destination device, as event lists
+func (b *CoreMIDI) SendUMP(packet midi.Packet) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.virtualOut != nil {
+		return errors.New("MIDI 2.0 is not supported by virtual destinations")
+	}
+	if b.umpEndpoint == 0 {
+		return errors.New("No MIDI destination")
+	}
+	umpPortOnce.Do(func() { umpPortStatus = C.umpOpenPort() })
+	if umpPortStatus != C.noErr {
+		return fmt.Errorf("Failed to create the MIDI 2.0 output port: %d", int(umpPortStatus))
+	}
+
+	words := make([]C.UInt32, len(packet.Data)/4)
+	if len(words) == 0 {
+		return nil
+	}
+	for i := range words {
+		words[i] = C.UInt32(binary.BigEndian.Uint32(packet.Data[4*i:]))
+	}
+	status := C.umpSend(b.umpEndpoint, &words[0], C.int(len(words)), C.MIDITimeStamp(packet.TimeStamp))
+	if status != C.noErr {
+		return fmt.Errorf("Failed to send MIDI 2.0 data: %d", int(status))
+	}
+	return nil
+}
+
+// Endpoint of the destination named name, listed at the same index by
+// coremidi.AllDestinations, 0 if not found
+func destinationRef(name string) C.MIDIEndpointRef {
+	destinations, err := coremidi.AllDestinations()
+	if err != nil {
+		return 0
+	}
+	for i, d := range destinations {
+		if destinationName(d) == name {
+			return C.destinationAt(C.ItemCount(i))
+		}
+	}
+	return 0
+}
+
+// Whether a listed source (input) or destination is unreachable: CoreMIDI
+// keeps Bluetooth peripherals out of range listed, marked offline
+func (b *CoreMIDI) Offline(name string, input bool) (bool, error) {
+	var names []string
+	var err error
+	if input {
+		names, err = b.Sources()
+	} else {
+		names, err = b.Destinations()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	in := C.int(0)
+	if input {
+		in = 1
+	}
+	for i, n := range names {
+		if n == name {
+			switch C.endpointOffline(in, C.ItemCount(i)) {
+			case 0:
+				return false, nil
+			case 1:
+				return true, nil
+			}
+		}
+	}
+	return false, errors.New("MIDI device not found: " + name)
+}
+
+// The router appears as a destination named name in other applications
+func (b *CoreMIDI) OpenVirtualSource(name string, receive func(packet midi.Packet)) error {
+	destination, err := coremidi.NewDestination(b.client, name, func(packet coremidi.Packet) {
+		receive(midi.NewPacket(packet.Data, packet.TimeStamp))
+	})
+	if err != nil {
+		return errors.New("Failed to create virtual MIDI destination " + name + ": " + err.Error())
+	}
+	b.virtualIn = &destination
+	return nil
+}
+
+// The router appears as a source named name in other applications (DAWs
+// subscribe to it, no IAC bus needed)
+func (b *CoreMIDI) OpenVirtualDestination(name string) error {
+	source, err := coremidi.NewSource(b.client, name)
+	if err != nil {
+		return errors.New("Failed to create virtual MIDI source " + name + ": " + err.Error())
+	}
+	b.virtualOut = &source
+	return nil
+}
+
+// go-coremidi sends single packet lists: long packets (SysEx dumps) are sent
+// as consecutive fragments.
+func (b *CoreMIDI) Send(packet midi.Packet) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if (b.virtualOut == nil) && (b.destPort == nil) {
+		return errors.New("No MIDI destination")
+	}
+	for len(packet.Data) > 0 {
+		n := len(packet.Data)
+		if n > maxPacketDataLength {
+			n = maxPacketDataLength
+		}
+		fragment := coremidi.NewPacket(packet.Data[:n], packet.TimeStamp)
+		var err error
+		if b.virtualOut != nil {
+			err = fragment.Received(b.virtualOut)
+		} else {
+			err = fragment.Send(b.destPort, &b.destination)
+		}
+		if err != nil {
+			return err
+		}
+		packet.Data = packet.Data[n:]
+	}
+	return nil
+}
+
+// Ports and virtual sources are released with the client, on exit
+func (b *CoreMIDI) Close() error {
+	if b.virtualIn != nil {
+		b.virtualIn.Dispose()
+		b.virtualIn = nil
+	}
+	return nil
+}
+
+func (b *CoreMIDI) Sources() ([]string, error) {
+	sources, err := coremidi.AllSources()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, s := range sources {
+		names = append(names, sourceName(s))
+	}
+	return names, nil
+}
+
+func (b *CoreMIDI) Destinations() ([]string, error) {
+	destinations, err := coremidi.AllDestinations()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, d := range destinations {
+		names = append(names, destinationName(d))
+	}
+	return names, nil
+}
+
+func sourceName(s coremidi.Source) string {
+	return s.Entity().Device().Name() + "/" + s.Manufacturer() + "/" + s.Name()
+}
+
+func destinationName(d coremidi.Destination) string {
+	return d.Manufacturer() + "/" + d.Name()
+}
+
+func findSource(key string) (coremidi.Source, error) {
+	sources, err := coremidi.AllSources()
+	if err != nil {
+		return coremidi.Source{}, err
+	}
+
+	for _, s := range sources {
+		if sourceName(s) == key {
+			return s, nil
+		}
+	}
+
+	return coremidi.Source{}, errors.New("MIDI source not found: " + key)
+}
+
+func findDestination(key string) (coremidi.Destination, error) {
+	dest, err := coremidi.AllDestinations()
+	if err != nil {
+		return coremidi.Destination{}, err
+	}
+
+	for _, d := range dest {
+		if destinationName(d) == key {
+			return d, nil
+		}
+	}
+
+	return coremidi.Destination{}, errors.New("MIDI destination not found: " + key)
+}
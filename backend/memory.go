@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"MIDIRouter/midi"
+	"sync"
+)
+
+// In-memory devices, for replays, self-tests and tests without any MIDI
+// system: packets are received with Inject, sent packets are kept (or handed
+// to the OnSend callback).
+type Memory struct {
+	mutex   sync.Mutex
+	receive func(packet midi.Packet)
+	sent    []midi.Packet
+	onSend  func(packet midi.Packet)
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (b *Memory) OpenSource(name string, receive func(packet midi.Packet)) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.receive = receive
+	return nil
+}
+
+func (b *Memory) OpenDestination(name string) error {
+	return nil
+}
+
+// Virtual endpoints behave as devices
+func (b *Memory) OpenVirtualSource(name string, receive func(packet midi.Packet)) error {
+	return b.OpenSource(name, receive)
+}
+
+func (b *Memory) OpenVirtualDestination(name string) error {
+	return b.OpenDestination(name)
+}
+
+func (b *Memory) Send(packet midi.Packet) error {
+	b.mutex.Lock()
+	onSend := b.onSend
+	if onSend == nil {
+		b.sent = append(b.sent, packet)
+	}
+	b.mutex.Unlock()
+
+	if onSend != nil {
+		onSend(packet)
+	}
+	return nil
+}
+
+// UMP data is kept as is, like MIDI 1.0 data
+func (b *Memory) SendUMP(packet midi.Packet) error {
+	return b.Send(packet)
+}
+
+// Any name is accepted, none is listed
+func (b *Memory) Sources() ([]string, error) {
+	return []string{}, nil
+}
+
+func (b *Memory) Destinations() ([]string, error) {
+	return []string{}, nil
+}
+
+func (b *Memory) Close() error {
+	return nil
+}
+
+// Hand sent packets to onSend instead of keeping them
+func (b *Memory) OnSend(onSend func(packet midi.Packet)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.onSend = onSend
+}
+
+// Simulate a packet received from the source
+func (b *Memory) Inject(packet midi.Packet) {
+	b.mutex.Lock()
+	receive := b.receive
+	b.mutex.Unlock()
+
+	if receive != nil {
+		receive(packet)
+	}
+}
+
+// Returns and forgets the packets sent so far
+func (b *Memory) Sent() []midi.Packet {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	sent := b.sent
+	b.sent = nil
+	return sent
+}
@@ -0,0 +1,190 @@
+//go:build linux
+
+package backend
+
+import (
+	"MIDIRouter/midi"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ALSA on Linux
+func NewSystem() (Backend, error) {
+	return NewRawMIDI()
+}
+
+// Linux ALSA devices, through the rawmidi devices of the kernel
+// (/dev/snd/midiC<card>D<device>): no library is needed, e.g. on a headless
+// Raspberry Pi. Devices are named "<card>/<device>" as listed in /proc/asound
+// ("UM2/UM-2 MIDI 1"), or "hw:<card>,<device>".
+type RawMIDI struct {
+	mutex       sync.Mutex
+	source      *os.File
+	destination *os.File
+}
+
+type rawMIDIDevice struct {
+	name   string
+	hw     string
+	path   string
+	input  bool
+	output bool
+}
+
+func NewRawMIDI() (*RawMIDI, error) {
+	return &RawMIDI{}, nil
+}
+
+func (b *RawMIDI) OpenSource(name string, receive func(packet midi.Packet)) error {
+	device, err := findRawMIDI(name, true)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(device.path, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.New("Failed to open MIDI source " + name + ": " + err.Error())
+	}
+	b.mutex.Lock()
+	if b.source != nil {
+		//Stops the reader of the previous source
+		b.source.Close()
+	}
+	b.source = f
+	b.mutex.Unlock()
+
+	go func() {
+		var stream byteStream
+		buf := make([]byte, 1024)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			if data := stream.write(buf[:n]); len(data) > 0 {
+				receive(midi.NewPacket(data, 0))
+			}
+		}
+	}()
+	return nil
+}
+
+func (b *RawMIDI) OpenDestination(name string) error {
+	device, err := findRawMIDI(name, false)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(device.path, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.New("Failed to open MIDI destination " + name + ": " + err.Error())
+	}
+	b.mutex.Lock()
+	if b.destination != nil {
+		b.destination.Close()
+	}
+	b.destination = f
+	b.mutex.Unlock()
+	return nil
+}
+
+func (b *RawMIDI) Send(packet midi.Packet) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.destination == nil {
+		return errors.New("No MIDI destination")
+	}
+	_, err := b.destination.Write(packet.Data)
+	return err
+}
+
+func (b *RawMIDI) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var err error
+	for _, f := range []*os.File{b.source, b.destination} {
+		if f != nil {
+			if e := f.Close(); e != nil {
+				err = e
+			}
+		}
+	}
+	b.source, b.destination = nil, nil
+	return err
+}
+
+func (b *RawMIDI) Sources() ([]string, error) {
+	return rawMIDINames(true)
+}
+
+func (b *RawMIDI) Destinations() ([]string, error) {
+	return rawMIDINames(false)
+}
+
+func rawMIDINames(input bool) ([]string, error) {
+	devices, err := rawMIDIDevices()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, d := range devices {
+		if (input && d.input) || (!input && d.output) {
+			names = append(names, d.name)
+		}
+	}
+	return names, nil
+}
+
+func findRawMIDI(name string, input bool) (rawMIDIDevice, error) {
+	devices, err := rawMIDIDevices()
+	if err != nil {
+		return rawMIDIDevice{}, err
+	}
+	for _, d := range devices {
+		if ((d.name == name) || (d.hw == name)) && ((input && d.input) || (!input && d.output)) {
+			return d, nil
+		}
+	}
+	if input {
+		return rawMIDIDevice{}, errors.New("MIDI source not found: " + name)
+	}
+	return rawMIDIDevice{}, errors.New("MIDI destination not found: " + name)
+}
+
+// Rawmidi devices, with their name and directions from /proc/asound
+func rawMIDIDevices() ([]rawMIDIDevice, error) {
+	paths, err := filepath.Glob("/dev/snd/midiC*D*")
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []rawMIDIDevice
+	for _, path := range paths {
+		var card, device int
+		if _, err := fmt.Sscanf(filepath.Base(path), "midiC%dD%d", &card, &device); err != nil {
+			continue
+		}
+		d := rawMIDIDevice{hw: fmt.Sprintf("hw:%d,%d", card, device), path: path}
+
+		id, err := os.ReadFile(fmt.Sprintf("/proc/asound/card%d/id", card))
+		info, err2 := os.ReadFile(fmt.Sprintf("/proc/asound/card%d/midi%d", card, device))
+		if (err != nil) || (err2 != nil) {
+			//No information: named after the device, both directions
+			d.name, d.input, d.output = d.hw, true, true
+			devices = append(devices, d)
+			continue
+		}
+		lines := strings.Split(string(info), "\n")
+		d.name = strings.TrimSpace(string(id)) + "/" + strings.TrimSpace(lines[0])
+		for _, line := range lines {
+			d.input = d.input || strings.HasPrefix(line, "Input")
+			d.output = d.output || strings.HasPrefix(line, "Output")
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
@@ -0,0 +1,76 @@
+package backend
+
+// Splits a raw MIDI byte stream (ALSA rawmidi devices) into whole messages:
+// bytes of a message may come in several reads, and running status is
+// expanded. Real-time messages are passed on right away, SysEx data as it
+// comes (the router reassembles SysEx fragments).
+type byteStream struct {
+	status  byte   // Running status, 0 if none
+	message []byte // Message being received
+	sysex   bool
+}
+
+// Length of the messages of a status byte, 0 for SysEx
+func messageLength(status byte) int {
+	switch {
+	case status < 0xC0, (status >= 0xE0) && (status < 0xF0), status == 0xF2:
+		return 3
+	case status < 0xE0, status == 0xF1, status == 0xF3:
+		return 2
+	case status == 0xF0:
+		return 0
+	}
+	return 1
+}
+
+// Whole messages received with data
+func (s *byteStream) write(data []byte) []byte {
+	var out []byte
+
+	for _, b := range data {
+		switch {
+		case b >= 0xF8:
+			out = append(out, b)
+		case s.sysex && (b < 0x80):
+			s.message = append(s.message, b)
+		case b == 0xF7:
+			if s.sysex {
+				out = append(out, s.message...)
+				out = append(out, b)
+			}
+			s.sysex, s.message = false, nil
+		case b >= 0x80:
+			//Any other status byte ends a SysEx (truncated)
+			if s.sysex {
+				out = append(out, s.message...)
+				s.sysex = false
+			}
+			s.message = []byte{b}
+			s.status = 0
+			if b < 0xF0 {
+				s.status = b
+			}
+			s.sysex = b == 0xF0
+		default:
+			if len(s.message) == 0 {
+				if s.status == 0 {
+					continue //Stray data byte
+				}
+				s.message = []byte{s.status}
+			}
+			s.message = append(s.message, b)
+		}
+
+		if !s.sysex && (len(s.message) > 0) && (len(s.message) == messageLength(s.message[0])) {
+			out = append(out, s.message...)
+			s.message = nil
+		}
+	}
+
+	//SysEx data is not held
+	if s.sysex {
+		out = append(out, s.message...)
+		s.message = s.message[:0]
+	}
+	return out
+}
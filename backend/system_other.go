@@ -0,0 +1,9 @@
+//go:build !darwin && !linux
+
+package backend
+
+import "errors"
+
+func NewSystem() (Backend, error) {
+	return nil, errors.New("MIDI devices require macOS (CoreMIDI) or Linux (ALSA)")
+}
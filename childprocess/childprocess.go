@@ -0,0 +1,241 @@
+package childprocess
+
+import (
+	"MIDIRouter/logger"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stdio protocol, all integers big endian:
+//
+//	request  (to the process):   length u16, value u16, message bytes
+//	response (from the process): length u16, response bytes
+//
+// Each request gets exactly one response.
+const (
+	defaultTimeoutMs      = 100
+	defaultRestartDelayMs = 1000
+	MaxFrameLength        = 0xFFFF
+)
+
+// A child process answering requests, restarted when it exits or stops
+// answering. Calls are serialized, processes are not shared between rules.
+type Process struct {
+	command      string
+	args         []string
+	dir          string
+	timeout      time.Duration
+	restartDelay time.Duration
+
+	mutex     sync.Mutex
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	responses chan []byte
+	exited    chan struct{}
+	stop      chan struct{}
+	lastStart time.Time
+	closed    bool
+
+	log *logger.Logger
+}
+
+type Config struct {
+	Command        string
+	Args           []string
+	TimeoutMs      int // Delay to wait for a response (default 100ms)
+	RestartDelayMs int // Minimal delay between two starts of the process (default 1s)
+}
+
+// Start a process in dir (the configuration file directory)
+func Start(conf Config, dir string) (*Process, error) {
+	if conf.Command == "" {
+		return nil, errors.New("Process requires a Command")
+	}
+	if (conf.TimeoutMs < 0) || (conf.RestartDelayMs < 0) {
+		return nil, errors.New("Invalid process settings: negative delay")
+	}
+	if conf.TimeoutMs == 0 {
+		conf.TimeoutMs = defaultTimeoutMs
+	}
+	if conf.RestartDelayMs == 0 {
+		conf.RestartDelayMs = defaultRestartDelayMs
+	}
+
+	p := &Process{
+		command:      conf.Command,
+		args:         conf.Args,
+		dir:          dir,
+		timeout:      time.Duration(conf.TimeoutMs) * time.Millisecond,
+		restartDelay: time.Duration(conf.RestartDelayMs) * time.Millisecond,
+		log:          logger.New(logger.LevelInfo),
+	}
+	if err := p.start(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Log restarts with the logger of the router
+func (p *Process) SetLogger(log *logger.Logger) {
+	p.log = log
+}
+
+// Start the process and its response reader. Called with the mutex held.
+func (p *Process) start() error {
+	cmd := exec.Command(p.command, p.args...)
+	cmd.Dir = p.dir
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return errors.New("Failed to start " + p.command + ": " + err.Error())
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return errors.New("Failed to start " + p.command + ": " + err.Error())
+	}
+
+	p.lastStart = time.Now()
+	err = cmd.Start()
+	if err != nil {
+		return errors.New("Failed to start " + p.command + ": " + err.Error())
+	}
+
+	responses := make(chan []byte)
+	exited := make(chan struct{})
+	stop := make(chan struct{})
+	go func() {
+		reader := bufio.NewReader(stdout)
+	read:
+		for {
+			frame, err := readFrame(reader)
+			if err != nil {
+				break
+			}
+			select {
+			case responses <- frame:
+			case <-stop:
+				break read
+			}
+		}
+		cmd.Wait()
+		close(exited)
+	}()
+
+	p.cmd = cmd
+	p.stdin = stdin
+	p.responses = responses
+	p.exited = exited
+	p.stop = stop
+	return nil
+}
+
+// Restart the process when it died, no more than once per restart delay
+func (p *Process) ensureRunning() error {
+	if p.closed {
+		return errors.New("Process " + p.command + " stopped")
+	}
+	select {
+	case <-p.exited:
+	default:
+		return nil
+	}
+
+	if time.Since(p.lastStart) < p.restartDelay {
+		return errors.New("Process " + p.command + " exited, waiting before restart")
+	}
+	p.log.Info("Restarting process " + p.command)
+	return p.start()
+}
+
+// Kill a process which no longer follows the protocol, it is restarted on the next message
+func (p *Process) kill() {
+	select {
+	case <-p.stop:
+		return
+	default:
+	}
+	close(p.stop)
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+}
+
+func readFrame(reader io.Reader) ([]byte, error) {
+	var length uint16
+
+	err := binary.Read(reader, binary.BigEndian, &length)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, length)
+	_, err = io.ReadFull(reader, frame)
+	if err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// Send a request, and wait for its response
+func (p *Process) Call(value uint16, data []byte) ([]byte, error) {
+	if len(data) > MaxFrameLength {
+		return nil, errors.New("Message too long for process " + p.command)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	err := p.ensureRunning()
+	if err != nil {
+		return nil, err
+	}
+
+	request := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(request[0:], uint16(len(data)))
+	binary.BigEndian.PutUint16(request[2:], value)
+	request = append(request, data...)
+	_, err = p.stdin.Write(request)
+	if err != nil {
+		p.kill()
+		return nil, errors.New("Failed to write to process " + p.command + ": " + err.Error())
+	}
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	select {
+	case response := <-p.responses:
+		return response, nil
+	case <-p.exited:
+		return nil, errors.New("Process " + p.command + " exited")
+	case <-timer.C:
+		p.kill()
+		return nil, errors.New("Process " + p.command + " did not answer in time, killed")
+	}
+}
+
+// Stop the process for good: its standard input is closed, it is killed and
+// waited for
+func (p *Process) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	p.kill()
+	<-p.exited
+	return nil
+}
+
+// Command line of the process
+func (p *Process) String() string {
+	return strings.TrimSpace(p.command + " " + strings.Join(p.args, " "))
+}
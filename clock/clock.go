@@ -0,0 +1,119 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Source of time of routers and rules: the wall clock when running, a manual
+// clock in tests and fast-forward replays, so that time-dependent behaviors
+// (DropDuplicates, send limits, delays, quantization) are deterministic
+type Clock interface {
+	Now() time.Time
+	// Call f in its own goroutine (wall clock) once d elapsed
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	// Prevent the timer from firing, false if it already fired or was stopped
+	Stop() bool
+}
+
+func Since(c Clock, t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func Until(c Clock, t time.Time) time.Duration {
+	return t.Sub(c.Now())
+}
+
+type wall struct{}
+
+// The system clock
+var Wall Clock = wall{}
+
+func (wall) Now() time.Time {
+	return time.Now()
+}
+
+func (wall) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// Clock moving only when told to. Timers fire, in order, on the goroutine
+// calling Advance or Set.
+type Manual struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+type manualTimer struct {
+	clock *Manual
+	at    time.Time
+	f     func()
+}
+
+func NewManual(start time.Time) *Manual {
+	return &Manual{now: start}
+}
+
+func (c *Manual) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *Manual) AfterFunc(d time.Duration, f func()) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	t := &manualTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Move the clock forward by d
+func (c *Manual) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Move the clock to t, firing the timers due on the way at their own time.
+// The clock never goes back.
+func (c *Manual) Set(t time.Time) {
+	for {
+		c.mutex.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+		if (len(c.timers) == 0) || c.timers[0].at.After(t) {
+			if t.After(c.now) {
+				c.now = t
+			}
+			c.mutex.Unlock()
+			return
+		}
+		next := c.timers[0]
+		c.timers = c.timers[1:]
+		if next.at.After(c.now) {
+			c.now = next.at
+		}
+		c.mutex.Unlock()
+
+		next.f()
+	}
+}
+
+func (t *manualTimer) Stop() bool {
+	c := t.clock
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Accept control commands on a Unix socket, one per line:
+//
+//	list               Routers with their position, name, config file and state
+//	restart <router>   Reload the config of a router (position, name or config
+//	                   file) and restart it, the other routers running on
+//	reload <router>    Reload the rules and routing settings of a router from
+//	                   its config file, its devices staying connected
+//	stats [tag]        Messages matched by the rules of the running routers,
+//	                   only rules tagged with tag if given
+func listenControl(path string, configFiles []string) (net.Listener, error) {
+	//Socket left by a previous run
+	if info, err := os.Stat(path); (err == nil) && (info.Mode()&os.ModeSocket != 0) {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.New("Failed to open control socket: " + err.Error())
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveControl(conn, configFiles)
+		}
+	}()
+	return listener, nil
+}
+
+func serveControl(conn net.Conn, configFiles []string) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case (fields[0] == "list") && (len(fields) == 1):
+			routersMutex.Lock()
+			for i, file := range configFiles {
+				name, state := "-", "stopped"
+				if routers[i] != nil {
+					name, state = routers[i].Name(), "running"
+				}
+				fmt.Fprintf(conn, "%d %s %s %s\n", i+1, name, file, state)
+			}
+			routersMutex.Unlock()
+		case (fields[0] == "restart") && (len(fields) == 2):
+			if err := restartRouter(fields[1], configFiles); err != nil {
+				fmt.Fprintln(conn, "Error:", err)
+			} else {
+				fmt.Fprintln(conn, "OK")
+			}
+		case (fields[0] == "reload") && (len(fields) == 2):
+			if err := reloadRouter(fields[1], configFiles); err != nil {
+				fmt.Fprintln(conn, "Error:", err)
+			} else {
+				fmt.Fprintln(conn, "OK")
+			}
+		case (fields[0] == "stats") && (len(fields) <= 2):
+			tag := ""
+			if len(fields) == 2 {
+				tag = fields[1]
+			}
+			writeStats(conn, tag)
+		default:
+			fmt.Fprintln(conn, "Error: unknown command, expected 'list', 'restart <router>', 'reload <router>' or 'stats [tag]'")
+		}
+	}
+}
+
+// One line per rule: router, rule name, matches, state and tags
+func writeStats(w io.Writer, tag string) {
+	routersMutex.Lock()
+	defer routersMutex.Unlock()
+
+	for _, relay := range routers {
+		if relay == nil {
+			continue
+		}
+		for _, r := range relay.RuleStats(tag) {
+			state := "enabled"
+			if !r.Enabled {
+				state = "disabled"
+			}
+			line := fmt.Sprintf("%s '%s' %d %s", relay.Name(), r.Name, r.Matches, state)
+			if len(r.Tags) > 0 {
+				line += " " + strings.Join(r.Tags, ",")
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// Stop a router, given by position (1 based), name or config file, and start
+// it again from its config file
+func restartRouter(id string, configFiles []string) error {
+	routersMutex.Lock()
+	i := findRouter(id, configFiles)
+	if i < 0 {
+		routersMutex.Unlock()
+		return errors.New("No such router: " + id)
+	}
+	old := routers[i]
+	routers[i] = nil
+	routersMutex.Unlock()
+
+	if old != nil {
+		old.Cleanup()
+	}
+	return startRouter(i, configFiles[i])
+}
+
+// Position of a router in configFiles, -1 if not found. Must be called with
+// routersMutex locked.
+func findRouter(id string, configFiles []string) int {
+	if n, err := strconv.Atoi(id); err == nil {
+		if (n < 1) || (n > len(configFiles)) {
+			return -1
+		}
+		return n - 1
+	}
+	for i, file := range configFiles {
+		if (routers[i] != nil) && (routers[i].Name() == id) {
+			return i
+		}
+		if (file == id) || (filepath.Base(file) == id) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"MIDIRouter/backend"
+)
+
+// MIDI devices, named as in config files
+type deviceList struct {
+	Inputs  []string
+	Outputs []string
+}
+
+// Print the MIDI inputs and outputs, as text or JSON. Returns the process exit
+// code.
+func printDevices(jsonOutput bool) int {
+	var devices deviceList
+
+	b, err := backend.NewSystem()
+	if err == nil {
+		devices.Inputs, err = b.Sources()
+	}
+	if err == nil {
+		devices.Outputs, err = b.Destinations()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(devices); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Println("MIDI inputs:")
+	for _, name := range devices.Inputs {
+		fmt.Println("  " + name)
+	}
+	fmt.Println("MIDI outputs:")
+	for _, name := range devices.Outputs {
+		fmt.Println("  " + name)
+	}
+	return 0
+}
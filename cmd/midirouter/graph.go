@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"MIDIRouter/config"
+)
+
+// Print the routing of config files as a Graphviz DOT graph, e.g. for
+// `midirouter graph rig.json | dot -Tsvg > rig.svg`. Returns the process exit
+// code.
+func graph(args []string) int {
+	flags, format := newConfigFlagSet("graph", "[--format <format>] <config file 1> [config file 2] ...")
+	if !parseConfigFlags(flags, format, args) {
+		return 2
+	}
+	args = flags.Args()
+	if len(args) < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := config.WriteGraph(os.Stdout, *format, args...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
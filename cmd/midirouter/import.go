@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"MIDIRouter/importer"
+)
+
+// Convert mappings of other tools to a configuration, printed on the standard
+// output: CSV files (.csv) or Bome-style translators (any other extension).
+// Returns the process exit code.
+func importMappings(args []string) int {
+	var source, destination string
+	for (len(args) > 2) && strings.HasPrefix(args[0], "--") {
+		switch args[0] {
+		case "--source":
+			source = args[1]
+		case "--dest":
+			destination = args[1]
+		default:
+			fmt.Println("Unknown option:", args[0])
+			return 2
+		}
+		args = args[2:]
+	}
+	if len(args) != 1 {
+		fmt.Println("Usage:", os.Args[0], "import [--source <source>] [--dest <destination>] <mappings.csv | translators.txt>")
+		return 2
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer f.Close()
+
+	var rules []importer.Rule
+	var skipped []string
+	if strings.EqualFold(filepath.Ext(args[0]), ".csv") {
+		rules, err = importer.FromCSV(f)
+	} else {
+		rules, skipped, err = importer.FromBome(f)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, s := range skipped {
+		fmt.Fprintln(os.Stderr, "Skipped", s)
+	}
+
+	config := struct {
+		SourceDevice      string
+		DestinationDevice string
+		Rules             []importer.Rule
+	}{SourceDevice: source, DestinationDevice: destination, Rules: rules}
+	data, _ := json.MarshalIndent(config, "", "  ")
+	fmt.Println(string(data))
+	return 0
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"MIDIRouter/backend"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"MIDIRouter/router"
+)
+
+// Probes are non-commercial SysEx messages carrying a sequence number
+var latencyProbeHeader = []byte{0xF0, 0x7D, 0x4C, 0x54}
+
+func latencyUsage() {
+	fmt.Println("Usage:", os.Args[0], "latency --out <destination> --in <source> [--count <probes>] [--interval <ms>]")
+}
+
+// Send probes to a destination and measure when they come back on a source
+// (looped back physically or through a router). Returns the process exit code.
+func latency(args []string) int {
+	flags := flag.NewFlagSet("latency", flag.ContinueOnError)
+	out := flags.String("out", "", "Destination the probes are sent to, matched as router devices are")
+	in := flags.String("in", "", "Source the probes come back on, matched as router devices are")
+	count := flags.Int("count", 100, "Number of probes")
+	intervalMs := flags.Int("interval", 20, "Interval between probes, in milliseconds")
+	flags.Usage = func() {
+		latencyUsage()
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if (flags.NArg() > 0) || (*out == "") || (*in == "") {
+		flags.Usage()
+		return 2
+	}
+	if *count <= 0 {
+		fmt.Println("Invalid --count value:", *count)
+		return 2
+	}
+	if *intervalMs <= 0 {
+		fmt.Println("Invalid --interval value:", *intervalMs)
+		return 2
+	}
+	interval := time.Duration(*intervalMs) * time.Millisecond
+
+	var mutex sync.Mutex
+	sent := make(map[int]time.Time)
+	var delays []time.Duration
+
+	log := logger.New(logger.LevelInfo)
+	var source, destination string
+	b, err := backend.NewSystem()
+	if err == nil {
+		source, err = router.ResolveDevice(b, *in, true, log)
+	}
+	if err == nil {
+		destination, err = router.ResolveDevice(b, *out, false, log)
+	}
+	if err == nil {
+		err = b.OpenSource(source, func(packet midi.Packet) {
+			now := time.Now()
+			i := bytes.Index(packet.Data, latencyProbeHeader)
+			if (i < 0) || (i+len(latencyProbeHeader)+2 > len(packet.Data)) {
+				return
+			}
+			seq := int(packet.Data[i+len(latencyProbeHeader)])<<7 | int(packet.Data[i+len(latencyProbeHeader)+1])
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if at, ok := sent[seq]; ok {
+				delays = append(delays, now.Sub(at))
+				delete(sent, seq)
+			}
+		})
+	}
+	if err == nil {
+		err = b.OpenDestination(destination)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	for seq := 0; seq < *count; seq++ {
+		probe := append(append([]byte(nil), latencyProbeHeader...), byte(seq>>7)&0x7F, byte(seq)&0x7F, 0xF7)
+		mutex.Lock()
+		sent[seq&0x3FFF] = time.Now()
+		mutex.Unlock()
+		if err := b.Send(midi.NewPacket(probe, 0)); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		time.Sleep(interval)
+	}
+	//Late probes
+	time.Sleep(500 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	fmt.Printf("Probes: %d sent, %d received\n", *count, len(delays))
+	if len(delays) == 0 {
+		return 1
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	var sum float64
+	for _, d := range delays {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(delays))
+	var variance float64
+	for _, d := range delays {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+	}
+	jitter := time.Duration(math.Sqrt(variance / float64(len(delays))))
+
+	fmt.Printf("Latency: min %v, mean %v, median %v, max %v\n", delays[0], time.Duration(mean),
+		delays[len(delays)/2], delays[len(delays)-1])
+	fmt.Printf("Jitter (standard deviation): %v\n", jitter)
+	return 0
+}
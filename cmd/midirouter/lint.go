@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"MIDIRouter/config"
+)
+
+// Report the rules of config files which load but cannot behave as intended.
+// Returns the process exit code: 1 when problems are found.
+func lint(args []string) int {
+	flags, format := newConfigFlagSet("lint", "[--format <format>] <config file 1> [config file 2] ...")
+	if !parseConfigFlags(flags, format, args) {
+		return 2
+	}
+	args = flags.Args()
+	if len(args) < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	code := 0
+	for _, file := range args {
+		warnings, err := config.Lint(file, *format)
+		if err != nil {
+			fmt.Println(err)
+			code = 1
+			continue
+		}
+		for _, w := range warnings {
+			fmt.Println(w)
+			code = 1
+		}
+	}
+	if code == 0 {
+		fmt.Println("No problem found")
+	}
+	return code
+}
@@ -1,69 +1,248 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"runtime/pprof"
+	"strings"
+	"sync"
 	"syscall"
 
-	"github.com/youpy/go-coremidi"
-
 	"MIDIRouter/config"
+	"MIDIRouter/logger"
 	"MIDIRouter/router"
+	"MIDIRouter/smf"
 )
 
 const (
 	version = "1.2"
 )
 
-var routers []*router.MIDIRouter
+var routers []*router.MIDIRouter // Running routers, by position of their config file (nil if failed to load)
+var routersMutex sync.Mutex
+var recorder *smf.Recorder
+var captureFile *os.File
+var verbose bool        // Overrides the Verbose setting of config files
+var verboseTag string   // Overrides the VerboseTag setting of config files
+var configFormat string // Format of the config files, "" to tell it from their extension
+
+// Values of an option which may be repeated (--config, --dest)
+type repeatedFlag []string
+
+func (r *repeatedFlag) String() string {
+	return strings.Join(*r, ", ")
+}
+
+func (r *repeatedFlag) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+func usage() {
+	fmt.Printf("MIDIRouter v%s\n", version)
+	fmt.Println("Usage:", os.Args[0], "[options] [--config <config file 1>] ... [config file 2] ...")
+	fmt.Println("      ", os.Args[0], "replay [--fast] [--format <format>] <config file> <file.jsonl>")
+	fmt.Println("      ", os.Args[0], "selftest [--format <format>] <config file>")
+	fmt.Println("      ", os.Args[0], "test [--format <format>] <config file> <hex bytes>")
+	fmt.Println("      ", os.Args[0], "graph [--format <format>] <config file 1> [config file 2] ...")
+	fmt.Println("      ", os.Args[0], "lint [--format <format>] <config file 1> [config file 2] ...")
+	fmt.Println("      ", os.Args[0], "import [--source <source>] [--dest <destination>] <mappings.csv | translators.txt>")
+	fmt.Println("      ", os.Args[0], "latency --out <destination> --in <source>")
+	fmt.Println("      ", os.Args[0], "send --dest <destination> [--ch <1-16>] <message>")
+	fmt.Println("      ", os.Args[0], "panic [--dest <destination>] ...")
+	fmt.Println("Options:")
+	flag.PrintDefaults()
+}
+
+// Options of the subcommands reading config files, with --format. arguments
+// is the usage line of the subcommand after its name.
+func newConfigFlagSet(name string, arguments string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	format := flags.String("format", "", "Format of the config files: json, yaml or toml (default: by file extension)")
+	flags.Usage = func() {
+		fmt.Println("Usage:", os.Args[0], name, arguments)
+		flags.PrintDefaults()
+	}
+	return flags, format
+}
+
+// Parse the options of a subcommand reading config files, false if invalid
+func parseConfigFlags(flags *flag.FlagSet, format *string, args []string) bool {
+	if err := flags.Parse(args); err != nil {
+		return false
+	}
+	if err := config.CheckFormat(*format); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	return true
+}
 
 func main() {
-	if len(os.Args) < 2 {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "replay":
+			os.Exit(replay(os.Args[2:]))
+		case "selftest":
+			os.Exit(selftest(os.Args[2:]))
+		case "send":
+			os.Exit(send(os.Args[2:]))
+		case "panic":
+			os.Exit(panicCommand(os.Args[2:]))
+		case "test":
+			os.Exit(test(os.Args[2:]))
+		case "latency":
+			os.Exit(latency(os.Args[2:]))
+		case "graph":
+			os.Exit(graph(os.Args[2:]))
+		case "lint":
+			os.Exit(lint(os.Args[2:]))
+		case "import":
+			os.Exit(importMappings(os.Args[2:]))
+		}
+	}
+
+	var configFiles repeatedFlag
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+	listDevices := flag.Bool("list-devices", false, "List MIDI inputs and outputs and exit")
+	jsonOutput := flag.Bool("json", false, "List devices as JSON (with --list-devices)")
+	flag.BoolVar(&verbose, "verbose", false, "Log every message, whatever the Verbose setting of config files")
+	flag.StringVar(&verboseTag, "verbose-tag", "", "Only log the messages seen by the rules with this tag (with --verbose)")
+	flag.Var(&configFiles, "config", "Config file to run (may be repeated, config files may also follow the options)")
+	record := flag.String("record", "", "Record the input and output of all routers to a Standard MIDI File")
+	capture := flag.String("capture", "", "Capture the session to a file, for replays (single config file)")
+	control := flag.String("control", "", "Unix socket accepting control commands, e.g. to restart a router")
+	watch := flag.Bool("watch", false, "Reload the rules of routers when their config file is modified")
+	color := flag.String("color", "auto", "Colorize verbose output: auto (on terminals), always or never")
+	flag.StringVar(&configFormat, "format", "", "Format of the config files: json, yaml or toml (default: by file extension)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showVersion {
 		fmt.Printf("MIDIRouter v%s\n", version)
-		fmt.Println("Usage:", os.Args[0], "<config file 1> [config file 2] ...")
-		fmt.Println("MIDI inputs:")
-		sources, err := coremidi.AllSources()
+		return
+	}
+	if *listDevices {
+		os.Exit(printDevices(*jsonOutput))
+	}
+	switch *color {
+	case "auto":
+	case "always", "never":
+		logger.SetColor(*color == "always")
+	default:
+		fmt.Println("Invalid --color value:", *color)
+		os.Exit(2)
+	}
+	if err := config.CheckFormat(configFormat); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	configFiles = append(configFiles, flag.Args()...)
+	if len(configFiles) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if (*capture != "") && (len(configFiles) != 1) {
+		fmt.Println("--capture requires a single config file")
+		os.Exit(2)
+	}
+
+	//Optional CPU profile of the routing session, for pprof analysis
+	if profile := os.Getenv("MIDIROUTER_CPUPROFILE"); len(profile) != 0 {
+		f, err := os.Create(profile)
 		if err != nil {
 			panic(err)
 		}
-		for _, source := range sources {
-			fmt.Println("  " + source.Entity().Device().Name() + "/" + source.Manufacturer() + "/" + source.Name())
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			panic(err)
 		}
+		defer pprof.StopCPUProfile()
+	}
 
-		fmt.Println("MIDI outputs:")
-		destinations, err := coremidi.AllDestinations()
-		if err != nil {
+	var err error
+	if *record != "" {
+		//Recording of all routers input and output streams
+		if recorder, err = smf.NewRecorder(*record); err != nil {
 			panic(err)
 		}
-		for _, destination := range destinations {
-			fmt.Println("  " + destination.Manufacturer() + "/" + destination.Name())
+	}
+	if *capture != "" {
+		//Session capture, for replays
+		if captureFile, err = os.Create(*capture); err != nil {
+			panic(err)
 		}
-
-		return
 	}
 
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
 
+	routers = make([]*router.MIDIRouter, len(configFiles))
+	for i, configFile := range configFiles {
+		go startRouter(i, configFile)
+	}
+	//Rules reloaded on SIGHUP, devices staying connected
+	hupchan := make(chan os.Signal, 1)
+	signal.Notify(hupchan, syscall.SIGHUP)
 	go func() {
-		for _, configFile := range os.Args[1:] {
-			go startRouter(configFile)
+		for range hupchan {
+			reloadRouters(configFiles)
 		}
 	}()
+	if *control != "" {
+		listener, err := listenControl(*control, configFiles)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer listener.Close()
+	}
+	if *watch {
+		go watchConfigs(configFiles)
+	}
 
 	<-sigchan
+	routersMutex.Lock()
 	for _, router := range routers {
-		router.Cleanup()
+		if router != nil {
+			router.Cleanup()
+		}
+	}
+	routersMutex.Unlock()
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if captureFile != nil {
+		captureFile.Close()
 	}
 }
 
-func startRouter(file string) {
-	router, err := config.LoadConfig(file)
+// Load and run the router of config file i
+func startRouter(i int, file string) error {
+	router, err := config.LoadConfig(file, configFormat)
 	if err != nil {
-		fmt.Printf("Error loading config %s: %v\n", file, err)
-		return
+		fmt.Printf("Error loading config %v\n", err)
+		return err
+	}
+	if verbose {
+		router.SetVerbose(true)
+	}
+	if verboseTag != "" {
+		router.SetVerboseTag(verboseTag)
+	}
+	if recorder != nil {
+		router.SetRecorder(recorder, true, true)
+	}
+	if captureFile != nil {
+		router.SetCapture(captureFile)
 	}
-	routers = append(routers, router)
-	router.Start()
+	routersMutex.Lock()
+	routers[i] = router
+	routersMutex.Unlock()
+	go router.Start()
+	return nil
 }
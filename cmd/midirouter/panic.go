@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"MIDIRouter/backend"
+	"MIDIRouter/logger"
+	"MIDIRouter/router"
+)
+
+// Silence destination devices: All Sound Off, All Notes Off, sustain release
+// and Reset All Controllers on every channel of the destinations given with
+// --dest, or of all destinations. Returns the process exit code.
+func panicCommand(args []string) int {
+	var destinations repeatedFlag
+	flags := flag.NewFlagSet("panic", flag.ContinueOnError)
+	flags.Var(&destinations, "dest", "Destination to silence, matched as router devices are (may be repeated, all of them by default)")
+	flags.Usage = func() {
+		fmt.Println("Usage:", os.Args[0], "panic [--dest <destination>] ...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if len(destinations) == 0 {
+		b, err := backend.NewSystem()
+		if err == nil {
+			destinations, err = b.Destinations()
+		}
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+
+	code := 0
+	for _, destination := range destinations {
+		if err := sendPanic(destination); err != nil {
+			fmt.Println(destination+":", err)
+			code = 1
+			continue
+		}
+		fmt.Println("Panic sent to", destination)
+	}
+	return code
+}
+
+func sendPanic(destination string) error {
+	b, err := backend.NewSystem()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	name, err := router.ResolveDevice(b, destination, false, logger.New(logger.LevelInfo))
+	if err != nil {
+		return err
+	}
+	if err := b.OpenDestination(name); err != nil {
+		return err
+	}
+	for _, p := range router.PanicSettings.Packets() {
+		if err := b.Send(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"MIDIRouter/config"
+)
+
+// Delay between checks of the config files modification time (--watch)
+const watchInterval = time.Second
+
+// Reload the rules and routing settings of a router, given by position (1
+// based), name or config file, from its config file. Devices stay connected
+// and notes playing keep playing.
+func reloadRouter(id string, configFiles []string) error {
+	routersMutex.Lock()
+	i := findRouter(id, configFiles)
+	if i < 0 {
+		routersMutex.Unlock()
+		return errors.New("No such router: " + id)
+	}
+	relay := routers[i]
+	routersMutex.Unlock()
+
+	if relay == nil {
+		return errors.New("Router not running: " + id + ", restart it instead")
+	}
+	return config.ReloadConfig(relay, configFiles[i], configFormat)
+}
+
+// Reload all routers, on SIGHUP
+func reloadRouters(configFiles []string) {
+	for i := range configFiles {
+		if err := reloadRouter(fmt.Sprint(i+1), configFiles); err != nil {
+			fmt.Printf("Error reloading config %v\n", err)
+		}
+	}
+}
+
+// Reload routers when their config file is modified
+func watchConfigs(configFiles []string) {
+	modified := make([]time.Time, len(configFiles))
+	for i, file := range configFiles {
+		if info, err := os.Stat(file); err == nil {
+			modified[i] = info.ModTime()
+		}
+	}
+
+	for range time.Tick(watchInterval) {
+		for i, file := range configFiles {
+			info, err := os.Stat(file)
+			//Files being replaced by editors may be missing for a moment
+			if (err != nil) || info.ModTime().Equal(modified[i]) {
+				continue
+			}
+			modified[i] = info.ModTime()
+			fmt.Println("Config file changed:", file)
+			if err := reloadRouter(fmt.Sprint(i+1), configFiles); err != nil {
+				fmt.Printf("Error reloading config %v\n", err)
+			}
+		}
+	}
+}
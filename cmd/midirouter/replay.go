@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"MIDIRouter/clock"
+	"MIDIRouter/config"
+	"MIDIRouter/router"
+)
+
+// Maximum number of differences printed by replay
+const maxReplayDiffs = 20
+
+// Run a captured session through a config, and compare the output with the
+// captured one. Returns the process exit code.
+func replay(args []string) int {
+	flags, format := newConfigFlagSet("replay", "[--fast] [--format <format>] <config file> <file.jsonl>")
+	fast := flags.Bool("fast", false, "Run on a manual clock, without waiting for the time between messages")
+	if !parseConfigFlags(flags, format, args) {
+		return 2
+	}
+	args = flags.Args()
+	if len(args) != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	f, err := os.Open(args[1])
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	entries, err := router.ReadCapture(f)
+	f.Close()
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	relay, err := config.LoadConfigOffline(args[0], *format)
+	if err != nil {
+		fmt.Printf("Error loading config %v\n", err)
+		return 2
+	}
+	if *fast {
+		relay.SetClock(clock.NewManual(time.Now()))
+	}
+	outputs, err := relay.Replay(entries)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	var expected []string
+	for _, e := range entries {
+		if e.Out != "" {
+			expected = append(expected, e.Out)
+		}
+	}
+
+	diffs := 0
+	for i := 0; i < max(len(expected), len(outputs)); i++ {
+		want, got := "(none)", "(none)"
+		if i < len(expected) {
+			want = expected[i]
+		}
+		if i < len(outputs) {
+			got = outputs[i]
+		}
+		if want != got {
+			if diffs < maxReplayDiffs {
+				fmt.Printf("Output #%d: expected %s, got %s\n", i+1, want, got)
+			}
+			diffs++
+		}
+	}
+
+	if diffs > 0 {
+		fmt.Printf("Replay: %d of %d output messages differ\n", diffs, max(len(expected), len(outputs)))
+		return 1
+	}
+	fmt.Printf("Replay: %d output messages match\n", len(outputs))
+	return 0
+}
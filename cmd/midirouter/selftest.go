@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+
+	"MIDIRouter/config"
+)
+
+// Push test messages through every rule of a config, connected to no device,
+// and report which rules produced output. Returns the process exit code.
+func selftest(args []string) int {
+	flags, format := newConfigFlagSet("selftest", "[--format <format>] <config file>")
+	if !parseConfigFlags(flags, format, args) {
+		return 2
+	}
+	args = flags.Args()
+	if len(args) != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	relay, err := config.LoadConfigOffline(args[0], *format)
+	if err != nil {
+		fmt.Printf("Error loading config %v\n", err)
+		return 2
+	}
+	relay.SetVerbose(false)
+
+	failed := 0
+	for _, res := range relay.SelfTest() {
+		fmt.Println(res)
+		if res.Enabled && !res.Passed() {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("Self-test: %d rules failed\n", failed)
+		return 1
+	}
+	fmt.Println("Self-test: all rules passed")
+	return 0
+}
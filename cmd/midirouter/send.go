@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"MIDIRouter/backend"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"MIDIRouter/notes"
+	"MIDIRouter/router"
+)
+
+func sendUsage() {
+	fmt.Println("Usage:", os.Args[0], "send --dest <destination> [--ch <1-16>] <message> [<message>...]")
+	fmt.Println("--ch applies to messages given as options (default 1), hex messages are sent as is.")
+	fmt.Println("Message: \"<hex bytes>\" (e.g. \"B0 07 64\"), --note-on <note> <velocity>, --note-off <note> <velocity>,")
+	fmt.Println("         --cc <controller> <value> or --pc <program>. Notes are numbers or names (C4 = 60).")
+	fmt.Println("Messages are sent in the order given.")
+}
+
+// Messages to send, in the order given
+type sendMessages struct {
+	data    [][]byte
+	built   []bool // Messages built from options, sent on --ch
+	option  string // Option of the last message built
+	missing int    // Values of the last message built still expected
+}
+
+// Option building a channel message (channel 1): its first value is the one
+// of the flag, the next ones follow it on the command line
+type messageOption struct {
+	name     string
+	status   byte
+	values   int
+	messages *sendMessages
+}
+
+func (o *messageOption) String() string {
+	return ""
+}
+
+func (o *messageOption) Set(value string) error {
+	m := o.messages
+	if m.missing > 0 {
+		return errors.New("--" + m.option + ": missing value")
+	}
+	v, err := messageValue(o.name, 0, value)
+	if err != nil {
+		return err
+	}
+	m.data = append(m.data, []byte{o.status, v})
+	m.built = append(m.built, true)
+	m.option = o.name
+	m.missing = o.values - 1
+	return nil
+}
+
+// Add the next value of the last message built
+func (m *sendMessages) addValue(value string) error {
+	last := len(m.data) - 1
+	v, err := messageValue(m.option, len(m.data[last])-1, value)
+	if err != nil {
+		return err
+	}
+	m.data[last] = append(m.data[last], v)
+	m.missing--
+	return nil
+}
+
+// Send messages to a destination device, in order. Returns the process exit
+// code.
+func send(args []string) int {
+	var messages sendMessages
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	destination := flags.String("dest", "", "Destination, matched as router devices are")
+	ch := flags.Int("ch", 1, "MIDI channel (1-16) of the messages given as options")
+	flags.Var(&messageOption{"note-on", 0x90, 2, &messages}, "note-on", "Note On <note> <velocity>")
+	flags.Var(&messageOption{"note-off", 0x80, 2, &messages}, "note-off", "Note Off <note> <velocity>")
+	flags.Var(&messageOption{"cc", 0xB0, 2, &messages}, "cc", "Control Change <controller> <value>")
+	flags.Var(&messageOption{"pc", 0xC0, 1, &messages}, "pc", "Program Change <program>")
+	flags.Usage = sendUsage
+
+	//Options stop at the values following message options and at hex
+	//messages, parsing goes on after them
+	for len(args) > 0 {
+		if err := flags.Parse(args); err != nil {
+			return 2
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		if messages.missing > 0 {
+			if err := messages.addValue(args[0]); err != nil {
+				fmt.Println(err)
+				return 2
+			}
+		} else {
+			data, err := hex.DecodeString(strings.ReplaceAll(args[0], " ", ""))
+			if (err == nil) && ((len(data) == 0) || (data[0] < 0x80)) {
+				err = errors.New("Message must start with a status byte")
+			}
+			if err != nil {
+				fmt.Println(err)
+				return 2
+			}
+			messages.data = append(messages.data, data)
+			messages.built = append(messages.built, false)
+		}
+		args = args[1:]
+	}
+	if messages.missing > 0 {
+		fmt.Println("--" + messages.option + ": missing value")
+		return 2
+	}
+	if (*ch < 1) || (*ch > 16) {
+		fmt.Println("Invalid MIDI channel, expected 1-16")
+		return 2
+	}
+	if (*destination == "") || (len(messages.data) == 0) {
+		sendUsage()
+		return 2
+	}
+
+	b, err := backend.NewSystem()
+	var name string
+	if err == nil {
+		name, err = router.ResolveDevice(b, *destination, false, logger.New(logger.LevelInfo))
+	}
+	if err == nil {
+		err = b.OpenDestination(name)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	for i, data := range messages.data {
+		if messages.built[i] {
+			data[0] |= byte(*ch - 1)
+		}
+		if err := b.Send(midi.NewPacket(data, 0)); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Printf("Sent % X to %s\n", data, name)
+	}
+	return 0
+}
+
+// Value i of a message option: a note (number or name) first for Note On/Off,
+// 0-127 otherwise
+func messageValue(option string, i int, arg string) (byte, error) {
+	if (i == 0) && ((option == "note-on") || (option == "note-off")) {
+		return notes.Parse(arg)
+	}
+	v, err := strconv.Atoi(arg)
+	if (err != nil) || (v < 0) || (v > 127) {
+		return 0, errors.New("--" + option + ": invalid value " + arg + ", expected 0-127")
+	}
+	return byte(v), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"MIDIRouter/config"
+	"MIDIRouter/midi"
+	"MIDIRouter/router"
+	"MIDIRouter/rule"
+)
+
+// Run messages through the rules of a config, connected to no device, and
+// print what each rule did with them. Returns the process exit code.
+func test(args []string) int {
+	flags, format := newConfigFlagSet("test", "[--format <format>] <config file> <hex bytes>")
+	if !parseConfigFlags(flags, format, args) {
+		return 2
+	}
+	args = flags.Args()
+	if len(args) < 2 {
+		flags.Usage()
+		return 2
+	}
+
+	data, err := hex.DecodeString(strings.ReplaceAll(strings.Join(args[1:], ""), " ", ""))
+	if err != nil {
+		fmt.Println("Invalid hex bytes:", err)
+		return 2
+	}
+
+	relay, err := config.LoadConfigOffline(args[0], *format)
+	if err != nil {
+		fmt.Printf("Error loading config %v\n", err)
+		return 2
+	}
+	relay.SetVerbose(false)
+
+	for _, e := range relay.Evaluate(data) {
+		fmt.Printf("Message % X:\n", e.Message)
+		res := e.Result
+		switch {
+		case e.Handled == router.HandledPassthrough:
+			fmt.Println("  Sent as is (passthrough)")
+		case e.Handled == router.HandledSendLimit:
+			fmt.Println("  Dropped (send limit)")
+		case e.Handled == router.HandledZones:
+			fmt.Println("  Played in a keyboard zone")
+			printOutput(e.Output)
+		case e.Handled != router.HandledRules:
+			fmt.Printf("  Handled by %s\n", e.Handled)
+		case !e.Matched:
+			fmt.Println("  No rule matched, dropped")
+		case (res.Result == rule.RuleMatchResultMatchNoInject) && (len(res.Delayed) > 0):
+			fmt.Printf("  Rule '%s' matched, output delayed (value %d, transformed %d)\n", res.Rule, res.Value, res.Transformed)
+		case res.Result == rule.RuleMatchResultMatchNoInject:
+			fmt.Printf("  Rule '%s' matched, nothing generated (value %d, transformed %d)\n", res.Rule, res.Value, res.Transformed)
+		default:
+			fmt.Printf("  Rule '%s' matched: value %d, transformed %d\n", res.Rule, res.Value, res.Transformed)
+			printOutput(e.Output)
+			for i, t := range res.Noise {
+				label := "  Noise :"
+				if i > 0 {
+					label = "         "
+				}
+				fmt.Printf("%s % X (after %v)\n", label, t.Packet.Data, t.Delay)
+			}
+		}
+		for i, t := range res.Delayed {
+			label := "  Later :"
+			if i > 0 {
+				label = "         "
+			}
+			fmt.Printf("%s % X (after %v)\n", label, t.Packet.Data, t.Delay.Round(100*time.Microsecond))
+		}
+	}
+	return 0
+}
+
+func printOutput(packets []midi.Packet) {
+	for i, p := range packets {
+		label := "  Output:"
+		if i > 0 {
+			label = "         "
+		}
+		fmt.Printf("%s % X\n", label, p.Data)
+	}
+}
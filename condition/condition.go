@@ -0,0 +1,81 @@
+package condition
+
+import (
+	"MIDIRouter/filter"
+	"errors"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Returns router state for the channel (0-15) of a message, exposed to
+// expressions as "state"
+type StateFunc func(channel uint8) map[string]interface{}
+
+// A boolean expression evaluated against a filtered message, e.g.
+// `channel == 1 && value > 64 && state.sustain`
+type Condition struct {
+	source  string
+	program *vm.Program
+	state   StateFunc
+}
+
+func New(source string, state StateFunc) (*Condition, error) {
+	env := environment([]byte{0x90, 0, 0}, 0, state)
+
+	program, err := expr.Compile(source, expr.Env(env), expr.AsBool())
+	if err != nil {
+		return nil, errors.New("Invalid condition '" + source + "': " + err.Error())
+	}
+
+	return &Condition{source: source, program: program, state: state}, nil
+}
+
+// Variables available to expressions
+func environment(data []byte, value uint16, state StateFunc) map[string]interface{} {
+	var data1, data2 int
+	var channel uint8
+	var channelNumber int // 1-16, 0 for system messages
+
+	status := data[0]
+	if len(data) > 1 {
+		data1 = int(data[1])
+	}
+	if len(data) > 2 {
+		data2 = int(data[2])
+	}
+
+	msgType := filter.FilterMsgType(status >> 4)
+	if status >= 0xF0 {
+		msgType = filter.FilterMsgTypeSysEx
+	} else {
+		channel = status & 0x0F
+		channelNumber = int(channel) + 1
+	}
+
+	env := map[string]interface{}{
+		"status":  int(status),
+		"msgType": msgType.String(),
+		"channel": channelNumber,
+		"data1":   data1,
+		"data2":   data2,
+		"value":   int(value),
+		"state":   map[string]interface{}{},
+	}
+	if state != nil {
+		env["state"] = state(channel)
+	}
+	return env
+}
+
+func (c *Condition) Eval(data []byte, value uint16) (bool, error) {
+	result, err := expr.Run(c.program, environment(data, value, c.state))
+	if err != nil {
+		return false, errors.New("Condition '" + c.source + "': " + err.Error())
+	}
+	return result.(bool), nil
+}
+
+func (c *Condition) String() string {
+	return c.source
+}
@@ -1,53 +1,172 @@
 package config
 
 import (
+	"MIDIRouter/actioninterface"
+	"MIDIRouter/condition"
 	"MIDIRouter/filter"
-	"MIDIRouter/filteraftertouch"
-	"MIDIRouter/filterchannelpressure"
-	"MIDIRouter/filtercontrolchange"
-	"MIDIRouter/filternoteoff"
-	"MIDIRouter/filternoteon"
-	"MIDIRouter/filterpitchwheel"
-	"MIDIRouter/filterprogramchange"
-
-	"MIDIRouter/genaftertouch"
-	"MIDIRouter/genchannelpressure"
-	"MIDIRouter/gencontrolchange"
-	"MIDIRouter/gennoteoff"
-	"MIDIRouter/gennoteon"
-	"MIDIRouter/genpitchwheel"
-	"MIDIRouter/genprogramchange"
-	"MIDIRouter/gensysex"
-
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/genmacro"
+	"MIDIRouter/highres"
+	"MIDIRouter/luascript"
+	"MIDIRouter/mpe"
+	"MIDIRouter/notes"
 	"MIDIRouter/router"
 	"MIDIRouter/rule"
+	"MIDIRouter/transforminterface"
+	"MIDIRouter/transformnoise"
+	"MIDIRouter/transformrunstatus"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type RouterConfig struct {
+	Name               string // Tag of the log lines, the config file name by default
 	SourceDevice       string
 	DestinationDevice  string
+	VirtualSource      bool // Create a destination named SourceDevice for other applications to send to
+	VirtualDestination bool // Create a source named DestinationDevice for other applications to receive from
+	Destinations       []DestinationConfig
 	DefaultPassthrough bool
 	SendLimitMs        int
-	Verbose            bool
-	Rules              []RuleConfig
+	OverflowPolicy     string // Block, DropOldest or DropNewest
+	OutputQueueSize    int
+	NoteOffInput       bool           // Handle Note On with velocity 0 as Note Off in filters
+	NoteOffOutput      bool           // Send Note On with velocity 0 as Note Off
+	RestampOutput      bool           // Send messages immediately, ignoring input timestamps
+	OutputValidation   string         // None, Clamp, Drop or Log
+	SustainAware       bool           // Hold generated Note Off while input sustain pedal is down
+	StuckNoteTimeoutMs int            // Release notes sounding longer than this (0: disabled)
+	Tempo              float64        // BPM for musical durations when no MIDI clock is received
+	MasterClock        bool           // Send clock at Tempo between Start/Continue and Stop sent to the destination
+	TapTempo           *FilterConfig  `json:"TapTempo,omitempty"` // Messages tapping the tempo
+	Variables          map[string]int // Initial values of router variables
+	Controllers        map[string]int // Custom controller names => Control Change numbers
+	MiddleC            string         // Name of note 60 in note names: C4 (default), C3 or C5
+	Snapshots          []SnapshotConfig
+	Modifiers          map[string]FilterConfig // Modifier name => messages holding it
+	Zones              []ZoneConfig
+	Macros             map[string][]genmacro.StepConfig // Macro name => timed messages, see the Macro generator
+	MPEInput           *MPEConfig                       `json:"MPEInput,omitempty"`  // MPE zone played by the source device
+	MPEOutput          *MPEConfig                       `json:"MPEOutput,omitempty"` // MPE zone expected by the destination device
+	SystemMessages     map[string]string                // System message name => Forward, Drop or Regenerate
+	Cleanup            *CleanupConfig                   `json:"Cleanup,omitempty"`
+	OnConnect          []string                         // Hex messages sent to the destination once connected
+	OnDisconnect       []string                         // Hex messages sent to the destination on exit, see Cleanup
+	Record             string                           // Standard MIDI File to record to
+	StateFile          string                           // Last values saved on exit and restored on startup
+	RecordStreams      string                           // Input, Output or Both (default)
+
+	ActiveSensingOutput    bool // Send Active Sensing to the destination
+	ActiveSensingInput     bool // Watch for Active Sensing loss on the source
+	ActiveSensingTimeoutMs int
+	SourceProtocol         string // MIDI 1.0 (default) or MIDI 2.0 (Universal MIDI Packets)
+	DestinationProtocol    string // MIDI 1.0 (default) or MIDI 2.0 (Universal MIDI Packets)
+	Verbose                bool
+	VerboseTag             string // Verbose output limited to the rules with this tag
+	Rules                  []RuleConfig
+}
+
+// Named destination device, instead of DestinationDevice: rules send to all
+// destinations, or to the one named by Generator.Destination. The first one is
+// the router destination device.
+type DestinationConfig struct {
+	Name   string
+	Device string
+}
+
+// Messages sent to the destination on exit. If not set, All Notes Off and
+// Reset All Controllers are sent on every channel, unless OnDisconnect
+// messages replace them.
+type CleanupConfig struct {
+	AllSoundOff      bool
+	AllNotesOff      bool
+	ReleaseSustain   bool
+	ResetControllers bool
+	UsedChannelsOnly bool
+	SysEx            string // Hex string, F0 ... F7
+}
+
+// Controller values saved and resent on trigger messages
+type SnapshotConfig struct {
+	Name        string
+	Channel     string // 1-16 or '*'
+	Controllers []int
+	Save        FilterConfig
+	Recall      FilterConfig
+}
+
+// Keyboard split or layer, notes as numbers or names ("C4")
+type ZoneConfig struct {
+	Name          string
+	Channel       string // Input channel, 1-16 or "*"
+	Low           string
+	High          string
+	OutputChannel string // 1-16, or "*" for the input channel
+	Transpose     int
+	VelocityCurve float64 // 1 (default) linear, below 1 louder, above 1 softer
+	While         string  // Modifier which must be active ("shift") or inactive ("!shift")
+}
+
+type MPEConfig struct {
+	Zone           string // Lower (default) or Upper
+	MemberChannels int    // 1-15 (default)
 }
 
 type RuleConfig struct {
-	Name      string
-	Filter    FilterConfig
-	Transform TransformConfig
+	Name         string
+	Seed         *int64 `json:"Seed,omitempty"` // Optional random seed, for reproducible noise
+	Disabled     bool
+	Tags         []string `json:"Tags,omitempty"` // Labels for the stats ("song:intro", "device:organ")
+	Filter       FilterConfig
+	Condition    string // Expression the filtered message must satisfy, e.g. "value > 64 && state.sustain"
+	While        string // Modifier which must be active ("shift") or inactive ("!shift")
+	KeepOriginal bool   // Send the filtered message along with the generated ones
+	Quantize     string // Delay generated Note On to the next note value of the clock grid ("1/16")
+	SetVariable  string // Router variable set to the transformed value of every match
+	SendLimitMs  *int   `json:"SendLimitMs,omitempty"` // Override of the router SendLimitMs for the output of the rule
+	Transform    TransformConfig
+	Generator    GeneratorConfig
+	Script       *ScriptConfig `json:"Script,omitempty"`
+	Preset       *PresetConfig `json:"Preset,omitempty"` // Ready-made Filter, Transform and Generator
+
+	VelocitySplit *VelocitySplitConfig `json:"VelocitySplit,omitempty"` // Other generator for hard Note On
+	OSC           *OSCConfig           `json:"OSC,omitempty"`           // OSC address of the generated messages
+	Action        *ActionConfig        `json:"Action,omitempty"`        // Run on every match, along with the generator
+}
+
+// Something done outside of MIDI when the rule matches, e.g. a keyboard shortcut
+type ActionConfig struct {
+	Type     string
+	Settings json.RawMessage
+}
+
+// Generator used instead of the rule one for Note On messages with a velocity
+// of at least Velocity
+type VelocitySplitConfig struct {
+	Velocity  int
 	Generator GeneratorConfig
 }
 
+// User logic, as Lua code or Lua file (path relative to the config file)
+type ScriptConfig struct {
+	Lua     string
+	LuaFile string
+}
+
 // Example: "program change 52" => 0xC0 0x34 => [0xC=PgmChange | 0x0 : Channel 0 | 0x34 : 52]
 type FilterConfig struct {
-	MsgType string //Note On, Note Off, Aftertouch, Control Change..
-	Channel string // 4bits or '*'
+	MsgType    string //Note On, Note Off, Aftertouch, Control Change..
+	Channel    string // 4bits or '*'
+	Resolution int    // Bits of the values: 7 (14 for pitch wheel) or 16
 
 	Settings json.RawMessage
 }
@@ -60,7 +179,8 @@ type TransformConfig struct {
 	ToMax         int
 	Mode          string
 	NoiseSettings NoiseSettingsConfig `json:"NoiseSettings,omitempty"`
-	// No additional settings needed for PreventRunningStatus
+	Spacer        string              `json:"Spacer,omitempty"`   // PreventRunningStatus: hex byte inserted between messages
+	Settings      json.RawMessage     `json:"Settings,omitempty"` // Registered transform types settings
 }
 
 // Add a new struct for noise settings in config
@@ -71,6 +191,12 @@ type NoiseSettingsConfig struct {
 	MaxValue   int    `json:"MaxValue"`
 	DelayMsMin int    `json:"DelayMsMin"`
 	DelayMsMax int    `json:"DelayMsMax"`
+	DelayMin   string `json:"DelayMin,omitempty"` // Musical units ("1/16", "1/8." dotted, "1/4t" triplet), replace DelayMs*
+	DelayMax   string `json:"DelayMax,omitempty"`
+
+	Count         int `json:"Count,omitempty"`         // Noise packets per match (burst), 1 by default
+	IntervalMsMin int `json:"IntervalMsMin,omitempty"` // Delay between the packets of a burst
+	IntervalMsMax int `json:"IntervalMsMax,omitempty"`
 }
 
 type GeneratorConfig struct {
@@ -78,232 +204,782 @@ type GeneratorConfig struct {
 
 	MsgType                 string //Note On, Note Off, Aftertouch, Control Change..
 	Channel                 string // 4bits or '*'
+	Destination             string // Name of the destination sent to, all of them if empty
 	DropDuplicates          bool
 	DropDuplicatesTimeoutMs int
+	Resolution              int // Bits of the values: 7 (14 for pitch wheel) or 16
 	Settings                json.RawMessage
 }
 
-func LoadConfig(configPath string) (*router.MIDIRouter, error) {
-	var config RouterConfig
-	var relay *router.MIDIRouter
+// Load a configuration file in the given format, "" to tell it from the file
+// extension (see CheckFormat)
+func LoadConfig(configPath string, format string) (*router.MIDIRouter, error) {
+	return loadConfig(configPath, format, router.New)
+}
 
-	config.Verbose = false
-	data, err := ioutil.ReadFile(configPath)
+// Load a configuration on a router connected to no device, for replays
+func LoadConfigOffline(configPath string, format string) (*router.MIDIRouter, error) {
+	return loadConfig(configPath, format, func(name string, sourceDevice string, destinationDevice string) (*router.MIDIRouter, error) {
+		return router.NewOffline(name, sourceDevice, destinationDevice), nil
+	})
+}
+
+func loadConfig(configPath string, format string, newRouter func(string, string, string) (*router.MIDIRouter, error)) (*router.MIDIRouter, error) {
+	var created *router.MIDIRouter
+	relay, err := loadRouter(configPath, format, func(name string, sourceDevice string, destinationDevice string) (*router.MIDIRouter, error) {
+		r, err := newRouter(name, sourceDevice, destinationDevice)
+		created = r
+		return r, err
+	})
 	if err != nil {
-		return nil, err
+		//Background tasks (watchdog, active sensing...) started before the error
+		if created != nil {
+			created.Discard()
+		}
+		return nil, fileError(configPath, err)
 	}
+	return relay, nil
+}
+
+func loadRouter(configPath string, format string, newRouter func(string, string, string) (*router.MIDIRouter, error)) (*router.MIDIRouter, error) {
+	var relay *router.MIDIRouter
 
-	err = json.Unmarshal(data, &config)
+	configDir := filepath.Dir(configPath)
+	config, err := readConfig(configPath, format)
 	if err != nil {
-		return nil, errors.New("Failed parsing config file: " + err.Error())
+		return nil, err
 	}
 	if len(config.SourceDevice) == 0 {
 		return nil, errors.New("MIDI source cannot be empty")
 	}
+	if len(config.Destinations) > 0 {
+		if len(config.DestinationDevice) > 0 {
+			return nil, errors.New("DestinationDevice and Destinations cannot be both set")
+		}
+		for i, d := range config.Destinations {
+			if (d.Name == "") || (d.Device == "") {
+				return nil, fieldError("Destinations", fmt.Errorf("Destination #%d: Name and Device cannot be empty", i+1))
+			}
+		}
+		config.DestinationDevice = config.Destinations[0].Device
+	}
 	if len(config.DestinationDevice) == 0 {
 		return nil, errors.New("MIDI destination cannot be empty")
 	}
-	if config.SourceDevice == config.DestinationDevice {
+	//Created endpoints can share the name of the other device
+	virtual := config.VirtualSource || config.VirtualDestination
+	if !virtual && (config.SourceDevice == config.DestinationDevice) {
 		return nil, errors.New("MIDI source and destination cannot identical")
 	}
 
-	relay, err = router.New(config.SourceDevice, config.DestinationDevice)
+	if config.Name == "" {
+		config.Name = strings.TrimSuffix(filepath.Base(configPath), filepath.Ext(configPath))
+	}
+	source, destination := config.SourceDevice, config.DestinationDevice
+	if config.VirtualSource {
+		source = "virtual:" + source
+	}
+	if config.VirtualDestination {
+		destination = "virtual:" + destination
+	}
+	relay, err = newRouter(config.Name, source, destination)
 	if err != nil {
 		return nil, err
 	}
 
 	relay.SetVerbose(config.Verbose)
+	if config.VerboseTag != "" {
+		relay.SetVerboseTag(config.VerboseTag)
+	}
 	relay.SetPassthrough(config.DefaultPassthrough)
 	relay.SetSendLimit(time.Duration(config.SendLimitMs) * time.Millisecond)
 
-	for _, r := range config.Rules {
-		newRule, _ := rule.New(r.Name)
+	overflowPolicy, err := stringToOverflowPolicy(config.OverflowPolicy)
+	if err != nil {
+		return nil, err
+	}
+	relay.SetOverflowPolicy(overflowPolicy, config.OutputQueueSize)
+	sourceProtocol, err := stringToProtocol(config.SourceProtocol)
+	if err != nil {
+		return nil, fieldError("SourceProtocol", err)
+	}
+	relay.SetSourceProtocol(sourceProtocol)
+	destinationProtocol, err := stringToProtocol(config.DestinationProtocol)
+	if err != nil {
+		return nil, fieldError("DestinationProtocol", err)
+	}
+	if err := relay.SetDestinationProtocol(destinationProtocol); err != nil {
+		return nil, fieldError("DestinationProtocol", err)
+	}
+	if len(config.Destinations) > 0 {
+		relay.SetDestinationName(config.Destinations[0].Name)
+		for _, d := range config.Destinations[1:] {
+			if err := relay.AddDestination(d.Name, d.Device); err != nil {
+				return nil, fieldError("Destinations", err)
+			}
+		}
+	}
+	relay.SetNoteOffNormalization(config.NoteOffInput, config.NoteOffOutput)
+	relay.SetRestamp(config.RestampOutput)
+	relay.SetSustainAware(config.SustainAware)
+	relay.SetStuckNoteWatchdog(time.Duration(config.StuckNoteTimeoutMs) * time.Millisecond)
+	if config.Tempo < 0 {
+		return nil, errors.New("Invalid Tempo")
+	}
+	relay.SetTempo(config.Tempo)
+	relay.SetMasterClock(config.MasterClock)
+	if config.TapTempo != nil {
+		f, err := loadFilter(*config.TapTempo, configDir)
+		if err != nil {
+			return nil, errors.New("Tap tempo: " + err.Error())
+		}
+		relay.SetTapTempo(f)
+	}
 
-		//Load input filter from config
-		filterMsgType, err := stringToMsgType(r.Filter.MsgType)
+	for _, sc := range config.Snapshots {
+		snapshot, err := loadSnapshot(sc, configDir)
 		if err != nil {
-			return nil, err
+			return nil, errors.New("Snapshot '" + sc.Name + "': " + err.Error())
 		}
-		ruleChannel, err := stringToFilterChannel(r.Filter.Channel)
+		relay.AddSnapshot(snapshot)
+	}
+
+	for name, fc := range config.Modifiers {
+		f, err := loadFilter(fc, configDir)
 		if err != nil {
-			return nil, errors.New("Invalid channel " + err.Error())
+			return nil, errors.New("Modifier '" + name + "': " + err.Error())
 		}
-		fmt.Println("Loading rule '" + r.Name + "'...")
+		relay.AddModifier(name, f)
+	}
 
-		switch filterMsgType {
-		case filter.FilterMsgTypeNoteOn:
-			f, err := filternoteon.New(ruleChannel, r.Filter.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetFilter(f)
-			break
-		case filter.FilterMsgTypeNoteOff:
-			f, err := filternoteoff.New(ruleChannel, r.Filter.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetFilter(f)
-			break
-		case filter.FilterMsgTypeAftertouch:
-			f, err := filteraftertouch.New(ruleChannel, r.Filter.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetFilter(f)
-			break
-		case filter.FilterMsgTypeControlChange:
-			f, err := filtercontrolchange.New(ruleChannel, r.Filter.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetFilter(f)
-			break
-		case filter.FilterMsgTypeProgramChange:
-			f, err := filterprogramchange.New(ruleChannel, r.Filter.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetFilter(f)
-			break
-		case filter.FilterMsgTypeChannelPressure:
-			f, err := filterchannelpressure.New(ruleChannel, r.Filter.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetFilter(f)
-			break
-		case filter.FilterMsgTypePitchWheel:
-			f, err := filterpitchwheel.New(ruleChannel, r.Filter.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetFilter(f)
-			break
-		default:
-			return nil, errors.New("Failed to add rule, invalid filter type: " + r.Filter.MsgType)
+	middleC, _ := middleCOctave(config.MiddleC)
+	for _, zc := range config.Zones {
+		zone, err := loadZone(zc, config.Modifiers, middleC)
+		if err != nil {
+			return nil, errors.New("Zone '" + zc.Name + "': " + err.Error())
 		}
+		relay.AddZone(zone)
+	}
+
+	validation, err := stringToValidationMode(config.OutputValidation)
+	if err != nil {
+		return nil, err
+	}
+	relay.SetValidation(validation)
 
-		//Load Transform
-		transformMode, err := stringToTransformMode(r.Transform.Mode)
+	for name, p := range config.SystemMessages {
+		policy, err := stringToSystemPolicy(p)
 		if err != nil {
 			return nil, err
 		}
-		if transformMode != rule.TransformModeNone {
-			newRule.SetTransform(
-				transformMode,
-				uint32(r.Transform.FromMin),
-				uint32(r.Transform.FromMax),
-				uint32(r.Transform.ToMin),
-				uint32(r.Transform.ToMax),
-			)
-
-			// Handle noise settings if mode is Noise
-			if transformMode == rule.TransformModeNoise {
-				// Parse MsgType
-				noiseMsgType, err := stringToMsgType(r.Transform.NoiseSettings.MsgType)
-				if err != nil {
-					return nil, errors.New("Invalid noise message type: " + err.Error())
-				}
-
-				// Parse Channel
-				noiseChannel, err := stringToFilterChannel(r.Transform.NoiseSettings.Channel)
-				if err != nil {
-					return nil, errors.New("Invalid noise channel: " + err.Error())
-				}
-
-				// Validate value ranges
-				if r.Transform.NoiseSettings.MaxValue > 127 {
-					return nil, errors.New("Noise MaxValue exceeds MIDI limit of 127")
-				}
-
-				// Create NoiseSettings struct
-				noiseSettings := rule.NoiseSettings{
-					MsgType:    noiseMsgType,
-					Channel:    noiseChannel,
-					MinValue:   uint8(r.Transform.NoiseSettings.MinValue),
-					MaxValue:   uint8(r.Transform.NoiseSettings.MaxValue),
-					DelayMsMin: uint16(r.Transform.NoiseSettings.DelayMsMin),
-					DelayMsMax: uint16(r.Transform.NoiseSettings.DelayMsMax),
-				}
-
-				// Set noise settings on the rule
-				newRule.SetNoiseSettings(noiseSettings)
+		//Regenerated Active Sensing: incoming messages dropped, the router sends its own
+		if p == "Regenerate" {
+			if name != "Active Sensing" {
+				return nil, errors.New("Only Active Sensing can be regenerated")
 			}
-			// PreventRunningStatus doesn't need additional settings
+			config.ActiveSensingOutput = true
 		}
+		err = relay.SetSystemPolicy(name, policy)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		//Drop consecutive identical values?
-		newRule.EnableDropDuplicates(r.Generator.DropDuplicates, time.Duration(time.Duration(r.Generator.DropDuplicatesTimeoutMs)*time.Millisecond))
+	relay.SetActiveSensing(config.ActiveSensingOutput, config.ActiveSensingInput,
+		time.Duration(config.ActiveSensingTimeoutMs)*time.Millisecond)
 
-		//Load Generator
-		generateMsgType, err := stringToMsgType(r.Generator.MsgType)
+	if config.Cleanup != nil {
+		cleanup, err := loadCleanup(*config.Cleanup)
 		if err != nil {
 			return nil, err
 		}
-		generatorChannel, err := stringToFilterChannel(r.Generator.Channel)
-		if (err != nil) && (generateMsgType != filter.FilterMsgTypeSysEx) {
-			fmt.Println(generateMsgType)
-			return nil, errors.New("Invalid channel " + err.Error())
+		relay.SetCleanup(cleanup)
+	}
+
+	onConnect, err := loadMessages(config.OnConnect)
+	if err != nil {
+		return nil, fieldError("OnConnect", err)
+	}
+	relay.SendOnConnect(onConnect)
+
+	onDisconnect, err := loadMessages(config.OnDisconnect)
+	if err != nil {
+		return nil, fieldError("OnDisconnect", err)
+	}
+	if (len(onDisconnect) > 0) && (config.Cleanup == nil) {
+		relay.SetCleanup(router.CleanupSettings{})
+	}
+	relay.SetOnDisconnect(onDisconnect)
+
+	if config.Record != "" {
+		input, output, err := stringToRecordStreams(config.RecordStreams)
+		if err != nil {
+			return nil, err
 		}
+		err = relay.RecordTo(config.Record, input, output)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		switch generateMsgType {
-		case filter.FilterMsgTypeNoteOn:
-			g, err := gennoteon.New(generatorChannel, r.Generator.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetGenerator(g)
-		case filter.FilterMsgTypeNoteOff:
-			g, err := gennoteoff.New(generatorChannel, r.Generator.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetGenerator(g)
-		case filter.FilterMsgTypeAftertouch:
-			g, err := genaftertouch.New(generatorChannel, r.Generator.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetGenerator(g)
-		case filter.FilterMsgTypeChannelPressure:
-			g, err := genchannelpressure.New(generatorChannel, r.Generator.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetGenerator(g)
-		case filter.FilterMsgTypeControlChange:
-			g, err := gencontrolchange.New(generatorChannel, r.Generator.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetGenerator(g)
-		case filter.FilterMsgTypeProgramChange:
-			g, err := genprogramchange.New(generatorChannel, r.Generator.Settings)
-			if err != nil {
-				return nil, err
-			}
-			newRule.SetGenerator(g)
-		case filter.FilterMsgTypePitchWheel:
-			g, err := genpitchwheel.New(generatorChannel, r.Generator.Settings)
-			if err != nil {
-				return nil, err
+	for name, value := range config.Variables {
+		relay.SetVariable(name, value)
+	}
+
+	for i, r := range config.Rules {
+		newRule, err := loadRule(r, &config, relay, configDir)
+		if err != nil {
+			return nil, ruleError(i+1, r.Name, err)
+		}
+		newRule.SetEnabled(!r.Disabled)
+		relay.AddRule(newRule)
+	}
+
+	if config.MPEInput != nil {
+		zone, err := mpe.NewZone(config.MPEInput.Zone, config.MPEInput.MemberChannels)
+		if err != nil {
+			return nil, err
+		}
+		relay.SetMPEInput(zone)
+	}
+	if config.MPEOutput != nil {
+		zone, err := mpe.NewZone(config.MPEOutput.Zone, config.MPEOutput.MemberChannels)
+		if err != nil {
+			return nil, err
+		}
+		relay.SetMPEOutput(zone)
+	}
+
+	if config.StateFile != "" {
+		path := config.StateFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(configDir, path)
+		}
+		relay.SetStateFile(path)
+		if err := relay.RestoreState(); err != nil {
+			return nil, err
+		}
+	}
+
+	return relay, nil
+}
+
+// Parse the configuration file, presets expanded and names resolved
+func readConfig(configPath string, format string) (RouterConfig, error) {
+	var config RouterConfig
+
+	config.Verbose = false
+	err := decodeConfig(configPath, format, &config)
+	if err != nil {
+		return config, err
+	}
+	err = expandPresets(&config)
+	if err != nil {
+		return config, err
+	}
+	err = resolveNames(&config)
+	if err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+func loadRule(r RuleConfig, config *RouterConfig, relay *router.MIDIRouter, configDir string) (loaded *rule.Rule, err error) {
+	newRule, _ := rule.New(r.Name)
+	//Processes and plugins already started for a rule failing to load are stopped
+	defer func() {
+		if err != nil {
+			newRule.Close()
+		}
+	}()
+	newRule.SetTempo(relay.Tempo)
+	newRule.SetKeepOriginal(r.KeepOriginal)
+	newRule.SetTags(r.Tags)
+	if r.Generator.Destination != "" {
+		found := false
+		for _, name := range relay.DestinationNames() {
+			found = found || (name == r.Generator.Destination)
+		}
+		if !found {
+			return nil, sectionError("Generator", fieldError("Destination", errors.New("Unknown destination: "+r.Generator.Destination)))
+		}
+		newRule.SetDestination(r.Generator.Destination)
+	}
+	if r.SetVariable != "" {
+		newRule.SetVariable(r.SetVariable, relay.SetVariable)
+	}
+	if r.Quantize != "" {
+		note, err := stringToNoteValue(r.Quantize)
+		if err != nil {
+			return nil, fieldError("Quantize", err)
+		}
+		newRule.SetQuantize(note, relay.UntilGrid)
+	}
+	if r.Seed != nil {
+		newRule.SetSeed(*r.Seed)
+	}
+	if r.OSC != nil {
+		if !relay.SendsOSC() {
+			return nil, sectionError("OSC", errors.New("Destination device is not an OSC server"))
+		}
+		route, err := oscRoute(r)
+		if err != nil {
+			return nil, sectionError("OSC", err)
+		}
+		newRule.SetOSC(&route)
+	}
+	if r.SendLimitMs != nil {
+		if *r.SendLimitMs < 0 {
+			return nil, fieldError("SendLimitMs", errors.New("Invalid send limit, expected 0 or more"))
+		}
+		newRule.SetSendLimit(time.Duration(*r.SendLimitMs) * time.Millisecond)
+	}
+
+	//Load input filter from config
+	relay.Log("Loading rule '" + r.Name + "'...")
+	f, err := loadFilter(r.Filter, configDir)
+	if err != nil {
+		return nil, sectionError("Filter", err)
+	}
+	if l, ok := f.(filterinterface.LoggerFilterInterface); ok {
+		l.SetLogger(relay.Logger())
+	}
+	newRule.SetFilter(f)
+
+	if r.While != "" {
+		expression, err := whileCondition(r.While, config.Modifiers)
+		if err != nil {
+			return nil, fieldError("While", err)
+		}
+		if r.Condition != "" {
+			expression = "(" + r.Condition + ") && " + expression
+		}
+		r.Condition = expression
+	}
+	if r.Condition != "" {
+		c, err := condition.New(r.Condition, relay.ChannelState)
+		if err != nil {
+			return nil, fieldError("Condition", err)
+		}
+		newRule.SetCondition(c)
+	}
+
+	//Load Transform
+	if err := loadTransform(newRule, r.Transform, configDir); err != nil {
+		return nil, sectionError("Transform", err)
+	}
+
+	//Drop consecutive identical values?
+	newRule.EnableDropDuplicates(r.Generator.DropDuplicates, time.Duration(time.Duration(r.Generator.DropDuplicatesTimeoutMs)*time.Millisecond))
+
+	//Load Generator
+	g, err := loadGenerator(r.Generator, relay, config.Macros, configDir)
+	if err != nil {
+		return nil, sectionError("Generator", err)
+	}
+	newRule.SetGenerator(g)
+
+	if r.VelocitySplit != nil {
+		if (r.VelocitySplit.Velocity < 1) || (r.VelocitySplit.Velocity > 127) {
+			return nil, sectionError("VelocitySplit", fieldError("Velocity", errors.New("Invalid velocity split, expected 1 to 127")))
+		}
+		g, err := loadGenerator(r.VelocitySplit.Generator, relay, config.Macros, configDir)
+		if err != nil {
+			return nil, sectionError("VelocitySplit.Generator", err)
+		}
+		if err := newRule.SetVelocitySplit(uint8(r.VelocitySplit.Velocity), g); err != nil {
+			if c, ok := g.(io.Closer); ok {
+				c.Close()
 			}
-			newRule.SetGenerator(g)
-		case filter.FilterMsgTypeSysEx:
-			g, err := gensysex.New(r.Generator.Settings)
-			if err != nil {
-				return nil, err
+			return nil, sectionError("VelocitySplit", err)
+		}
+	}
+
+	if r.Action != nil {
+		newAction, found := lookupActionType(r.Action.Type)
+		if !found {
+			return nil, sectionError("Action", fieldError("Type", errors.New("Invalid action type: "+r.Action.Type)))
+		}
+		action, err := newAction(r.Action.Settings, configDir)
+		if err != nil {
+			return nil, sectionError("Action", fieldError("Settings", err))
+		}
+		if l, ok := action.(actioninterface.LoggerActionInterface); ok {
+			l.SetLogger(relay.Logger())
+		}
+		newRule.SetAction(action)
+	}
+
+	if r.Script != nil {
+		script, err := loadScript(*r.Script, configDir)
+		if err != nil {
+			return nil, sectionError("Script", err)
+		}
+		newRule.SetScript(script)
+	}
+
+	err = newRule.Validate()
+	if err != nil {
+		//Only the transform range can be wrong here, validation errors naming the rule already
+		return nil, sectionError("Transform", errors.New(strings.TrimPrefix(err.Error(), "Rule '"+r.Name+"': ")))
+	}
+	return newRule, nil
+}
+
+func loadTransform(newRule *rule.Rule, tc TransformConfig, configDir string) error {
+	if newTransform, found := builtinTransforms[tc.Mode]; found {
+		t, err := newTransform(tc)
+		if err != nil {
+			return err
+		}
+		newRule.SetTransformer(t)
+		return nil
+	}
+
+	transformMode, err := stringToTransformMode(tc.Mode)
+	if err != nil {
+		newTransform, found := lookupTransformType(tc.Mode)
+		if !found {
+			return fieldError("Mode", err)
+		}
+		t, err := newTransform(tc.Settings, configDir)
+		if err != nil {
+			return fieldError("Settings", err)
+		}
+		newRule.SetTransformer(t)
+		return nil
+	}
+	if transformMode == rule.TransformModeNone {
+		return nil
+	}
+
+	newRule.SetTransform(
+		transformMode,
+		uint32(tc.FromMin),
+		uint32(tc.FromMax),
+		uint32(tc.ToMin),
+		uint32(tc.ToMax),
+	)
+	return nil
+}
+
+// Built-in transforms set up by their own TransformConfig fields, rather
+// than by Settings
+var builtinTransforms = map[string]func(tc TransformConfig) (transforminterface.TransformInterface, error){
+	"Noise":                loadNoiseTransform,
+	"PreventRunningStatus": loadRunStatusTransform,
+}
+
+func loadNoiseTransform(tc TransformConfig) (transforminterface.TransformInterface, error) {
+	// Parse MsgType
+	noiseMsgType, err := stringToMsgType(tc.NoiseSettings.MsgType)
+	if err != nil {
+		return nil, fieldError("NoiseSettings.MsgType", errors.New("Invalid noise message type: "+err.Error()))
+	}
+
+	// Parse Channel
+	noiseChannel, err := stringToFilterChannel(tc.NoiseSettings.Channel)
+	if err != nil {
+		return nil, fieldError("NoiseSettings.Channel", errors.New("Invalid noise channel: "+err.Error()))
+	}
+
+	// Validate value ranges
+	if (tc.NoiseSettings.MinValue < 0) || (tc.NoiseSettings.MinValue > 127) {
+		return nil, fieldError("NoiseSettings.MinValue", errors.New("Invalid noise MinValue, expected 0 to 127"))
+	}
+	if (tc.NoiseSettings.MaxValue < 0) || (tc.NoiseSettings.MaxValue > 127) {
+		return nil, fieldError("NoiseSettings.MaxValue", errors.New("Invalid noise MaxValue, expected 0 to 127"))
+	}
+	if tc.NoiseSettings.MaxValue < tc.NoiseSettings.MinValue {
+		return nil, fieldError("NoiseSettings.MaxValue", errors.New("Noise MaxValue is lower than MinValue"))
+	}
+	if tc.NoiseSettings.DelayMsMin < 0 {
+		return nil, fieldError("NoiseSettings.DelayMsMin", errors.New("Invalid noise delay, expected 0 or more"))
+	}
+	if tc.NoiseSettings.DelayMsMax > 65535 {
+		return nil, fieldError("NoiseSettings.DelayMsMax", errors.New("Noise DelayMsMax exceeds 65535"))
+	}
+	if tc.NoiseSettings.DelayMsMax < tc.NoiseSettings.DelayMsMin {
+		return nil, fieldError("NoiseSettings.DelayMsMax", errors.New("Noise DelayMsMax is shorter than DelayMsMin"))
+	}
+
+	noiseSettings := transformnoise.Settings{
+		MsgType:    noiseMsgType,
+		Channel:    noiseChannel,
+		MinValue:   uint8(tc.NoiseSettings.MinValue),
+		MaxValue:   uint8(tc.NoiseSettings.MaxValue),
+		DelayMsMin: uint16(tc.NoiseSettings.DelayMsMin),
+		DelayMsMax: uint16(tc.NoiseSettings.DelayMsMax),
+	}
+	if tc.NoiseSettings.DelayMin != "" {
+		noiseSettings.DelayNoteMin, err = stringToNoteValue(tc.NoiseSettings.DelayMin)
+		if err != nil {
+			return nil, fieldError("NoiseSettings.DelayMin", err)
+		}
+		noiseSettings.DelayNoteMax = noiseSettings.DelayNoteMin
+	}
+	if tc.NoiseSettings.DelayMax != "" {
+		noiseSettings.DelayNoteMax, err = stringToNoteValue(tc.NoiseSettings.DelayMax)
+		if err != nil {
+			return nil, fieldError("NoiseSettings.DelayMax", err)
+		}
+	}
+	if noiseSettings.DelayNoteMax < noiseSettings.DelayNoteMin {
+		return nil, fieldError("NoiseSettings.DelayMax", errors.New("Noise DelayMax is shorter than DelayMin"))
+	}
+
+	if (tc.NoiseSettings.Count < 0) || (tc.NoiseSettings.Count > 64) {
+		return nil, fieldError("NoiseSettings.Count", errors.New("Invalid noise count, expected 1 to 64"))
+	}
+	if tc.NoiseSettings.IntervalMsMin < 0 {
+		return nil, fieldError("NoiseSettings.IntervalMsMin", errors.New("Invalid noise interval, expected 0 or more"))
+	}
+	if tc.NoiseSettings.IntervalMsMax > 65535 {
+		return nil, fieldError("NoiseSettings.IntervalMsMax", errors.New("Noise IntervalMsMax exceeds 65535"))
+	}
+	if tc.NoiseSettings.IntervalMsMax < tc.NoiseSettings.IntervalMsMin {
+		return nil, fieldError("NoiseSettings.IntervalMsMax", errors.New("Noise IntervalMsMax is shorter than IntervalMsMin"))
+	}
+	noiseSettings.Count = uint8(tc.NoiseSettings.Count)
+	noiseSettings.IntervalMsMin = uint16(tc.NoiseSettings.IntervalMsMin)
+	noiseSettings.IntervalMsMax = uint16(tc.NoiseSettings.IntervalMsMax)
+
+	return transformnoise.New(uint32(tc.FromMin), uint32(tc.FromMax), uint32(tc.ToMin), uint32(tc.ToMax), noiseSettings), nil
+}
+
+func loadRunStatusTransform(tc TransformConfig) (transforminterface.TransformInterface, error) {
+	var spacer []byte
+	if tc.Spacer != "" {
+		var err error
+		spacer, err = hex.DecodeString(tc.Spacer)
+		if (err != nil) || (len(spacer) != 1) || ((spacer[0] != 0xF4) && (spacer[0] != 0xF5) && (spacer[0] < 0xF8)) {
+			return nil, fieldError("Spacer", errors.New("Invalid Spacer '"+tc.Spacer+"': expected F4, F5 or a real-time byte (F8-FF)"))
+		}
+	}
+	return transformrunstatus.New(spacer), nil
+}
+
+func loadGenerator(gc GeneratorConfig, relay *router.MIDIRouter, macros map[string][]genmacro.StepConfig, configDir string) (generatorinterface.GeneratorInterface, error) {
+	//Macros without steps are defined in the general settings
+	if gc.MsgType == "Macro" {
+		var conf genmacro.GenMacroConfig
+		if err := json.Unmarshal(gc.Settings, &conf); err != nil {
+			return nil, fieldError("Settings", errors.New("Failed to parse generator settings :"+err.Error()))
+		}
+		if len(conf.Steps) == 0 {
+			steps, found := macros[conf.Name]
+			if !found {
+				return nil, fieldError("Settings", errors.New("Unknown macro '"+conf.Name+"'"))
 			}
-			newRule.SetGenerator(g)
-		default:
-			return nil, errors.New("Failed to add rule, invalid generate type.")
+			conf.Steps = steps
+			gc.Settings, _ = json.Marshal(conf)
 		}
+	}
 
-		relay.AddRule(newRule)
+	newGenerator, found := lookupGeneratorType(gc.MsgType)
+	if !found {
+		return nil, fieldError("MsgType", errors.New("Invalid generator type: "+gc.MsgType))
+	}
+	generatorChannel, err := stringToFilterChannel(gc.Channel)
+	if (err != nil) && hasChannel(gc.MsgType) {
+		return nil, fieldError("Channel", err)
+	}
+	//Checked before building the generator, which may hold resources
+	highRes, err := loadResolution(gc.Resolution, gc.MsgType, gc.Settings)
+	if err != nil {
+		return nil, fieldError("Resolution", err)
 	}
 
-	return relay, nil
+	g, err := newGenerator(generatorChannel, gc.Settings, configDir)
+	if err != nil {
+		return nil, fieldError("Settings", err)
+	}
+	if v, ok := g.(generatorinterface.VariablesGeneratorInterface); ok {
+		v.SetVariables(relay.Variables)
+	}
+	if l, ok := g.(generatorinterface.LoggerGeneratorInterface); ok {
+		l.SetLogger(relay.Logger())
+	}
+	if highRes {
+		return highres.NewGenerator(g), nil
+	}
+	return g, nil
+}
+
+// Build a filter for trigger messages (tap tempo, snapshots)
+func loadFilter(fc FilterConfig, configDir string) (filterinterface.FilterInterface, error) {
+	newFilter, found := lookupFilterType(fc.MsgType)
+	if !found {
+		return nil, fieldError("MsgType", errors.New("Invalid filter type: "+fc.MsgType))
+	}
+	channel, err := stringToFilterChannel(fc.Channel)
+	if (err != nil) && hasChannel(fc.MsgType) {
+		return nil, fieldError("Channel", err)
+	}
+	highRes, err := loadResolution(fc.Resolution, fc.MsgType, fc.Settings)
+	if err != nil {
+		return nil, fieldError("Resolution", err)
+	}
+	f, err := newFilter(channel, fc.Settings, configDir)
+	if err != nil {
+		return nil, fieldError("Settings", err)
+	}
+	if highRes {
+		return highres.NewFilter(f), nil
+	}
+	return f, nil
+}
+
+// Whether values are 16 bits, for the channel voice messages carrying one
+func loadResolution(resolution int, msgType string, settings json.RawMessage) (bool, error) {
+	switch resolution {
+	case 0, 7:
+		return false, nil
+	case highres.Bits:
+	case 32:
+		return false, errors.New("Invalid resolution 32, values are 16 bits at most")
+	default:
+		return false, fmt.Errorf("Invalid resolution %d, expected 7 or 16", resolution)
+	}
+	switch msgType {
+	case "Note On", "Note Off", "Aftertouch", "Channel Pressure", "Pitch Wheel":
+	case "Control Change":
+		var conf struct{ Mode string }
+		json.Unmarshal(settings, &conf)
+		if conf.Mode == "CCAh" {
+			return false, errors.New("Invalid resolution in CCAh mode, values are already 14 bits")
+		}
+	default:
+		return false, errors.New("Invalid resolution for " + msgType + " messages")
+	}
+	return true, nil
+}
+
+func loadSnapshot(sc SnapshotConfig, configDir string) (*router.Snapshot, error) {
+	snapshot := router.Snapshot{Name: sc.Name}
+
+	channel, err := stringToFilterChannel(sc.Channel)
+	if err != nil {
+		return nil, errors.New("Invalid channel " + err.Error())
+	}
+	for c := uint8(0); c < 16; c++ {
+		if (channel == filter.FilterChannelAny) || (uint8(channel) == c) {
+			snapshot.Channels = append(snapshot.Channels, c)
+		}
+	}
+
+	if len(sc.Controllers) == 0 {
+		return nil, errors.New("No controllers")
+	}
+	for _, controller := range sc.Controllers {
+		if (controller < 0) || (controller > 127) {
+			return nil, fmt.Errorf("Invalid controller %d", controller)
+		}
+		snapshot.Controllers = append(snapshot.Controllers, uint8(controller))
+	}
+
+	snapshot.Save, err = loadFilter(sc.Save, configDir)
+	if err != nil {
+		return nil, errors.New("Save: " + err.Error())
+	}
+	snapshot.Recall, err = loadFilter(sc.Recall, configDir)
+	if err != nil {
+		return nil, errors.New("Recall: " + err.Error())
+	}
+	return &snapshot, nil
+}
+
+func loadZone(zc ZoneConfig, modifiers map[string]FilterConfig, middleC int) (*router.Zone, error) {
+	zone := router.Zone{Name: zc.Name, Transpose: zc.Transpose, VelocityCurve: zc.VelocityCurve, While: zc.While}
+
+	channel, err := stringToFilterChannel(zc.Channel)
+	if err != nil {
+		return nil, errors.New("Invalid channel " + err.Error())
+	}
+	for c := uint8(0); c < 16; c++ {
+		if (channel == filter.FilterChannelAny) || (uint8(channel) == c) {
+			zone.Channels = append(zone.Channels, c)
+		}
+	}
+	zone.OutputChannel = filter.FilterChannelAny
+	if zc.OutputChannel != "" {
+		zone.OutputChannel, err = stringToFilterChannel(zc.OutputChannel)
+	}
+	if err != nil {
+		return nil, errors.New("Invalid output channel " + err.Error())
+	}
+
+	if zone.Low, err = notes.ParseMiddleC(zc.Low, middleC); err != nil {
+		return nil, err
+	}
+	if zone.High, err = notes.ParseMiddleC(zc.High, middleC); err != nil {
+		return nil, err
+	}
+	if zone.Low > zone.High {
+		return nil, errors.New("Low note above High note")
+	}
+	if zone.VelocityCurve < 0 {
+		return nil, errors.New("Invalid velocity curve")
+	}
+	if zc.While != "" {
+		if _, err := whileCondition(zc.While, modifiers); err != nil {
+			return nil, err
+		}
+	}
+	return &zone, nil
+}
+
+// Condition expression of a rule "While" setting
+func whileCondition(while string, modifiers map[string]FilterConfig) (string, error) {
+	name := strings.TrimPrefix(while, "!")
+	if _, found := modifiers[name]; !found {
+		return "", errors.New("Unknown modifier '" + name + "'")
+	}
+	if name != while {
+		return "!state.modifiers[" + strconv.Quote(name) + "]", nil
+	}
+	return "state.modifiers[" + strconv.Quote(name) + "]", nil
+}
+
+func loadCleanup(conf CleanupConfig) (router.CleanupSettings, error) {
+	settings := router.CleanupSettings{
+		AllSoundOff:      conf.AllSoundOff,
+		AllNotesOff:      conf.AllNotesOff,
+		ReleaseSustain:   conf.ReleaseSustain,
+		ResetControllers: conf.ResetControllers,
+		UsedChannelsOnly: conf.UsedChannelsOnly,
+	}
+
+	if len(conf.SysEx) != 0 {
+		data, err := hex.DecodeString(conf.SysEx)
+		if err != nil {
+			return settings, errors.New("Invalid cleanup SysEx: " + err.Error())
+		}
+		if (len(data) < 2) || (data[0] != 0xF0) || (data[len(data)-1] != 0xF7) {
+			return settings, errors.New("Invalid cleanup SysEx, must start with F0 and end with F7")
+		}
+		settings.SysEx = data
+	}
+	return settings, nil
+}
+
+// Parse hex messages ("B0 7A 00"), each a whole MIDI message
+func loadMessages(messages []string) ([][]byte, error) {
+	var list [][]byte
+	for _, m := range messages {
+		data, err := hex.DecodeString(strings.ReplaceAll(m, " ", ""))
+		if err != nil {
+			return nil, errors.New("Invalid message '" + m + "': " + err.Error())
+		}
+		if (len(data) == 0) || (data[0] < 0x80) {
+			return nil, errors.New("Invalid message '" + m + "': must start with a status byte")
+		}
+		if (data[0] == 0xF0) && (data[len(data)-1] != 0xF7) {
+			return nil, errors.New("Invalid message '" + m + "': SysEx must end with F7")
+		}
+		list = append(list, data)
+	}
+	return list, nil
 }
 
 // Update the stringToTransformMode function to handle the new mode
@@ -317,15 +993,94 @@ func stringToTransformMode(str string) (rule.TransformMode, error) {
 		return rule.TransformModeLinear, nil
 	case "LinearDrop":
 		return rule.TransformModeLinearDrop, nil
-	case "Noise":
-		return rule.TransformModeNoise, nil
-	case "PreventRunningStatus":
-		return rule.TransformModePreventRunStatus, nil
+	case "Toggle":
+		return rule.TransformModeToggle, nil
 	default:
 		return rule.TransformModeNone, errors.New("Invalid transform mode: " + str)
 	}
 }
 
+func stringToProtocol(str string) (router.Protocol, error) {
+	switch str {
+	case "", "MIDI 1.0":
+		return router.ProtocolMIDI1, nil
+	case "MIDI 2.0":
+		return router.ProtocolMIDI2, nil
+	default:
+		return router.ProtocolMIDI1, errors.New("Invalid protocol: " + str)
+	}
+}
+
+func stringToOverflowPolicy(str string) (router.OverflowPolicy, error) {
+	switch str {
+	case "", "Block":
+		return router.OverflowPolicyBlock, nil
+	case "DropOldest":
+		return router.OverflowPolicyDropOldest, nil
+	case "DropNewest":
+		return router.OverflowPolicyDropNewest, nil
+	default:
+		return router.OverflowPolicyBlock, errors.New("Invalid overflow policy: " + str)
+	}
+}
+
+func stringToValidationMode(str string) (router.ValidationMode, error) {
+	switch str {
+	case "Clamp":
+		return router.ValidationModeClamp, nil
+	case "Drop":
+		return router.ValidationModeDrop, nil
+	case "Log":
+		return router.ValidationModeLog, nil
+	case "", "None":
+		return router.ValidationModeNone, nil
+	default:
+		return router.ValidationModeNone, errors.New("Invalid output validation mode: " + str)
+	}
+}
+
+func loadScript(conf ScriptConfig, configDir string) (*luascript.LuaScript, error) {
+	code := conf.Lua
+	if conf.LuaFile != "" {
+		path := conf.LuaFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(configDir, path)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		code = string(data)
+	}
+	return luascript.New(code)
+}
+
+func stringToRecordStreams(str string) (input bool, output bool, err error) {
+	switch str {
+	case "", "Both":
+		return true, true, nil
+	case "Input":
+		return true, false, nil
+	case "Output":
+		return false, true, nil
+	default:
+		return false, false, errors.New("Invalid recorded streams: " + str)
+	}
+}
+
+func stringToSystemPolicy(str string) (router.SystemPolicy, error) {
+	switch str {
+	case "", "Default":
+		return router.SystemPolicyDefault, nil
+	case "Forward":
+		return router.SystemPolicyForward, nil
+	case "Drop", "Regenerate":
+		return router.SystemPolicyDrop, nil
+	default:
+		return router.SystemPolicyDefault, errors.New("Invalid system message policy: " + str)
+	}
+}
+
 func stringToFilterChannel(str string) (filter.FilterChannel, error) {
 	switch str {
 	case "1":
@@ -366,6 +1121,40 @@ func stringToFilterChannel(str string) (filter.FilterChannel, error) {
 	return filter.FilterChannelAny, errors.New("Invalid MIDI channel value: '" + str + "'")
 }
 
+// Duration as a fraction of a whole note: "1/8" (eighth note), "1/8." (dotted)
+// or "1/8t" (triplet). "3/16" is also accepted.
+func stringToNoteValue(str string) (float64, error) {
+	factor := 1.0
+	s := strings.TrimSpace(str)
+	if strings.HasSuffix(s, ".") {
+		factor = 1.5
+		s = strings.TrimSuffix(s, ".")
+	} else if strings.HasSuffix(s, "t") {
+		factor = 2.0 / 3.0
+		s = strings.TrimSuffix(s, "t")
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return 0, errors.New("Invalid note value '" + str + "', expected a fraction such as 1/16")
+	}
+	num, err1 := strconv.ParseUint(parts[0], 10, 16)
+	den, err2 := strconv.ParseUint(parts[1], 10, 16)
+	if (err1 != nil) || (err2 != nil) || (num == 0) || (den == 0) {
+		return 0, errors.New("Invalid note value '" + str + "', expected a fraction such as 1/16")
+	}
+	return float64(num) / float64(den) * factor, nil
+}
+
+// Whether the Channel setting applies to a filter or generator type
+func hasChannel(msgType string) bool {
+	switch msgType {
+	case "SysEx", "Clock", "Tempo", "MTC", "Transport", "Macro", "MCU":
+		return false
+	}
+	return true
+}
+
 func stringToMsgType(str string) (filter.FilterMsgType, error) {
 	switch str {
 	case "Note On":
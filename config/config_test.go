@@ -0,0 +1,53 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Settings with side effects outside of the router (child processes, files
+// written, scripts), left out of fuzzing
+var fuzzSkipped = [][]byte{[]byte("Process"), []byte("Record"), []byte("Script"), []byte("Plugin"), []byte("Action")}
+
+// Configurations either load on an offline router or are rejected with an
+// error, never a panic
+func FuzzLoadConfig(f *testing.F) {
+	samples, _ := filepath.Glob("../sample_configs/*.json")
+	for _, path := range samples {
+		if data, err := os.ReadFile(path); err == nil {
+			f.Add(data)
+		}
+	}
+
+	//Loading logs the rules, which would flood the fuzzing output
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		f.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	f.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, s := range fuzzSkipped {
+			if bytes.Contains(data, s) {
+				return
+			}
+		}
+		path := filepath.Join(dir, "config.json")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		relay, err := LoadConfigOffline(path, "")
+		if err != nil {
+			return
+		}
+		relay.Discard()
+	})
+}
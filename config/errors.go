@@ -0,0 +1,80 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error found loading a configuration file, located down to the rule and
+// setting when it comes from a rule
+type ConfigError struct {
+	Path    string // Configuration file
+	Rule    string // Rule name, "" outside of rules
+	Index   int    // Rule position in the Rules array (1 based), 0 outside of rules
+	Section string // Part of the rule: Filter, Condition, Transform, Generator... "" for the rule itself
+	Field   string // Setting of the section, e.g. "Channel", "" when not known
+	Err     error
+}
+
+func (e *ConfigError) Error() string {
+	var str string
+	if e.Path != "" {
+		str = e.Path + ": "
+	}
+	if e.Index > 0 {
+		str += fmt.Sprintf("rule #%d '%s': ", e.Index, e.Rule)
+	}
+	switch {
+	case (e.Section != "") && (e.Field != ""):
+		str += e.Section + "." + e.Field + ": "
+	case e.Section != "":
+		str += e.Section + ": "
+	case e.Field != "":
+		str += e.Field + ": "
+	}
+	return str + e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Error of a setting of the current section
+func fieldError(field string, err error) error {
+	return &ConfigError{Field: field, Err: err}
+}
+
+// Error of a section of a rule, e.g. "Generator", or of a setting of it when
+// err is a fieldError. Nested sections are joined ("VelocitySplit.Generator").
+func sectionError(section string, err error) error {
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		return &ConfigError{Section: section, Err: err}
+	}
+	if configErr.Section != "" {
+		section += "." + configErr.Section
+	}
+	return &ConfigError{Section: section, Field: configErr.Field, Err: configErr.Err}
+}
+
+// Error of the rule at index (1 based) of the Rules array
+func ruleError(index int, name string, err error) error {
+	located := ConfigError{Err: err}
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		located = *configErr
+	}
+	located.Index, located.Rule = index, name
+	return &located
+}
+
+// Error of a configuration file, rule errors included
+func fileError(path string, err error) error {
+	located := ConfigError{Err: err}
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		located = *configErr
+	}
+	located.Path = path
+	return &located
+}
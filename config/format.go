@@ -0,0 +1,103 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration files are read as "json", "yaml" or "toml" whatever their
+// extension, given as format to the loading functions, or with format ""
+// from their extension: .yaml and .yml files are YAML, .toml files TOML,
+// others JSON. Other formats are an error.
+func CheckFormat(format string) error {
+	switch format {
+	case "", "json", "yaml", "toml":
+		return nil
+	}
+	return errors.New("Invalid configuration format '" + format + "', expected json, yaml or toml")
+}
+
+func fileFormat(configPath string, format string) string {
+	if format != "" {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return "json"
+}
+
+// Read a configuration file into config, with the same settings whatever its
+// format (see CheckFormat)
+func decodeConfig(configPath string, format string, config *RouterConfig) error {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	if err := CheckFormat(format); err != nil {
+		return err
+	}
+	switch fileFormat(configPath, format) {
+	case "yaml":
+		data, err = yamlToJSON(data)
+	case "toml":
+		data, err = tomlToJSON(data)
+	}
+	if err != nil {
+		return errors.New("Failed parsing config file: " + err.Error())
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return errors.New("Failed parsing config file: " + err.Error())
+	}
+	return nil
+}
+
+// Convert a YAML document to JSON, for the settings to be decoded (down to the
+// raw settings of filters and generators) as those of JSON files
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonValue(doc))
+}
+
+// Convert a TOML document to JSON, as YAML ones
+func tomlToJSON(data []byte) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := toml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// YAML mappings with keys other than strings (e.g. numbers) as JSON objects
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = jsonValue(value)
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonValue(value)
+		}
+	}
+	return v
+}
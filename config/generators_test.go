@@ -0,0 +1,120 @@
+package config
+
+import (
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/midi"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of the tests")
+
+// Generator built from the settings of a rule, fed with a message and values
+type generatorCase struct {
+	MsgType  string
+	Channel  string
+	Settings json.RawMessage
+	Input    string // Filtered message, hex bytes
+	Values   []uint16
+}
+
+// The output of every generator of testdata/generators.json, for each of its
+// values, is that of testdata/generators.golden (go test ./config -update to
+// rewrite it after a deliberate change)
+func TestGeneratorsGolden(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "generators.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []generatorCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	for _, c := range cases {
+		var settings bytes.Buffer
+		if err := json.Compact(&settings, c.Settings); err != nil {
+			t.Fatalf("%s: invalid settings: %v", c.MsgType, err)
+		}
+		if c.Channel != "" {
+			fmt.Fprintf(&out, "%s, channel %s, %s\n", c.MsgType, c.Channel, settings.String())
+		} else {
+			fmt.Fprintf(&out, "%s, %s\n", c.MsgType, settings.String())
+		}
+		fmt.Fprintf(&out, "  input: %s\n", c.Input)
+		g, err := newTestGenerator(c)
+		if err != nil {
+			fmt.Fprintf(&out, "  error: %v\n", err)
+			continue
+		}
+		input, err := hex.DecodeString(strings.ReplaceAll(c.Input, " ", ""))
+		if err != nil {
+			t.Fatalf("%s: invalid input: %v", c.MsgType, err)
+		}
+		for _, value := range c.Values {
+			fmt.Fprintf(&out, "  %5d: %s\n", value, generate(g, midi.NewPacket(input, 0), value))
+		}
+	}
+
+	golden := filepath.Join("testdata", "generators.golden")
+	if *update {
+		if err := os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Errorf("Generator output differs from %s (-update to rewrite it):\n%s", golden, out.String())
+	}
+}
+
+func newTestGenerator(c generatorCase) (generatorinterface.GeneratorInterface, error) {
+	newGenerator, found := lookupGeneratorType(c.MsgType)
+	if !found {
+		return nil, fmt.Errorf("Invalid generator type: %s", c.MsgType)
+	}
+	channel, err := stringToFilterChannel(c.Channel)
+	if (err != nil) && hasChannel(c.MsgType) {
+		return nil, err
+	}
+	return newGenerator(channel, c.Settings, "")
+}
+
+// Output of a generator as a line: messages (with their delay if any) or error
+func generate(g generatorinterface.GeneratorInterface, packet midi.Packet, value uint16) string {
+	var messages []string
+	var err error
+	switch gen := g.(type) {
+	case generatorinterface.TimedGeneratorInterface:
+		var timed []generatorinterface.TimedPacket
+		timed, err = gen.GenerateTimed(packet, value)
+		for _, t := range timed {
+			messages = append(messages, fmt.Sprintf("% X (+%v)", t.Packet.Data, t.Delay))
+		}
+	case generatorinterface.MultiGeneratorInterface:
+		var packets []midi.Packet
+		packets, err = gen.GenerateMulti(packet, value)
+		for _, p := range packets {
+			messages = append(messages, fmt.Sprintf("% X", p.Data))
+		}
+	default:
+		var p midi.Packet
+		p, err = g.Generate(packet, value)
+		messages = append(messages, fmt.Sprintf("% X", p.Data))
+	}
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return strings.Join(messages, " | ")
+}
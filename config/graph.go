@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Write the routing of configuration files as a Graphviz DOT graph: devices,
+// and the rules (filter, transform, generator) of every configuration between
+// them. Devices shared by configurations appear once, so that rigs made of
+// several configurations can be reviewed as a whole. Files are read in format
+// (see CheckFormat).
+func WriteGraph(w io.Writer, format string, configPaths ...string) error {
+	var b strings.Builder
+
+	b.WriteString("digraph MIDIRouter {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, fontname=\"Helvetica\", fontsize=10];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\", fontsize=9];\n")
+
+	devices := make(map[string]string) // Device name => node ID
+	device := func(name string) string {
+		if id, found := devices[name]; found {
+			return id
+		}
+		id := fmt.Sprintf("device%d", len(devices))
+		devices[name] = id
+		fmt.Fprintf(&b, "  %s [shape=ellipse, style=filled, fillcolor=\"#e8e8e8\", label=%s];\n", id, dotString(name))
+		return id
+	}
+
+	for i, path := range configPaths {
+		var config RouterConfig
+		if err := decodeConfig(path, format, &config); err != nil {
+			return fileError(path, err)
+		}
+		if err := expandPresets(&config); err != nil {
+			return fileError(path, err)
+		}
+
+		source := device(config.SourceDevice)
+		//Rules targeting a destination have an edge to it only
+		var all []string
+		named := make(map[string]string) // Destination name => node ID
+		if len(config.Destinations) == 0 {
+			all = append(all, device(config.DestinationDevice))
+		}
+		for _, d := range config.Destinations {
+			named[d.Name] = device(d.Device)
+			all = append(all, named[d.Name])
+		}
+		destinations := func(name string) []string {
+			if id, found := named[name]; found {
+				return []string{id}
+			}
+			return all
+		}
+
+		fmt.Fprintf(&b, "  subgraph cluster%d {\n", i)
+		fmt.Fprintf(&b, "    label=%s;\n", dotString(filepath.Base(path)))
+		for j, z := range config.Zones {
+			id := fmt.Sprintf("zone%d_%d", i, j)
+			label := fmt.Sprintf("Zone '%s'\n%s to %s, channel %s", z.Name, z.Low, z.High, orAny(z.Channel))
+			fmt.Fprintf(&b, "    %s [shape=component, label=%s];\n", id, dotString(label+"\n"+zoneOutput(z)))
+			fmt.Fprintf(&b, "    %s -> %s;\n", source, id)
+			for _, destination := range all {
+				fmt.Fprintf(&b, "    %s -> %s;\n", id, destination)
+			}
+		}
+		for j, r := range config.Rules {
+			id := fmt.Sprintf("rule%d_%d", i, j)
+			style := ""
+			if r.Disabled {
+				style = ", style=dashed"
+			}
+			fmt.Fprintf(&b, "    %s [label=%s%s];\n", id, dotString(ruleLabel(r)), style)
+			fmt.Fprintf(&b, "    %s -> %s;\n", source, id)
+			for _, destination := range destinations(r.Generator.Destination) {
+				fmt.Fprintf(&b, "    %s -> %s;\n", id, destination)
+			}
+		}
+		if config.DefaultPassthrough {
+			for _, destination := range all {
+				fmt.Fprintf(&b, "    %s -> %s [style=dashed, label=\"passthrough\"];\n", source, destination)
+			}
+		}
+		b.WriteString("  }\n")
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func ruleLabel(r RuleConfig) string {
+	lines := []string{"Rule '" + r.Name + "'", "Filter: " + messageLabel(r.Filter.MsgType, r.Filter.Channel, r.Filter.Settings)}
+	if r.Condition != "" {
+		lines = append(lines, "Condition: "+r.Condition)
+	}
+	if r.While != "" {
+		lines = append(lines, "While: "+r.While)
+	}
+	if t := transformLabel(r.Transform); t != "" {
+		lines = append(lines, "Transform: "+t)
+	}
+	lines = append(lines, "Generator: "+messageLabel(r.Generator.MsgType, r.Generator.Channel, r.Generator.Settings))
+	if r.VelocitySplit != nil {
+		g := r.VelocitySplit.Generator
+		lines = append(lines, fmt.Sprintf("Velocity >= %d: %s", r.VelocitySplit.Velocity, messageLabel(g.MsgType, g.Channel, g.Settings)))
+	}
+	if r.OSC != nil {
+		lines = append(lines, "OSC: "+r.OSC.Address)
+	}
+	if r.Action != nil {
+		lines = append(lines, "Action: "+r.Action.Type+settingsLabel(r.Action.Settings))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Message type, channel and settings, e.g. "Control Change, channel 1 (ControllerNumber 7, Value *)"
+func messageLabel(msgType string, channel string, settings json.RawMessage) string {
+	label := msgType
+	if hasChannel(msgType) {
+		label += ", channel " + orAny(channel)
+	}
+	return label + settingsLabel(settings)
+}
+
+// Settings sorted by name, e.g. " (ControllerNumber 7, Value *)", "" if none
+func settingsLabel(settings json.RawMessage) string {
+	var values map[string]interface{}
+	if json.Unmarshal(settings, &values) != nil || len(values) == 0 {
+		return ""
+	}
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		value, _ := json.Marshal(values[name])
+		parts = append(parts, name+" "+strings.Trim(string(value), "\""))
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+func transformLabel(t TransformConfig) string {
+	switch t.Mode {
+	case "", "None":
+		return ""
+	case "Linear", "LinearDrop", "Noise":
+		return fmt.Sprintf("%s [%d, %d] to [%d, %d]", t.Mode, t.FromMin, t.FromMax, t.ToMin, t.ToMax)
+	case "Toggle":
+		return fmt.Sprintf("Toggle between %d and %d", t.ToMin, t.ToMax)
+	}
+	return t.Mode
+}
+
+func zoneOutput(z ZoneConfig) string {
+	label := "to channel " + orAny(z.OutputChannel)
+	if z.Transpose != 0 {
+		label += fmt.Sprintf(", transpose %+d", z.Transpose)
+	}
+	if z.While != "" {
+		label += ", while " + z.While
+	}
+	return label
+}
+
+func orAny(channel string) string {
+	if channel == "" {
+		return "*"
+	}
+	return channel
+}
+
+// Quoted DOT string, line breaks centered
+func dotString(str string) string {
+	str = strings.ReplaceAll(str, "\\", "\\\\")
+	str = strings.ReplaceAll(str, "\"", "\\\"")
+	return "\"" + strings.ReplaceAll(str, "\n", "\\n") + "\""
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"MIDIRouter/highres"
+	"MIDIRouter/ump"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+)
+
+// Setting holding the value extracted by built-in filters, and the largest
+// value they extract
+var filterValues = map[string]struct {
+	setting string
+	max     int
+}{
+	"Note On":          {"Velocity", 127},
+	"Note Off":         {"Velocity", 127},
+	"Aftertouch":       {"Pressure", 127},
+	"Control Change":   {"Value", 127},
+	"Program Change":   {"ProgramNumber", 127},
+	"Channel Pressure": {"Pressure", 127},
+	"Pitch Wheel":      {"Pitch", 16383},
+}
+
+// Check the rule set of a configuration file for rules which load but
+// cannot behave as intended: rules shadowed by earlier broader rules, noise
+// settings of transforms without noise, and generator values filters can
+// never produce. Problems are returned as *ConfigError, locating the rule.
+func Lint(configPath string, format string) ([]error, error) {
+	var config RouterConfig
+	if err := decodeConfig(configPath, format, &config); err != nil {
+		return nil, fileError(configPath, err)
+	}
+	if err := expandPresets(&config); err != nil {
+		return nil, fileError(configPath, err)
+	}
+	if err := resolveNames(&config); err != nil {
+		return nil, fileError(configPath, err)
+	}
+
+	var warnings []error
+	for i, r := range config.Rules {
+		if r.Disabled {
+			continue
+		}
+		for _, err := range lintRule(config.Rules[:i], r) {
+			warnings = append(warnings, fileError(configPath, ruleError(i+1, r.Name, err)))
+		}
+	}
+	return warnings, nil
+}
+
+// Problems of rule r, following the previous rules
+func lintRule(previous []RuleConfig, r RuleConfig) []error {
+	var warnings []error
+
+	for i, p := range previous {
+		if !p.Disabled && shadows(p, r) {
+			warnings = append(warnings, sectionError("Filter",
+				fmt.Errorf("Never matches: rule #%d '%s' matches the same messages first", i+1, p.Name)))
+			break
+		}
+	}
+
+	if (r.Transform.Mode != "Noise") && (r.Transform.NoiseSettings != NoiseSettingsConfig{}) {
+		warnings = append(warnings, sectionError("Transform", fieldError("NoiseSettings",
+			errors.New("Ignored: transform mode is not Noise"))))
+	}
+
+	if err := lintRange(r); err != nil {
+		warnings = append(warnings, sectionError("Transform", err))
+	}
+	return warnings
+}
+
+// Whether rule p, checked before r, takes every message r matches. Only
+// rules of built-in filter types matching unconditionally are considered.
+func shadows(p RuleConfig, r RuleConfig) bool {
+	if _, found := filterValues[p.Filter.MsgType]; !found || (p.Filter.MsgType != r.Filter.MsgType) {
+		return false
+	}
+	if (p.Condition != "") || (p.While != "") || (p.Script != nil) {
+		return false
+	}
+	//Out of range values are left to the next rules
+	if (p.Transform.Mode == "LinearDrop") || (p.Transform.Mode == "Toggle") {
+		return false
+	}
+	if _, found := lookupTransformType(p.Transform.Mode); found {
+		return false
+	}
+	if (orAny(p.Filter.Channel) != "*") && (p.Filter.Channel != r.Filter.Channel) {
+		return false
+	}
+
+	pSettings, rSettings := filterSettings(p.Filter), filterSettings(r.Filter)
+	if (pSettings == nil) || (rSettings == nil) {
+		return false
+	}
+	for name, value := range pSettings {
+		if (value != "*") && (value != rSettings[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// String settings of a filter, nil if they cannot be read
+func filterSettings(fc FilterConfig) map[string]string {
+	settings := make(map[string]string)
+	if len(fc.Settings) == 0 {
+		return settings
+	}
+	if err := json.Unmarshal(fc.Settings, &settings); err != nil {
+		return nil
+	}
+	return settings
+}
+
+// Check that the values extracted by the filter cover the input range of a
+// linear transform: otherwise part of the generated range is never reached
+func lintRange(r RuleConfig) error {
+	t := r.Transform
+	if ((t.Mode != "Linear") && (t.Mode != "LinearDrop") && (t.Mode != "Noise")) || (t.FromMax <= t.FromMin) {
+		return nil
+	}
+	filter, found := filterValues[r.Filter.MsgType]
+	if !found {
+		return nil
+	}
+	settings := filterSettings(r.Filter)
+	if settings == nil {
+		return nil
+	}
+
+	low, high := 0, filter.max
+	if (r.Filter.MsgType == "Control Change") && (settings["Mode"] == "CCAh") {
+		high = 16383
+	}
+	if value, err := strconv.Atoi(settings[filter.setting]); err == nil {
+		low, high = value, value
+	}
+	if r.Filter.Resolution == highres.Bits {
+		srcBits := uint(bits.Len(uint(filter.max)))
+		low, high = int(ump.ScaleUp(uint32(low), srcBits, highres.Bits)), int(ump.ScaleUp(uint32(high), srcBits, highres.Bits))
+	}
+	if (low <= t.FromMin) && (high >= t.FromMax) {
+		return nil
+	}
+
+	if (high < t.FromMin) || (low > t.FromMax) {
+		if t.Mode == "LinearDrop" {
+			return fmt.Errorf("Never matches: filter values [%d, %d] are out of range [%d, %d]", low, high, t.FromMin, t.FromMax)
+		}
+		return nil
+	}
+	//A single value is mapped to a single value on purpose
+	if low == high {
+		return nil
+	}
+	if low < t.FromMin {
+		low = t.FromMin
+	}
+	if high > t.FromMax {
+		high = t.FromMax
+	}
+	reached := []int{scale(t, low), scale(t, high)}
+	sort.Ints(reached)
+	return fmt.Errorf("Generator values [%d, %d] only partly reached: filter values [%d, %d] give [%d, %d]",
+		t.ToMin, t.ToMax, low, high, reached[0], reached[1])
+}
+
+// Value of the linear transform, as transformlinear computes it
+func scale(t TransformConfig, value int) int {
+	a := float64(t.ToMax-t.ToMin) / float64(t.FromMax-t.FromMin)
+	b := float64(t.ToMin) - a*float64(t.FromMin)
+	return int(a*float64(value) + b)
+}
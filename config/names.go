@@ -0,0 +1,108 @@
+package config
+
+import (
+	"MIDIRouter/controllers"
+	"MIDIRouter/notes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Replace controller names of Control Change settings and note names of Note
+// On/Off settings by their numbers, so filters and generators only see numbers
+func resolveNames(config *RouterConfig) error {
+	if _, err := middleCOctave(config.MiddleC); err != nil {
+		return err
+	}
+	for i := range config.Rules {
+		r := &config.Rules[i]
+		if err := resolveSettings(r.Filter.MsgType, &r.Filter.Settings, config); err != nil {
+			return ruleError(i+1, r.Name, sectionError("Filter", fieldError("Settings", err)))
+		}
+		if err := resolveSettings(r.Generator.MsgType, &r.Generator.Settings, config); err != nil {
+			return ruleError(i+1, r.Name, sectionError("Generator", fieldError("Settings", err)))
+		}
+		if r.VelocitySplit != nil {
+			gc := &r.VelocitySplit.Generator
+			if err := resolveSettings(gc.MsgType, &gc.Settings, config); err != nil {
+				return ruleError(i+1, r.Name, sectionError("VelocitySplit.Generator", fieldError("Settings", err)))
+			}
+		}
+	}
+
+	if config.TapTempo != nil {
+		if err := resolveSettings(config.TapTempo.MsgType, &config.TapTempo.Settings, config); err != nil {
+			return errors.New("Tap tempo: " + err.Error())
+		}
+	}
+	for i := range config.Snapshots {
+		sc := &config.Snapshots[i]
+		if err := resolveSettings(sc.Save.MsgType, &sc.Save.Settings, config); err != nil {
+			return errors.New("Snapshot '" + sc.Name + "': Save: " + err.Error())
+		}
+		if err := resolveSettings(sc.Recall.MsgType, &sc.Recall.Settings, config); err != nil {
+			return errors.New("Snapshot '" + sc.Name + "': Recall: " + err.Error())
+		}
+	}
+	for name, fc := range config.Modifiers {
+		if err := resolveSettings(fc.MsgType, &fc.Settings, config); err != nil {
+			return errors.New("Modifier '" + name + "': " + err.Error())
+		}
+		config.Modifiers[name] = fc
+	}
+	return nil
+}
+
+func resolveSettings(msgType string, settings *json.RawMessage, config *RouterConfig) error {
+	var field string
+	var parse func(string) (uint8, error)
+	switch msgType {
+	case "Control Change":
+		field = "ControllerNumber"
+		parse = func(name string) (uint8, error) {
+			return controllers.Parse(name, config.Controllers)
+		}
+	case "Note On", "Note Off":
+		field = "Note"
+		parse = func(name string) (uint8, error) {
+			middleC, _ := middleCOctave(config.MiddleC)
+			return notes.ParseMiddleC(name, middleC)
+		}
+	default:
+		return nil
+	}
+	if len(*settings) == 0 {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(*settings, &fields); err != nil {
+		//Left to the filter or generator to report
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(fields[field], &name); (err != nil) || (name == "*") || (name == "$") {
+		return nil
+	}
+
+	number, err := parse(name)
+	if err != nil {
+		return err
+	}
+	fields[field] = json.RawMessage(strconv.Quote(strconv.Itoa(int(number))))
+	*settings, err = json.Marshal(fields)
+	return err
+}
+
+// Octave of middle C (60) from the MiddleC setting: "C4" (default), "C3" or "C5"
+func middleCOctave(str string) (int, error) {
+	if str == "" {
+		return 4, nil
+	}
+	octave, err := strconv.Atoi(strings.TrimPrefix(str, "C"))
+	if (err != nil) || !strings.HasPrefix(str, "C") {
+		return 0, errors.New("Invalid MiddleC '" + str + "': expected C3, C4 or C5")
+	}
+	return octave, nil
+}
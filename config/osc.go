@@ -0,0 +1,62 @@
+package config
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/osc"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// OSC address of the messages generated by a rule, when the destination
+// device is an OSC server ("osc://host:port")
+type OSCConfig struct {
+	Address string // Template, e.g. "/mixer/{channel}/fader"
+	Type    string // Argument type: int (default), float or bool
+}
+
+var oscStatuses = map[string]byte{
+	"Note On":          0x90,
+	"Note Off":         0x80,
+	"Aftertouch":       0xA0,
+	"Control Change":   0xB0,
+	"Program Change":   0xC0,
+	"Channel Pressure": 0xD0,
+	"Pitch Wheel":      0xE0,
+}
+
+// Route translating the messages of the rule generator
+func oscRoute(r RuleConfig) (osc.Route, error) {
+	route := osc.Route{Address: r.OSC.Address, Channel: -1, Number: -1}
+
+	var err error
+	if route.Type, err = osc.ParseArgType(r.OSC.Type); err != nil {
+		return route, fieldError("Type", err)
+	}
+	status, found := oscStatuses[r.Generator.MsgType]
+	if !found {
+		return route, errors.New(r.Generator.MsgType + " messages have no OSC translation")
+	}
+	route.Status = status
+
+	channel, err := stringToFilterChannel(r.Generator.Channel)
+	if err != nil {
+		return route, errors.New("Invalid generator channel: " + err.Error())
+	}
+	if channel != filter.FilterChannelAny {
+		route.Channel = int(channel)
+	}
+
+	//Fixed controller or note numbers restrict the route to them
+	var settings struct {
+		ControllerNumber string
+		Note             string
+	}
+	json.Unmarshal(r.Generator.Settings, &settings)
+	for _, number := range []string{settings.ControllerNumber, settings.Note} {
+		if n, err := strconv.ParseUint(number, 10, 7); err == nil {
+			route.Number = int(n)
+		}
+	}
+	return route, nil
+}
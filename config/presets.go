@@ -0,0 +1,89 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Ready-made rule: the preset fills the filter, transform and generator of
+// the rule
+type PresetConfig struct {
+	Name             string // Preset, see presets
+	Channel          string // Input channel, 1-16 or * (default)
+	OutputChannel    string // 1-16, or * (default) for the input channel
+	ControllerNumber string // Generated (inverted for Sustain Inverter) controller, number or name
+}
+
+type preset func(p PresetConfig) (FilterConfig, TransformConfig, GeneratorConfig, error)
+
+var presets = map[string]preset{
+	"Channel Pressure to CC": func(p PresetConfig) (FilterConfig, TransformConfig, GeneratorConfig, error) {
+		if p.ControllerNumber == "" {
+			return FilterConfig{}, TransformConfig{}, GeneratorConfig{}, errors.New("Missing ControllerNumber")
+		}
+		return pressureToCC(p)
+	},
+	//Aftertouch as most keyboards send it: Channel Pressure
+	"Aftertouch to Mod Wheel": func(p PresetConfig) (FilterConfig, TransformConfig, GeneratorConfig, error) {
+		if p.ControllerNumber == "" {
+			p.ControllerNumber = "ModWheel"
+		}
+		return pressureToCC(p)
+	},
+	//Pedals wired backwards send 0 when pressed
+	"Sustain Inverter": func(p PresetConfig) (FilterConfig, TransformConfig, GeneratorConfig, error) {
+		if p.ControllerNumber == "" {
+			p.ControllerNumber = "Sustain"
+		}
+		settings := presetSettings(map[string]string{"ControllerNumber": p.ControllerNumber, "Value": "*"})
+		f := FilterConfig{MsgType: "Control Change", Channel: orAny(p.Channel), Settings: settings}
+		t := TransformConfig{Mode: "Linear", FromMin: 0, FromMax: 127, ToMin: 127, ToMax: 0}
+		g := GeneratorConfig{MsgType: "Control Change", Channel: orAny(p.OutputChannel),
+			Settings: presetSettings(map[string]string{"ControllerNumber": p.ControllerNumber, "Value": "$"})}
+		return f, t, g, nil
+	},
+}
+
+func pressureToCC(p PresetConfig) (FilterConfig, TransformConfig, GeneratorConfig, error) {
+	f := FilterConfig{MsgType: "Channel Pressure", Channel: orAny(p.Channel),
+		Settings: presetSettings(map[string]string{"Pressure": "*"})}
+	g := GeneratorConfig{MsgType: "Control Change", Channel: orAny(p.OutputChannel),
+		Settings: presetSettings(map[string]string{"ControllerNumber": p.ControllerNumber, "Value": "$"})}
+	return f, TransformConfig{}, g, nil
+}
+
+func presetSettings(settings map[string]string) json.RawMessage {
+	data, _ := json.Marshal(settings)
+	return data
+}
+
+// Replace the presets of rules by the filter, transform and generator they
+// stand for
+func expandPresets(config *RouterConfig) error {
+	for i := range config.Rules {
+		r := &config.Rules[i]
+		if r.Preset == nil {
+			continue
+		}
+		if (r.Filter.MsgType != "") || (r.Generator.MsgType != "") {
+			return ruleError(i+1, r.Name, sectionError("Preset", errors.New("Rules using a preset cannot set a Filter or Generator")))
+		}
+		newPreset, found := presets[r.Preset.Name]
+		if !found {
+			return ruleError(i+1, r.Name, sectionError("Preset", fieldError("Name", errors.New("Unknown preset: "+r.Preset.Name))))
+		}
+		f, t, g, err := newPreset(*r.Preset)
+		if err != nil {
+			return ruleError(i+1, r.Name, sectionError("Preset", err))
+		}
+		r.Filter, r.Generator = f, g
+		//A transform given with the preset is kept
+		if r.Transform.Mode == "" {
+			r.Transform = t
+		}
+		if r.Name == "" {
+			r.Name = r.Preset.Name
+		}
+	}
+	return nil
+}
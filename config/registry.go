@@ -0,0 +1,271 @@
+package config
+
+import (
+	"MIDIRouter/actionapplescript"
+	"MIDIRouter/actioninterface"
+	"MIDIRouter/actionkeystroke"
+	"MIDIRouter/filter"
+	"MIDIRouter/filteraftertouch"
+	"MIDIRouter/filterchannelpressure"
+	"MIDIRouter/filterclock"
+	"MIDIRouter/filtercontrolchange"
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/filtermcu"
+	"MIDIRouter/filtermtc"
+	"MIDIRouter/filternoteoff"
+	"MIDIRouter/filternoteon"
+	"MIDIRouter/filterpitchwheel"
+	"MIDIRouter/filterplugin"
+	"MIDIRouter/filterprocess"
+	"MIDIRouter/filterprogramchange"
+	"MIDIRouter/filtertempo"
+	"MIDIRouter/filtertransport"
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/transforminterface"
+
+	"MIDIRouter/genaftertouch"
+	"MIDIRouter/genchannelpressure"
+	"MIDIRouter/genclock"
+	"MIDIRouter/gencontrolchange"
+	"MIDIRouter/genmacro"
+	"MIDIRouter/genmcu"
+	"MIDIRouter/genmtc"
+	"MIDIRouter/gennoteoff"
+	"MIDIRouter/gennoteon"
+	"MIDIRouter/genpitchwheel"
+	"MIDIRouter/genplugin"
+	"MIDIRouter/genprocess"
+	"MIDIRouter/genprogramchange"
+	"MIDIRouter/gensysex"
+	"MIDIRouter/gentransport"
+
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// Creates a filter from the rule channel and its Settings. configDir is the
+// directory of the configuration file, to resolve paths found in settings.
+type FilterFactory func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error)
+
+// Creates a generator from its channel and Settings
+type GeneratorFactory func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error)
+
+// Creates a transform from its Settings
+type TransformFactory func(settings json.RawMessage, configDir string) (transforminterface.TransformInterface, error)
+
+// Creates a rule action from its Settings
+type ActionFactory func(settings json.RawMessage, configDir string) (actioninterface.ActionInterface, error)
+
+var (
+	registryMutex  sync.RWMutex
+	filterTypes    = make(map[string]FilterFactory)
+	generatorTypes = make(map[string]GeneratorFactory)
+	transformTypes = make(map[string]TransformFactory)
+	actionTypes    = make(map[string]ActionFactory)
+)
+
+func init() {
+	RegisterFilterType("Note On", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filternoteon.New(channel, settings)
+	})
+	RegisterFilterType("Note Off", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filternoteoff.New(channel, settings)
+	})
+	RegisterFilterType("Aftertouch", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filteraftertouch.New(channel, settings)
+	})
+	RegisterFilterType("Control Change", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filtercontrolchange.New(channel, settings)
+	})
+	RegisterFilterType("Program Change", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filterprogramchange.New(channel, settings)
+	})
+	RegisterFilterType("Channel Pressure", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filterchannelpressure.New(channel, settings)
+	})
+	RegisterFilterType("Pitch Wheel", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filterpitchwheel.New(channel, settings)
+	})
+	RegisterFilterType("Clock", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filterclock.New(channel, settings)
+	})
+	RegisterFilterType("Tempo", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filtertempo.New(channel, settings)
+	})
+	RegisterFilterType("Transport", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filtertransport.New(channel, settings)
+	})
+	RegisterFilterType("MTC", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filtermtc.New(channel, settings)
+	})
+	RegisterFilterType("MCU", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filtermcu.New(channel, settings)
+	})
+	RegisterFilterType("Plugin", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filterplugin.New(channel, settings, configDir)
+	})
+	RegisterFilterType("Process", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (filterinterface.FilterInterface, error) {
+		return filterprocess.New(channel, settings, configDir)
+	})
+
+	RegisterGeneratorType("Note On", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return gennoteon.New(channel, settings)
+	})
+	RegisterGeneratorType("Note Off", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return gennoteoff.New(channel, settings)
+	})
+	RegisterGeneratorType("Aftertouch", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return genaftertouch.New(channel, settings)
+	})
+	RegisterGeneratorType("Channel Pressure", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return genchannelpressure.New(channel, settings)
+	})
+	RegisterGeneratorType("Control Change", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return gencontrolchange.New(channel, settings)
+	})
+	RegisterGeneratorType("Program Change", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return genprogramchange.New(channel, settings)
+	})
+	RegisterGeneratorType("Pitch Wheel", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return genpitchwheel.New(channel, settings)
+	})
+	RegisterGeneratorType("SysEx", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return gensysex.New(settings)
+	})
+	RegisterGeneratorType("Clock", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return genclock.New(channel, settings)
+	})
+	RegisterGeneratorType("MTC", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return genmtc.New(channel, settings)
+	})
+	RegisterGeneratorType("Transport", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return gentransport.New(settings)
+	})
+	RegisterGeneratorType("Macro", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return genmacro.New(settings)
+	})
+	RegisterGeneratorType("MCU", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return genmcu.New(settings)
+	})
+	RegisterGeneratorType("Plugin", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return genplugin.New(channel, settings, configDir)
+	})
+	RegisterGeneratorType("Process", func(channel filter.FilterChannel, settings json.RawMessage, configDir string) (generatorinterface.GeneratorInterface, error) {
+		return genprocess.New(channel, settings, configDir)
+	})
+
+	RegisterActionType("Keystroke", func(settings json.RawMessage, configDir string) (actioninterface.ActionInterface, error) {
+		return actionkeystroke.New(settings)
+	})
+	RegisterActionType("AppleScript", func(settings json.RawMessage, configDir string) (actioninterface.ActionInterface, error) {
+		return actionapplescript.New(settings, configDir)
+	})
+	RegisterActionType("Shortcut", func(settings json.RawMessage, configDir string) (actioninterface.ActionInterface, error) {
+		return actionapplescript.NewShortcut(settings)
+	})
+}
+
+// Make a filter type available to configurations as Filter.MsgType. Must be
+// called before loading configurations, typically from an init() function.
+func RegisterFilterType(name string, factory FilterFactory) error {
+	if (name == "") || (factory == nil) {
+		return errors.New("Failed to register filter type: name and factory are required")
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, found := filterTypes[name]; found {
+		return errors.New("Failed to register filter type: '" + name + "' already registered")
+	}
+	filterTypes[name] = factory
+	return nil
+}
+
+// Make a generator type available to configurations as Generator.MsgType
+func RegisterGeneratorType(name string, factory GeneratorFactory) error {
+	if (name == "") || (factory == nil) {
+		return errors.New("Failed to register generator type: name and factory are required")
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, found := generatorTypes[name]; found {
+		return errors.New("Failed to register generator type: '" + name + "' already registered")
+	}
+	generatorTypes[name] = factory
+	return nil
+}
+
+// Make a transform type available to configurations as Transform.Mode. Built-in
+// modes (Linear, Noise...) cannot be replaced.
+func RegisterTransformType(name string, factory TransformFactory) error {
+	if (name == "") || (factory == nil) {
+		return errors.New("Failed to register transform type: name and factory are required")
+	}
+	if _, builtin := builtinTransforms[name]; builtin {
+		return errors.New("Failed to register transform type: '" + name + "' is a built-in mode")
+	}
+	if _, err := stringToTransformMode(name); err == nil {
+		return errors.New("Failed to register transform type: '" + name + "' is a built-in mode")
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, found := transformTypes[name]; found {
+		return errors.New("Failed to register transform type: '" + name + "' already registered")
+	}
+	transformTypes[name] = factory
+	return nil
+}
+
+// Make an action type available to configurations as Action.Type
+func RegisterActionType(name string, factory ActionFactory) error {
+	if (name == "") || (factory == nil) {
+		return errors.New("Failed to register action type: name and factory are required")
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, found := actionTypes[name]; found {
+		return errors.New("Failed to register action type: '" + name + "' already registered")
+	}
+	actionTypes[name] = factory
+	return nil
+}
+
+func lookupFilterType(name string) (FilterFactory, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	factory, found := filterTypes[name]
+	return factory, found
+}
+
+func lookupGeneratorType(name string) (GeneratorFactory, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	factory, found := generatorTypes[name]
+	return factory, found
+}
+
+func lookupTransformType(name string) (TransformFactory, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	factory, found := transformTypes[name]
+	return factory, found
+}
+
+func lookupActionType(name string) (ActionFactory, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	factory, found := actionTypes[name]
+	return factory, found
+}
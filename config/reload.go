@@ -0,0 +1,47 @@
+package config
+
+import (
+	"MIDIRouter/router"
+	"MIDIRouter/rule"
+	"path/filepath"
+	"time"
+)
+
+// Load the rules, DefaultPassthrough and SendLimitMs of the configuration
+// file (read in format, see CheckFormat) into a running router, without
+// reconnecting its devices. Other settings (devices, zones...) take effect on
+// restart. The router is left unchanged if the configuration is invalid.
+func ReloadConfig(relay *router.MIDIRouter, configPath string, format string) error {
+	err := reloadRouter(relay, configPath, format)
+	if err != nil {
+		return fileError(configPath, err)
+	}
+	return nil
+}
+
+func reloadRouter(relay *router.MIDIRouter, configPath string, format string) error {
+	config, err := readConfig(configPath, format)
+	if err != nil {
+		return err
+	}
+
+	var rules []*rule.Rule
+	for i, r := range config.Rules {
+		newRule, err := loadRule(r, &config, relay, filepath.Dir(configPath))
+		if err != nil {
+			for _, built := range rules {
+				built.Close()
+			}
+			return ruleError(i+1, r.Name, err)
+		}
+		newRule.SetEnabled(!r.Disabled)
+		rules = append(rules, newRule)
+	}
+
+	relay.Reload(router.ReloadSettings{
+		Passthrough: config.DefaultPassthrough,
+		SendLimit:   time.Duration(config.SendLimitMs) * time.Millisecond,
+		Rules:       rules,
+	})
+	return nil
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Standard Control Change numbers, by name (lower case, no spaces)
+var standard = map[string]uint8{
+	"bankselect":          0,
+	"modwheel":            1,
+	"modulation":          1,
+	"breath":              2,
+	"foot":                4,
+	"portamentotime":      5,
+	"dataentry":           6,
+	"volume":              7,
+	"balance":             8,
+	"pan":                 10,
+	"expression":          11,
+	"effect1":             12,
+	"effect2":             13,
+	"generalpurpose1":     16,
+	"generalpurpose2":     17,
+	"generalpurpose3":     18,
+	"generalpurpose4":     19,
+	"bankselectlsb":       32,
+	"sustain":             64,
+	"damper":              64,
+	"portamento":          65,
+	"sostenuto":           66,
+	"softpedal":           67,
+	"legato":              68,
+	"hold2":               69,
+	"soundvariation":      70,
+	"resonance":           71,
+	"timbre":              71,
+	"releasetime":         72,
+	"attacktime":          73,
+	"cutoff":              74,
+	"brightness":          74,
+	"decaytime":           75,
+	"vibratorate":         76,
+	"vibratodepth":        77,
+	"vibratodelay":        78,
+	"portamentocontrol":   84,
+	"reverb":              91,
+	"tremolo":             92,
+	"chorus":              93,
+	"detune":              94,
+	"phaser":              95,
+	"dataincrement":       96,
+	"datadecrement":       97,
+	"nrpnlsb":             98,
+	"nrpnmsb":             99,
+	"rpnlsb":              100,
+	"rpnmsb":              101,
+	"allsoundoff":         120,
+	"resetallcontrollers": 121,
+	"localcontrol":        122,
+	"allnotesoff":         123,
+	"omnioff":             124,
+	"omnion":              125,
+	"monoon":              126,
+	"polyon":              127,
+}
+
+// Names are matched ignoring case and spaces: "ModWheel", "Mod Wheel"
+func key(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, " ", ""))
+}
+
+// Convert a controller name ("ModWheel", "Sustain", "Cutoff"...) to a Control
+// Change number. Custom names take precedence over standard ones, and plain
+// numbers are accepted too.
+func Parse(name string, custom map[string]int) (uint8, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		if (n < 0) || (n > 127) {
+			return 0, errors.New("Controller number out of range: " + name)
+		}
+		return uint8(n), nil
+	}
+
+	for customName, n := range custom {
+		if key(customName) == key(name) {
+			if (n < 0) || (n > 127) {
+				return 0, errors.New("Controller number out of range for '" + customName + "': " + strconv.Itoa(n))
+			}
+			return uint8(n), nil
+		}
+	}
+	if n, found := standard[key(name)]; found {
+		return n, nil
+	}
+	return 0, errors.New("Unknown controller name: " + name)
+}
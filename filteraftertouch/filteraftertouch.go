@@ -3,12 +3,11 @@ package filteraftertouch
 import (
 	"MIDIRouter/filter"
 	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type FilterAftertouch struct {
@@ -74,7 +73,7 @@ func (f *FilterAftertouch) QuickMatch(msgType filter.FilterMsgType, channel filt
 	return false
 }
 
-func (f *FilterAftertouch) Match(packet coremidi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+func (f *FilterAftertouch) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
 	if len(packet.Data) != 2 || packet.Data[0]&0xF0 != highNibble {
 		return filterinterface.FilterMatchResult_NoMatch, 0
 	}
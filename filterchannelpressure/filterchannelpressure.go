@@ -3,12 +3,11 @@ package filterchannelpressure
 import (
 	"MIDIRouter/filter"
 	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type FilterChannelPressure struct {
@@ -74,7 +73,7 @@ func (f *FilterChannelPressure) QuickMatch(msgType filter.FilterMsgType, channel
 	return false
 }
 
-func (f *FilterChannelPressure) Match(packet coremidi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+func (f *FilterChannelPressure) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
 	if len(packet.Data) != 2 || packet.Data[0]&0xF0 != highNibble {
 		return filterinterface.FilterMatchResult_NoMatch, 0
 	}
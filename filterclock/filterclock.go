@@ -0,0 +1,57 @@
+package filterclock
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
+	"encoding/json"
+)
+
+// Matches MIDI clock ticks, transport messages (Start, Continue, Stop) and Song
+// Position Pointer
+type FilterClock struct {
+}
+
+const (
+	statusClock    = 0xF8
+	statusStart    = 0xFA
+	statusContinue = 0xFB
+	statusStop     = 0xFC
+	statusPosition = 0xF2
+)
+
+// No settings
+func New(channel filter.FilterChannel, config json.RawMessage) (*FilterClock, error) {
+	return &FilterClock{}, nil
+}
+
+func (f *FilterClock) String() string {
+	return "Clock"
+}
+
+// Real-time messages decode as type 0xF, "channel" being the low nibble of the status byte
+func (f *FilterClock) QuickMatch(msgType filter.FilterMsgType, channel filter.FilterChannel) bool {
+	if msgType != 0xF {
+		return false
+	}
+	switch 0xF0 | byte(channel) {
+	case statusClock, statusStart, statusContinue, statusStop, statusPosition:
+		return true
+	}
+	return false
+}
+
+func (f *FilterClock) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+	if (len(packet.Data) == 3) && (packet.Data[0] == statusPosition) {
+		return filterinterface.FilterMatchResult_Match, uint16(packet.Data[1]) | uint16(packet.Data[2])<<7
+	}
+	if len(packet.Data) != 1 {
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	}
+
+	switch packet.Data[0] {
+	case statusClock, statusStart, statusContinue, statusStop:
+		return filterinterface.FilterMatchResult_Match, 0
+	}
+	return filterinterface.FilterMatchResult_NoMatch, 0
+}
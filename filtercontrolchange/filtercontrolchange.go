@@ -3,12 +3,11 @@ package filtercontrolchange
 import (
 	"MIDIRouter/filter"
 	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type ControlChangeMode uint8
@@ -134,7 +133,7 @@ func (f *FilterControlChange) QuickMatch(msgType filter.FilterMsgType, channel f
 	return false
 }
 
-func (f *FilterControlChange) Match(packet coremidi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+func (f *FilterControlChange) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
 	if len(packet.Data) != 3 || packet.Data[0]&0xF0 != highNibble {
 		return filterinterface.FilterMatchResult_NoMatch, 0
 	}
@@ -149,7 +148,7 @@ func (f *FilterControlChange) Match(packet coremidi.Packet) (match filterinterfa
 	return filterinterface.FilterMatchResult_NoMatch, 0
 }
 
-func (f *FilterControlChange) matchStandard(packet coremidi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+func (f *FilterControlChange) matchStandard(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
 	if len(packet.Data) != 3 {
 		return filterinterface.FilterMatchResult_NoMatch, 0
 	}
@@ -166,7 +165,7 @@ func (f *FilterControlChange) matchStandard(packet coremidi.Packet) (match filte
 	return filterinterface.FilterMatchResult_Match, uint16(packet.Data[2])
 }
 
-func (f *FilterControlChange) matchCCAh(packet coremidi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+func (f *FilterControlChange) matchCCAh(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
 	if len(packet.Data) != 3 {
 		return filterinterface.FilterMatchResult_NoMatch, 0
 	}
@@ -1,9 +1,10 @@
 package filterinterface
 
 import (
+	"MIDIRouter/clock"
 	"MIDIRouter/filter"
-
-	"github.com/youpy/go-coremidi"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
 )
 
 type FilterMatchResult int
@@ -16,6 +17,24 @@ const (
 
 type FilterInterface interface {
 	QuickMatch(msgType filter.FilterMsgType, channel filter.FilterChannel) bool
-	Match(packet coremidi.Packet) (match FilterMatchResult, value uint16)
+	Match(packet midi.Packet) (match FilterMatchResult, value uint16)
 	String() string
 }
+
+// Optional interface for filters logging on their own (e.g. errors of a
+// plugin), with the logger of their router
+type LoggerFilterInterface interface {
+	SetLogger(log *logger.Logger)
+}
+
+// Optional interface for filters timing messages (e.g. tempo measurement),
+// with the time source of their rule
+type ClockFilterInterface interface {
+	SetClock(c clock.Clock)
+}
+
+// Optional interface for filters holding resources (child processes,
+// plugins), closed when their rule is dropped or the router stops
+type CloserFilterInterface interface {
+	Close() error
+}
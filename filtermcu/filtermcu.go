@@ -0,0 +1,132 @@
+package filtermcu
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+type Control uint8
+
+const (
+	ControlFader Control = iota // Pitch Wheel on the strip channel, 14 bits
+	ControlVPot  Control = iota // Relative Control Change 16-23 on channel 1
+)
+
+const (
+	vpotController = 0x10
+	faderStrips    = 9 // Strips 1-8, and the master fader
+	vpotStrips     = 8
+)
+
+// Matches the controls of Mackie Control (MCU) surfaces. Faders give their
+// 14 bits position, V-Pots an absolute value (0-127) accumulated from the
+// relative moves they send.
+type FilterMCU struct {
+	control  Control
+	stripAny bool
+	strip    uint8 // 0 based
+
+	mutex     sync.Mutex
+	positions [vpotStrips]uint8 // Accumulated V-Pot values
+}
+
+type FilterMCUConfig struct {
+	Control string // Fader or VPot
+	Strip   string // 1-8 (9 for the master fader) or *
+}
+
+func New(channel filter.FilterChannel, config json.RawMessage) (*FilterMCU, error) {
+	var f FilterMCU
+	var conf FilterMCUConfig
+
+	err := json.Unmarshal([]byte(config), &conf)
+	if err != nil {
+		return nil, errors.New("Failed to parse filter settings :" + err.Error())
+	}
+
+	strips := faderStrips
+	switch conf.Control {
+	case "Fader":
+		f.control = ControlFader
+	case "VPot":
+		f.control = ControlVPot
+		strips = vpotStrips
+	default:
+		return nil, errors.New("Invalid MCU control '" + conf.Control + "': expected Fader or VPot")
+	}
+
+	if conf.Strip == "*" {
+		f.stripAny = true
+	} else {
+		value, err := strconv.ParseUint(conf.Strip, 10, 8)
+		if (err != nil) || (value < 1) || (int(value) > strips) {
+			return nil, fmt.Errorf("Invalid MCU strip: %s", conf.Strip)
+		}
+		f.strip = uint8(value - 1)
+	}
+
+	return &f, nil
+}
+
+func (f *FilterMCU) String() string {
+	strip := "*"
+	if !f.stripAny {
+		strip = strconv.Itoa(int(f.strip) + 1)
+	}
+	if f.control == ControlFader {
+		return "MCU fader on strip '" + strip + "'"
+	}
+	return "MCU V-Pot on strip '" + strip + "'"
+}
+
+func (f *FilterMCU) QuickMatch(msgType filter.FilterMsgType, channel filter.FilterChannel) bool {
+	if f.control == ControlFader {
+		return (msgType == filter.FilterMsgTypePitchWheel) && (uint8(channel) < faderStrips) && (f.stripAny || (uint8(channel) == f.strip))
+	}
+	return (msgType == filter.FilterMsgTypeControlChange) && (channel == filter.FilterChannel1)
+}
+
+func (f *FilterMCU) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+	if len(packet.Data) != 3 {
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	}
+
+	if f.control == ControlFader {
+		if packet.Data[0]&0xF0 != 0xE0 {
+			return filterinterface.FilterMatchResult_NoMatch, 0
+		}
+		return filterinterface.FilterMatchResult_Match, uint16(packet.Data[2])<<7 | uint16(packet.Data[1])
+	}
+
+	if packet.Data[0] != 0xB0 {
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	}
+	strip := packet.Data[1] - vpotController
+	if (packet.Data[1] < vpotController) || (strip >= vpotStrips) || (!f.stripAny && (strip != f.strip)) {
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	}
+
+	//Bit 6 gives the direction (set for counterclockwise), bits 0-5 the number of steps
+	steps := int(packet.Data[2] & 0x3F)
+	if packet.Data[2]&0x40 != 0 {
+		steps = -steps
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	position := int(f.positions[strip]) + steps
+	if position < 0 {
+		position = 0
+	} else if position > 127 {
+		position = 127
+	}
+	f.positions[strip] = uint8(position)
+	return filterinterface.FilterMatchResult_Match, uint16(position)
+}
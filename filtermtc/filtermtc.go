@@ -0,0 +1,34 @@
+package filtermtc
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
+	"MIDIRouter/mtc"
+	"encoding/json"
+)
+
+// Matches MIDI Time Code quarter frames, the extracted value being the data byte
+type FilterMTC struct {
+}
+
+// No settings
+func New(channel filter.FilterChannel, config json.RawMessage) (*FilterMTC, error) {
+	return &FilterMTC{}, nil
+}
+
+func (f *FilterMTC) String() string {
+	return "MTC"
+}
+
+// Quarter frames decode as type 0xF, "channel" 1
+func (f *FilterMTC) QuickMatch(msgType filter.FilterMsgType, channel filter.FilterChannel) bool {
+	return (msgType == 0xF) && (0xF0|byte(channel) == mtc.QuarterFrame)
+}
+
+func (f *FilterMTC) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+	if (len(packet.Data) != 2) || (packet.Data[0] != mtc.QuarterFrame) {
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	}
+	return filterinterface.FilterMatchResult_Match, uint16(packet.Data[1])
+}
@@ -3,12 +3,11 @@ package filternoteon
 import (
 	"MIDIRouter/filter"
 	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type FilterNoteOn struct {
@@ -98,7 +97,7 @@ func (f *FilterNoteOn) QuickMatch(msgType filter.FilterMsgType, channel filter.F
 	return false
 }
 
-func (f *FilterNoteOn) Match(packet coremidi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+func (f *FilterNoteOn) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
 	if len(packet.Data) != 3 || packet.Data[0]&0xF0 != highNibble {
 		return filterinterface.FilterMatchResult_NoMatch, 0
 	}
@@ -3,12 +3,11 @@ package filterpitchwheel
 import (
 	"MIDIRouter/filter"
 	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type FilterPitchWheel struct {
@@ -46,8 +45,8 @@ func New(channel filter.FilterChannel, config json.RawMessage) (*FilterPitchWhee
 		if err != nil {
 			return nil, err
 		}
-		if value > 0xFFFF {
-			return nil, errors.New("Pitch value too large")
+		if value > 16383 {
+			return nil, fmt.Errorf("Invalid pitch value: %s", conf.Pitch)
 		}
 		f.pitch = uint16(value)
 	}
@@ -75,7 +74,7 @@ func (f *FilterPitchWheel) QuickMatch(msgType filter.FilterMsgType, channel filt
 	return false
 }
 
-func (f *FilterPitchWheel) Match(packet coremidi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+func (f *FilterPitchWheel) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
 	if len(packet.Data) != 3 || packet.Data[0]&0xF0 != highNibble {
 		return filterinterface.FilterMatchResult_NoMatch, 0
 	}
@@ -0,0 +1,91 @@
+package filterplugin
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"MIDIRouter/wasmplugin"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+type FilterPlugin struct {
+	channel filter.FilterChannel
+	plugin  *wasmplugin.Plugin
+	log     *logger.Logger
+}
+
+type FilterPluginConfig struct {
+	Module string
+}
+
+// Module path is relative to the configuration file directory
+func New(channel filter.FilterChannel, config json.RawMessage, configDir string) (*FilterPlugin, error) {
+	var f FilterPlugin
+	var conf FilterPluginConfig
+
+	f.channel = channel
+	f.log = logger.New(logger.LevelInfo)
+	err := json.Unmarshal([]byte(config), &conf)
+	if err != nil {
+		return nil, errors.New("Failed to parse filter settings :" + err.Error())
+	}
+	if conf.Module == "" {
+		return nil, errors.New("Plugin filter requires a Module")
+	}
+
+	path := conf.Module
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	f.plugin, err = wasmplugin.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if !f.plugin.CanMatch() {
+		f.plugin.Close()
+		return nil, errors.New("Plugin " + path + " does not export a match function")
+	}
+
+	return &f, nil
+}
+
+func (f *FilterPlugin) SetLogger(log *logger.Logger) {
+	f.log = log
+}
+
+// Release the plugin instance
+func (f *FilterPlugin) Close() error {
+	return f.plugin.Close()
+}
+
+func (f *FilterPlugin) String() string {
+	return fmt.Sprintf("Plugin '%s' (channel %s)", filepath.Base(f.plugin.Path()), f.channel.String())
+}
+
+// Channel messages on the rule channel, system messages only when the rule accepts any channel
+func (f *FilterPlugin) QuickMatch(msgType filter.FilterMsgType, channel filter.FilterChannel) bool {
+	if msgType < filter.FilterMsgTypeNoteOff {
+		return false
+	}
+	if f.channel == filter.FilterChannelAny {
+		return true
+	}
+	return (msgType < 0xF) && (f.channel == channel)
+}
+
+func (f *FilterPlugin) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+	value, ok, err := f.plugin.Match(packet.Data)
+	if err != nil {
+		f.log.Error(err)
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	}
+	if !ok {
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	}
+
+	return filterinterface.FilterMatchResult_Match, value
+}
@@ -0,0 +1,83 @@
+package filterprocess
+
+import (
+	"MIDIRouter/childprocess"
+	"MIDIRouter/filter"
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The process answers each request (see childprocess, the value being 0) with
+// the value extracted from the message (2 bytes), or nothing to reject it
+type FilterProcess struct {
+	channel filter.FilterChannel
+	process *childprocess.Process
+	log     *logger.Logger
+}
+
+type FilterProcessConfig = childprocess.Config
+
+// The process is started in the configuration file directory
+func New(channel filter.FilterChannel, settings json.RawMessage, configDir string) (*FilterProcess, error) {
+	var f FilterProcess
+	var conf FilterProcessConfig
+
+	f.channel = channel
+	f.log = logger.New(logger.LevelInfo)
+
+	err := json.Unmarshal([]byte(settings), &conf)
+	if err != nil {
+		return nil, errors.New("Failed to parse filter settings :" + err.Error())
+	}
+	f.process, err = childprocess.Start(conf, configDir)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (f *FilterProcess) SetLogger(log *logger.Logger) {
+	f.log = log
+	f.process.SetLogger(log)
+}
+
+func (f *FilterProcess) String() string {
+	return fmt.Sprintf("Process '%s' (channel %s)", f.process.String(), f.channel.String())
+}
+
+// Channel messages on the rule channel, system messages only when the rule accepts any channel
+func (f *FilterProcess) QuickMatch(msgType filter.FilterMsgType, channel filter.FilterChannel) bool {
+	if msgType < filter.FilterMsgTypeNoteOff {
+		return false
+	}
+	if f.channel == filter.FilterChannelAny {
+		return true
+	}
+	return (msgType < 0xF) && (f.channel == channel)
+}
+
+func (f *FilterProcess) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+	response, err := f.process.Call(0, packet.Data)
+	if err != nil {
+		f.log.Error(err)
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	}
+	switch len(response) {
+	case 0:
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	case 2:
+		return filterinterface.FilterMatchResult_Match, binary.BigEndian.Uint16(response)
+	}
+	f.log.Error("Process " + f.process.String() + ": invalid response, expected a 2 bytes value or nothing")
+	return filterinterface.FilterMatchResult_NoMatch, 0
+}
+
+// Stop the process
+func (f *FilterProcess) Close() error {
+	return f.process.Close()
+}
@@ -3,12 +3,11 @@ package filterprogramchange
 import (
 	"MIDIRouter/filter"
 	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type FilterProgramChange struct {
@@ -74,7 +73,7 @@ func (f *FilterProgramChange) QuickMatch(msgType filter.FilterMsgType, channel f
 	return false
 }
 
-func (f *FilterProgramChange) Match(packet coremidi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+func (f *FilterProgramChange) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
 	if len(packet.Data) != 2 || packet.Data[0]&0xF0 != highNibble {
 		return filterinterface.FilterMatchResult_NoMatch, 0
 	}
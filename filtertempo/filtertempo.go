@@ -0,0 +1,57 @@
+package filtertempo
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/filter"
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
+	"MIDIRouter/tempo"
+	"encoding/json"
+	"sync"
+)
+
+// Measures the tempo of the incoming MIDI clock, matching the clock tick on
+// which the tempo (in BPM) changes. Other ticks do not match.
+type FilterTempo struct {
+	clock   clock.Clock
+	mutex   sync.Mutex
+	tracker tempo.Tracker
+	changes tempo.ChangeDetector
+}
+
+// No settings
+func New(channel filter.FilterChannel, config json.RawMessage) (*FilterTempo, error) {
+	return &FilterTempo{clock: clock.Wall}, nil
+}
+
+// Time source of the ticks, clock.Wall by default
+func (f *FilterTempo) SetClock(c clock.Clock) {
+	f.clock = c
+}
+
+func (f *FilterTempo) String() string {
+	return "Tempo changes"
+}
+
+// Clock ticks decode as type 0xF, "channel" 8
+func (f *FilterTempo) QuickMatch(msgType filter.FilterMsgType, channel filter.FilterChannel) bool {
+	return (msgType == 0xF) && (0xF0|byte(channel) == tempo.ClockTick)
+}
+
+func (f *FilterTempo) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+	if (len(packet.Data) != 1) || (packet.Data[0] != tempo.ClockTick) {
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	}
+
+	now := f.clock.Now()
+	f.tracker.Tick(now)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	bpm, changed := f.changes.Changed(f.tracker.BPM(now))
+	if !changed {
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	}
+	return filterinterface.FilterMatchResult_Match, bpm
+}
@@ -0,0 +1,81 @@
+package filtertransport
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
+	"encoding/json"
+	"errors"
+)
+
+// Matches transport real-time messages: Start, Continue, Stop, or any of them
+type FilterTransport struct {
+	name     string
+	statuses []byte
+}
+
+type FilterTransportConfig struct {
+	Message string // Start, Continue, Stop or * (default)
+}
+
+var messages = map[string][]byte{
+	"Start":    {0xFA},
+	"Continue": {0xFB},
+	"Stop":     {0xFC},
+	"*":        {0xFA, 0xFB, 0xFC},
+}
+
+func New(channel filter.FilterChannel, config json.RawMessage) (*FilterTransport, error) {
+	var f FilterTransport
+	var conf FilterTransportConfig
+
+	if len(config) > 0 {
+		err := json.Unmarshal([]byte(config), &conf)
+		if err != nil {
+			return nil, errors.New("Failed to parse filter settings :" + err.Error())
+		}
+	}
+	if conf.Message == "" {
+		conf.Message = "*"
+	}
+
+	statuses, found := messages[conf.Message]
+	if !found {
+		return nil, errors.New("Invalid transport message '" + conf.Message + "': expected Start, Continue, Stop or *")
+	}
+	f.name = conf.Message
+	f.statuses = statuses
+
+	return &f, nil
+}
+
+func (f *FilterTransport) String() string {
+	if f.name == "*" {
+		return "Transport (Start, Continue, Stop)"
+	}
+	return "Transport " + f.name
+}
+
+// Real-time messages decode as type 0xF, "channel" being the low nibble of the status byte
+func (f *FilterTransport) QuickMatch(msgType filter.FilterMsgType, channel filter.FilterChannel) bool {
+	if msgType != 0xF {
+		return false
+	}
+	return f.accepts(0xF0 | byte(channel))
+}
+
+func (f *FilterTransport) accepts(status byte) bool {
+	for _, s := range f.statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FilterTransport) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+	if (len(packet.Data) != 1) || !f.accepts(packet.Data[0]) {
+		return filterinterface.FilterMatchResult_NoMatch, 0
+	}
+	return filterinterface.FilterMatchResult_Match, 0
+}
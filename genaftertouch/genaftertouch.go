@@ -2,12 +2,11 @@ package genaftertouch
 
 import (
 	"MIDIRouter/filter"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type GenAftertouch struct {
@@ -53,7 +52,7 @@ func New(channel filter.FilterChannel, settings json.RawMessage) (*GenAftertouch
 	return &g, nil
 }
 
-func (g *GenAftertouch) Generate(packet coremidi.Packet, value uint16) (generate coremidi.Packet, err error) {
+func (g *GenAftertouch) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
 	var statusByte byte
 	var pressure byte
 
@@ -79,11 +78,16 @@ func (g *GenAftertouch) Generate(packet coremidi.Packet, value uint16) (generate
 		pressure = g.pressure
 	}
 
-	newPacket := coremidi.NewPacket([]byte{statusByte, pressure}, packet.TimeStamp)
+	newPacket := midi.NewPacket([]byte{statusByte, pressure}, packet.TimeStamp)
 
 	return newPacket, nil
 }
 
+// Largest value the generator can encode
+func (g *GenAftertouch) MaxValue() uint16 {
+	return 127
+}
+
 func (g *GenAftertouch) String() string {
 	str := fmt.Sprintf("Aftertouch (channel %s) ", g.channel.String())
 
@@ -2,12 +2,11 @@ package genchannelpressure
 
 import (
 	"MIDIRouter/filter"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type GenChannelPressure struct {
@@ -53,7 +52,7 @@ func New(channel filter.FilterChannel, settings json.RawMessage) (*GenChannelPre
 	return &g, nil
 }
 
-func (g *GenChannelPressure) Generate(packet coremidi.Packet, value uint16) (generate coremidi.Packet, err error) {
+func (g *GenChannelPressure) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
 	var statusByte byte
 	var pressure byte
 
@@ -79,11 +78,16 @@ func (g *GenChannelPressure) Generate(packet coremidi.Packet, value uint16) (gen
 		pressure = g.pressure
 	}
 
-	newPacket := coremidi.NewPacket([]byte{statusByte, pressure}, packet.TimeStamp)
+	newPacket := midi.NewPacket([]byte{statusByte, pressure}, packet.TimeStamp)
 
 	return newPacket, nil
 }
 
+// Largest value the generator can encode
+func (g *GenChannelPressure) MaxValue() uint16 {
+	return 127
+}
+
 func (g *GenChannelPressure) String() string {
 	str := fmt.Sprintf("ChannelPressure (channel %s) ", g.channel.String())
 	if g.pressureReuse == true {
@@ -0,0 +1,340 @@
+package genclock
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/filter"
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/midi"
+	"MIDIRouter/mtc"
+	"MIDIRouter/tempo"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	statusClock    = 0xF8
+	statusStart    = 0xFA
+	statusContinue = 0xFB
+	statusStop     = 0xFC
+	statusPosition = 0xF2
+
+	maxTickInterval = time.Second // Longer gaps are clock restarts, not tempo
+	mtcTimeout      = 250 * time.Millisecond
+	defaultTempo    = 120.0
+)
+
+// Re-emits incoming clock divided or multiplied. Transport messages are
+// forwarded, Start resetting the phase: the first tick after Start is always
+// sent. Song Position Pointer is scaled along with the clock, and sent again
+// before Continue, so that slaves resume from the right bar. With Reclock,
+// ticks are regenerated from a smoothed estimate of the incoming tempo
+// instead of being sent as they arrive.
+// Incoming MTC quarter frames are converted to clock at Tempo: the clock is
+// located with Song Position Pointer and Continue when the time code starts
+// or jumps, and stopped when it resumes after a pause.
+type GenClock struct {
+	divide   int
+	multiply int
+	tempo    float64
+	reclock  bool
+	clock    clock.Clock
+
+	mutex    sync.Mutex
+	count    int // Ticks received since Start
+	last     time.Time
+	interval time.Duration // Between the last two incoming ticks
+	pll      tempo.PLL
+	offset   time.Duration // Delay of the last tick by the PLL, transport messages are delayed the same
+	later    *scheduler    // Delayed ticks and the messages following them, nil until SetOutput
+
+	mtc       mtc.Decoder
+	mtcLast   time.Time
+	mtcPos    float64 // Last received position, in seconds
+	mtcTicks  int64   // Index of the next tick to send since the song start
+	mtcLocked bool
+}
+
+type GenClockConfig struct {
+	Divide   int
+	Multiply int
+	Tempo    float64
+	Reclock  float64
+}
+
+func New(channel filter.FilterChannel, settings json.RawMessage) (*GenClock, error) {
+	var g GenClock
+	var conf GenClockConfig
+
+	if len(settings) > 0 {
+		err := json.Unmarshal([]byte(settings), &conf)
+		if err != nil {
+			return nil, errors.New("Failed to parse generator settings :" + err.Error())
+		}
+	}
+
+	if conf.Divide == 0 {
+		conf.Divide = 1
+	}
+	if conf.Multiply == 0 {
+		conf.Multiply = 1
+	}
+	if (conf.Divide < 1) || (conf.Multiply < 1) || (conf.Multiply > 96) {
+		return nil, fmt.Errorf("Invalid clock factor: Divide %d, Multiply %d", conf.Divide, conf.Multiply)
+	}
+	if (conf.Divide > 1) && (conf.Multiply > 1) {
+		return nil, errors.New("Clock can be divided or multiplied, not both")
+	}
+	if (conf.Reclock < 0) || (conf.Reclock > 1) {
+		return nil, fmt.Errorf("Invalid clock Reclock %g: expected 0 (off) to 1", conf.Reclock)
+	}
+	if conf.Tempo == 0 {
+		conf.Tempo = defaultTempo
+	}
+	if (conf.Tempo < 20) || (conf.Tempo > 300) {
+		return nil, fmt.Errorf("Invalid clock tempo %g: expected 20 to 300 BPM", conf.Tempo)
+	}
+	g.divide = conf.Divide
+	g.multiply = conf.Multiply
+	g.tempo = conf.Tempo
+	g.reclock = conf.Reclock > 0
+	g.pll.Responsiveness = conf.Reclock
+	g.clock = clock.Wall
+
+	return &g, nil
+}
+
+// Time source of the incoming ticks and of the delayed ones, clock.Wall by
+// default
+func (g *GenClock) SetClock(c clock.Clock) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.clock = c
+	if g.later != nil {
+		g.later.setClock(c)
+	}
+}
+
+// Send the delayed ticks on its own, along with the transport messages
+// following them: they keep their order, and ticks due after Stop are
+// cancelled
+func (g *GenClock) SetOutput(send func(packet midi.Packet)) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.later = &scheduler{send: send, clock: g.clock}
+}
+
+// Cancel the pending ticks
+func (g *GenClock) Close() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.later != nil {
+		g.later.cancel()
+	}
+	return nil
+}
+
+func (g *GenClock) GenerateTimed(packet midi.Packet, value uint16) (generate []generatorinterface.TimedPacket, err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if packet.Data[0] == mtc.QuarterFrame {
+		return g.fromMTC(packet), nil
+	}
+
+	if packet.Data[0] != statusClock {
+		return g.transport(packet), nil
+	}
+
+	now := g.clock.Now()
+	if !g.last.IsZero() && (now.Sub(g.last) < maxTickInterval) {
+		g.interval = now.Sub(g.last)
+	}
+	g.last = now
+
+	var delay time.Duration
+	interval := g.interval
+	if g.reclock {
+		delay = g.pll.Tick(now).Sub(now)
+		interval = g.pll.Period()
+		g.offset = delay
+	}
+
+	tick := g.count
+	g.count++
+	if tick%g.divide != 0 {
+		return nil, nil
+	}
+
+	generate = g.emit(now, delay, packet)
+	if interval > 0 {
+		for i := 1; i < g.multiply; i++ {
+			extra := midi.NewPacket([]byte{statusClock}, 0)
+			generate = append(generate, g.emit(now, delay+interval*time.Duration(i)/time.Duration(g.multiply), extra)...)
+		}
+	}
+	return generate, nil
+}
+
+// Start, Stop, Continue and Song Position Pointer, delayed like the ticks
+// when reclocking so that they stay in order
+func (g *GenClock) transport(packet midi.Packet) []generatorinterface.TimedPacket {
+	now := g.clock.Now()
+	delay := g.offset
+	packets := []midi.Packet{packet}
+
+	switch packet.Data[0] {
+	case statusStart:
+		g.count = 0
+		g.last = time.Time{}
+		g.offset = 0
+		g.pll.Reset()
+	case statusPosition:
+		if len(packet.Data) == 3 {
+			//Song position is in 16th notes, 6 clock ticks each. The divided
+			//clock resumes on the first tick after the locate, on the beat.
+			g.count = (int(packet.Data[1]) | int(packet.Data[2])<<7) * 6
+			g.count -= g.count % g.divide
+			if g.scaled() {
+				packets = []midi.Packet{g.position()}
+			}
+		}
+	case statusContinue:
+		//Slaves start from the position of the scaled clock
+		if g.scaled() {
+			packets = []midi.Packet{g.position(), packet}
+		}
+	}
+
+	if (g.later != nil) && ((packet.Data[0] == statusStart) || (packet.Data[0] == statusStop)) {
+		g.later.cancelAfter(now.Add(delay))
+	}
+	return g.emit(now, delay, packets...)
+}
+
+// Packets sent delay after now: returned to the rule, or scheduled when
+// delayed or following pending messages, so that they keep their order
+func (g *GenClock) emit(now time.Time, delay time.Duration, packets ...midi.Packet) (generate []generatorinterface.TimedPacket) {
+	if (g.later != nil) && ((delay > 0) || !g.later.idle()) {
+		for _, p := range packets {
+			g.later.schedule(p, now.Add(delay))
+		}
+		return nil
+	}
+	for _, p := range packets {
+		generate = append(generate, generatorinterface.TimedPacket{Packet: p, Delay: delay})
+	}
+	return generate
+}
+
+func (g *GenClock) scaled() bool {
+	return (g.divide > 1) || (g.multiply > 1)
+}
+
+// Song Position Pointer of the outgoing clock, rounded down to the 16th note
+func (g *GenClock) position() midi.Packet {
+	ticks := (g.count + g.divide - 1) / g.divide * g.multiply
+	sixteenth := ticks / 6
+	if sixteenth > 0x3FFF {
+		sixteenth = 0x3FFF
+	}
+	return midi.NewPacket([]byte{statusPosition, byte(sixteenth & 0x7F), byte(sixteenth >> 7)}, 0)
+}
+
+// Seconds between two clock ticks at the MTC conversion tempo
+func (g *GenClock) tickDuration() float64 {
+	return 60 / (g.tempo * tempo.ClockTicksPerBeat)
+}
+
+func (g *GenClock) fromMTC(packet midi.Packet) (generate []generatorinterface.TimedPacket) {
+	if len(packet.Data) != 2 {
+		return nil
+	}
+
+	now := g.clock.Now()
+	if g.mtcLocked && (now.Sub(g.mtcLast) > mtcTimeout) {
+		//Time code was paused: stop, and locate again once a full time code is received
+		g.mtcLocked = false
+		g.mtc.Reset()
+		generate = append(generate, g.stop(now)...)
+	}
+	g.mtcLast = now
+
+	position, ok := g.mtc.QuarterFrame(packet.Data[1])
+	if !ok {
+		return generate
+	}
+	quarter := g.mtc.Rate().QuarterFrameDuration()
+	tick := g.tickDuration()
+
+	if g.mtcLocked && math.Abs(position-g.mtcPos-quarter) > 2*quarter {
+		//Jump in time code
+		g.mtcLocked = false
+		generate = append(generate, g.stop(now)...)
+	}
+	g.mtcPos = position
+
+	if !g.mtcLocked {
+		//Song position is in 16th notes (6 ticks): start on the next one
+		sixteenth := int64(math.Ceil(position / tick / 6))
+		if sixteenth > 0x3FFF {
+			return generate
+		}
+		g.mtcTicks = sixteenth * 6
+		g.mtcLocked = true
+		generate = append(generate, g.emit(now, 0,
+			midi.NewPacket([]byte{statusPosition, byte(sixteenth & 0x7F), byte(sixteenth >> 7)}, 0),
+			midi.NewPacket([]byte{statusContinue}, 0))...)
+	}
+
+	//Ticks due before the next quarter frame, delayed from this one
+	for float64(g.mtcTicks)*tick < position+quarter {
+		delay := time.Duration((float64(g.mtcTicks)*tick - position) * float64(time.Second))
+		if delay < 0 {
+			delay = 0
+		}
+		generate = append(generate, g.emit(now, delay, midi.NewPacket([]byte{statusClock}, 0))...)
+		g.mtcTicks++
+	}
+	return generate
+}
+
+// Stop of the clock converted from MTC, cancelling the ticks pending
+func (g *GenClock) stop(now time.Time) []generatorinterface.TimedPacket {
+	if g.later != nil {
+		g.later.cancelAfter(now)
+	}
+	return g.emit(now, 0, midi.NewPacket([]byte{statusStop}, 0))
+}
+
+func (g *GenClock) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
+	timed, err := g.GenerateTimed(packet, value)
+	if err != nil {
+		return packet, err
+	}
+	if len(timed) == 0 {
+		return packet, generatorinterface.ErrNoOutput
+	}
+	return timed[0].Packet, nil
+}
+
+// Largest value the generator can encode
+func (g *GenClock) MaxValue() uint16 {
+	return 127
+}
+
+func (g *GenClock) String() string {
+	if g.reclock {
+		return fmt.Sprintf("Clock re-clocked (responsiveness %g), divided by %d, multiplied by %d", g.pll.Responsiveness, g.divide, g.multiply)
+	}
+	if g.multiply > 1 {
+		return fmt.Sprintf("Clock multiplied by %d", g.multiply)
+	}
+	return fmt.Sprintf("Clock divided by %d", g.divide)
+}
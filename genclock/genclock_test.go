@@ -0,0 +1,43 @@
+package genclock
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/filter"
+	"MIDIRouter/midi"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMultiplyTicksCancelledOnStop(t *testing.T) {
+	g, err := New(filter.FilterChannel1, json.RawMessage(`{"Multiply": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := clock.NewManual(time.Unix(0, 0))
+	var sent []time.Duration
+	g.SetOutput(func(packet midi.Packet) { sent = append(sent, clock.Since(c, time.Unix(0, 0))) })
+	g.SetClock(c)
+
+	tick := midi.NewPacket([]byte{statusClock}, 0)
+	for i := 0; i < 3; i++ {
+		if now, err := g.GenerateTimed(tick, 0); (err != nil) || (len(now) != 1) {
+			t.Fatalf("Tick %d: got %v (%v), expected the tick right away", i, now, err)
+		}
+		c.Advance(20 * time.Millisecond)
+	}
+	//Extra ticks halfway between the incoming ones, once the interval is known
+	if (len(sent) != 2) || (sent[0] != 30*time.Millisecond) || (sent[1] != 50*time.Millisecond) {
+		t.Fatalf("Extra ticks sent at %v, expected [30ms 50ms]", sent)
+	}
+
+	g.GenerateTimed(tick, 0)
+	c.Advance(5 * time.Millisecond)
+	if stop, _ := g.GenerateTimed(midi.NewPacket([]byte{statusStop}, 0), 0); len(stop) != 1 {
+		t.Fatalf("Got %v, expected Stop right away", stop)
+	}
+	c.Advance(time.Second)
+	if len(sent) != 2 {
+		t.Errorf("Extra tick sent after Stop at %v", sent[2:])
+	}
+}
@@ -0,0 +1,116 @@
+package genclock
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/midi"
+	"sync"
+	"time"
+)
+
+// Messages sent later through the rule output, in the order they were
+// scheduled: ticks and transport messages can't overtake each other. Ticks
+// due after a Stop are cancelled, so that none is sent once the clock stopped.
+type scheduler struct {
+	send  func(packet midi.Packet)
+	clock clock.Clock
+
+	mutex sync.Mutex
+	queue []scheduled
+	timer clock.Timer // Fires for the head of the queue, nil if empty
+	armed uint64      // Timers armed, so that a cancelled one firing anyway is ignored
+}
+
+type scheduled struct {
+	packet midi.Packet
+	at     time.Time
+}
+
+// Send packet at the given time, or right after the messages scheduled
+// before it when they are late
+func (s *scheduler) schedule(packet midi.Packet, at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.queue = append(s.queue, scheduled{packet: packet, at: at})
+	if s.timer == nil {
+		s.arm()
+	}
+}
+
+// Pending messages are dropped
+func (s *scheduler) setClock(c clock.Clock) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.queue = nil
+	s.clock = c
+}
+
+// Drop the pending messages
+func (s *scheduler) cancel() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.queue = nil
+}
+
+// Drop the pending messages due after the given time
+func (s *scheduler) cancelAfter(at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	kept := s.queue[:0]
+	for _, m := range s.queue {
+		if !m.at.After(at) {
+			kept = append(kept, m)
+		}
+	}
+	s.queue = kept
+	if (len(s.queue) == 0) && (s.timer != nil) {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// Whether no message is pending
+func (s *scheduler) idle() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.queue) == 0
+}
+
+func (s *scheduler) arm() {
+	s.armed++
+	armed := s.armed
+	s.timer = s.clock.AfterFunc(clock.Until(s.clock, s.queue[0].at), func() { s.run(armed) })
+}
+
+// Send the messages due, then wait for the next one. Messages are sent with
+// the mutex held: a cancelled message is never sent.
+func (s *scheduler) run(armed uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if (s.timer == nil) || (armed != s.armed) {
+		//Cancelled
+		return
+	}
+	now := s.clock.Now()
+	for (len(s.queue) > 0) && !s.queue[0].at.After(now) {
+		s.send(s.queue[0].packet)
+		s.queue = s.queue[1:]
+	}
+	s.timer = nil
+	if len(s.queue) > 0 {
+		s.arm()
+	}
+}
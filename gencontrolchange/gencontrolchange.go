@@ -2,12 +2,11 @@ package gencontrolchange
 
 import (
 	"MIDIRouter/filter"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type ControlChangeMode uint8
@@ -27,7 +26,7 @@ type GenControlChange struct {
 
 	valueReuse   bool
 	valueReplace bool
-	value        uint8
+	value        uint16
 }
 
 type FilterControlChangeConfig struct {
@@ -66,7 +65,9 @@ func New(channel filter.FilterChannel, settings json.RawMessage) (*GenControlCha
 		if err != nil {
 			return nil, err
 		}
-		if value > 127 {
+		if (g.mode == controlChangeModeStandard) && (value > 127) {
+			return nil, fmt.Errorf("Invalid controllerNumber value: %s", conf.ControllerNumber)
+		} else if (g.mode == controlChangeModeCCAh) && (value > 31) {
 			return nil, fmt.Errorf("Invalid controllerNumber value: %s", conf.ControllerNumber)
 		}
 		g.controllerNumber = uint8(value)
@@ -75,11 +76,14 @@ func New(channel filter.FilterChannel, settings json.RawMessage) (*GenControlCha
 	g.valueReuse = false
 	g.valueReplace = false
 	if conf.Value == "*" {
+		if g.mode == controlChangeModeCCAh {
+			return nil, errors.New("Cannot reuse original value in CCAh mode, use '$' instead")
+		}
 		g.valueReuse = true
 	} else if conf.Value == "$" {
 		g.valueReplace = true
 	} else {
-		value, err := strconv.ParseUint(conf.Value, 10, 8)
+		value, err := strconv.ParseUint(conf.Value, 10, 16)
 		if err != nil {
 			return nil, err
 		}
@@ -89,23 +93,41 @@ func New(channel filter.FilterChannel, settings json.RawMessage) (*GenControlCha
 		} else if (g.mode == controlChangeModeCCAh) && (value > 16383) {
 			return nil, fmt.Errorf("Invalid value: %s", conf.Value)
 		}
-		g.value = uint8(value)
+		g.value = uint16(value)
 	}
 
 	return &g, nil
 }
 
-func (g *GenControlChange) Generate(packet coremidi.Packet, value uint16) (generate coremidi.Packet, err error) {
+func (g *GenControlChange) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
 	if g.mode == controlChangeModeStandard {
 		return g.generateStandard(packet, value)
 	} else if g.mode == controlChangeModeCCAh {
-		return g.generateCCAh(packet, value)
+		//Both messages in a single packet
+		packets, err := g.generateCCAh(packet, value)
+		if err != nil {
+			return packet, err
+		}
+		data := append(append([]byte{}, packets[0].Data...), packets[1].Data...)
+		return midi.NewPacket(data, packet.TimeStamp), nil
 	}
 
 	return packet, errors.New("Invalid generate mode")
 }
 
-func (g *GenControlChange) generateStandard(packet coremidi.Packet, value uint16) (generate coremidi.Packet, err error) {
+func (g *GenControlChange) GenerateMulti(packet midi.Packet, value uint16) (generate []midi.Packet, err error) {
+	if g.mode == controlChangeModeCCAh {
+		return g.generateCCAh(packet, value)
+	}
+
+	newPacket, err := g.Generate(packet, value)
+	if err != nil {
+		return nil, err
+	}
+	return []midi.Packet{newPacket}, nil
+}
+
+func (g *GenControlChange) generateStandard(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
 	var statusByte byte
 	var controllerNumber byte
 	var newValue byte
@@ -137,19 +159,62 @@ func (g *GenControlChange) generateStandard(packet coremidi.Packet, value uint16
 	} else if g.valueReplace == true {
 		newValue = byte(value & 0xFF)
 	} else {
-		newValue = g.value
+		newValue = byte(g.value)
 	}
 
-	newPacket := coremidi.NewPacket([]byte{statusByte, controllerNumber, newValue}, packet.TimeStamp)
+	newPacket := midi.NewPacket([]byte{statusByte, controllerNumber, newValue}, packet.TimeStamp)
 
 	return newPacket, nil
 }
 
-func (g *GenControlChange) generateCCAh(packet coremidi.Packet, value uint16) (generate coremidi.Packet, err error) {
+func (g *GenControlChange) generateCCAh(packet midi.Packet, value uint16) (generate []midi.Packet, err error) {
+	var statusByte byte
+	var controllerNumber byte
+	var newValue uint16
 
-	// We need to return 2 packets
-	// On reuse value, we only have the last message value
-	return packet, errors.New("Not implemented")
+	filteredMsgType := (packet.Data[0] >> 4)
+	filteredChannel := (packet.Data[0] & 0x0F)
+
+	if g.channel == filter.FilterChannelAny {
+		statusByte = byte(filter.FilterMsgTypeControlChange<<4 | filteredChannel)
+	} else {
+		statusByte = byte(filter.FilterMsgTypeControlChange<<4 | g.channel)
+	}
+
+	if (g.controllerNumberReuse == true) && (filteredMsgType != filter.FilterMsgTypeControlChange) {
+		return nil, errors.New("Cannot generate MIDI message with same ControllerNumber, filtered message is of distinct type")
+	}
+
+	if g.controllerNumberReuse == true {
+		controllerNumber = packet.Data[1]
+	} else if g.controllerNumberReplace == true {
+		controllerNumber = byte(value & 0xFF)
+	} else {
+		controllerNumber = g.controllerNumber
+	}
+	if controllerNumber > 31 {
+		return nil, fmt.Errorf("Invalid CCAh controller number: %d", controllerNumber)
+	}
+
+	if g.valueReplace == true {
+		newValue = value & 0x3FFF
+	} else {
+		newValue = g.value
+	}
+
+	//First message: MSB on controller number, second one: LSB on controller number + 0x20
+	msb := midi.NewPacket([]byte{statusByte, controllerNumber, byte(newValue >> 7)}, packet.TimeStamp)
+	lsb := midi.NewPacket([]byte{statusByte, controllerNumber + 0x20, byte(newValue & 0x7F)}, packet.TimeStamp)
+
+	return []midi.Packet{msb, lsb}, nil
+}
+
+// Largest value the generator can encode
+func (g *GenControlChange) MaxValue() uint16 {
+	if g.mode == controlChangeModeCCAh {
+		return 16383
+	}
+	return 127
 }
 
 func (g *GenControlChange) String() string {
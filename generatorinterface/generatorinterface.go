@@ -1,8 +1,77 @@
 package generatorinterface
 
-import "github.com/youpy/go-coremidi"
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Returned by generators deciding not to send anything for a filtered message:
+// the message is dropped instead of being forwarded unchanged.
+var ErrNoOutput = errors.New("Generator produced no message")
 
 type GeneratorInterface interface {
-	Generate(packet coremidi.Packet, value uint16) (generate coremidi.Packet, err error)
+	Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error)
+	MaxValue() uint16 // Largest value that can be encoded (127 for 7 bits messages)
 	String() string
 }
+
+// Optional interface for generators emitting several MIDI messages per match
+// (e.g. CCAh MSB/LSB pairs). Messages are returned in sending order.
+type MultiGeneratorInterface interface {
+	GenerateMulti(packet midi.Packet, value uint16) (generate []midi.Packet, err error)
+}
+
+// A generated message to be sent Delay after the filtered message
+type TimedPacket struct {
+	Packet midi.Packet
+	Delay  time.Duration
+}
+
+// Optional interface for generators spreading messages over time (e.g. clock
+// multiplication). Messages without delay are sent right away, used instead
+// of Generate.
+type TimedGeneratorInterface interface {
+	GenerateTimed(packet midi.Packet, value uint16) (generate []TimedPacket, err error)
+}
+
+// Optional interface for generators reading router variables (see
+// router.SetVariable). The function returns a copy of all variables.
+type VariablesGeneratorInterface interface {
+	SetVariables(vars func() map[string]interface{})
+}
+
+// Optional interface for generators logging on their own (e.g. a process
+// restarted), with the logger of their router
+type LoggerGeneratorInterface interface {
+	SetLogger(log *logger.Logger)
+}
+
+// Optional interface for generators holding resources (child processes,
+// plugins), closed when their rule is dropped or the router stops
+type CloserGeneratorInterface interface {
+	Close() error
+}
+
+// Optional interface for generators using random numbers (humanized notes),
+// given the random source of their rule so that runs can be reproduced
+type RandomGeneratorInterface interface {
+	SetRand(rng *rand.Rand)
+}
+
+// Optional interface for generators timing messages on their own (e.g. clock
+// ticks), with the time source of their rule, so that replays run with a
+// manual clock are deterministic
+type ClockGeneratorInterface interface {
+	SetClock(c clock.Clock)
+}
+
+// Optional interface for generators sending messages later on their own,
+// rather than as TimedPacket, so that they can cancel them (e.g. clock ticks
+// pending on Stop). send pushes a packet to the output of the rule.
+type OutputGeneratorInterface interface {
+	SetOutput(send func(packet midi.Packet))
+}
@@ -0,0 +1,105 @@
+package genmacro
+
+import (
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/gensysex"
+	"MIDIRouter/midi"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sends a sequence of timed messages, e.g. a whole synth patch set up by a
+// single button press. Messages are templates, as SysEx templates, so that
+// they can use the filtered message and its value.
+type GenMacro struct {
+	name  string
+	steps []step
+}
+
+type step struct {
+	at      time.Duration // Delay from the filtered message
+	message *gensysex.MessageTemplate
+}
+
+type GenMacroConfig struct {
+	Name  string // Macro name, for logs
+	Steps []StepConfig
+}
+
+type StepConfig struct {
+	AtMs    int    // Delay from the filtered message, in milliseconds
+	Message string // Hex bytes and {expression} placeholders, e.g. "B0 07 {value}"
+}
+
+func New(settings json.RawMessage) (*GenMacro, error) {
+	var g GenMacro
+	var conf GenMacroConfig
+
+	err := json.Unmarshal([]byte(settings), &conf)
+	if err != nil {
+		return nil, errors.New("Failed to parse generator settings :" + err.Error())
+	}
+	if len(conf.Steps) == 0 {
+		return nil, errors.New("Macro '" + conf.Name + "' has no steps")
+	}
+
+	g.name = conf.Name
+	for _, s := range conf.Steps {
+		if s.AtMs < 0 {
+			return nil, fmt.Errorf("Macro '%s': invalid delay %dms", conf.Name, s.AtMs)
+		}
+		message, err := gensysex.NewMessageTemplate(s.Message)
+		if err != nil {
+			return nil, errors.New("Macro '" + conf.Name + "': " + err.Error())
+		}
+		g.steps = append(g.steps, step{at: time.Duration(s.AtMs) * time.Millisecond, message: message})
+	}
+
+	return &g, nil
+}
+
+func (g *GenMacro) GenerateTimed(packet midi.Packet, value uint16) ([]generatorinterface.TimedPacket, error) {
+	var timed []generatorinterface.TimedPacket
+
+	for _, s := range g.steps {
+		data, err := s.message.Render(packet.Data, value)
+		if err != nil {
+			return nil, errors.New("Macro '" + g.name + "': " + err.Error())
+		}
+		timed = append(timed, generatorinterface.TimedPacket{Packet: midi.NewPacket(data, packet.TimeStamp), Delay: s.at})
+	}
+	return timed, nil
+}
+
+// First message of the macro, use GenerateTimed
+func (g *GenMacro) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
+	data, err := g.steps[0].message.Render(packet.Data, value)
+	if err != nil {
+		return packet, err
+	}
+	return midi.NewPacket(data, packet.TimeStamp), nil
+}
+
+// Router variables, readable from messages as vars.name
+func (g *GenMacro) SetVariables(vars func() map[string]interface{}) {
+	for _, s := range g.steps {
+		s.message.SetVariables(vars)
+	}
+}
+
+// Values are checked by placeholders
+func (g *GenMacro) MaxValue() uint16 {
+	return 0xFFFF
+}
+
+func (g *GenMacro) String() string {
+	var length time.Duration
+	for _, s := range g.steps {
+		if s.at > length {
+			length = s.at
+		}
+	}
+	return fmt.Sprintf("Macro '%s' / %d messages over %dms", g.name, len(g.steps), length.Milliseconds())
+}
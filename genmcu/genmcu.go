@@ -0,0 +1,144 @@
+package genmcu
+
+import (
+	"MIDIRouter/midi"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+type Control uint8
+
+const (
+	ControlFader   Control = iota // Motorized fader position
+	ControlLEDRing Control = iota // V-Pot LED ring
+)
+
+const (
+	ledRingController = 0x30
+	faderStrips       = 9
+	vpotStrips        = 8
+)
+
+// LED ring display modes, and the number of positions they show
+var ringModes = map[string]struct {
+	mode      uint8
+	positions uint8
+}{
+	"Dot":      {0, 11},
+	"BoostCut": {1, 11},
+	"Wrap":     {2, 11},
+	"Spread":   {3, 6},
+}
+
+// Feedback to Mackie Control (MCU) surfaces: moves motorized faders (Pitch
+// Wheel on the strip channel) and lights V-Pot LED rings (Control Change
+// 48-55 on channel 1) from the transformed value
+type GenMCU struct {
+	control  Control
+	stripAny bool
+	strip    uint8 // 0 based
+
+	ring      string
+	mode      uint8
+	positions uint8
+	center    bool
+}
+
+type GenMCUConfig struct {
+	Control string // Fader or LED Ring
+	Strip   string // 1-8 (9 for the master fader), or * for the channel of the filtered message
+	Ring    string // LED ring mode: Dot (default), BoostCut, Wrap or Spread
+	Center  bool   // Light the LED below the ring
+}
+
+func New(settings json.RawMessage) (*GenMCU, error) {
+	var g GenMCU
+	var conf GenMCUConfig
+
+	err := json.Unmarshal([]byte(settings), &conf)
+	if err != nil {
+		return nil, errors.New("Failed to parse generator settings :" + err.Error())
+	}
+
+	strips := faderStrips
+	switch conf.Control {
+	case "Fader":
+		g.control = ControlFader
+	case "LED Ring":
+		g.control = ControlLEDRing
+		strips = vpotStrips
+		if conf.Ring == "" {
+			conf.Ring = "Dot"
+		}
+		ring, found := ringModes[conf.Ring]
+		if !found {
+			return nil, errors.New("Invalid LED ring mode '" + conf.Ring + "': expected Dot, BoostCut, Wrap or Spread")
+		}
+		g.ring, g.mode, g.positions = conf.Ring, ring.mode, ring.positions
+		g.center = conf.Center
+	default:
+		return nil, errors.New("Invalid MCU control '" + conf.Control + "': expected Fader or LED Ring")
+	}
+
+	if conf.Strip == "*" {
+		g.stripAny = true
+	} else {
+		value, err := strconv.ParseUint(conf.Strip, 10, 8)
+		if (err != nil) || (value < 1) || (int(value) > strips) {
+			return nil, fmt.Errorf("Invalid MCU strip: %s", conf.Strip)
+		}
+		g.strip = uint8(value - 1)
+	}
+
+	return &g, nil
+}
+
+func (g *GenMCU) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
+	strip := g.strip
+	if g.stripAny {
+		strip = packet.Data[0] & 0x0F
+	}
+
+	if g.control == ControlFader {
+		if strip >= faderStrips {
+			return packet, fmt.Errorf("Cannot generate MCU fader message for channel %d", strip+1)
+		}
+		return midi.NewPacket([]byte{0xE0 | strip, byte(value & 0x7F), byte((value >> 7) & 0x7F)}, packet.TimeStamp), nil
+	}
+
+	if strip >= vpotStrips {
+		return packet, fmt.Errorf("Cannot generate MCU LED ring message for channel %d", strip+1)
+	}
+	//Positions from 1 (value 0) to the last LED of the mode (value 127)
+	position := 1 + uint8((uint32(value)*uint32(g.positions-1)+63)/127)
+	data := g.mode<<4 | position
+	if g.center {
+		data |= 0x40
+	}
+	return midi.NewPacket([]byte{0xB0, ledRingController + strip, data}, packet.TimeStamp), nil
+}
+
+// Largest value the generator can encode
+func (g *GenMCU) MaxValue() uint16 {
+	if g.control == ControlFader {
+		return 16383
+	}
+	return 127
+}
+
+func (g *GenMCU) String() string {
+	strip := "strip of filtered channel"
+	if !g.stripAny {
+		strip = fmt.Sprintf("strip %d", g.strip+1)
+	}
+	if g.control == ControlFader {
+		return "MCU fader (" + strip + ") / set position to transformed value"
+	}
+	str := "MCU LED ring (" + strip + ") / " + g.ring + " mode"
+	if g.center {
+		str += ", center LED"
+	}
+	return str + " / set position to transformed value"
+}
@@ -0,0 +1,160 @@
+package genmtc
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/midi"
+	"MIDIRouter/mtc"
+	"MIDIRouter/tempo"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	statusPosition = 0xF2
+	statusStart    = 0xFA
+	statusContinue = 0xFB
+	statusStop     = 0xFC
+
+	defaultTempo = 120.0
+)
+
+// Converts incoming MIDI clock into MIDI Time Code at a fixed tempo. Start and
+// Song Position Pointer locate the time code (a Full Frame message is sent on
+// Start and Continue), quarter frames are then sent while the clock runs,
+// spread between incoming ticks.
+type GenMTC struct {
+	tempo float64
+	rate  mtc.Rate
+
+	mutex   sync.Mutex
+	running bool
+	ticks   int64 // Clock ticks since the song start
+	next    int64 // Index of the next quarter frame since the song start
+}
+
+type GenMTCConfig struct {
+	Tempo     float64
+	FrameRate string
+}
+
+func New(channel filter.FilterChannel, settings json.RawMessage) (*GenMTC, error) {
+	var g GenMTC
+	var conf GenMTCConfig
+
+	if len(settings) > 0 {
+		err := json.Unmarshal([]byte(settings), &conf)
+		if err != nil {
+			return nil, errors.New("Failed to parse generator settings :" + err.Error())
+		}
+	}
+
+	if conf.Tempo == 0 {
+		conf.Tempo = defaultTempo
+	}
+	if (conf.Tempo < 20) || (conf.Tempo > 300) {
+		return nil, fmt.Errorf("Invalid MTC tempo %g: expected 20 to 300 BPM", conf.Tempo)
+	}
+	rate, err := mtc.ParseRate(conf.FrameRate)
+	if err != nil {
+		return nil, err
+	}
+	g.tempo = conf.Tempo
+	g.rate = rate
+
+	return &g, nil
+}
+
+// Position in seconds of a clock tick
+func (g *GenMTC) seconds(ticks int64) float64 {
+	return float64(ticks) * 60 / (g.tempo * tempo.ClockTicksPerBeat)
+}
+
+// Moves to a clock position, the next quarter frame starting a new time code
+func (g *GenMTC) locate(ticks int64) {
+	g.ticks = ticks
+	frames := g.seconds(ticks) / g.rate.QuarterFrameDuration()
+	g.next = int64(math.Ceil(frames/8-1e-9)) * 8
+}
+
+func (g *GenMTC) fullFrame() []generatorinterface.TimedPacket {
+	data := mtc.FullFrame(g.seconds(g.ticks), g.rate)
+	return []generatorinterface.TimedPacket{{Packet: midi.NewPacket(data, 0)}}
+}
+
+func (g *GenMTC) GenerateTimed(packet midi.Packet, value uint16) (generate []generatorinterface.TimedPacket, err error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	switch packet.Data[0] {
+	case statusStart:
+		g.locate(0)
+		g.running = true
+		return g.fullFrame(), nil
+	case statusContinue:
+		g.running = true
+		return g.fullFrame(), nil
+	case statusStop:
+		g.running = false
+		return nil, nil
+	case statusPosition:
+		if len(packet.Data) == 3 {
+			//Song position is in 16th notes, 6 clock ticks each
+			g.locate((int64(packet.Data[1]) | int64(packet.Data[2])<<7) * 6)
+		}
+		return nil, nil
+	case tempo.ClockTick:
+	default:
+		return nil, nil
+	}
+
+	if !g.running {
+		return nil, nil
+	}
+
+	//Quarter frames due before the next tick, delayed from this one
+	now := g.seconds(g.ticks)
+	g.ticks++
+	end := g.seconds(g.ticks)
+	quarter := g.rate.QuarterFrameDuration()
+	for float64(g.next)*quarter < end {
+		piece := int(g.next % 8)
+		at := float64(g.next) * quarter
+		cycle := float64(g.next-int64(piece)) * quarter
+
+		delay := time.Duration((at - now) * float64(time.Second))
+		if delay < 0 {
+			delay = 0
+		}
+		generate = append(generate, generatorinterface.TimedPacket{
+			Packet: midi.NewPacket([]byte{mtc.QuarterFrame, mtc.QuarterFrameData(piece, cycle, g.rate)}, 0),
+			Delay:  delay,
+		})
+		g.next++
+	}
+	return generate, nil
+}
+
+func (g *GenMTC) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
+	timed, err := g.GenerateTimed(packet, value)
+	if err != nil {
+		return packet, err
+	}
+	if len(timed) == 0 {
+		return packet, generatorinterface.ErrNoOutput
+	}
+	return timed[0].Packet, nil
+}
+
+// Largest value the generator can encode
+func (g *GenMTC) MaxValue() uint16 {
+	return 127
+}
+
+func (g *GenMTC) String() string {
+	return fmt.Sprintf("MTC at %s fps from clock at %g BPM", g.rate, g.tempo)
+}
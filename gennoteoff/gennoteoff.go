@@ -2,12 +2,11 @@ package gennoteoff
 
 import (
 	"MIDIRouter/filter"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type GenNoteOff struct {
@@ -75,7 +74,7 @@ func New(channel filter.FilterChannel, settings json.RawMessage) (*GenNoteOff, e
 	return &g, nil
 }
 
-func (g *GenNoteOff) Generate(packet coremidi.Packet, value uint16) (generate coremidi.Packet, err error) {
+func (g *GenNoteOff) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
 	var statusByte byte
 	var note byte
 	var velocity byte
@@ -112,11 +111,16 @@ func (g *GenNoteOff) Generate(packet coremidi.Packet, value uint16) (generate co
 		velocity = g.velocity
 	}
 
-	newPacket := coremidi.NewPacket([]byte{statusByte, note, velocity}, packet.TimeStamp)
+	newPacket := midi.NewPacket([]byte{statusByte, note, velocity}, packet.TimeStamp)
 
 	return newPacket, nil
 }
 
+// Largest value the generator can encode
+func (g *GenNoteOff) MaxValue() uint16 {
+	return 127
+}
+
 func (g *GenNoteOff) String() string {
 	str := fmt.Sprintf("NoteOff (channel %s) ", g.channel.String())
 
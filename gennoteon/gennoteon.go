@@ -2,12 +2,15 @@ package gennoteon
 
 import (
 	"MIDIRouter/filter"
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
+	"sync"
+	"time"
 )
 
 type GenNoteOn struct {
@@ -20,11 +23,23 @@ type GenNoteOn struct {
 	velocityReuse   bool
 	velocityReplace bool
 	velocity        uint8
+
+	humanizeVelocity int           // Random velocity change, up to ± this value
+	humanizeTiming   time.Duration // Random delay, up to this duration
+	mutex            sync.Mutex
+	rng              *rand.Rand
 }
 
 type FilterNoteOnConfig struct {
 	Note     string
 	Velocity string
+	Humanize *HumanizeConfig `json:"Humanize,omitempty"`
+}
+
+// Random variations making programmed notes sound less mechanical
+type HumanizeConfig struct {
+	Velocity int // Velocity changed by up to ± Velocity (result kept in 1-127)
+	TimingMs int // Notes delayed by up to TimingMs milliseconds
 }
 
 func New(channel filter.FilterChannel, settings json.RawMessage) (*GenNoteOn, error) {
@@ -71,10 +86,29 @@ func New(channel filter.FilterChannel, settings json.RawMessage) (*GenNoteOn, er
 		g.velocity = uint8(value)
 	}
 
+	if conf.Humanize != nil {
+		if (conf.Humanize.Velocity < 0) || (conf.Humanize.Velocity > 127) {
+			return nil, fmt.Errorf("Invalid humanize velocity: %d", conf.Humanize.Velocity)
+		}
+		if (conf.Humanize.TimingMs < 0) || (conf.Humanize.TimingMs > 1000) {
+			return nil, fmt.Errorf("Invalid humanize timing: %dms", conf.Humanize.TimingMs)
+		}
+		g.humanizeVelocity = conf.Humanize.Velocity
+		g.humanizeTiming = time.Duration(conf.Humanize.TimingMs) * time.Millisecond
+		g.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
 	return &g, nil
 }
 
-func (g *GenNoteOn) Generate(packet coremidi.Packet, value uint16) (generate coremidi.Packet, err error) {
+// Use the random source of the rule, seedable for reproducible runs
+func (g *GenNoteOn) SetRand(rng *rand.Rand) {
+	g.mutex.Lock()
+	g.rng = rng
+	g.mutex.Unlock()
+}
+
+func (g *GenNoteOn) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
 	var statusByte byte
 	var note byte
 	var velocity byte
@@ -111,11 +145,49 @@ func (g *GenNoteOn) Generate(packet coremidi.Packet, value uint16) (generate cor
 		velocity = g.velocity
 	}
 
-	newPacket := coremidi.NewPacket([]byte{statusByte, note, velocity}, packet.TimeStamp)
+	//Velocity 0 is a Note Off, left as is
+	if (g.humanizeVelocity > 0) && (velocity > 0) {
+		velocity = g.humanize(velocity)
+	}
+
+	newPacket := midi.NewPacket([]byte{statusByte, note, velocity}, packet.TimeStamp)
 
 	return newPacket, nil
 }
 
+func (g *GenNoteOn) humanize(velocity byte) byte {
+	g.mutex.Lock()
+	v := int(velocity) + g.rng.Intn(2*g.humanizeVelocity+1) - g.humanizeVelocity
+	g.mutex.Unlock()
+
+	if v < 1 {
+		return 1
+	} else if v > 127 {
+		return 127
+	}
+	return byte(v)
+}
+
+// Note On delayed at random when timing is humanized
+func (g *GenNoteOn) GenerateTimed(packet midi.Packet, value uint16) ([]generatorinterface.TimedPacket, error) {
+	newPacket, err := g.Generate(packet, value)
+	if err != nil {
+		return nil, err
+	}
+	var delay time.Duration
+	if g.humanizeTiming > 0 {
+		g.mutex.Lock()
+		delay = time.Duration(g.rng.Int63n(int64(g.humanizeTiming) + 1))
+		g.mutex.Unlock()
+	}
+	return []generatorinterface.TimedPacket{{Packet: newPacket, Delay: delay}}, nil
+}
+
+// Largest value the generator can encode
+func (g *GenNoteOn) MaxValue() uint16 {
+	return 127
+}
+
 func (g *GenNoteOn) String() string {
 	str := fmt.Sprintf("NoteOn (channel %s) ", g.channel.String())
 
@@ -135,5 +207,9 @@ func (g *GenNoteOn) String() string {
 		str += fmt.Sprintf(" / set velocity to %d", g.velocity)
 	}
 
+	if (g.humanizeVelocity > 0) || (g.humanizeTiming > 0) {
+		str += fmt.Sprintf(" / humanize velocity ±%d, timing %v", g.humanizeVelocity, g.humanizeTiming)
+	}
+
 	return str
 }
@@ -2,12 +2,11 @@ package genpitchwheel
 
 import (
 	"MIDIRouter/filter"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type GenPitchWheel struct {
@@ -53,7 +52,7 @@ func New(channel filter.FilterChannel, settings json.RawMessage) (*GenPitchWheel
 	return &g, nil
 }
 
-func (g *GenPitchWheel) Generate(packet coremidi.Packet, value uint16) (generate coremidi.Packet, err error) {
+func (g *GenPitchWheel) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
 	var statusByte byte
 	var pitchLSB byte
 	var pitchMSB byte
@@ -76,19 +75,24 @@ func (g *GenPitchWheel) Generate(packet coremidi.Packet, value uint16) (generate
 		pitchLSB = packet.Data[1]
 		pitchMSB = packet.Data[2]
 	} else if g.pitchReplace == true {
-		//Encode 16bits value into two 7bits
+		//Encode 14bits value into two 7bits
 		pitchLSB = byte(value & 0x7F)
-		pitchMSB = byte(value >> 7)
+		pitchMSB = byte((value >> 7) & 0x7F)
 	} else {
 		pitchLSB = byte(g.pitch & 0x7F)
 		pitchMSB = byte(g.pitch >> 7)
 	}
 
-	newPacket := coremidi.NewPacket([]byte{statusByte, pitchLSB, pitchMSB}, packet.TimeStamp)
+	newPacket := midi.NewPacket([]byte{statusByte, pitchLSB, pitchMSB}, packet.TimeStamp)
 
 	return newPacket, nil
 }
 
+// Largest value the generator can encode
+func (g *GenPitchWheel) MaxValue() uint16 {
+	return 16383
+}
+
 func (g *GenPitchWheel) String() string {
 	str := fmt.Sprintf("PitchBend (channel %s) ", g.channel.String())
 
@@ -0,0 +1,86 @@
+package genplugin
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/midi"
+	"MIDIRouter/wasmplugin"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+type GenPlugin struct {
+	channel filter.FilterChannel
+	plugin  *wasmplugin.Plugin
+}
+
+type GenPluginConfig struct {
+	Module string
+}
+
+// Module path is relative to the configuration file directory
+func New(channel filter.FilterChannel, settings json.RawMessage, configDir string) (*GenPlugin, error) {
+	var g GenPlugin
+	var conf GenPluginConfig
+
+	g.channel = channel
+
+	err := json.Unmarshal([]byte(settings), &conf)
+	if err != nil {
+		return nil, errors.New("Failed to parse generator settings :" + err.Error())
+	}
+	if conf.Module == "" {
+		return nil, errors.New("Plugin generator requires a Module")
+	}
+
+	path := conf.Module
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	g.plugin, err = wasmplugin.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if !g.plugin.CanGenerate() {
+		g.plugin.Close()
+		return nil, errors.New("Plugin " + path + " does not export a generate function")
+	}
+
+	return &g, nil
+}
+
+func (g *GenPlugin) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
+	data, err := g.plugin.Generate(packet.Data, value)
+	if err != nil {
+		return packet, err
+	}
+	if len(data) == 0 {
+		return packet, errors.New("Plugin " + g.plugin.Path() + " generated no message")
+	}
+
+	//Move channel messages to the generator channel if one is set
+	if g.channel != filter.FilterChannelAny {
+		for i, b := range data {
+			if (b >= 0x80) && (b < 0xF0) {
+				data[i] = (b & 0xF0) | byte(g.channel)
+			}
+		}
+	}
+
+	return midi.NewPacket(data, packet.TimeStamp), nil
+}
+
+// Release the plugin instance
+func (g *GenPlugin) Close() error {
+	return g.plugin.Close()
+}
+
+// Largest value the generator can encode
+func (g *GenPlugin) MaxValue() uint16 {
+	return 0xFFFF
+}
+
+func (g *GenPlugin) String() string {
+	return fmt.Sprintf("Plugin '%s' (channel %s)", filepath.Base(g.plugin.Path()), g.channel.String())
+}
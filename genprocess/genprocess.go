@@ -0,0 +1,76 @@
+package genprocess
+
+import (
+	"MIDIRouter/childprocess"
+	"MIDIRouter/filter"
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The process answers each request (see childprocess) with the bytes to send:
+// any number of MIDI messages, an empty response dropping the message
+type GenProcess struct {
+	channel filter.FilterChannel
+	process *childprocess.Process
+}
+
+type GenProcessConfig = childprocess.Config
+
+// The process is started in the configuration file directory
+func New(channel filter.FilterChannel, settings json.RawMessage, configDir string) (*GenProcess, error) {
+	var g GenProcess
+	var conf GenProcessConfig
+
+	g.channel = channel
+
+	err := json.Unmarshal([]byte(settings), &conf)
+	if err != nil {
+		return nil, errors.New("Failed to parse generator settings :" + err.Error())
+	}
+	g.process, err = childprocess.Start(conf, configDir)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (g *GenProcess) SetLogger(log *logger.Logger) {
+	g.process.SetLogger(log)
+}
+
+func (g *GenProcess) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
+	data, err := g.process.Call(value, packet.Data)
+	if err != nil {
+		return packet, err
+	}
+	if len(data) == 0 {
+		return packet, generatorinterface.ErrNoOutput
+	}
+	//Move channel messages to the generator channel if one is set
+	if g.channel != filter.FilterChannelAny {
+		for i, b := range data {
+			if (b >= 0x80) && (b < 0xF0) {
+				data[i] = (b & 0xF0) | byte(g.channel)
+			}
+		}
+	}
+	return midi.NewPacket(data, packet.TimeStamp), nil
+}
+
+// Stop the process
+func (g *GenProcess) Close() error {
+	return g.process.Close()
+}
+
+// Largest value the generator can encode
+func (g *GenProcess) MaxValue() uint16 {
+	return 0xFFFF
+}
+
+func (g *GenProcess) String() string {
+	return fmt.Sprintf("Process '%s' (channel %s)", g.process.String(), g.channel.String())
+}
@@ -2,12 +2,11 @@ package genprogramchange
 
 import (
 	"MIDIRouter/filter"
+	"MIDIRouter/midi"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type GenProgramChange struct {
@@ -16,10 +15,15 @@ type GenProgramChange struct {
 	programNumberReuse   bool
 	programNumberReplace bool
 	programNumber        uint8
+
+	offset int  // Added to the program number
+	wrap   bool // Out of range program numbers wrap around instead of being clamped
 }
 
 type FilterProgramChangeConfig struct {
 	ProgramNumber string
+	Offset        int    // -127 to 127, e.g. 1 for synths numbering patches from 1
+	Overflow      string // Clamp (default) or Wrap
 }
 
 func New(channel filter.FilterChannel, settings json.RawMessage) (*GenProgramChange, error) {
@@ -50,10 +54,22 @@ func New(channel filter.FilterChannel, settings json.RawMessage) (*GenProgramCha
 		g.programNumber = uint8(value)
 	}
 
+	if (conf.Offset < -127) || (conf.Offset > 127) {
+		return nil, fmt.Errorf("Invalid program Offset: %d, expected -127 to 127", conf.Offset)
+	}
+	g.offset = conf.Offset
+	switch conf.Overflow {
+	case "", "Clamp":
+	case "Wrap":
+		g.wrap = true
+	default:
+		return nil, errors.New("Invalid program Overflow '" + conf.Overflow + "': expected Clamp or Wrap")
+	}
+
 	return &g, nil
 }
 
-func (g *GenProgramChange) Generate(packet coremidi.Packet, value uint16) (generate coremidi.Packet, err error) {
+func (g *GenProgramChange) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
 	var statusByte byte
 	var programNumber byte
 
@@ -78,12 +94,33 @@ func (g *GenProgramChange) Generate(packet coremidi.Packet, value uint16) (gener
 	} else {
 		programNumber = g.programNumber
 	}
+	programNumber = g.shift(programNumber)
 
-	newPacket := coremidi.NewPacket([]byte{statusByte, programNumber}, packet.TimeStamp)
+	newPacket := midi.NewPacket([]byte{statusByte, programNumber}, packet.TimeStamp)
 
 	return newPacket, nil
 }
 
+// Program number moved by the offset, wrapped or clamped to 0-127
+func (g *GenProgramChange) shift(programNumber byte) byte {
+	n := int(programNumber) + g.offset
+	if g.wrap {
+		return byte((n + 128) % 128)
+	}
+	if n < 0 {
+		return 0
+	}
+	if n > 127 {
+		return 127
+	}
+	return byte(n)
+}
+
+// Largest value the generator can encode
+func (g *GenProgramChange) MaxValue() uint16 {
+	return 127
+}
+
 func (g *GenProgramChange) String() string {
 	str := fmt.Sprintf("ProgramChange (channel %s) ", g.channel.String())
 
@@ -94,6 +131,13 @@ func (g *GenProgramChange) String() string {
 	} else {
 		str += fmt.Sprintf(" / set program number to %d", g.programNumber)
 	}
+	if g.offset != 0 {
+		overflow := "clamped"
+		if g.wrap {
+			overflow = "wrapped"
+		}
+		str += fmt.Sprintf(" / offset %+d (%s)", g.offset, overflow)
+	}
 
 	return str
 }
@@ -1,11 +1,10 @@
 package gensysex
 
 import (
+	"MIDIRouter/midi"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type Mode int
@@ -14,18 +13,21 @@ const (
 	Mode7Bits         = iota
 	Mode14Bits        = iota
 	ModeEnsoniq14To32 = iota
+	ModeTemplate      = iota
 )
 
 type GenSysEx struct {
-	mode   Mode
-	prefix []byte
-	suffix []byte
+	mode     Mode
+	prefix   []byte
+	suffix   []byte
+	template *template
 }
 
 type FilterSysExConfig struct {
-	Prefix string
-	Suffix string
-	Mode   string
+	Prefix   string
+	Suffix   string
+	Mode     string
+	Template string // Whole message with placeholders, replaces Prefix, Suffix and Mode
 }
 
 func New(settings json.RawMessage) (*GenSysEx, error) {
@@ -37,6 +39,15 @@ func New(settings json.RawMessage) (*GenSysEx, error) {
 		return nil, errors.New("Failed to parse generator settings :" + err.Error())
 	}
 
+	if conf.Template != "" {
+		g.mode = ModeTemplate
+		g.template, err = newTemplate(conf.Template)
+		if err != nil {
+			return nil, err
+		}
+		return &g, nil
+	}
+
 	switch conf.Mode {
 	case "7bits":
 		g.mode = Mode7Bits
@@ -70,16 +81,24 @@ func New(settings json.RawMessage) (*GenSysEx, error) {
 	return &g, nil
 }
 
-func (g *GenSysEx) Generate(packet coremidi.Packet, value uint16) (generate coremidi.Packet, err error) {
+func (g *GenSysEx) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
 	var data []byte
 
+	if g.mode == ModeTemplate {
+		data, err = g.template.render(packet.Data, value)
+		if err != nil {
+			return packet, err
+		}
+		return midi.NewPacket(data, packet.TimeStamp), nil
+	}
+
 	data = append(data, g.prefix...)
 	switch g.mode {
 	case Mode7Bits:
 		data = append(data, byte(value))
 	case Mode14Bits:
 		pitchLSB := byte(value & 0x7F)
-		pitchMSB := byte(value >> 7)
+		pitchMSB := byte((value >> 7) & 0x7F)
 		data = append(data, pitchLSB)
 		data = append(data, pitchMSB)
 	case ModeEnsoniq14To32:
@@ -95,14 +114,36 @@ func (g *GenSysEx) Generate(packet coremidi.Packet, value uint16) (generate core
 
 	data = append(data, g.suffix...)
 
-	newPacket := coremidi.NewPacket(data, packet.TimeStamp)
+	newPacket := midi.NewPacket(data, packet.TimeStamp)
 
 	return newPacket, nil
 }
 
+// Router variables, readable from templates as vars.name
+func (g *GenSysEx) SetVariables(vars func() map[string]interface{}) {
+	if g.template != nil {
+		g.template.vars = vars
+	}
+}
+
+// Largest value the generator can encode
+func (g *GenSysEx) MaxValue() uint16 {
+	switch g.mode {
+	case Mode14Bits:
+		return 16383
+	case ModeEnsoniq14To32, ModeTemplate:
+		return 0xFFFF
+	}
+	return 127
+}
+
 func (g *GenSysEx) String() string {
 	str := "Sysex"
 
+	if g.mode == ModeTemplate {
+		return str + " / template " + g.template.source
+	}
+
 	str += " / " + hex.EncodeToString(g.prefix)
 	switch g.mode {
 	case Mode7Bits:
@@ -0,0 +1,257 @@
+package gensysex
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// A SysEx message template: hex bytes and {expression} placeholders, e.g.
+// "F0 41 10 42 12 40 00 7F {value} {checksum(5)} F7". Expressions see the
+// filtered message and can use the functions below to produce several bytes.
+type template struct {
+	source string
+	parts  []templatePart
+	vars   func() map[string]interface{} // Router variables, exposed as "vars"
+}
+
+type templatePart struct {
+	data     []byte      // Literal bytes
+	program  *vm.Program // Placeholder expression
+	checksum int         // Roland checksum of the bytes from this offset, when >= 0
+}
+
+var (
+	placeholderRegexp = regexp.MustCompile(`\{[^}]*\}`)
+	checksumRegexp    = regexp.MustCompile(`^checksum\(\s*(\d+)\s*\)$`)
+)
+
+var templateFunctions = []expr.Option{
+	// Split into n 4 bits nibbles, most significant first
+	expr.Function("nibbles", func(params ...interface{}) (interface{}, error) {
+		return split(params[0].(int), params[1].(int), 4)
+	}, new(func(int, int) []int)),
+	// Split into n 7 bits bytes, most significant first
+	expr.Function("pack7", func(params ...interface{}) (interface{}, error) {
+		return split(params[0].(int), params[1].(int), 7)
+	}, new(func(int, int) []int)),
+	// Text as ASCII bytes, padded with spaces or truncated to n characters
+	expr.Function("ascii", func(params ...interface{}) (interface{}, error) {
+		text := params[0].(string)
+		n := params[1].(int)
+		if len(text) < n {
+			text += strings.Repeat(" ", n-len(text))
+		}
+		var out []int
+		for _, c := range []byte(text[:n]) {
+			if c > 0x7F {
+				return nil, errors.New("ascii: non ASCII character")
+			}
+			out = append(out, int(c))
+		}
+		return out, nil
+	}, new(func(string, int) []int)),
+	// Linear scale from [fromMin, fromMax] to [toMin, toMax]
+	expr.Function("scale", func(params ...interface{}) (interface{}, error) {
+		x, fromMin, fromMax := params[0].(int), params[1].(int), params[2].(int)
+		toMin, toMax := params[3].(int), params[4].(int)
+		if fromMax == fromMin {
+			return toMin, nil
+		}
+		return toMin + (x-fromMin)*(toMax-toMin)/(fromMax-fromMin), nil
+	}, new(func(int, int, int, int, int) int)),
+}
+
+func split(x int, n int, bits uint) ([]int, error) {
+	if (n < 1) || (n > 8) {
+		return nil, fmt.Errorf("invalid byte count %d", n)
+	}
+	out := make([]int, n)
+	for i := n - 1; i >= 0; i-- {
+		out[i] = x & ((1 << bits) - 1)
+		x >>= bits
+	}
+	return out, nil
+}
+
+func templateEnv(data []byte, value uint16, vars func() map[string]interface{}) map[string]interface{} {
+	env := map[string]interface{}{
+		"value":   int(value),
+		"status":  0,
+		"channel": 0,
+		"data1":   0,
+		"data2":   0,
+		"vars":    map[string]interface{}{},
+	}
+	if vars != nil {
+		env["vars"] = vars()
+	}
+	if len(data) > 0 {
+		env["status"] = int(data[0])
+		if data[0] < 0xF0 {
+			env["channel"] = int(data[0]&0x0F) + 1
+		}
+	}
+	if len(data) > 1 {
+		env["data1"] = int(data[1])
+	}
+	if len(data) > 2 {
+		env["data2"] = int(data[2])
+	}
+	return env
+}
+
+func parseHex(str string) ([]byte, error) {
+	return hex.DecodeString(strings.Join(strings.Fields(str), ""))
+}
+
+func newTemplate(source string) (*template, error) {
+	t, err := parseTemplate(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if (len(t.parts[0].data) == 0) || (t.parts[0].data[0] != 0xF0) {
+		return nil, errors.New("Invalid SysEx template, must start with F0")
+	}
+	end := t.parts[len(t.parts)-1].data
+	if (len(end) == 0) || (end[len(end)-1] != 0xF7) {
+		return nil, errors.New("Invalid SysEx template, must end with F7")
+	}
+	return t, nil
+}
+
+// Parse hex bytes and placeholders, whatever the message
+func parseTemplate(source string) (*template, error) {
+	t := template{source: source}
+	options := append([]expr.Option{expr.Env(templateEnv(nil, 0, nil))}, templateFunctions...)
+
+	last := 0
+	for _, loc := range placeholderRegexp.FindAllStringIndex(source, -1) {
+		data, err := parseHex(source[last:loc[0]])
+		if err != nil {
+			return nil, errors.New("Invalid SysEx template: " + err.Error())
+		}
+		t.parts = append(t.parts, templatePart{data: data, checksum: -1})
+
+		code := strings.TrimSpace(source[loc[0]+1 : loc[1]-1])
+		if m := checksumRegexp.FindStringSubmatch(code); m != nil {
+			offset, _ := strconv.Atoi(m[1])
+			t.parts = append(t.parts, templatePart{checksum: offset})
+		} else {
+			program, err := expr.Compile(code, options...)
+			if err != nil {
+				return nil, errors.New("Invalid SysEx template placeholder {" + code + "}: " + err.Error())
+			}
+			t.parts = append(t.parts, templatePart{program: program, checksum: -1})
+		}
+		last = loc[1]
+	}
+	data, err := parseHex(source[last:])
+	if err != nil {
+		return nil, errors.New("Invalid SysEx template: " + err.Error())
+	}
+	t.parts = append(t.parts, templatePart{data: data, checksum: -1})
+	return &t, nil
+}
+
+func (t *template) render(data []byte, value uint16) ([]byte, error) {
+	var out []byte
+	var env map[string]interface{}
+
+	for _, p := range t.parts {
+		switch {
+		case p.checksum >= 0:
+			if p.checksum > len(out) {
+				return nil, fmt.Errorf("SysEx template: checksum offset %d out of message", p.checksum)
+			}
+			sum := 0
+			for _, b := range out[p.checksum:] {
+				sum += int(b)
+			}
+			out = append(out, byte((128-sum%128)%128))
+		case p.program != nil:
+			if env == nil {
+				env = templateEnv(data, value, t.vars)
+			}
+			result, err := expr.Run(p.program, env)
+			if err != nil {
+				return nil, errors.New("SysEx template: " + err.Error())
+			}
+			out, err = appendResult(out, result)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			out = append(out, p.data...)
+		}
+	}
+	return out, nil
+}
+
+// Append placeholder results, which must be 7 bits data bytes
+func appendResult(out []byte, result interface{}) ([]byte, error) {
+	var values []int
+
+	switch r := result.(type) {
+	case int:
+		values = []int{r}
+	case float64:
+		values = []int{int(r)}
+	case []int:
+		values = r
+	case []interface{}:
+		for _, v := range r {
+			i, ok := v.(int)
+			if !ok {
+				return nil, fmt.Errorf("SysEx template: invalid value %v", v)
+			}
+			values = append(values, i)
+		}
+	default:
+		return nil, fmt.Errorf("SysEx template: invalid value %v", result)
+	}
+
+	for _, v := range values {
+		if (v < 0) || (v > 0x7F) {
+			return nil, fmt.Errorf("SysEx template: value %d is not a data byte", v)
+		}
+		out = append(out, byte(v))
+	}
+	return out, nil
+}
+
+// Any MIDI message written as a SysEx template is, e.g. "B0 07 {value}"
+type MessageTemplate struct {
+	template *template
+}
+
+func NewMessageTemplate(source string) (*MessageTemplate, error) {
+	t, err := parseTemplate(source)
+	if err != nil {
+		return nil, err
+	}
+	if (len(t.parts[0].data) == 0) || (t.parts[0].data[0] < 0x80) {
+		return nil, errors.New("Invalid message template '" + source + "', must start with a status byte")
+	}
+	return &MessageTemplate{template: t}, nil
+}
+
+// Message for a filtered message and its value
+func (m *MessageTemplate) Render(data []byte, value uint16) ([]byte, error) {
+	return m.template.render(data, value)
+}
+
+func (m *MessageTemplate) SetVariables(vars func() map[string]interface{}) {
+	m.template.vars = vars
+}
+
+func (m *MessageTemplate) String() string {
+	return m.template.source
+}
@@ -0,0 +1,56 @@
+package gentransport
+
+import (
+	"MIDIRouter/midi"
+	"encoding/json"
+	"errors"
+)
+
+// Sends a transport real-time message (Start, Continue or Stop) whatever the
+// filtered message, e.g. to start a sequencer from a footswitch CC
+type GenTransport struct {
+	name   string
+	status byte
+}
+
+type GenTransportConfig struct {
+	Message string // Start, Continue or Stop
+}
+
+var messages = map[string]byte{
+	"Start":    0xFA,
+	"Continue": 0xFB,
+	"Stop":     0xFC,
+}
+
+func New(settings json.RawMessage) (*GenTransport, error) {
+	var g GenTransport
+	var conf GenTransportConfig
+
+	err := json.Unmarshal([]byte(settings), &conf)
+	if err != nil {
+		return nil, errors.New("Failed to parse generator settings :" + err.Error())
+	}
+
+	status, found := messages[conf.Message]
+	if !found {
+		return nil, errors.New("Invalid transport message '" + conf.Message + "': expected Start, Continue or Stop")
+	}
+	g.name = conf.Message
+	g.status = status
+
+	return &g, nil
+}
+
+func (g *GenTransport) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
+	return midi.NewPacket([]byte{g.status}, 0), nil
+}
+
+// The value is not used
+func (g *GenTransport) MaxValue() uint16 {
+	return 127
+}
+
+func (g *GenTransport) String() string {
+	return "Transport " + g.name
+}
@@ -2,4 +2,11 @@ module MIDIRouter
 
 go 1.23.5
 
-require github.com/youpy/go-coremidi v0.0.0-20241117111815-4e11c355831c
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/expr-lang/expr v1.17.8
+	github.com/tetratelabs/wazero v1.9.0
+	github.com/youpy/go-coremidi v0.0.0-20241117111815-4e11c355831c
+	github.com/yuin/gopher-lua v1.1.2
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,82 @@
+package highres
+
+import (
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/midi"
+	"MIDIRouter/ump"
+	"math/bits"
+)
+
+// Filters and generators of channel voice messages (notes, controllers,
+// pressure, pitch bend) working on 16 bits values, the resolution of MIDI 2.0
+// velocities, instead of 7 bits (14 for pitch bend). Messages received from a
+// MIDI 2.0 source give their own value, 32 bits values being cut to their 16
+// most significant bits; other ones are scaled up.
+const Bits = 16
+
+// Filter matching as the wrapped one, the value being 16 bits
+type Filter struct {
+	filterinterface.FilterInterface
+}
+
+func NewFilter(f filterinterface.FilterInterface) *Filter {
+	return &Filter{FilterInterface: f}
+}
+
+func (f *Filter) Match(packet midi.Packet) (match filterinterface.FilterMatchResult, value uint16) {
+	match, value = f.FilterInterface.Match(packet)
+	if match != filterinterface.FilterMatchResult_Match {
+		return match, value
+	}
+	midi1, midi1Bits := ump.MIDI1Value(packet.Data)
+	if (midi1Bits == 0) || (uint32(value) != midi1) {
+		//Not the value of the message (a note number)
+		return match, value
+	}
+	if packet.HasHighRes {
+		if ump.ValueBits(packet.Data[0]) == 32 {
+			return match, uint16(packet.HighRes >> 16)
+		}
+		return match, uint16(packet.HighRes)
+	}
+	return match, uint16(ump.ScaleUp(midi1, midi1Bits, Bits))
+}
+
+func (f *Filter) String() string {
+	return f.FilterInterface.String() + " (16 bits)"
+}
+
+// Generator producing the message of the wrapped one from a 16 bits value.
+// The message carries the value, for MIDI 2.0 destinations.
+type Generator struct {
+	generatorinterface.GeneratorInterface
+}
+
+func NewGenerator(g generatorinterface.GeneratorInterface) *Generator {
+	return &Generator{GeneratorInterface: g}
+}
+
+func (g *Generator) Generate(packet midi.Packet, value uint16) (generate midi.Packet, err error) {
+	shift := Bits - bits.Len16(g.GeneratorInterface.MaxValue())
+	scaled := value >> shift
+	generate, err = g.GeneratorInterface.Generate(packet, scaled)
+	if err != nil {
+		return generate, err
+	}
+	midi1, midi1Bits := ump.MIDI1Value(generate.Data)
+	if (midi1Bits == 0) || (midi1 != uint32(scaled)) {
+		//Fixed value, or the value went elsewhere (a note number)
+		return generate, nil
+	}
+	generate.HighRes, generate.HasHighRes = ump.ScaleUp(uint32(value), Bits, ump.ValueBits(generate.Data[0])), true
+	return generate, nil
+}
+
+func (g *Generator) MaxValue() uint16 {
+	return 0xFFFF
+}
+
+func (g *Generator) String() string {
+	return g.GeneratorInterface.String() + " (16 bits)"
+}
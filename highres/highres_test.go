@@ -0,0 +1,61 @@
+package highres_test
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/filtercontrolchange"
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/gencontrolchange"
+	"MIDIRouter/highres"
+	"MIDIRouter/midi"
+	"encoding/json"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f, err := filtercontrolchange.New(filter.FilterChannel1, json.RawMessage(`{"ControllerNumber": "74", "Value": "*"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := highres.NewFilter(f)
+
+	tests := []struct {
+		name   string
+		packet midi.Packet
+		value  uint16
+	}{
+		{"MIDI 1.0 min", midi.NewPacket([]byte{0xB0, 74, 0}, 0), 0},
+		{"MIDI 1.0 center", midi.NewPacket([]byte{0xB0, 74, 64}, 0), 0x8000},
+		{"MIDI 1.0 max", midi.NewPacket([]byte{0xB0, 74, 127}, 0), 0xFFFF},
+		{"MIDI 2.0", midi.Packet{Data: []byte{0xB0, 74, 64}, HighRes: 0x81234567, HasHighRes: true}, 0x8123},
+	}
+	for _, test := range tests {
+		match, value := h.Match(test.packet)
+		if match != filterinterface.FilterMatchResult_Match {
+			t.Errorf("%s: no match", test.name)
+		} else if value != test.value {
+			t.Errorf("%s: value %#x, expected %#x", test.name, value, test.value)
+		}
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	g, err := gencontrolchange.New(filter.FilterChannel2, json.RawMessage(`{"ControllerNumber": "74", "Value": "$"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := highres.NewGenerator(g)
+	if h.MaxValue() != 0xFFFF {
+		t.Fatalf("Max value %d, expected 65535", h.MaxValue())
+	}
+
+	generated, err := h.Generate(midi.NewPacket([]byte{0xB0, 74, 0}, 0), 0x8123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(generated.Data) != 3) || (generated.Data[0] != 0xB1) || (generated.Data[2] != 64) {
+		t.Errorf("Generated % X, expected B1 4A 40", generated.Data)
+	}
+	if !generated.HasHighRes || (generated.HighRes>>16 != 0x8123) {
+		t.Errorf("High resolution value %#x, expected 0x8123xxxx", generated.HighRes)
+	}
+}
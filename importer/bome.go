@@ -0,0 +1,165 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// A message of a translator: status byte and data bytes, fixed or variable
+type pattern struct {
+	status byte
+	data   []string // Decimal value, or variable name
+}
+
+var (
+	variableRegexp = regexp.MustCompile(`^[g-z][a-z0-9]$`)
+	portRegexp     = regexp.MustCompile(`^MID[I0-9]*$`)
+)
+
+// Convert Bome-style translators: sections holding a Name, an Incoming and an
+// Outgoing MIDI message, written as hex bytes and two letters variables, e.g.
+//
+//	[Translator.0]
+//	Name=Volume to expression
+//	Incoming=MID1 B0 07 pp
+//	Outgoing=MID1 B1 0B pp
+//
+// Translators this router cannot express (non MIDI actions, variables moving
+// between data bytes, several messages) are returned as skipped, with the
+// reason.
+func FromBome(r io.Reader) (rules []Rule, skipped []string, err error) {
+	var name, incoming, outgoing string
+	flush := func() {
+		if (incoming == "") && (outgoing == "") {
+			return
+		}
+		rule, err := bomeRule(name, incoming, outgoing)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", name, err))
+		} else {
+			rules = append(rules, rule)
+		}
+		name, incoming, outgoing = "", "", ""
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			flush()
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Name":
+			if (incoming != "") || (outgoing != "") {
+				flush()
+			}
+			name = strings.TrimSpace(value)
+		case "Incoming":
+			incoming = strings.TrimSpace(value)
+		case "Outgoing":
+			outgoing = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	flush()
+	return rules, skipped, nil
+}
+
+func parsePattern(str string) (pattern, error) {
+	var chunks []string
+	for _, field := range strings.Fields(str) {
+		if portRegexp.MatchString(field) {
+			continue
+		}
+		if len(field)%2 != 0 {
+			return pattern{}, errors.New("not a MIDI message '" + str + "'")
+		}
+		for i := 0; i < len(field); i += 2 {
+			chunks = append(chunks, field[i:i+2])
+		}
+	}
+	if len(chunks) == 0 {
+		return pattern{}, errors.New("no MIDI message")
+	}
+
+	status, err := hex.DecodeString(chunks[0])
+	if err != nil {
+		return pattern{}, errors.New("variable status byte in '" + str + "'")
+	}
+	p := pattern{status: status[0]}
+	names, found := dataNames[p.status&0xF0]
+	if !found || (p.status >= 0xF0) {
+		return pattern{}, fmt.Errorf("unsupported message type %02X", p.status)
+	}
+	if len(chunks)-1 != len(names) {
+		return pattern{}, errors.New("not a single message '" + str + "'")
+	}
+
+	for _, c := range chunks[1:] {
+		if variableRegexp.MatchString(c) {
+			p.data = append(p.data, c)
+			continue
+		}
+		b, err := hex.DecodeString(c)
+		if (err != nil) || (b[0] > 0x7F) {
+			return pattern{}, errors.New("invalid data byte '" + c + "'")
+		}
+		p.data = append(p.data, fmt.Sprintf("%d", b[0]))
+	}
+	return p, nil
+}
+
+func bomeRule(name string, incoming string, outgoing string) (Rule, error) {
+	in, err := parsePattern(incoming)
+	if err != nil {
+		return Rule{}, errors.New("Incoming: " + err.Error())
+	}
+	out, err := parsePattern(outgoing)
+	if err != nil {
+		return Rule{}, errors.New("Outgoing: " + err.Error())
+	}
+
+	rule := Rule{
+		Name:      name,
+		Filter:    Message{MsgType: msgTypes[in.status&0xF0], Channel: channelString(int(in.status&0x0F) + 1), Settings: map[string]string{}},
+		Generator: Message{MsgType: msgTypes[out.status&0xF0], Channel: channelString(int(out.status&0x0F) + 1), Settings: map[string]string{}},
+	}
+	inNames := dataNames[in.status&0xF0]
+	for i, d := range in.data {
+		if variableRegexp.MatchString(d) {
+			d = "*"
+		}
+		rule.Filter.Settings[inNames[i]] = d
+	}
+
+	outNames := dataNames[out.status&0xF0]
+	for i, d := range out.data {
+		if variableRegexp.MatchString(d) {
+			switch {
+			case (valueIndex(in.status&0xF0) < len(in.data)) && (in.data[valueIndex(in.status&0xF0)] == d):
+				d = "$" // Value extracted by the filter
+			case (i < len(in.data)) && (in.data[i] == d) && (inNames[i] == outNames[i]):
+				d = "*" // Same byte of the filtered message
+			default:
+				return Rule{}, errors.New("Outgoing: variable " + d + " cannot be mapped")
+			}
+		}
+		rule.Generator.Settings[outNames[i]] = d
+	}
+	if rule.Name == "" {
+		rule.Name = incoming + " to " + outgoing
+	}
+	return rule, nil
+}
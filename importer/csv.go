@@ -0,0 +1,108 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Columns of CSV mappings, the first line naming them. Name, OutMin and OutMax
+// are optional.
+var csvColumns = []string{"InChannel", "InCC", "OutChannel", "OutCC", "Name", "OutMin", "OutMax"}
+
+// Convert a CSV table of Control Change mappings, one per line, e.g.
+//
+//	InChannel,InCC,OutChannel,OutCC,Name
+//	1,7,2,11,Volume to expression
+//
+// Values are scaled to [OutMin, OutMax] when these columns are set.
+func FromCSV(r io.Reader) ([]Rule, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("Failed to read CSV header: " + err.Error())
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		for _, c := range csvColumns {
+			if strings.EqualFold(strings.ReplaceAll(strings.TrimSpace(name), " ", ""), c) {
+				columns[c] = i
+			}
+		}
+	}
+	for _, c := range csvColumns[:4] {
+		if _, found := columns[c]; !found {
+			return nil, errors.New("Missing CSV column " + c)
+		}
+	}
+
+	var rules []Rule
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, found := columns[name]; found && (i < len(record)) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		rule, err := csvRule(field)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %v", line, err)
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("CC%s to CC%s", field("InCC"), field("OutCC"))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func csvRule(field func(name string) string) (Rule, error) {
+	inChannel, err := parseChannel(field("InChannel"))
+	if err != nil {
+		return Rule{}, err
+	}
+	outChannel, err := parseChannel(field("OutChannel"))
+	if err != nil {
+		return Rule{}, err
+	}
+	for _, c := range []string{"InCC", "OutCC"} {
+		if _, err := parseDataByte(field(c)); err != nil {
+			return Rule{}, err
+		}
+	}
+
+	rule := Rule{
+		Name: field("Name"),
+		Filter: Message{MsgType: "Control Change", Channel: channelString(inChannel),
+			Settings: map[string]string{"ControllerNumber": field("InCC"), "Value": "*"}},
+		Generator: Message{MsgType: "Control Change", Channel: channelString(outChannel),
+			Settings: map[string]string{"ControllerNumber": field("OutCC"), "Value": "$"}},
+	}
+
+	if (field("OutMin") != "") || (field("OutMax") != "") {
+		min, err := strconv.Atoi(field("OutMin"))
+		if err != nil {
+			return Rule{}, errors.New("invalid OutMin '" + field("OutMin") + "'")
+		}
+		max, err := strconv.Atoi(field("OutMax"))
+		if err != nil {
+			return Rule{}, errors.New("invalid OutMax '" + field("OutMax") + "'")
+		}
+		rule.Transform = &Transform{Mode: "Linear", FromMin: 0, FromMax: 127, ToMin: min, ToMax: max}
+	}
+	return rule, nil
+}
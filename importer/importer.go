@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Rules converted from other tools, in the configuration file format (see
+// config.RuleConfig), ready to be pasted in the "Rules" array
+type Rule struct {
+	Name      string
+	Filter    Message
+	Transform *Transform `json:",omitempty"`
+	Generator Message
+}
+
+// Filter or generator
+type Message struct {
+	MsgType  string
+	Channel  string
+	Settings map[string]string
+}
+
+type Transform struct {
+	Mode    string
+	FromMin int
+	FromMax int
+	ToMin   int
+	ToMax   int
+}
+
+// Settings names of the data bytes of channel messages, by status high nibble
+var dataNames = map[byte][]string{
+	0x80: {"Note", "Velocity"},
+	0x90: {"Note", "Velocity"},
+	0xB0: {"ControllerNumber", "Value"},
+	0xC0: {"ProgramNumber"},
+}
+
+var msgTypes = map[byte]string{
+	0x80: "Note Off",
+	0x90: "Note On",
+	0xB0: "Control Change",
+	0xC0: "Program Change",
+}
+
+// Index of the data byte extracted by filters as value
+func valueIndex(status byte) int {
+	return len(dataNames[status]) - 1
+}
+
+func channelString(channel int) string {
+	if channel == 0 {
+		return "*"
+	}
+	return strconv.Itoa(channel)
+}
+
+// Channel 1-16, or 0 for "*"
+func parseChannel(str string) (int, error) {
+	if (str == "*") || (str == "") {
+		return 0, nil
+	}
+	channel, err := strconv.Atoi(str)
+	if (err != nil) || (channel < 1) || (channel > 16) {
+		return 0, fmt.Errorf("invalid channel '%s'", str)
+	}
+	return channel, nil
+}
+
+func parseDataByte(str string) (int, error) {
+	value, err := strconv.Atoi(str)
+	if (err != nil) || (value < 0) || (value > 127) {
+		return 0, fmt.Errorf("invalid data byte '%s'", str)
+	}
+	return value, nil
+}
@@ -0,0 +1,141 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ANSI escape sequences
+const (
+	colorReset = "\033[0m"
+	colorDim   = "\033[2m"
+	colorRed   = "\033[31m"
+	colorSysEx = "\033[94m"
+)
+
+// Output colorized by default when it is a terminal, unless NO_COLOR is set
+var colorOutput = isTerminal(os.Stdout) && (os.Getenv("NO_COLOR") == "")
+
+// Force colors on or off, whatever the output
+func SetColor(enabled bool) {
+	colorOutput = enabled
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return (err == nil) && (info.Mode()&os.ModeCharDevice != 0)
+}
+
+func colorize(color string, str string) string {
+	if !colorOutput {
+		return str
+	}
+	return color + str + colorReset
+}
+
+// Name and color of channel messages, by status (high nibble)
+var channelMessages = map[byte]struct {
+	name  string
+	color string
+}{
+	0x80: {"Note Off", "\033[36m"},
+	0x90: {"Note On", "\033[32m"},
+	0xA0: {"Aftertouch", "\033[35m"},
+	0xB0: {"Control Change", "\033[33m"},
+	0xC0: {"Program Change", "\033[34m"},
+	0xD0: {"Channel Pressure", "\033[35m"},
+	0xE0: {"Pitch Wheel", "\033[95m"},
+}
+
+// Names of system messages, displayed dimmed but SysEx
+var systemMessages = map[byte]string{
+	0xF0: "SysEx",
+	0xF1: "MTC Quarter Frame",
+	0xF2: "Song Position",
+	0xF3: "Song Select",
+	0xF6: "Tune Request",
+	0xF8: "Clock",
+	0xFA: "Start",
+	0xFB: "Continue",
+	0xFC: "Stop",
+	0xFE: "Active Sensing",
+	0xFF: "Reset",
+}
+
+// Per packet message, dimmed: something dropped or ignored
+func (l *Logger) DebugDim(a ...interface{}) {
+	if l.level >= LevelDebug {
+		l.println(colorize(colorDim, strings.TrimSuffix(fmt.Sprintln(a...), "\n")))
+	}
+}
+
+// Per packet message, one aligned line per MIDI message of data, e.g.
+// "in  Control Change   ch 1    7 100  B0 07 64"
+func (l *Logger) DebugMessages(direction string, data []byte) {
+	if l.level < LevelDebug {
+		return
+	}
+	for len(data) > 0 {
+		length := messageLength(data)
+		if length > len(data) {
+			length = len(data)
+		}
+		l.println(formatMessage(direction, data[:length]))
+		data = data[length:]
+	}
+}
+
+func formatMessage(direction string, msg []byte) string {
+	bytes := fmt.Sprintf("% X", msg)
+	if msg[0] >= 0xF0 {
+		name, found := systemMessages[msg[0]]
+		if !found {
+			name = "Unknown"
+		}
+		line := fmt.Sprintf("%-4s %-18s %-5s %-7s  ", direction, name, "", "")
+		if msg[0] == 0xF0 {
+			return line + colorize(colorSysEx, bytes)
+		}
+		return colorize(colorDim, line+bytes)
+	}
+
+	message, found := channelMessages[msg[0]&0xF0]
+	if !found {
+		return colorize(colorDim, fmt.Sprintf("%-4s %-18s %-5s %-7s  %s", direction, "Data", "", "", bytes))
+	}
+	var values string
+	switch {
+	case (msg[0]&0xF0 == 0xE0) && (len(msg) == 3):
+		values = fmt.Sprintf("%7d", int(msg[1])|int(msg[2])<<7)
+	case len(msg) == 3:
+		values = fmt.Sprintf("%3d %3d", msg[1], msg[2])
+	case len(msg) == 2:
+		values = fmt.Sprintf("%3d", msg[1])
+	}
+	channel := fmt.Sprintf("ch %d", msg[0]&0x0F+1)
+	line := fmt.Sprintf("%-4s %s %-5s %-7s  ", direction, colorize(message.color, fmt.Sprintf("%-18s", message.name)), channel, values)
+	return line + colorize(colorDim, bytes)
+}
+
+// Length of the message starting data, up to the next status byte for SysEx
+// and stray data bytes
+func messageLength(data []byte) int {
+	switch {
+	case (data[0] == 0xF0) || (data[0] < 0x80):
+		for i := 1; i < len(data); i++ {
+			if data[i] >= 0x80 {
+				if data[i] == 0xF7 {
+					return i + 1
+				}
+				return i
+			}
+		}
+		return len(data)
+	case (data[0] == 0xF1) || (data[0] == 0xF3) || (data[0]&0xF0 == 0xC0) || (data[0]&0xF0 == 0xD0):
+		return 2
+	case (data[0] == 0xF2) || (data[0] < 0xF0):
+		return 3
+	}
+	return 1
+}
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Level uint8
+
+const (
+	LevelError = iota // Always displayed
+	LevelInfo  = iota // Startup, shutdown and configuration messages
+	LevelDebug = iota // Per packet messages (verbose mode)
+)
+
+// Leveled logger. Disabled levels cost a single comparison: per packet
+// callers building costly arguments should check Enabled first.
+type Logger struct {
+	level  Level
+	prefix string
+}
+
+func New(level Level) *Logger {
+	return &Logger{level: level}
+}
+
+func (l *Logger) SetLevel(level Level) {
+	l.level = level
+}
+
+// Tag every line, e.g. with the router name when several routers share the
+// output. Lines are printed as is with an empty prefix.
+func (l *Logger) SetPrefix(prefix string) {
+	l.prefix = prefix
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level <= l.level
+}
+
+// Errors are displayed in red on color output
+func (l *Logger) Error(a ...interface{}) {
+	l.println(colorize(colorRed, strings.TrimSuffix(fmt.Sprintln(a...), "\n")))
+}
+
+func (l *Logger) Errorf(format string, a ...interface{}) {
+	l.println(colorize(colorRed, strings.TrimSuffix(fmt.Sprintf(format, a...), "\n")))
+}
+
+func (l *Logger) Info(a ...interface{}) {
+	if l.level >= LevelInfo {
+		l.println(a...)
+	}
+}
+
+func (l *Logger) Infof(format string, a ...interface{}) {
+	if l.level >= LevelInfo {
+		l.printf(format, a...)
+	}
+}
+
+func (l *Logger) Debug(a ...interface{}) {
+	if l.level >= LevelDebug {
+		l.println(a...)
+	}
+}
+
+func (l *Logger) Debugf(format string, a ...interface{}) {
+	if l.level >= LevelDebug {
+		l.printf(format, a...)
+	}
+}
+
+func (l *Logger) println(a ...interface{}) {
+	if l.prefix != "" {
+		a = append([]interface{}{"[" + l.prefix + "]"}, a...)
+	}
+	fmt.Println(a...)
+}
+
+func (l *Logger) printf(format string, a ...interface{}) {
+	if l.prefix != "" {
+		format = "[" + l.prefix + "] " + format
+	}
+	fmt.Printf(format, a...)
+}
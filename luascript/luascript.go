@@ -0,0 +1,134 @@
+package luascript
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Maximum run time of a script call, so a runaway loop can't stall routing
+const maxRunTime = 20 * time.Millisecond
+
+// Maximum run time of the script body, run once on load
+const maxLoadTime = time.Second
+
+// Lua script of a rule, defining match(packet, value) and/or transform(value, packet).
+// Globals are kept between calls, so scripts may hold state.
+type LuaScript struct {
+	mutex     sync.Mutex
+	state     *lua.LState
+	match     *lua.LFunction
+	transform *lua.LFunction
+}
+
+func New(code string) (*LuaScript, error) {
+	state := lua.NewState(lua.Options{SkipOpenLibs: true})
+
+	//Scripts compute values: no access to files or processes
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		state.Push(state.NewFunction(lib.open))
+		state.Push(lua.LString(lib.name))
+		state.Call(1, 0)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), maxLoadTime)
+	state.SetContext(ctx)
+	err := state.DoString(code)
+	state.RemoveContext()
+	cancel()
+	if err != nil {
+		state.Close()
+		return nil, errors.New("Failed to load Lua script: " + err.Error())
+	}
+
+	s := &LuaScript{state: state}
+	s.match, _ = state.GetGlobal("match").(*lua.LFunction)
+	s.transform, _ = state.GetGlobal("transform").(*lua.LFunction)
+	if (s.match == nil) && (s.transform == nil) {
+		state.Close()
+		return nil, errors.New("Lua script defines neither match nor transform function")
+	}
+	return s, nil
+}
+
+// Call match with the message bytes (a 1-based table) and the value extracted
+// by the filter. It returns false or nil to reject the message, true to keep
+// the value, or a number replacing it.
+func (s *LuaScript) Match(data []byte, value uint16) (bool, uint16, error) {
+	if s.match == nil {
+		return true, value, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.call(s.match, value, s.packetTable(data), lua.LNumber(value))
+}
+
+// Call transform with the (transformed) value and the message bytes. It
+// returns nil or false to drop the message, or the value to generate.
+func (s *LuaScript) Transform(data []byte, value uint16) (bool, uint16, error) {
+	if s.transform == nil {
+		return true, value, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.call(s.transform, value, lua.LNumber(value), s.packetTable(data))
+}
+
+// Message bytes as a Lua table, packet[1] being the status byte
+func (s *LuaScript) packetTable(data []byte) *lua.LTable {
+	packet := s.state.NewTable()
+	for _, b := range data {
+		packet.Append(lua.LNumber(b))
+	}
+	return packet
+}
+
+func (s *LuaScript) call(fn *lua.LFunction, value uint16, args ...lua.LValue) (bool, uint16, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), maxRunTime)
+	s.state.SetContext(ctx)
+	err := s.state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...)
+	s.state.RemoveContext()
+	cancel()
+	if err != nil {
+		return false, value, errors.New("Lua script error: " + err.Error())
+	}
+	ret := s.state.Get(-1)
+	s.state.Pop(1)
+
+	switch v := ret.(type) {
+	case lua.LBool:
+		return bool(v), value, nil
+	case lua.LNumber:
+		if (v < 0) || (v > 0xFFFF) {
+			return false, value, errors.New("Lua script returned an out of range value")
+		}
+		return true, uint16(v), nil
+	case *lua.LNilType:
+		return false, value, nil
+	}
+	return false, value, errors.New("Lua script returned a " + ret.Type().String() + ", expected a number, a boolean or nil")
+}
+
+// Release the interpreter
+func (s *LuaScript) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.state.Close()
+	return nil
+}
@@ -0,0 +1,17 @@
+package midi
+
+// MIDI data (one or more messages) with its timestamp, as read from a source
+// or sent to a destination, whatever the MIDI backend
+type Packet struct {
+	Data      []byte
+	TimeStamp uint64
+
+	//MIDI 2.0 value of a single channel voice message (16 bits velocity, 32
+	//bits otherwise), when received from or generated for a MIDI 2.0 device
+	HighRes    uint32
+	HasHighRes bool
+}
+
+func NewPacket(data []byte, timeStamp uint64) Packet {
+	return Packet{Data: data, TimeStamp: timeStamp}
+}
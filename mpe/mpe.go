@@ -0,0 +1,240 @@
+package mpe
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	noteOff        = 0x80
+	noteOn         = 0x90
+	polyAftertouch = 0xA0
+	controlChange  = 0xB0
+	channelPress   = 0xD0
+	pitchWheel     = 0xE0
+	timbre         = 74 // Third dimension of control, sent per note as CC74
+)
+
+// An MPE zone: a master channel for zone-wide messages, and member channels
+// playing one note each
+type Zone struct {
+	Master  uint8   // 0-15
+	Members []uint8 // 0-15
+}
+
+// Lower zones have their master on channel 1 and members above it, upper
+// zones their master on channel 16 and members below it
+func NewZone(name string, members int) (Zone, error) {
+	if members == 0 {
+		members = 15
+	}
+	if (members < 1) || (members > 15) {
+		return Zone{}, errors.New("Invalid number of MPE member channels: expected 1 to 15")
+	}
+
+	var z Zone
+	switch name {
+	case "", "Lower":
+		z.Master = 0
+		for c := 1; c <= members; c++ {
+			z.Members = append(z.Members, uint8(c))
+		}
+	case "Upper":
+		z.Master = 15
+		for c := 14; c >= 15-members; c-- {
+			z.Members = append(z.Members, uint8(c))
+		}
+	default:
+		return Zone{}, errors.New("Invalid MPE zone '" + name + "': expected Lower or Upper")
+	}
+	return z, nil
+}
+
+func (z Zone) isMember(channel uint8) bool {
+	for _, c := range z.Members {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// MPE Configuration Message (RPN 6 on the master channel) setting up the zone
+// on a receiver
+func (z Zone) ConfigurationMessage() [][]byte {
+	cc := controlChange | z.Master
+	return [][]byte{
+		{cc, 101, 0},
+		{cc, 100, 6},
+		{cc, 6, uint8(len(z.Members))},
+		{cc, 101, 127},
+		{cc, 100, 127},
+	}
+}
+
+// Translates MPE input to a single channel, the zone master: notes of all
+// member channels are played on it, and the per-note pitch bend, pressure and
+// timbre (CC74) of the most recent note become those of the channel. Messages
+// of other channels are left as is.
+type Collapser struct {
+	zone   Zone
+	mutex  sync.Mutex
+	notes  [16]int8    // Note sounding on each member channel, -1 for none
+	bends  [16][2]byte // Last pitch bend of each member channel
+	recent []uint8     // Member channels with a note, most recent last
+}
+
+func NewCollapser(zone Zone) *Collapser {
+	c := &Collapser{zone: zone}
+	for i := range c.notes {
+		c.notes[i] = -1
+		c.bends[i] = [2]byte{0, 0x40}
+	}
+	return c
+}
+
+func (c *Collapser) Collapse(data []byte) [][]byte {
+	channel := data[0] & 0x0F
+	if (data[0] >= 0xF0) || !c.zone.isMember(channel) {
+		return [][]byte{data}
+	}
+	status := data[0] & 0xF0
+	master := c.zone.Master
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch {
+	case (status == noteOn) && (len(data) == 3) && (data[2] > 0):
+		c.release(channel)
+		c.notes[channel] = int8(data[1])
+		c.recent = append(c.recent, channel)
+		return [][]byte{{noteOn | master, data[1], data[2]}}
+
+	case ((status == noteOff) || (status == noteOn)) && (len(data) == 3):
+		if c.notes[channel] != int8(data[1]) {
+			return [][]byte{{status | master, data[1], data[2]}}
+		}
+		latest := c.latest() == channel
+		c.release(channel)
+		c.notes[channel] = -1
+		messages := [][]byte{{status | master, data[1], data[2]}}
+		//The pitch bend of the note still sounding takes over
+		if latest && (len(c.recent) > 0) {
+			bend := c.bends[c.latest()]
+			messages = append(messages, []byte{pitchWheel | master, bend[0], bend[1]})
+		}
+		return messages
+
+	case (status == pitchWheel) && (len(data) == 3):
+		c.bends[channel] = [2]byte{data[1], data[2]}
+		if c.latest() != channel {
+			return nil
+		}
+		return [][]byte{{pitchWheel | master, data[1], data[2]}}
+
+	case (status == channelPress) || ((status == controlChange) && (len(data) == 3) && (data[1] == timbre)):
+		if c.latest() != channel {
+			return nil
+		}
+		return [][]byte{append([]byte{status | master}, data[1:]...)}
+	}
+
+	//Other messages of member channels apply to the whole zone
+	return [][]byte{append([]byte{status | master}, data[1:]...)}
+}
+
+// Member channel of the most recent note still sounding, or 0xFF
+func (c *Collapser) latest() uint8 {
+	if len(c.recent) == 0 {
+		return 0xFF
+	}
+	return c.recent[len(c.recent)-1]
+}
+
+func (c *Collapser) release(channel uint8) {
+	for i, r := range c.recent {
+		if r == channel {
+			c.recent = append(c.recent[:i], c.recent[i+1:]...)
+			return
+		}
+	}
+}
+
+// Translates single channel output, on the zone master channel, to MPE: every
+// note is given a member channel of its own, and Polyphonic Aftertouch becomes
+// the pressure of that channel. Other messages of the master channel (pitch
+// bend, controllers) apply to the whole zone and are left as is, as are
+// messages of other channels.
+type Expander struct {
+	zone     Zone
+	mutex    sync.Mutex
+	channels map[uint8]uint8 // Note => member channel
+	used     []uint8         // Member channels, least recently used first
+}
+
+func NewExpander(zone Zone) *Expander {
+	return &Expander{
+		zone:     zone,
+		channels: make(map[uint8]uint8),
+		used:     append([]uint8(nil), zone.Members...),
+	}
+}
+
+func (e *Expander) Expand(data []byte) [][]byte {
+	if (len(data) != 3) || (data[0]&0x0F != e.zone.Master) {
+		return [][]byte{data}
+	}
+	status := data[0] & 0xF0
+	note := data[1]
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	channel, sounding := e.channels[note]
+	switch {
+	case (status == noteOn) && (data[2] > 0):
+		var messages [][]byte
+		if sounding {
+			messages = append(messages, []byte{noteOff | channel, note, 0x40})
+		}
+		channel = e.allocate()
+		e.channels[note] = channel
+		//Reset the expression left by the previous note of the channel
+		messages = append(messages, []byte{pitchWheel | channel, 0, 0x40}, []byte{noteOn | channel, note, data[2]})
+		return messages
+
+	case (status == noteOff) || (status == noteOn):
+		if !sounding {
+			return [][]byte{data}
+		}
+		delete(e.channels, note)
+		return [][]byte{{status | channel, note, data[2]}}
+
+	case status == polyAftertouch:
+		if !sounding {
+			return nil
+		}
+		return [][]byte{{channelPress | channel, data[2]}}
+	}
+	return [][]byte{data}
+}
+
+// Least recently used member channel with no note sounding, or the least
+// recently used one if all are busy
+func (e *Expander) allocate() uint8 {
+	busy := make(map[uint8]bool, len(e.channels))
+	for _, c := range e.channels {
+		busy[c] = true
+	}
+	index := 0
+	for i, c := range e.used {
+		if !busy[c] {
+			index = i
+			break
+		}
+	}
+	channel := e.used[index]
+	e.used = append(append(e.used[:index:index], e.used[index+1:]...), channel)
+	return channel
+}
@@ -0,0 +1,186 @@
+package mtc
+
+import (
+	"errors"
+	"math"
+)
+
+// MIDI Time Code frame rates, as encoded in quarter frame piece 7
+type Rate uint8
+
+const (
+	Rate24        = 0
+	Rate25        = 1
+	Rate2997Drop  = 2
+	Rate30        = 3
+	QuarterFrame  = 0xF1
+	quarterFrames = 8 // Quarter frames per full time code (2 frames)
+)
+
+func ParseRate(str string) (Rate, error) {
+	switch str {
+	case "24":
+		return Rate24, nil
+	case "", "25":
+		return Rate25, nil
+	case "29.97", "29.97df":
+		return Rate2997Drop, nil
+	case "30":
+		return Rate30, nil
+	}
+	return Rate25, errors.New("Invalid MTC frame rate '" + str + "': expected 24, 25, 29.97 or 30")
+}
+
+// Frames per second
+func (r Rate) FPS() float64 {
+	switch r {
+	case Rate24:
+		return 24
+	case Rate2997Drop:
+		return 30000.0 / 1001.0
+	case Rate30:
+		return 30
+	}
+	return 25
+}
+
+func (r Rate) String() string {
+	switch r {
+	case Rate24:
+		return "24"
+	case Rate2997Drop:
+		return "29.97 drop frame"
+	case Rate30:
+		return "30"
+	}
+	return "25"
+}
+
+// Duration of a quarter frame, in seconds
+func (r Rate) QuarterFrameDuration() float64 {
+	return 1 / (4 * r.FPS())
+}
+
+// Time code of a position in seconds
+func ToTimeCode(seconds float64, r Rate) (hours, minutes, secs, frames int) {
+	if seconds < 0 {
+		seconds = 0
+	}
+	frame := int(math.Floor(seconds*r.FPS() + 1e-6))
+	nominal := int(math.Round(r.FPS()))
+
+	//Drop frame: frame numbers 0 and 1 are skipped every minute, except every tenth minute
+	if r == Rate2997Drop {
+		d := frame / 17982
+		m := frame % 17982
+		frame += 18 * d
+		if m >= 2 {
+			frame += 2 * ((m - 2) / 1798)
+		}
+	}
+
+	frames = frame % nominal
+	secs = (frame / nominal) % 60
+	minutes = (frame / (nominal * 60)) % 60
+	hours = (frame / (nominal * 3600)) % 24
+	return
+}
+
+// Position in seconds of a time code
+func FromTimeCode(hours, minutes, secs, frames int, r Rate) float64 {
+	nominal := int(math.Round(r.FPS()))
+	frame := ((hours*60+minutes)*60+secs)*nominal + frames
+	if r == Rate2997Drop {
+		totalMinutes := hours*60 + minutes
+		frame -= 2 * (totalMinutes - totalMinutes/10)
+	}
+	return float64(frame) / r.FPS()
+}
+
+// Data byte of quarter frame piece (0-7) for the time code at seconds
+func QuarterFrameData(piece int, seconds float64, r Rate) byte {
+	hours, minutes, secs, frames := ToTimeCode(seconds, r)
+
+	var value int
+	switch piece {
+	case 0:
+		value = frames & 0x0F
+	case 1:
+		value = frames >> 4
+	case 2:
+		value = secs & 0x0F
+	case 3:
+		value = secs >> 4
+	case 4:
+		value = minutes & 0x0F
+	case 5:
+		value = minutes >> 4
+	case 6:
+		value = hours & 0x0F
+	case 7:
+		value = (hours >> 4) | int(r)<<1
+	}
+	return byte(piece<<4 | (value & 0x0F))
+}
+
+// Full frame SysEx message, sent to locate receivers
+func FullFrame(seconds float64, r Rate) []byte {
+	hours, minutes, secs, frames := ToTimeCode(seconds, r)
+	return []byte{0xF0, 0x7F, 0x7F, 0x01, 0x01, byte(int(r)<<5 | hours), byte(minutes), byte(secs), byte(frames), 0xF7}
+}
+
+// Assembles quarter frames into positions. Only forward playback is followed.
+type Decoder struct {
+	pieces   [quarterFrames]byte
+	received uint8 // Bitmask of pieces received in the current cycle
+	base     float64
+	valid    bool
+	rate     Rate
+}
+
+// Feed the data byte of a quarter frame. Returns the current position in
+// seconds, once a full time code was received.
+func (d *Decoder) QuarterFrame(data byte) (seconds float64, ok bool) {
+	piece := int(data >> 4)
+	if piece >= quarterFrames {
+		return 0, false
+	}
+	if piece == 0 {
+		d.received = 0
+	}
+	d.pieces[piece] = data & 0x0F
+	d.received |= 1 << piece
+
+	if piece == quarterFrames-1 {
+		if d.received != 0xFF {
+			d.valid = false
+			return 0, false
+		}
+		d.rate = Rate((d.pieces[7] >> 1) & 0x03)
+		frames := int(d.pieces[0] | d.pieces[1]<<4)
+		secs := int(d.pieces[2] | d.pieces[3]<<4)
+		minutes := int(d.pieces[4] | d.pieces[5]<<4)
+		hours := int(d.pieces[6] | (d.pieces[7]&0x01)<<4)
+
+		//The time code is the one of piece 0, sent two frames ago
+		d.base = FromTimeCode(hours, minutes, secs, frames, d.rate) + 2/d.rate.FPS()
+		d.valid = true
+		return d.base, true
+	}
+
+	if !d.valid {
+		return 0, false
+	}
+	return d.base + float64(piece+1)*d.rate.QuarterFrameDuration(), true
+}
+
+// Frame rate of the received time code
+func (d *Decoder) Rate() Rate {
+	return d.rate
+}
+
+// Forget the current position, after a stop or a jump
+func (d *Decoder) Reset() {
+	d.received = 0
+	d.valid = false
+}
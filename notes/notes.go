@@ -0,0 +1,55 @@
+package notes
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Semitones from C, by note letter
+var noteOffsets = map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+// Convert a note name in scientific pitch notation ("C4", "F#3", "Bb-1") to a
+// MIDI note number, C4 being middle C (60). Plain numbers are accepted too.
+func Parse(name string) (uint8, error) {
+	return ParseMiddleC(name, 4)
+}
+
+// Same as Parse, middle C (60) being in the given octave: 3 for the Yamaha
+// convention ("C3"), 5 for some other manufacturers ("C5")
+func ParseMiddleC(name string, middleC int) (uint8, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		if (n < 0) || (n > 127) {
+			return 0, errors.New("Note number out of range: " + name)
+		}
+		return uint8(n), nil
+	}
+
+	invalid := errors.New("Invalid note name: " + name)
+	if len(name) < 2 {
+		return 0, invalid
+	}
+	offset, ok := noteOffsets[strings.ToUpper(name[:1])[0]]
+	if !ok {
+		return 0, invalid
+	}
+	rest := name[1:]
+	switch {
+	case strings.HasPrefix(rest, "#"):
+		offset++
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "b"):
+		offset--
+		rest = rest[1:]
+	}
+	octave, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0, invalid
+	}
+
+	n := (octave+5-middleC)*12 + offset
+	if (n < 0) || (n > 127) {
+		return 0, errors.New("Note out of MIDI range: " + name)
+	}
+	return uint8(n), nil
+}
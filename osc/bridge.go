@@ -0,0 +1,166 @@
+package osc
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// OSC argument type of a route, derived from the MIDI message value
+type ArgType string
+
+const (
+	ArgTypeInt   ArgType = "int"   // Value as is
+	ArgTypeFloat ArgType = "float" // Value scaled to [0, 1]
+	ArgTypeBool  ArgType = "bool"  // True for any value but 0
+)
+
+func ParseArgType(str string) (ArgType, error) {
+	switch ArgType(str) {
+	case "":
+		return ArgTypeInt, nil
+	case ArgTypeInt, ArgTypeFloat, ArgTypeBool:
+		return ArgType(str), nil
+	}
+	return "", errors.New("Invalid OSC argument type '" + str + "': expected int, float or bool")
+}
+
+// Translation of MIDI messages to an OSC address. The address is a template in
+// which {channel} (1-16), {number} (controller, note or program number) and
+// {value} are replaced by those of the message.
+type Route struct {
+	Status  byte // Message type: 0x80-0xE0, Note On routes also translate Note Off
+	Channel int  // 0-15, -1 for any
+	Number  int  // Controller or note number, -1 for any
+	Address string
+	Type    ArgType
+}
+
+// Addresses of messages no route translates
+var defaultAddresses = map[byte]string{
+	0x80: "/midi/{channel}/note/{number}",
+	0x90: "/midi/{channel}/note/{number}",
+	0xA0: "/midi/{channel}/polypressure/{number}",
+	0xB0: "/midi/{channel}/cc/{number}",
+	0xC0: "/midi/{channel}/program",
+	0xD0: "/midi/{channel}/pressure",
+	0xE0: "/midi/{channel}/pitchbend",
+}
+
+func (r *Route) matches(status byte, channel int, number int) bool {
+	if (r.Status != status) && !((r.Status == 0x90) && (status == 0x80)) {
+		return false
+	}
+	return ((r.Channel < 0) || (r.Channel == channel)) && ((r.Number < 0) || (r.Number == number))
+}
+
+// Sends the MIDI messages of a router as OSC messages over UDP
+type Bridge struct {
+	conn net.Conn
+}
+
+// Connect to an OSC server, address being "host:port"
+func Dial(address string) (*Bridge, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, errors.New("Failed to connect to OSC server " + address + ": " + err.Error())
+	}
+	return &Bridge{conn: conn}, nil
+}
+
+// OSC messages for the MIDI messages of data, translated with route when they
+// match it (nil for none), with the default addresses otherwise. System
+// messages have no OSC translation and are dropped.
+func Translate(data []byte, route *Route) []Message {
+	var messages []Message
+	for len(data) > 0 {
+		length := messageLength(data)
+		if length > len(data) {
+			break
+		}
+		if (data[0] >= 0x80) && (data[0] < 0xF0) {
+			messages = append(messages, translate(data[:length], route))
+		}
+		data = data[length:]
+	}
+	return messages
+}
+
+func translate(msg []byte, route *Route) Message {
+	status, channel := msg[0]&0xF0, int(msg[0]&0x0F)
+	number, value, max := 0, 0, 127
+	switch status {
+	case 0x80:
+		number = int(msg[1])
+	case 0x90, 0xA0, 0xB0:
+		number, value = int(msg[1]), int(msg[2])
+	case 0xC0:
+		number, value = int(msg[1]), int(msg[1])
+	case 0xD0:
+		value = int(msg[1])
+	case 0xE0:
+		value, max = int(msg[1])|int(msg[2])<<7, 16383
+	}
+
+	address, argType := defaultAddresses[status], ArgTypeInt
+	if (route != nil) && route.matches(status, channel, number) {
+		address, argType = route.Address, route.Type
+	}
+	address = strings.NewReplacer(
+		"{channel}", strconv.Itoa(channel+1),
+		"{number}", strconv.Itoa(number),
+		"{value}", strconv.Itoa(value),
+	).Replace(address)
+
+	var arg interface{}
+	switch argType {
+	case ArgTypeFloat:
+		arg = float32(value) / float32(max)
+	case ArgTypeBool:
+		arg = value != 0
+	default:
+		arg = int32(value)
+	}
+	return Message{Address: address, Args: []interface{}{arg}}
+}
+
+// Send the MIDI messages of data, one datagram per OSC message
+func (b *Bridge) Send(data []byte, route *Route) error {
+	for _, m := range Translate(data, route) {
+		packet, err := m.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if _, err := b.conn.Write(packet); err != nil {
+			return errors.New("Failed to send OSC message: " + err.Error())
+		}
+	}
+	return nil
+}
+
+func (b *Bridge) Close() error {
+	return b.conn.Close()
+}
+
+// Length of the message starting data, up to the next status byte for SysEx
+// and stray data bytes
+func messageLength(data []byte) int {
+	switch {
+	case (data[0] == 0xF0) || (data[0] < 0x80):
+		for i := 1; i < len(data); i++ {
+			if data[i] >= 0x80 {
+				if data[i] == 0xF7 {
+					return i + 1
+				}
+				return i
+			}
+		}
+		return len(data)
+	case (data[0] == 0xF1) || (data[0] == 0xF3) || (data[0]&0xF0 == 0xC0) || (data[0]&0xF0 == 0xD0):
+		return 2
+	case (data[0] == 0xF2) || (data[0] < 0xF0):
+		return 3
+	}
+	return 1
+}
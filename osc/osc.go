@@ -0,0 +1,53 @@
+package osc
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+)
+
+// An Open Sound Control message: an address and typed arguments (int32,
+// float32 or bool)
+type Message struct {
+	Address string
+	Args    []interface{}
+}
+
+// OSC 1.0 binary encoding of the message
+func (m Message) MarshalBinary() ([]byte, error) {
+	if !strings.HasPrefix(m.Address, "/") {
+		return nil, errors.New("Invalid OSC address '" + m.Address + "': must start with /")
+	}
+	tags := ","
+	var args []byte
+	for _, arg := range m.Args {
+		switch v := arg.(type) {
+		case int32:
+			tags += "i"
+			args = binary.BigEndian.AppendUint32(args, uint32(v))
+		case float32:
+			tags += "f"
+			args = binary.BigEndian.AppendUint32(args, math.Float32bits(v))
+		case bool:
+			//Booleans are carried by the type tag only
+			if v {
+				tags += "T"
+			} else {
+				tags += "F"
+			}
+		default:
+			return nil, errors.New("Unsupported OSC argument type")
+		}
+	}
+
+	data := appendString(nil, m.Address)
+	data = appendString(data, tags)
+	return append(data, args...), nil
+}
+
+// OSC string: null terminated, padded to a multiple of 4 bytes
+func appendString(data []byte, str string) []byte {
+	data = append(data, str...)
+	return append(data, make([]byte, 4-len(str)%4)...)
+}
@@ -0,0 +1,254 @@
+package remote
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Frame layout, integers big endian: length u16 (of what follows), sending
+// time u64 (Unix microseconds), MIDI bytes (one or more complete messages)
+const (
+	headerLength   = 8
+	maxFrameLength = 0xFFFF
+	redialDelay    = time.Second
+	writeTimeout   = 100 * time.Millisecond
+)
+
+// MIDI data sent by a remote router, and when it was sent
+type Frame struct {
+	At   time.Time
+	Data []byte
+}
+
+func WriteFrame(w io.Writer, f Frame) error {
+	if len(f.Data)+headerLength > maxFrameLength {
+		return errors.New("Failed to send remote frame: too much data")
+	}
+	buf := binary.BigEndian.AppendUint16(nil, uint16(headerLength+len(f.Data)))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(f.At.UnixMicro()))
+	_, err := w.Write(append(buf, f.Data...))
+	return err
+}
+
+func ReadFrame(r io.Reader) (Frame, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return Frame{}, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return Frame{}, err
+	}
+	if len(buf) < headerLength {
+		return Frame{}, errors.New("Invalid remote frame: too short")
+	}
+	at := time.UnixMicro(int64(binary.BigEndian.Uint64(buf)))
+	return Frame{At: at, Data: buf[headerLength:]}, nil
+}
+
+// Connection to a remote router, re-established in the background when lost.
+// Data sent while disconnected is dropped.
+type Sender struct {
+	address  string
+	secret   []byte
+	mutex    sync.Mutex
+	conn     net.Conn
+	greeting [][]byte      // Sent first on every new connection
+	lost     chan struct{} // Wakes the dialer up
+	quit     chan struct{}
+	start    sync.Once
+	stop     sync.Once
+}
+
+// Sender to a remote router listening on address ("host:port"), connecting
+// on Connect. With a secret, the listener must have the same one.
+func NewSender(address string, secret string) *Sender {
+	s := &Sender{address: address, lost: make(chan struct{}, 1), quit: make(chan struct{})}
+	if secret != "" {
+		s.secret = []byte(secret)
+	}
+	return s
+}
+
+// Connect once, then keep connecting again in the background whenever the
+// connection is lost. The error is the one of the first attempt.
+func (s *Sender) Connect() error {
+	var err error
+
+	s.start.Do(func() {
+		err = s.dial()
+		if err != nil {
+			s.lost <- struct{}{}
+		}
+		go s.redial()
+	})
+	return err
+}
+
+func (s *Sender) redial() {
+	for {
+		select {
+		case <-s.lost:
+		case <-s.quit:
+			return
+		}
+		for s.dial() != nil {
+			select {
+			case <-time.After(redialDelay):
+			case <-s.quit:
+				return
+			}
+		}
+	}
+}
+
+func (s *Sender) dial() error {
+	conn, err := net.DialTimeout("tcp", s.address, redialDelay)
+	if err != nil {
+		return errors.New("Failed to connect to remote router " + s.address + ": " + err.Error())
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetNoDelay(true)
+	}
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := answerChallenge(conn, s.secret); err != nil {
+		conn.Close()
+		return errors.New("Failed to authenticate to remote router " + s.address + ": " + err.Error())
+	}
+	s.mutex.Lock()
+	greeting := s.greeting
+	s.mutex.Unlock()
+	for _, data := range greeting {
+		if err := WriteFrame(conn, Frame{At: time.Now(), Data: data}); err != nil {
+			conn.Close()
+			return errors.New("Failed to send to remote router " + s.address + ": " + err.Error())
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	select {
+	case <-s.quit:
+		conn.Close()
+	default:
+		s.conn = conn
+	}
+	return nil
+}
+
+// Data sent first whenever the connection is established again
+func (s *Sender) SetGreeting(messages [][]byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.greeting = messages
+}
+
+// Send right away or fail: a slow remote router doesn't block the output
+func (s *Sender) Send(data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		return errors.New("Failed to send to remote router " + s.address + ": not connected")
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := WriteFrame(s.conn, Frame{At: time.Now(), Data: data}); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		select {
+		case s.lost <- struct{}{}:
+		default:
+		}
+		return errors.New("Failed to send to remote router " + s.address + ": " + err.Error())
+	}
+	return nil
+}
+
+func (s *Sender) Close() error {
+	s.stop.Do(func() { close(s.quit) })
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// Accepts remote routers, receive being called for every frame they send
+type Listener struct {
+	listener net.Listener
+	secret   []byte
+	mutex    sync.Mutex
+	conns    map[net.Conn]struct{}
+}
+
+// Listen for remote routers on address (":port" or "host:port"). With a
+// secret, only the routers having the same one are accepted.
+func Listen(address string, secret string, receive func(f Frame)) (*Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, errors.New("Failed to listen for remote routers on " + address + ": " + err.Error())
+	}
+	l := &Listener{listener: listener, conns: make(map[net.Conn]struct{})}
+	if secret != "" {
+		l.secret = []byte(secret)
+	}
+	go l.accept(receive)
+	return l, nil
+}
+
+func (l *Listener) accept(receive func(f Frame)) {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+		l.mutex.Lock()
+		l.conns[conn] = struct{}{}
+		l.mutex.Unlock()
+
+		go func() {
+			conn.SetDeadline(time.Now().Add(handshakeTimeout))
+			err := challenge(conn, l.secret)
+			conn.SetDeadline(time.Time{})
+			reader := bufio.NewReader(conn)
+			for err == nil {
+				var f Frame
+				if f, err = ReadFrame(reader); err == nil {
+					receive(f)
+				}
+			}
+			conn.Close()
+			l.mutex.Lock()
+			delete(l.conns, conn)
+			l.mutex.Unlock()
+		}()
+	}
+}
+
+// Address the listener is bound to
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+func (l *Listener) Close() error {
+	err := l.listener.Close()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package router
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/midi"
+	"bytes"
+	"time"
+)
+
+const (
+	activeSensing = 0xFE
+
+	// A receiver expects a message at least every 300ms once Active Sensing started
+	activeSensingInterval       = 270 * time.Millisecond
+	DefaultActiveSensingTimeout = 300 * time.Millisecond
+)
+
+// Send Active Sensing to the destination when nothing else was sent lately
+// (output), and/or treat the loss of incoming Active Sensing as a disconnected
+// source, sending the cleanup sequence (input).
+func (relay *MIDIRouter) SetActiveSensing(output bool, input bool, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultActiveSensingTimeout
+	}
+	if output {
+		go relay.generateActiveSensing()
+	}
+	if input {
+		go relay.watchActiveSensing(timeout)
+	}
+}
+
+func (relay *MIDIRouter) generateActiveSensing() {
+	ticker := time.NewTicker(activeSensingInterval / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-relay.quit:
+			return
+		case <-ticker.C:
+			if clock.Since(relay.clock, time.Unix(0, relay.lastSent.Load())) >= activeSensingInterval {
+				relay.output.push(midi.Packet{Data: []byte{activeSensing}})
+			}
+		}
+	}
+}
+
+func (relay *MIDIRouter) watchActiveSensing(timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 6)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-relay.quit:
+			return
+		case <-ticker.C:
+			if relay.sensingSource.Load() && clock.Since(relay.clock, time.Unix(0, relay.lastReceived.Load())) > timeout {
+				relay.sensingSource.Store(false)
+				relay.log.Info("Active Sensing lost: source disconnected, sending cleanup messages")
+				relay.sendCleanup()
+			}
+		}
+	}
+}
+
+// Keep track of incoming traffic for the Active Sensing watchdog
+func (relay *MIDIRouter) trackReceived(packet midi.Packet) {
+	relay.lastReceived.Store(relay.clock.Now().UnixNano())
+	if bytes.IndexByte(packet.Data, activeSensing) >= 0 {
+		relay.sensingSource.Store(true)
+	}
+}
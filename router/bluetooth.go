@@ -0,0 +1,203 @@
+package router
+
+import (
+	"MIDIRouter/backend"
+	"MIDIRouter/midi"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Devices named "ble:<name>" are Bluetooth LE MIDI peripherals. Scanning and
+// pairing are left to the system, which remembers paired peripherals (Audio
+// MIDI Setup > MIDI Studio > Bluetooth on macOS): the router polls the devices
+// of the backend for one whose name contains <name>, preferring the one it
+// used last (saved in the StateFile), waits for it while it is out of range,
+// and connects again when it comes back. Out of range peripherals that stay
+// listed, marked offline, are skipped.
+const (
+	blePrefix    = "ble:"
+	bleScanDelay = time.Second
+)
+
+func isBLEDevice(device string) bool {
+	return strings.HasPrefix(device, blePrefix)
+}
+
+// Peripheral the router uses or waits for
+type bleDevice struct {
+	name      string // Part of the device name
+	input     bool
+	mutex     sync.Mutex
+	connected string // Device connected to, "" while out of range
+	last      string // Device connected to last, preferred when several match
+	greeting  [][]byte
+	done      chan struct{}
+}
+
+func (relay *MIDIRouter) setupBLESource() error {
+	//Offline routers are fed by replays and self-tests
+	if _, offline := relay.backend.(*backend.Memory); offline {
+		return nil
+	}
+	relay.bleSource = relay.watchBLE(strings.TrimPrefix(relay.sourceDevice, blePrefix), true)
+	return nil
+}
+
+func (relay *MIDIRouter) setupBLEDestination() error {
+	if _, offline := relay.backend.(*backend.Memory); offline {
+		return nil
+	}
+	relay.bleDestination = relay.watchBLE(strings.TrimPrefix(relay.destinationDevice, blePrefix), false)
+	return nil
+}
+
+// Connect to the peripheral if it is in range, then look for it every
+// bleScanDelay
+func (relay *MIDIRouter) watchBLE(name string, input bool) *bleDevice {
+	d := &bleDevice{name: name, input: input, done: make(chan struct{})}
+	if !relay.scanBLE(d) {
+		relay.log.Info("Waiting for Bluetooth device '" + name + "'")
+	}
+	go func() {
+		ticker := time.NewTicker(bleScanDelay)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.done:
+				return
+			case <-ticker.C:
+				relay.scanBLE(d)
+			}
+		}
+	}()
+	return d
+}
+
+// Matching devices in range, in listing order
+func (relay *MIDIRouter) bleCandidates(d *bleDevice) ([]string, error) {
+	var names []string
+	var err error
+	if d.input {
+		names, err = relay.backend.Sources()
+	} else {
+		names, err = relay.backend.Destinations()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	offline, _ := relay.backend.(backend.OfflineBackend)
+	var candidates []string
+	for _, n := range names {
+		if !strings.Contains(n, d.name) {
+			continue
+		}
+		if offline != nil {
+			if off, err := offline.Offline(n, d.input); (err == nil) && off {
+				continue
+			}
+		}
+		candidates = append(candidates, n)
+	}
+	return candidates, nil
+}
+
+// Follow the peripheral going out of range and coming back, true if connected
+func (relay *MIDIRouter) scanBLE(d *bleDevice) bool {
+	candidates, err := relay.bleCandidates(d)
+	if err != nil {
+		relay.log.Error(err)
+		return false
+	}
+
+	d.mutex.Lock()
+	//The device used last first, then the one connected, then the first one
+	found := ""
+	for _, preferred := range []string{d.last, d.connected} {
+		for _, n := range candidates {
+			if (found == "") && (preferred != "") && (n == preferred) {
+				found = n
+			}
+		}
+	}
+	if (found == "") && (len(candidates) > 0) {
+		found = candidates[0]
+	}
+	if (found != "") && (found == d.connected) {
+		d.mutex.Unlock()
+		return true
+	}
+	if d.connected != "" {
+		relay.log.Info("Bluetooth device '" + d.connected + "' disconnected")
+		d.connected = ""
+	}
+	if found == "" {
+		d.mutex.Unlock()
+		return false
+	}
+
+	//Opening replaces the port of the device connected before
+	if d.input {
+		err = relay.backend.OpenSource(found, relay.onPacket)
+	} else {
+		err = relay.backend.OpenDestination(found)
+	}
+	if err != nil {
+		d.mutex.Unlock()
+		relay.log.Error(err)
+		return false
+	}
+	d.connected = found
+	d.last = found
+	greeting := d.greeting
+	d.mutex.Unlock()
+
+	relay.log.Info("Bluetooth device '" + found + "' connected")
+	//Pushed unlocked, the output checking the connection
+	for _, data := range greeting {
+		relay.output.push(midi.NewPacket(data, 0))
+	}
+	return true
+}
+
+func (d *bleDevice) setGreeting(messages [][]byte) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.greeting = messages
+}
+
+// Error while the destination peripheral is out of range
+func (d *bleDevice) check() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.connected == "" {
+		return errors.New("Failed to send to Bluetooth device '" + d.name + "': not connected")
+	}
+	return nil
+}
+
+// Device connected to last, "" if none
+func (d *bleDevice) lastDevice() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.last
+}
+
+// Prefer the device used last by a previous run, once back in range
+func (d *bleDevice) setLastDevice(name string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if name != "" {
+		d.last = name
+	}
+}
+
+func (d *bleDevice) close() {
+	close(d.done)
+}
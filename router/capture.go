@@ -0,0 +1,133 @@
+package router
+
+import (
+	"MIDIRouter/backend"
+	"MIDIRouter/clock"
+	"MIDIRouter/midi"
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// A line of a session capture: a message received from the source (In) or sent
+// to the destination (Out), as hex string, At microseconds from the start.
+type CaptureEntry struct {
+	At  int64  `json:"at"`
+	In  string `json:"in,omitempty"`
+	Out string `json:"out,omitempty"`
+}
+
+// JSON lines session capture
+type capture struct {
+	mutex   sync.Mutex
+	start   time.Time
+	encoder *json.Encoder
+}
+
+// Capture every message received and sent by the router to w, one JSON object
+// per line. Captures can be replayed with Replay to check a configuration
+// still produces the same output.
+func (relay *MIDIRouter) SetCapture(w io.Writer) {
+	relay.capture = &capture{start: time.Now(), encoder: json.NewEncoder(w)}
+}
+
+func (c *capture) write(entry CaptureEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry.At = time.Since(c.start).Microseconds()
+	if err := c.encoder.Encode(entry); err != nil {
+		//Stop capturing rather than logging on every message
+		c.encoder = json.NewEncoder(io.Discard)
+	}
+}
+
+func (relay *MIDIRouter) captureIncoming(msg midi.Packet) {
+	if relay.capture != nil {
+		relay.capture.write(CaptureEntry{In: hex.EncodeToString(msg.Data)})
+	}
+}
+
+func (relay *MIDIRouter) captureOutgoing(packet midi.Packet) {
+	if relay.capture == nil {
+		return
+	}
+	messages, _ := splitMIDIData(packet.Data)
+	for _, msg := range messages {
+		relay.capture.write(CaptureEntry{Out: hex.EncodeToString(msg)})
+	}
+}
+
+// Read a session capture
+func ReadCapture(r io.Reader) ([]CaptureEntry, error) {
+	var entries []CaptureEntry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry CaptureEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("Failed parsing capture line %d: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("Failed reading capture: " + err.Error())
+	}
+	return entries, nil
+}
+
+// Feed the captured input messages through the router with their original
+// timing, then clean it up. Returns the messages it sent, as hex strings.
+// The router must have been created with NewOffline. With a clock.Manual
+// (see SetClock), the replay runs as fast as possible.
+func (relay *MIDIRouter) Replay(entries []CaptureEntry) ([]string, error) {
+	var outputs []string
+	var mutex sync.Mutex
+
+	memory, ok := relay.backend.(*backend.Memory)
+	if !ok {
+		return nil, errors.New("Replay requires an offline router")
+	}
+	memory.OnSend(func(packet midi.Packet) {
+		messages, _ := splitMIDIData(packet.Data)
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, msg := range messages {
+			outputs = append(outputs, hex.EncodeToString(msg))
+		}
+	})
+
+	//With a manual clock, the replay moves it instead of waiting
+	manual, fastForward := relay.clock.(*clock.Manual)
+	start := relay.clock.Now()
+	for _, e := range entries {
+		if e.In == "" {
+			continue
+		}
+		data, err := hex.DecodeString(e.In)
+		if err != nil {
+			return nil, errors.New("Invalid captured message '" + e.In + "'")
+		}
+		at := start.Add(time.Duration(e.At) * time.Microsecond)
+		if fastForward {
+			manual.Set(at)
+		} else {
+			time.Sleep(time.Until(at))
+		}
+		relay.receive(midi.NewPacket(data, 0))
+	}
+	relay.Cleanup()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	return outputs, nil
+}
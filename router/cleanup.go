@@ -0,0 +1,93 @@
+package router
+
+import "MIDIRouter/midi"
+
+// Messages sent to the destination device on exit (and on a Stop message in
+// passthrough mode), to leave it in a clean state.
+type CleanupSettings struct {
+	AllSoundOff      bool   // CC120
+	AllNotesOff      bool   // CC123
+	ReleaseSustain   bool   // CC64 = 0
+	ResetControllers bool   // CC121
+	UsedChannelsOnly bool   // Only channels messages were sent on
+	SysEx            []byte // Custom message, sent last
+}
+
+// Historical behavior: All Notes Off and Reset All Controllers on every channel
+var DefaultCleanupSettings = CleanupSettings{
+	AllNotesOff:      true,
+	ResetControllers: true,
+}
+
+// Everything off, for the panic command
+var PanicSettings = CleanupSettings{
+	AllSoundOff:      true,
+	AllNotesOff:      true,
+	ReleaseSustain:   true,
+	ResetControllers: true,
+}
+
+func (relay *MIDIRouter) SetCleanup(settings CleanupSettings) {
+	relay.cleanup = settings
+}
+
+// Remember channels of sent channel voice messages
+func (relay *MIDIRouter) trackUsedChannels(packet midi.Packet) {
+	for _, b := range packet.Data {
+		if (b >= 0x80) && (b < 0xF0) {
+			mask := uint32(1) << (b & 0x0F)
+			if relay.usedChannels.Load()&mask == 0 {
+				relay.usedChannels.Or(mask)
+			}
+		}
+	}
+}
+
+// Send the cleanup sequence right away
+func (relay *MIDIRouter) sendCleanup() {
+	for _, p := range relay.cleanupPackets() {
+		relay.sendNow(p)
+	}
+}
+
+// Returns the cleanup sequence, one packet per channel
+func (relay *MIDIRouter) cleanupPackets() []midi.Packet {
+	return relay.cleanup.packets(relay.usedChannels.Load())
+}
+
+// Cleanup sequence on every channel, whatever UsedChannelsOnly
+func (settings CleanupSettings) Packets() []midi.Packet {
+	return settings.packets(0xFFFF)
+}
+
+func (settings CleanupSettings) packets(usedChannels uint32) []midi.Packet {
+	var packets []midi.Packet
+
+	for ch := 0; ch < 16; ch++ {
+		if settings.UsedChannelsOnly && (usedChannels&(1<<ch) == 0) {
+			continue
+		}
+		var data []byte
+		status := 0xB0 | byte(ch)
+		if settings.AllSoundOff {
+			data = append(data, status, 120, 0)
+		}
+		if settings.AllNotesOff {
+			data = append(data, status, 123, 0)
+		}
+		if settings.ReleaseSustain {
+			data = append(data, status, 64, 0)
+		}
+		if settings.ResetControllers {
+			data = append(data, status, 121, 0)
+		}
+		if len(data) > 0 {
+			packets = append(packets, midi.Packet{Data: data})
+		}
+	}
+
+	if len(settings.SysEx) > 0 {
+		packets = append(packets, midi.Packet{Data: settings.SysEx})
+	}
+	return packets
+}
@@ -0,0 +1,39 @@
+package router
+
+import "MIDIRouter/midi"
+
+// Send messages putting the destination device in the right mode (local
+// off, multi mode...) right away, the destination being connected, and again
+// whenever the connection to a remote router destination is re-established
+// or a participant joins an RTP-MIDI session destination, or a Bluetooth
+// destination comes back in range
+func (relay *MIDIRouter) SendOnConnect(messages [][]byte) {
+	if len(messages) == 0 {
+		return
+	}
+	if relay.remoteDestination != nil {
+		relay.remoteDestination.SetGreeting(messages)
+	}
+	if relay.rtpDestination != nil {
+		relay.rtpDestination.SetGreeting(messages)
+	}
+	if relay.bleDestination != nil {
+		relay.bleDestination.setGreeting(messages)
+	}
+	relay.log.Infof("Sending %d OnConnect messages\n", len(messages))
+	for _, data := range messages {
+		relay.output.push(midi.NewPacket(data, 0))
+	}
+}
+
+// Messages sent to the destination device on exit, after the cleanup
+// sequence (local on, a goodbye SysEx, restore a program...)
+func (relay *MIDIRouter) SetOnDisconnect(messages [][]byte) {
+	relay.onDisconnect = messages
+}
+
+func (relay *MIDIRouter) sendOnDisconnect() {
+	for _, data := range relay.onDisconnect {
+		relay.sendNow(midi.NewPacket(data, 0))
+	}
+}
@@ -0,0 +1,148 @@
+package router
+
+import (
+	"MIDIRouter/backend"
+	"MIDIRouter/midi"
+	"MIDIRouter/osc"
+	"errors"
+)
+
+// Named destination devices, for one source to drive several synthesizers.
+// Packets go to all of them, unless the rule generating them targets one
+// (see rule.SetDestination): those go through their own output queue and
+// the send path, to that destination only.
+type destination struct {
+	name    string
+	device  string
+	backend backend.Backend // nil for the router destination device, and offline
+	send    func(packet midi.Packet) error
+	output  *outputQueue // Packets of the rules targeting the destination
+	osc     *osc.Route   // OSC translation of the packets, nil for the default one
+}
+
+// Name the router destination device, for rules to target it
+func (relay *MIDIRouter) SetDestinationName(name string) {
+	relay.addDestination(&destination{name: name, device: relay.destinationDevice})
+}
+
+// Send to device as well, rules targeting it by name. Only MIDI devices can
+// be added, with the same overflow policy as the router destination.
+func (relay *MIDIRouter) AddDestination(name string, device string) error {
+	for _, d := range relay.destinations {
+		if d.name == name {
+			return errors.New("Failed to add destination " + name + ": name already used")
+		}
+	}
+	if isOSCDestination(device) || isRemoteDevice(device) || isRTPMIDIDevice(device) || isVirtualDevice(device) || isBLEDevice(device) {
+		return errors.New("Failed to add destination " + name + ": only MIDI devices can be added")
+	}
+	d := &destination{name: name, device: device}
+	//Offline routers keep the output of every destination
+	if _, offline := relay.backend.(*backend.Memory); !offline {
+		resolved, err := relay.resolveDevice(device, false)
+		if err != nil {
+			return err
+		}
+		b, err := backend.NewSystem()
+		if err != nil {
+			return err
+		}
+		if err := b.OpenDestination(resolved); err != nil {
+			return err
+		}
+		d.backend = b
+	}
+	relay.addDestination(d)
+	relay.log.Info("Destination '" + name + "': " + device)
+	return nil
+}
+
+func (relay *MIDIRouter) addDestination(d *destination) {
+	relay.initDestination(d)
+	relay.destinations = append(relay.destinations, d)
+}
+
+// Set up the send path and output queue of d
+func (relay *MIDIRouter) initDestination(d *destination) {
+	d.send = relay.chain(func(packet midi.Packet) error {
+		return relay.deliverTo(d, packet)
+	})
+	d.output = newOutputQueue(cap(relay.output.packets), relay.output.policy, func(packet midi.Packet) {
+		if err := d.send(packet); err != nil {
+			relay.log.Error("Failed to send MIDI packet to '"+d.name+"':", err)
+		}
+	})
+}
+
+// Names of the destinations rules can target
+func (relay *MIDIRouter) DestinationNames() []string {
+	names := []string{}
+	for _, d := range relay.destinations {
+		names = append(names, d.name)
+	}
+	return names
+}
+
+// Queue of the packets sent to the destination named name, all of them if ""
+func (relay *MIDIRouter) outputFor(name string) *outputQueue {
+	for _, d := range relay.destinations {
+		if (name != "") && (d.name == name) {
+			return d.output
+		}
+	}
+	return relay.output
+}
+
+// End of the send path of the rules targeting d
+func (relay *MIDIRouter) deliverTo(d *destination, packet midi.Packet) error {
+	relay.recordOutgoing(packet)
+	relay.captureOutgoing(packet)
+	relay.lastSent.Store(relay.clock.Now().UnixNano())
+	if (d.osc != nil) && (relay.osc != nil) {
+		return relay.osc.Send(packet.Data, d.osc)
+	}
+	if d.backend == nil {
+		return relay.deliverDevice(packet)
+	}
+	return d.backend.Send(packet)
+}
+
+// Send to the added destinations as well
+func (relay *MIDIRouter) broadcast(packet midi.Packet) error {
+	var err error
+	for _, d := range relay.destinations {
+		if d.backend == nil {
+			continue
+		}
+		if e := d.backend.Send(packet); e != nil {
+			err = errors.New("'" + d.name + "': " + e.Error())
+		}
+	}
+	return err
+}
+
+func (relay *MIDIRouter) closeDestinations() {
+	relay.oscMutex.Lock()
+	for _, d := range relay.oscOutputs {
+		d.output.close()
+	}
+	relay.oscMutex.Unlock()
+
+	for _, d := range relay.destinations {
+		d.output.close()
+		if d.output.sent.Load() > 0 {
+			relay.log.Infof("Output '%s': %d packets sent, %d dropped\n", d.name, d.output.sent.Load(), d.output.dropped.Load())
+		}
+	}
+}
+
+func (relay *MIDIRouter) closeDestinationBackends() {
+	for _, d := range relay.destinations {
+		if d.backend == nil {
+			continue
+		}
+		if err := d.backend.Close(); err != nil {
+			relay.log.Error(err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"MIDIRouter/midi"
+	"MIDIRouter/rule"
+)
+
+// What handled a message, when not the rules
+type Handled string
+
+const (
+	HandledRules       Handled = ""
+	HandledSystem      Handled = "system policy"
+	HandledTap         Handled = "tap tempo"
+	HandledSnapshot    Handled = "snapshot"
+	HandledPassthrough Handled = "passthrough"
+	HandledZones       Handled = "keyboard zones"
+	HandledVetoed      Handled = "vetoed"     // By an OnMatched hook
+	HandledSendLimit   Handled = "send limit" // Dropped
+)
+
+// Outcome of the evaluation of a message by the router
+type Evaluation struct {
+	Message []byte
+	Handled Handled
+	Matched bool
+	Result  rule.MatchResult
+	Output  []midi.Packet // Sent right away, delayed messages left out
+}
+
+// Run the messages of data through the router, as if received from the source:
+// the decision path is that of received messages, sending to the destination
+// (nowhere for offline routers, see NewOffline). Rule state (duplicates, CCAh)
+// is updated.
+func (relay *MIDIRouter) Evaluate(data []byte) []Evaluation {
+	var evaluations []Evaluation
+
+	messages, _ := splitMIDIData(data)
+	for _, msg := range messages {
+		for _, p := range relay.collapseMPE(midi.NewPacket(msg, 0)) {
+			evaluations = append(evaluations, relay.route(p))
+		}
+	}
+	return evaluations
+}
+
+// Whether unmatched messages are sent as is
+func (relay *MIDIRouter) Passthrough() bool {
+	return relay.defaultPassThrough
+}
@@ -0,0 +1,45 @@
+package router
+
+import (
+	"MIDIRouter/midi"
+	"MIDIRouter/rule"
+)
+
+// Callbacks for applications embedding the router. Each returns whether the
+// router should go on: false vetoes the message. Callbacks must be set before
+// Start and must not block, they run on the MIDI threads.
+type eventHooks struct {
+	received func(packet midi.Packet) bool
+	matched  func(result rule.MatchResult) bool
+	sent     func(packet midi.Packet) bool
+}
+
+// Called for each message read from the source (SysEx reassembled), before
+// any processing. Returning false ignores the message.
+func (relay *MIDIRouter) OnPacketReceived(callback func(packet midi.Packet) bool) {
+	relay.events.received = callback
+}
+
+// Called when a rule matched a message, with the generated packets. Returning
+// false drops them.
+func (relay *MIDIRouter) OnRuleMatched(callback func(result rule.MatchResult) bool) {
+	relay.events.matched = callback
+}
+
+// Called for each packet about to be sent to the destination, once validated
+// and normalized. Returning false drops the packet.
+func (relay *MIDIRouter) OnPacketSent(callback func(packet midi.Packet) bool) {
+	relay.events.sent = callback
+}
+
+func (e *eventHooks) onReceived(packet midi.Packet) bool {
+	return (e.received == nil) || e.received(packet)
+}
+
+func (e *eventHooks) onMatched(result rule.MatchResult) bool {
+	return (e.matched == nil) || e.matched(result)
+}
+
+func (e *eventHooks) onSent(packet midi.Packet) bool {
+	return (e.sent == nil) || e.sent(packet)
+}
@@ -0,0 +1,49 @@
+package router
+
+import (
+	"MIDIRouter/midi"
+	"MIDIRouter/rule"
+)
+
+// Jump table of rules by status byte (message type, channel), in priority
+// order, so that only rules able to match a message are evaluated.
+type ruleIndex [256][]*rule.Rule
+
+func (index *ruleIndex) add(r *rule.Rule) {
+	for status := 0; status < 256; status++ {
+		if r.QuickMatch(byte(status)) {
+			index[status] = append(index[status], r)
+		}
+	}
+}
+
+func (index *ruleIndex) candidates(packet midi.Packet) []*rule.Rule {
+	if len(packet.Data) == 0 {
+		return nil
+	}
+	return index[packet.Data[0]]
+}
+
+// Result of the first rule (by priority) matching the packet, and that rule
+// (nil if none). Later rules do not see the message, so their state
+// (DropDuplicates, CCAh, toggles, notes) only follows the messages they match.
+func (relay *MIDIRouter) matchingRule(packet midi.Packet) (rule.MatchResult, *rule.Rule) {
+	monitored := false
+	for _, r := range relay.index.candidates(packet) {
+		log := relay.ruleLog(r)
+		if (relay.verboseTag != "") && (log == relay.log) && !monitored {
+			//Verbose output limited to tagged rules: the input is logged
+			//when the first of them sees it
+			log.DebugMessages("in", packet.Data)
+			monitored = true
+		}
+		res := r.Match(packet, log)
+		if res.Result != rule.RuleMatchResultNoMatch {
+			r.CountMatch()
+			res.Destination = r.Destination()
+			res.OSC = r.OSC()
+			return res, r
+		}
+	}
+	return rule.MatchResult{Result: rule.RuleMatchResultNoMatch, MainPacket: packet}, nil
+}
@@ -0,0 +1,130 @@
+package router
+
+import (
+	"MIDIRouter/backend"
+	"MIDIRouter/logger"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// MIDI device names are matched against the devices available: exactly, as
+// "regex:<expression>", as a glob pattern ("Scarlett 18i20*", * and ?, from
+// the start of a part of the name), or failing that loosely, ignoring case,
+// spaces and punctuation, for interfaces whose names get varying suffixes
+// ("Scarlett 18i20 USB (Port 1)").
+const regexPrefix = "regex:"
+
+// Devices of available matching name, best matches first
+func matchDevice(name string, available []string) ([]string, error) {
+	for _, a := range available {
+		if a == name {
+			return []string{a}, nil
+		}
+	}
+
+	var pattern *regexp.Regexp
+	switch {
+	case strings.HasPrefix(name, regexPrefix):
+		re, err := regexp.Compile(strings.TrimPrefix(name, regexPrefix))
+		if err != nil {
+			return nil, errors.New("Invalid device pattern '" + name + "': " + err.Error())
+		}
+		pattern = re
+	case strings.ContainsAny(name, "*?"):
+		expr := regexp.QuoteMeta(name)
+		expr = strings.ReplaceAll(expr, `\*`, ".*")
+		expr = strings.ReplaceAll(expr, `\?`, ".")
+		pattern = regexp.MustCompile("(^|/)" + expr + "$")
+	}
+
+	var matches []string
+	if pattern != nil {
+		for _, a := range available {
+			if pattern.MatchString(a) {
+				matches = append(matches, a)
+			}
+		}
+		return matches, nil
+	}
+
+	//The whole name, then all of its words
+	loose := looseName(name)
+	if loose == "" {
+		return nil, nil
+	}
+	var partial []string
+	for _, a := range available {
+		if strings.Contains(looseName(a), loose) {
+			matches = append(matches, a)
+		} else if containsWords(a, name) {
+			partial = append(partial, a)
+		}
+	}
+	return append(matches, partial...), nil
+}
+
+func containsWords(device string, name string) bool {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	loose := looseName(device)
+	for _, w := range words {
+		if !strings.Contains(loose, looseName(w)) {
+			return false
+		}
+	}
+	return len(words) > 0
+}
+
+// Lower case letters and digits of name
+func looseName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// Name of the available device matching name, logged when not an exact match.
+// Unmatched plain names are returned as is, for the backend to report.
+func (relay *MIDIRouter) resolveDevice(name string, input bool) (string, error) {
+	//Offline routers accept any name
+	if _, offline := relay.backend.(*backend.Memory); offline {
+		return name, nil
+	}
+	return ResolveDevice(relay.backend, name, input, relay.log)
+}
+
+// Name of the device of b matching name, as routers resolve it (source if
+// input, destination otherwise), logged to log when not an exact match
+func ResolveDevice(b backend.Backend, name string, input bool, log *logger.Logger) (string, error) {
+	kind, list := "destination", b.Destinations
+	if input {
+		kind, list = "source", b.Sources
+	}
+	available, err := list()
+	if err != nil {
+		return "", err
+	}
+	matches, err := matchDevice(name, available)
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		if strings.HasPrefix(name, regexPrefix) || strings.ContainsAny(name, "*?") {
+			return "", errors.New("No MIDI " + kind + " matches '" + name + "'")
+		}
+		return name, nil
+	}
+	if matches[0] != name {
+		log.Info("Matched MIDI " + kind + " '" + matches[0] + "' for '" + name + "'")
+		if len(matches) > 1 {
+			log.Infof("%d MIDI %ss match '%s' ('%s'), using the first one\n", len(matches), kind, name, strings.Join(matches, "', '"))
+		}
+	}
+	return matches[0], nil
+}
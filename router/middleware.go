@@ -0,0 +1,115 @@
+package router
+
+import "MIDIRouter/midi"
+
+// A send path layer: handles a packet and calls next to pass it on, possibly
+// modified, several times or not at all (dropping it).
+type Middleware func(packet midi.Packet, next func(midi.Packet) error) error
+
+// Add a layer to the send path, after the built-in ones (validation, Note Off
+// normalization, restamping, tracking, transport, MPE) and before packets are recorded and
+// sent to the destination. Layers run in the order they were added, and must
+// be added before Start.
+func (relay *MIDIRouter) Use(m Middleware) {
+	relay.middlewares = append(relay.middlewares, m)
+	relay.buildSendChain()
+}
+
+func (relay *MIDIRouter) buildSendChain() {
+	relay.send = relay.chain(relay.deliver)
+	for _, d := range relay.destinations {
+		d.send = relay.chain(func(packet midi.Packet) error {
+			return relay.deliverTo(d, packet)
+		})
+	}
+}
+
+// Send path ending with last
+func (relay *MIDIRouter) chain(last func(midi.Packet) error) func(midi.Packet) error {
+	layers := []Middleware{
+		relay.validateLayer,
+		relay.normalizeLayer,
+		relay.trackLayer,
+		relay.eventsLayer,
+		relay.transportLayer,
+		relay.mpeLayer,
+	}
+	layers = append(layers, relay.middlewares...)
+
+	send := last
+	for i := len(layers) - 1; i >= 0; i-- {
+		layer, next := layers[i], send
+		send = func(packet midi.Packet) error {
+			return layer(packet, next)
+		}
+	}
+	return send
+}
+
+func (relay *MIDIRouter) validateLayer(packet midi.Packet, next func(midi.Packet) error) error {
+	packet, ok := relay.validate(packet)
+	if !ok {
+		return nil
+	}
+	return next(packet)
+}
+
+func (relay *MIDIRouter) normalizeLayer(packet midi.Packet, next func(midi.Packet) error) error {
+	if relay.noteOffOutput {
+		packet = normalizeNoteOff(packet)
+	}
+	if relay.restamp {
+		packet.TimeStamp = 0
+	}
+	return next(packet)
+}
+
+func (relay *MIDIRouter) trackLayer(packet midi.Packet, next func(midi.Packet) error) error {
+	relay.trackUsedChannels(packet)
+	relay.controllers.track(packet)
+	if relay.watchdog != nil {
+		relay.watchdog.noteOff(packet)
+	}
+	return next(packet)
+}
+
+func (relay *MIDIRouter) eventsLayer(packet midi.Packet, next func(midi.Packet) error) error {
+	if !relay.events.onSent(packet) {
+		return nil
+	}
+	return next(packet)
+}
+
+// End of the send path, to every destination
+func (relay *MIDIRouter) deliver(packet midi.Packet) error {
+	relay.recordOutgoing(packet)
+	relay.captureOutgoing(packet)
+	relay.lastSent.Store(relay.clock.Now().UnixNano())
+	err := relay.deliverDevice(packet)
+	if e := relay.broadcast(packet); e != nil {
+		err = e
+	}
+	return err
+}
+
+// Send to the router destination device
+func (relay *MIDIRouter) deliverDevice(packet midi.Packet) error {
+	if relay.osc != nil {
+		return relay.osc.Send(packet.Data, nil)
+	}
+	if relay.remoteDestination != nil {
+		return relay.remoteDestination.Send(packet.Data)
+	}
+	if relay.rtpDestination != nil {
+		return relay.rtpDestination.Send(packet.Data)
+	}
+	if relay.bleDestination != nil {
+		if err := relay.bleDestination.check(); err != nil {
+			return err
+		}
+	}
+	if relay.umpOutput {
+		return relay.sendUMP(packet)
+	}
+	return relay.backend.Send(packet)
+}
@@ -0,0 +1,53 @@
+package router
+
+import (
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
+	"sync"
+)
+
+// An input held down to change what other rules do, e.g. a shift button
+type modifier struct {
+	name   string
+	filter filterinterface.FilterInterface
+	active bool
+}
+
+type modifiers struct {
+	mutex sync.RWMutex
+	list  []*modifier
+}
+
+// Messages matching the filter with a value above 0 make the modifier active,
+// with a value of 0 (or Note Off) inactive. They are processed by rules as any
+// other message.
+func (relay *MIDIRouter) AddModifier(name string, f filterinterface.FilterInterface) {
+	relay.modifiers.mutex.Lock()
+	defer relay.modifiers.mutex.Unlock()
+
+	relay.modifiers.list = append(relay.modifiers.list, &modifier{name: name, filter: f})
+}
+
+func (relay *MIDIRouter) trackModifiers(packet midi.Packet) {
+	relay.modifiers.mutex.Lock()
+	defer relay.modifiers.mutex.Unlock()
+
+	for _, m := range relay.modifiers.list {
+		if matched, pressed := matchTrigger(m.filter, packet); matched && (pressed != m.active) {
+			m.active = pressed
+			relay.log.Debugf("Modifier '%s': %t\n", m.name, pressed)
+		}
+	}
+}
+
+// Modifier name => active, as seen by expressions
+func (relay *MIDIRouter) Modifiers() map[string]interface{} {
+	relay.modifiers.mutex.RLock()
+	defer relay.modifiers.mutex.RUnlock()
+
+	active := make(map[string]interface{}, len(relay.modifiers.list))
+	for _, m := range relay.modifiers.list {
+		active[m.name] = m.active
+	}
+	return active
+}
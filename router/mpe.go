@@ -0,0 +1,58 @@
+package router
+
+import (
+	"MIDIRouter/midi"
+	"MIDIRouter/mpe"
+)
+
+// The source device plays MPE in this zone: its messages are collapsed to the
+// zone master channel before being handled
+func (relay *MIDIRouter) SetMPEInput(zone mpe.Zone) {
+	relay.mpeInput = mpe.NewCollapser(zone)
+}
+
+// The destination device expects MPE in this zone: notes sent on the zone
+// master channel are spread over member channels. The MPE Configuration
+// Message is sent to set the zone up on the destination.
+func (relay *MIDIRouter) SetMPEOutput(zone mpe.Zone) {
+	relay.mpeOutput = mpe.NewExpander(zone)
+
+	var packets []midi.Packet
+	for _, msg := range zone.ConfigurationMessage() {
+		packets = append(packets, midi.NewPacket(msg, 0))
+	}
+	relay.sendBatch(packets)
+}
+
+func (relay *MIDIRouter) collapseMPE(packet midi.Packet) []midi.Packet {
+	if (relay.mpeInput == nil) || (len(packet.Data) == 0) {
+		return []midi.Packet{packet}
+	}
+	var packets []midi.Packet
+	for _, msg := range relay.mpeInput.Collapse(packet.Data) {
+		packets = append(packets, midi.NewPacket(msg, packet.TimeStamp))
+	}
+	return packets
+}
+
+func (relay *MIDIRouter) mpeLayer(packet midi.Packet, next func(midi.Packet) error) error {
+	if relay.mpeOutput == nil {
+		return next(packet)
+	}
+
+	messages, _ := splitMIDIData(packet.Data)
+	var packets []midi.Packet
+	for _, msg := range messages {
+		for _, expanded := range relay.mpeOutput.Expand(msg) {
+			packets = append(packets, midi.NewPacket(expanded, packet.TimeStamp))
+		}
+	}
+	for _, p := range mergePackets(packets) {
+		//Member channels are cleaned up on exit as well
+		relay.trackUsedChannels(p)
+		if err := next(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package router
+
+import "MIDIRouter/midi"
+
+// Release velocity used when converting a Note On with velocity 0
+const defaultNoteOffVelocity = 0x40
+
+// Many keyboards send Note On with velocity 0 instead of Note Off: rewrite
+// them into the equivalent Note Off. Packets are copied, never modified.
+func normalizeNoteOff(packet midi.Packet) midi.Packet {
+	var data []byte
+
+	for i := 0; i+2 < len(packet.Data); i++ {
+		if (packet.Data[i]&0xF0 == 0x90) && (packet.Data[i+1] < 0x80) && (packet.Data[i+2] == 0) {
+			if data == nil {
+				data = append([]byte{}, packet.Data...)
+			}
+			data[i] = 0x80 | (data[i] & 0x0F)
+			data[i+2] = defaultNoteOffVelocity
+			i += 2
+		}
+	}
+
+	if data == nil {
+		return packet
+	}
+	return midi.NewPacket(data, packet.TimeStamp)
+}
@@ -0,0 +1,71 @@
+package router
+
+import (
+	"MIDIRouter/backend"
+	"MIDIRouter/osc"
+	"strings"
+)
+
+// Destination devices named "osc://<host>:<port>" are OSC servers, sent the
+// output as OSC messages over UDP
+const oscDestinationPrefix = "osc://"
+
+func isOSCDestination(destinationDevice string) bool {
+	return strings.HasPrefix(destinationDevice, oscDestinationPrefix)
+}
+
+func (relay *MIDIRouter) setupOSCDestination() error {
+	address := strings.TrimPrefix(relay.destinationDevice, oscDestinationPrefix)
+	//Offline routers keep the MIDI output, for replays and self-tests
+	if _, offline := relay.backend.(*backend.Memory); offline {
+		return nil
+	}
+	bridge, err := osc.Dial(address)
+	if err != nil {
+		return err
+	}
+	relay.osc = bridge
+	relay.log.Info("Destination OSC server: ", address)
+	return nil
+}
+
+// Whether the destination device is an OSC server, rules setting the OSC
+// address of their messages (see rule.SetOSC)
+func (relay *MIDIRouter) SendsOSC() bool {
+	return isOSCDestination(relay.destinationDevice)
+}
+
+// Give the rules translated with route their own output queue and send path,
+// ending with that translation. Rules sharing a route share the queue.
+func (relay *MIDIRouter) addOSCOutput(route *osc.Route) {
+	if (route == nil) || (relay.osc == nil) {
+		return
+	}
+
+	relay.oscMutex.Lock()
+	defer relay.oscMutex.Unlock()
+
+	if _, found := relay.oscOutputs[*route]; found {
+		return
+	}
+	if relay.oscOutputs == nil {
+		relay.oscOutputs = make(map[osc.Route]*destination)
+	}
+	d := &destination{name: route.Address, device: relay.destinationDevice, osc: route}
+	relay.initDestination(d)
+	relay.oscOutputs[*route] = d
+}
+
+// Queue of the packets of a rule: the one of its OSC route, or of its
+// destination
+func (relay *MIDIRouter) ruleQueue(destination string, route *osc.Route) *outputQueue {
+	if route != nil {
+		relay.oscMutex.Lock()
+		d, found := relay.oscOutputs[*route]
+		relay.oscMutex.Unlock()
+		if found {
+			return d.output
+		}
+	}
+	return relay.outputFor(destination)
+}
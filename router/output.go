@@ -0,0 +1,127 @@
+package router
+
+import (
+	"MIDIRouter/midi"
+	"sync/atomic"
+)
+
+type OverflowPolicy uint8
+
+const (
+	OverflowPolicyBlock      = iota // Wait for the destination to catch up
+	OverflowPolicyDropOldest = iota // Discard the oldest queued packet
+	OverflowPolicyDropNewest = iota // Discard the packet being queued
+)
+
+const DefaultOutputQueueSize = 256
+
+// Bounded queue of packets waiting to be sent to a destination, drained by a
+// single sender goroutine. When full, the overflow policy decides what happens.
+type outputQueue struct {
+	packets chan midi.Packet
+	policy  OverflowPolicy
+	send    func(packet midi.Packet)
+
+	quit chan struct{}
+	done chan struct{}
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+}
+
+func newOutputQueue(size int, policy OverflowPolicy, send func(packet midi.Packet)) *outputQueue {
+	if size <= 0 {
+		size = DefaultOutputQueueSize
+	}
+	q := &outputQueue{
+		packets: make(chan midi.Packet, size),
+		policy:  policy,
+		send:    send,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *outputQueue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case p := <-q.packets:
+			q.send(p)
+			q.sent.Add(1)
+		case <-q.quit:
+			//Flush what is already queued
+			for {
+				select {
+				case p := <-q.packets:
+					q.send(p)
+					q.sent.Add(1)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Queue a packet, applying the overflow policy if the queue is full
+func (q *outputQueue) push(packet midi.Packet) {
+	select {
+	case <-q.quit:
+		q.dropped.Add(1)
+		return
+	default:
+	}
+
+	switch q.policy {
+	case OverflowPolicyBlock:
+		select {
+		case q.packets <- packet:
+		case <-q.quit:
+			q.dropped.Add(1)
+		}
+	case OverflowPolicyDropNewest:
+		select {
+		case q.packets <- packet:
+		default:
+			q.dropped.Add(1)
+		}
+	case OverflowPolicyDropOldest:
+		for {
+			select {
+			case q.packets <- packet:
+				return
+			default:
+			}
+			select {
+			case <-q.packets:
+				q.dropped.Add(1)
+			default:
+			}
+		}
+	}
+}
+
+// Stop accepting packets, and wait for queued ones to be sent
+func (q *outputQueue) close() {
+	select {
+	case <-q.quit:
+	default:
+		close(q.quit)
+	}
+	<-q.done
+}
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowPolicyBlock:
+		return "Block"
+	case OverflowPolicyDropOldest:
+		return "DropOldest"
+	case OverflowPolicyDropNewest:
+		return "DropNewest"
+	}
+	return "Unknown"
+}
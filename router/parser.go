@@ -0,0 +1,167 @@
+package router
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"bytes"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	maxSysExLength = 64 * 1024       // Larger SysEx dumps are discarded
+	sysExTimeout   = 2 * time.Second // Maximum delay between two fragments of a SysEx
+)
+
+// Stateful parser of incoming packets: splits packets into single messages and
+// reassembles SysEx messages fragmented across several CoreMIDI packets.
+type midiParser struct {
+	sysex     []byte // SysEx being reassembled, nil if none
+	sysexTs   uint64
+	sysexLast time.Time
+	clock     clock.Clock
+
+	discardedSysEx uint64
+	malformedBytes uint64
+
+	log *logger.Logger
+}
+
+func (p *midiParser) parse(packet midi.Packet) []midi.Packet {
+	var messages []midi.Packet
+	data := packet.Data
+
+	// Continuation of a SysEx started in a previous packet
+	if p.sysex != nil {
+		if clock.Since(p.clock, p.sysexLast) > sysExTimeout {
+			p.discardSysEx()
+		} else {
+			end := sysExEnd(data)
+			if end < 0 {
+				clean, realTime := splitRealTime(data)
+				messages = append(messages, packetsFromData(realTime, packet.TimeStamp)...)
+				p.appendSysEx(clean)
+				return messages
+			}
+			if data[end] == 0xF7 {
+				clean, realTime := splitRealTime(data[:end+1])
+				messages = append(messages, packetsFromData(realTime, packet.TimeStamp)...)
+				p.appendSysEx(clean)
+				if p.sysex != nil {
+					messages = append(messages, midi.NewPacket(p.sysex, p.sysexTs))
+				}
+				p.sysex = nil
+				data = data[end+1:]
+			} else {
+				//Another message started before the end of the SysEx: truncated
+				p.discardSysEx()
+				data = data[end:]
+			}
+		}
+	}
+
+	for len(data) > 0 {
+		start := bytes.IndexByte(data, 0xF0)
+		if start < 0 {
+			messages = append(messages, p.split(data, packet.TimeStamp)...)
+			break
+		}
+		messages = append(messages, p.split(data[:start], packet.TimeStamp)...)
+
+		end := sysExEnd(data[start+1:])
+		if end < 0 {
+			//SysEx continues in next packet(s)
+			clean, realTime := splitRealTime(data[start:])
+			messages = append(messages, packetsFromData(realTime, packet.TimeStamp)...)
+			p.sysex = []byte{}
+			p.sysexTs = packet.TimeStamp
+			p.appendSysEx(clean)
+			break
+		}
+		end += start + 1
+		if data[end] != 0xF7 {
+			//Truncated SysEx, resume parsing on the new status byte
+			p.discardedSysEx++
+			data = data[end:]
+			continue
+		}
+		clean, realTime := splitRealTime(data[start : end+1])
+		messages = append(messages, packetsFromData(realTime, packet.TimeStamp)...)
+		messages = append(messages, midi.NewPacket(clean, packet.TimeStamp))
+		data = data[end+1:]
+	}
+
+	return messages
+}
+
+// Split regular (non SysEx) messages, keeping track of malformed data
+func (p *midiParser) split(data []byte, timeStamp uint64) []midi.Packet {
+	messages, discarded := splitMIDIData(data)
+	if len(discarded) > 0 {
+		p.malformedBytes += uint64(len(discarded))
+		if p.log.Enabled(logger.LevelDebug) {
+			p.log.DebugDim("Discarded malformed MIDI data:", hex.EncodeToString(discarded))
+		}
+	}
+	return packetsFromData(messages, timeStamp)
+}
+
+// Returns the index of the SysEx end (0xF7) or of the first status byte
+// interrupting it, or -1 if the SysEx continues after data. Real-time bytes
+// may appear within a SysEx and do not interrupt it.
+func sysExEnd(data []byte) int {
+	for i, b := range data {
+		if b >= 0x80 && !isRealTime(b) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Real-time messages (clock, transport, active sensing, reset) are single
+// bytes allowed anywhere, even between the bytes of another message.
+func isRealTime(b byte) bool {
+	return b >= 0xF8
+}
+
+// Separates real-time bytes from the rest of data
+func splitRealTime(data []byte) (clean []byte, realTime [][]byte) {
+	for i, b := range data {
+		if isRealTime(b) {
+			if clean == nil {
+				clean = append([]byte{}, data[:i]...)
+			}
+			realTime = append(realTime, data[i:i+1])
+		} else if clean != nil {
+			clean = append(clean, b)
+		}
+	}
+	if clean == nil {
+		clean = data
+	}
+	return clean, realTime
+}
+
+func (p *midiParser) appendSysEx(data []byte) {
+	if len(p.sysex)+len(data) > maxSysExLength {
+		p.discardSysEx()
+		return
+	}
+	p.sysex = append(p.sysex, data...)
+	p.sysexLast = p.clock.Now()
+}
+
+func (p *midiParser) discardSysEx() {
+	p.sysex = nil
+	p.discardedSysEx++
+}
+
+// Build packets from messages, all keeping the timestamp of the original packet
+func packetsFromData(messages [][]byte, timeStamp uint64) []midi.Packet {
+	packets := make([]midi.Packet, 0, len(messages))
+	for _, msg := range messages {
+		packets = append(packets, midi.NewPacket(msg, timeStamp))
+	}
+	return packets
+}
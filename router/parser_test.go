@@ -0,0 +1,52 @@
+package router
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"testing"
+)
+
+// Byte streams cut into two packets at cut: every message parsed starts with a
+// status byte, SysEx are complete, other messages have no status byte inside,
+// and rule matching accepts them
+func FuzzParse(f *testing.F) {
+	f.Add([]byte{0x90, 60, 100, 0x80, 60, 0}, uint8(3))
+	f.Add([]byte{0xF0, 0x43, 0xF8, 0x10, 0xF7, 0xB0, 7}, uint8(2))
+	f.Add([]byte{0x90, 60, 100, 62, 100}, uint8(0))
+
+	relay, _ := newTestRouter(f)
+	relay.AddRule(newCCRule(f, "cc", "7", "74"))
+
+	f.Fuzz(func(t *testing.T, data []byte, cut uint8) {
+		p := midiParser{clock: clock.Wall, log: logger.New(logger.LevelError)}
+		at := 0
+		if len(data) > 0 {
+			at = int(cut) % len(data)
+		}
+
+		var messages []midi.Packet
+		messages = append(messages, p.parse(midi.NewPacket(data[:at], 0))...)
+		messages = append(messages, p.parse(midi.NewPacket(data[at:], 0))...)
+		for _, msg := range messages {
+			if (len(msg.Data) == 0) || (msg.Data[0] < 0x80) {
+				t.Fatalf("Message without status byte: % X", msg.Data)
+			}
+			if msg.Data[0] == 0xF0 {
+				if (msg.Data[len(msg.Data)-1] != 0xF7) || (len(msg.Data) > maxSysExLength) {
+					t.Fatalf("Incomplete SysEx: % X", msg.Data)
+				}
+				continue
+			}
+			if len(msg.Data) > 3 {
+				t.Fatalf("Message too long: % X", msg.Data)
+			}
+			for _, b := range msg.Data[1:] {
+				if b >= 0x80 {
+					t.Fatalf("Status byte within a message: % X", msg.Data)
+				}
+			}
+			relay.matchingRule(msg)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/midi"
+	"sync"
+	"time"
+)
+
+// Note On messages scheduled for later (quantized, delayed by a generator).
+// The matching Note Off must not overtake them.
+type pendingNotes struct {
+	clock clock.Clock
+	mutex sync.Mutex
+	notes map[uint16]time.Time // Channel and note => time the Note On is sent
+}
+
+func noteKey(data []byte) (key uint16, noteOn bool, ok bool) {
+	if (len(data) != 3) || (data[0] < 0x80) || (data[0] > 0x9F) {
+		return 0, false, false
+	}
+	return uint16(data[0]&0x0F)<<8 | uint16(data[1]), (data[0]&0xF0 == 0x90) && (data[2] != 0), true
+}
+
+// Record a Note On sent after delay
+func (p *pendingNotes) schedule(packet midi.Packet, delay time.Duration) {
+	key, noteOn, ok := noteKey(packet.Data)
+	if !ok || !noteOn {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.notes == nil {
+		p.notes = make(map[uint16]time.Time)
+	}
+	p.notes[key] = p.clock.Now().Add(delay)
+}
+
+// Delay before a Note Off can be sent, 0 if its Note On was already sent
+func (p *pendingNotes) hold(packet midi.Packet) time.Duration {
+	key, noteOn, ok := noteKey(packet.Data)
+	if !ok || noteOn {
+		return 0
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	at, found := p.notes[key]
+	if !found {
+		return 0
+	}
+	delete(p.notes, key)
+	if delay := clock.Until(p.clock, at); delay > 0 {
+		return delay + time.Millisecond
+	}
+	return 0
+}
+
+// Split packets into the ones sent now and Note Off messages held until
+// their Note On was sent
+func (relay *MIDIRouter) holdNoteOffs(packets []midi.Packet) []midi.Packet {
+	var now []midi.Packet
+
+	for _, p := range packets {
+		if delay := relay.pending.hold(p); delay > 0 {
+			packet := p
+			relay.clock.AfterFunc(delay, func() {
+				relay.output.push(packet)
+			})
+			continue
+		}
+		now = append(now, p)
+	}
+	return now
+}
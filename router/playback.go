@@ -0,0 +1,42 @@
+package router
+
+import (
+	"MIDIRouter/midi"
+	"MIDIRouter/smf"
+	"strings"
+	"time"
+)
+
+// Source devices named "file:<path>" are Standard MIDI Files played back on Start
+const fileSourcePrefix = "file:"
+
+func isFileSource(sourceDevice string) bool {
+	return strings.HasPrefix(sourceDevice, fileSourcePrefix)
+}
+
+func (relay *MIDIRouter) setupFileSource() error {
+	path := strings.TrimPrefix(relay.sourceDevice, fileSourcePrefix)
+	events, err := smf.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	relay.playback = events
+	relay.log.Info("Source file: ", path, " (", len(events), " events)")
+	return nil
+}
+
+// Feed the events of the source file through the rules, at the file tempo
+func (relay *MIDIRouter) play() {
+	start := time.Now()
+	for _, e := range relay.playback {
+		if wait := time.Until(start.Add(e.At)); wait > 0 {
+			select {
+			case <-relay.quit:
+				return
+			case <-time.After(wait):
+			}
+		}
+		relay.receive(midi.NewPacket(e.Data, 0))
+	}
+	relay.log.Info("Source file: playback finished")
+}
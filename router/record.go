@@ -0,0 +1,58 @@
+package router
+
+import (
+	"MIDIRouter/midi"
+	"MIDIRouter/smf"
+)
+
+// Record incoming (as received from the source) and/or outgoing (as sent to
+// the destination) messages to their own tracks of a Standard MIDI File. The
+// recorder may be shared by several routers, and is not closed on Cleanup.
+func (relay *MIDIRouter) SetRecorder(rec *smf.Recorder, input bool, output bool) {
+	relay.recordInput = -1
+	relay.recordOutput = -1
+	if input {
+		relay.recordInput = rec.AddTrack(relay.sourceDevice)
+	}
+	if output {
+		relay.recordOutput = rec.AddTrack(relay.destinationDevice)
+	}
+	relay.recorder = rec
+	relay.ownRecorder = false
+}
+
+// Record to a Standard MIDI File owned by the router, written on Cleanup
+func (relay *MIDIRouter) RecordTo(path string, input bool, output bool) error {
+	rec, err := smf.NewRecorder(path)
+	if err != nil {
+		return err
+	}
+	relay.SetRecorder(rec, input, output)
+	relay.ownRecorder = true
+	return nil
+}
+
+func (relay *MIDIRouter) recordIncoming(msg midi.Packet) {
+	if (relay.recorder != nil) && (relay.recordInput >= 0) {
+		relay.recorder.Record(relay.recordInput, msg.Data)
+	}
+}
+
+func (relay *MIDIRouter) recordOutgoing(packet midi.Packet) {
+	if (relay.recorder == nil) || (relay.recordOutput < 0) {
+		return
+	}
+	messages, _ := splitMIDIData(packet.Data)
+	for _, msg := range messages {
+		relay.recorder.Record(relay.recordOutput, msg)
+	}
+}
+
+func (relay *MIDIRouter) closeRecorder() {
+	if (relay.recorder == nil) || !relay.ownRecorder {
+		return
+	}
+	if err := relay.recorder.Close(); err != nil {
+		relay.log.Error(err)
+	}
+}
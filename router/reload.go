@@ -0,0 +1,70 @@
+package router
+
+import (
+	"MIDIRouter/midi"
+	"MIDIRouter/rule"
+	"time"
+)
+
+// Settings of a running router replaced on a configuration reload. Devices
+// stay connected: rules replacing one of the same name take over the notes it
+// started, so none get stuck or cut. Notes of the dropped rules are released,
+// and the replaced rules closed.
+type ReloadSettings struct {
+	Passthrough bool
+	SendLimit   time.Duration
+	Rules       []*rule.Rule
+}
+
+func (relay *MIDIRouter) Reload(settings ReloadSettings) {
+	relay.rulesMutex.Lock()
+	replaced := relay.rules
+	previous := map[string]*rule.Rule{}
+	for _, r := range relay.rules {
+		if r.Name() != "" {
+			previous[r.Name()] = r
+		}
+	}
+
+	var index ruleIndex
+	var noteOffs [][]midi.Packet
+	takenOver := map[*rule.Rule]bool{}
+	for _, r := range settings.Rules {
+		r.SetClock(relay.clock)
+		r.SetOutput(relay.ruleOutput(r))
+		relay.addOSCOutput(r.OSC())
+		if old, found := previous[r.Name()]; found {
+			delete(previous, r.Name())
+			takenOver[old] = true
+			if released := r.TakeOver(old); len(released) > 0 {
+				noteOffs = append(noteOffs, released)
+			}
+		}
+		index.add(r)
+	}
+	for _, r := range replaced {
+		if takenOver[r] {
+			continue
+		}
+		if released := r.FlushNotes(); len(released) > 0 {
+			noteOffs = append(noteOffs, released)
+		}
+	}
+
+	relay.rules = settings.Rules
+	relay.index = index
+	relay.defaultPassThrough = settings.Passthrough
+	relay.sendLimit = settings.SendLimit
+	relay.rulesMutex.Unlock()
+
+	for _, packets := range noteOffs {
+		relay.sendBatch(packets)
+	}
+	for _, r := range replaced {
+		r.Close()
+	}
+	for _, r := range settings.Rules {
+		relay.log.Info(r)
+	}
+	relay.log.Infof("Configuration reloaded: %d rules\n", len(settings.Rules))
+}
@@ -0,0 +1,89 @@
+package router
+
+import (
+	"MIDIRouter/backend"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"MIDIRouter/remote"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Devices named "tcp://<host>:<port>" are other MIDIRouter instances: as
+// destination, the output is sent to the remote router listening on that
+// address; as source, the router listens on it ("tcp://:<port>" for all
+// interfaces) for remote routers. "tcp://<secret>@..." requires remote
+// routers to share that secret.
+const remotePrefix = "tcp://"
+
+func isRemoteDevice(device string) bool {
+	return strings.HasPrefix(device, remotePrefix)
+}
+
+func remoteAddress(device string) (address string, secret string, err error) {
+	address = strings.TrimPrefix(device, remotePrefix)
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		secret, address = address[:i], address[i+1:]
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", "", errors.New("Invalid remote router address '" + address + "': expected host:port")
+	}
+	return address, secret, nil
+}
+
+func (relay *MIDIRouter) setupRemoteSource() error {
+	address, secret, err := remoteAddress(relay.sourceDevice)
+	if err != nil {
+		return err
+	}
+	//Offline routers are fed by replays and self-tests
+	if _, offline := relay.backend.(*backend.Memory); offline {
+		return nil
+	}
+	listener, err := remote.Listen(address, secret, relay.onFrame)
+	if err != nil {
+		return err
+	}
+	relay.remoteSource = listener
+	relay.log.Info("Source: listening for remote routers on ", address)
+	if host, _, _ := net.SplitHostPort(address); (secret == "") && !isLoopback(host) {
+		relay.log.Info("No secret: any computer of the network can send to this router")
+	}
+	return nil
+}
+
+func (relay *MIDIRouter) setupRemoteDestination() error {
+	address, secret, err := remoteAddress(relay.destinationDevice)
+	if err != nil {
+		return err
+	}
+	if _, offline := relay.backend.(*backend.Memory); offline {
+		return nil
+	}
+	relay.remoteDestination = remote.NewSender(address, secret)
+	if err := relay.remoteDestination.Connect(); err != nil {
+		//The remote router may start later, connecting is retried in the
+		//background
+		relay.log.Error(err)
+	} else {
+		relay.log.Info("Destination remote router: ", address)
+	}
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return (ip != nil) && ip.IsLoopback()
+}
+
+func (relay *MIDIRouter) onFrame(f remote.Frame) {
+	if relay.log.Enabled(logger.LevelDebug) {
+		relay.log.Debugf("remote frame sent %v ago\n", time.Since(f.At))
+	}
+	relay.onPacket(midi.NewPacket(f.Data, 0))
+}
@@ -1,58 +1,194 @@
 package router
 
 import (
+	"MIDIRouter/backend"
+	"MIDIRouter/clock"
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"MIDIRouter/mpe"
+	"MIDIRouter/osc"
+	"MIDIRouter/remote"
+	"MIDIRouter/rtpmidi"
 	"MIDIRouter/rule"
+	"MIDIRouter/smf"
+	"MIDIRouter/tempo"
 	"encoding/hex"
-	"fmt"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type MIDIRouter struct {
+	name              string // Tag of the log lines
 	sourceDevice      string
 	destinationDevice string
 
-	midiClient coremidi.Client
-	srcPort    coremidi.InputPort
-
-	destPort    coremidi.OutputPort
-	destination coremidi.Destination
+	backend backend.Backend
 
 	defaultPassThrough bool
 	lastMIDIMsg        time.Time
 	sendLimit          time.Duration
 	rules              []*rule.Rule
+	index              ruleIndex
+	rulesMutex         sync.RWMutex
+	noteOffInput       bool // Note On with velocity 0 are filtered as Note Off
+	noteOffOutput      bool // Note On with velocity 0 are sent as Note Off
+	restamp            bool // Send packets "now" rather than with the input timestamp
+	validation         ValidationMode
+	sustainAware       bool
+	systemPolicies     [16]SystemPolicy // By status byte low nibble (0xF1-0xFF)
+	sustain            sustainTracker
+	tempo              tempo.Tracker
+	tempoChanges       tempo.ChangeDetector
+	tempoMutex         sync.Mutex
+	fallbackTempo      float64 // BPM when no clock is received
+	tap                tempo.Tap
+	tapFilter          filterinterface.FilterInterface // Messages tapping the tempo, nil if disabled
+	transport          transport
+	position           tempo.Position // Song position, for quantization
+	pending            pendingNotes
+	variables          variables
+	controllers        controllerCache // Last Control Change values sent
+	snapshots          []*Snapshot
+	zones              zones
+	mpeInput           *mpe.Collapser
+	mpeOutput          *mpe.Expander
+	osc                *osc.Bridge      // OSC server destination, nil for MIDI devices
+	remoteSource       *remote.Listener // Remote routers source, nil for MIDI devices
+	remoteDestination  *remote.Sender   // Remote router destination, nil for MIDI devices
+	rtpSource          *rtpmidi.Session // RTP-MIDI session source, nil for MIDI devices
+	rtpDestination     *rtpmidi.Session // RTP-MIDI session destination, nil for MIDI devices
+	bleSource          *bleDevice       // Bluetooth LE MIDI source, nil for other devices
+	bleDestination     *bleDevice       // Bluetooth LE MIDI destination, nil for other devices
+	umpInput           bool             // The source sends Universal MIDI Packets
+	umpOutput          bool             // The destination expects Universal MIDI Packets
+	destinations       []*destination   // Named destinations, rules targeting them
+	modifiers          modifiers
+	stateFile          string // State saved on exit and restored on startup, "" if disabled
+	invalidPackets     atomic.Uint64
+	cleanup            CleanupSettings
+	onDisconnect       [][]byte      // Messages sent on exit, after the cleanup sequence
+	usedChannels       atomic.Uint32 // Bitmask of channels messages were sent on
+	watchdog           *noteWatchdog // Stuck note watchdog, nil if disabled
+	recorder           *smf.Recorder
+	recordInput        int // Recorder track, -1 if not recorded
+	recordOutput       int
+	ownRecorder        bool
+	playback           []smf.Event // Source file events, played on Start
+	capture            *capture
+	events             eventHooks
+	middlewares        []Middleware
+	send               func(packet midi.Packet) error // Send path, see Use
+	output             *outputQueue
+	parser             midiParser
+	quit               chan struct{} // Closed on cleanup, stops background tasks
+	closeOnce          sync.Once
+	clock              clock.Clock
+
+	lastSent      atomic.Int64 // Unix nanoseconds of last packet sent
+	lastReceived  atomic.Int64 // Unix nanoseconds of last packet received
+	sensingSource atomic.Bool  // Active Sensing received from source
+
+	oscOutputs map[osc.Route]*destination // Rules translated with their own OSC route, see rule.SetOSC
+	oscMutex   sync.Mutex
+
+	sendErrors sendErrors
+	verboseTag string         // Verbose output limited to the rules tagged with it, "" for all
+	quietLog   *logger.Logger // Logger of the other rules, errors only
+	log        *logger.Logger
+}
 
-	verbose bool
+// Create a router between MIDI devices of the system (CoreMIDI on macOS, ALSA
+// on Linux). The name tags the log lines of the router, "" for none.
+func New(name string, sourceDevice string, destinationDevice string) (*MIDIRouter, error) {
+	b, err := backend.NewSystem()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithBackend(name, sourceDevice, destinationDevice, b)
 }
 
-func New(sourceDevice string, destinationDevice string) (*MIDIRouter, error) {
+func NewWithBackend(name string, sourceDevice string, destinationDevice string, b backend.Backend) (*MIDIRouter, error) {
 	var relay MIDIRouter
-	var err error
 
+	relay.name = name
 	relay.sourceDevice = sourceDevice
 	relay.destinationDevice = destinationDevice
-	relay.defaultPassThrough = false
+	relay.backend = b
+	relay.init()
 
-	relay.midiClient, err = coremidi.NewClient("MIDIRouter")
-	if err != nil {
-		return nil, err
-	}
-	err = relay.setupSource()
-	if err != nil {
-		return nil, err
+	err := relay.setupSource()
+	if err == nil {
+		err = relay.setupDestination()
 	}
-
-	err = relay.setupDestination()
 	if err != nil {
+		relay.Discard()
 		return nil, err
 	}
 	return &relay, nil
 }
 
+// Create a router connected to no device (in-memory backend), for replays
+// and self-tests
+func NewOffline(name string, sourceDevice string, destinationDevice string) *MIDIRouter {
+	relay, _ := NewWithBackend(name, sourceDevice, destinationDevice, backend.NewMemory())
+	return relay
+}
+
+func (relay *MIDIRouter) init() {
+	relay.defaultPassThrough = false
+	relay.clock = clock.Wall
+	relay.pending.clock = relay.clock
+	relay.parser.clock = relay.clock
+	relay.log = logger.New(logger.LevelInfo)
+	relay.log.SetPrefix(relay.name)
+	relay.parser.log = relay.log
+	relay.cleanup = DefaultCleanupSettings
+	relay.validation = ValidationModeNone
+	relay.quit = make(chan struct{})
+	relay.buildSendChain()
+	relay.output = newOutputQueue(DefaultOutputQueueSize, OverflowPolicyBlock, relay.sendNow)
+}
+
+func (relay *MIDIRouter) Name() string {
+	return relay.name
+}
+
+// Log an informational message, tagged with the router name
+func (relay *MIDIRouter) Log(a ...interface{}) {
+	relay.log.Info(a...)
+}
+
+// Logger of the router, for filters and generators logging on their own
+func (relay *MIDIRouter) Logger() *logger.Logger {
+	return relay.log
+}
+
 func (relay *MIDIRouter) SetVerbose(verb bool) {
-	relay.verbose = verb
+	if verb {
+		relay.log.SetLevel(logger.LevelDebug)
+	} else {
+		relay.log.SetLevel(logger.LevelInfo)
+	}
+}
+
+// Limit the verbose output to the messages seen by the rules tagged with tag
+// ("song:intro"), "" for all messages. Errors are always logged.
+func (relay *MIDIRouter) SetVerboseTag(tag string) {
+	relay.verboseTag = tag
+	relay.quietLog = logger.New(logger.LevelInfo)
+	relay.quietLog.SetPrefix(relay.name)
+}
+
+// Logger of the messages seen by rule r (nil: by no rule)
+func (relay *MIDIRouter) ruleLog(r *rule.Rule) *logger.Logger {
+	if (relay.verboseTag == "") || ((r != nil) && r.HasTag(relay.verboseTag)) {
+		return relay.log
+	}
+	return relay.quietLog
 }
 
 func (relay *MIDIRouter) SetPassthrough(pass bool) {
@@ -63,170 +199,502 @@ func (relay *MIDIRouter) SetSendLimit(delay time.Duration) {
 	relay.sendLimit = delay
 }
 
+// Set what happens when the destination can't keep up with outgoing packets
+func (relay *MIDIRouter) SetOverflowPolicy(policy OverflowPolicy, queueSize int) {
+	old := relay.output
+	relay.output = newOutputQueue(queueSize, policy, relay.sendNow)
+	if old != nil {
+		old.close()
+	}
+}
+
+// Convert Note On messages with velocity 0 to Note Off, before rule
+// evaluation (input) and/or before sending (output)
+func (relay *MIDIRouter) SetNoteOffNormalization(input bool, output bool) {
+	relay.noteOffInput = input
+	relay.noteOffOutput = output
+}
+
+// Send packets with a zero timestamp (as soon as possible) instead of
+// the timestamp of the input packet they were generated from
+func (relay *MIDIRouter) SetRestamp(restamp bool) {
+	relay.restamp = restamp
+}
+
+// Time source of the router and its rules, clock.Wall by default. Set a
+// clock.Manual before Start for deterministic tests and fast-forward replays.
+func (relay *MIDIRouter) SetClock(c clock.Clock) {
+	relay.clock = c
+	relay.pending.clock = c
+	relay.parser.clock = c
+	if relay.watchdog != nil {
+		relay.watchdog.clock = c
+	}
+	for _, r := range relay.rules {
+		r.SetClock(c)
+	}
+}
+
+// Run the router, until Cleanup
 func (relay *MIDIRouter) Start() {
-	for {
-		time.Sleep(5 * time.Second)
+	if relay.playback != nil {
+		go relay.play()
 	}
+	<-relay.quit
 }
 
+// Stop the router: held notes are released, the cleanup sequence is sent, the
+// state saved and devices closed. Later calls do nothing.
 func (relay *MIDIRouter) Cleanup() {
-	relay.sendAllNotesOffAndResetControllers()
+	relay.closeOnce.Do(relay.shutdown)
+}
+
+// Stop a router whose configuration failed to load: background tasks stop and
+// devices are closed, without sending anything or saving the state
+func (relay *MIDIRouter) Discard() {
+	relay.closeOnce.Do(func() {
+		close(relay.quit)
+		relay.closeDestinations()
+		relay.output.close()
+		relay.closeRecorder()
+		relay.closeDevices()
+		relay.closeRules()
+	})
+}
+
+func (relay *MIDIRouter) shutdown() {
+	relay.stopMasterClock()
+	close(relay.quit)
+	if held := relay.sustain.flush(); len(held) > 0 {
+		relay.sendBatch(held)
+	}
+	relay.closeDestinations()
+	relay.output.close()
+	if relay.stateFile != "" {
+		if err := relay.saveState(); err != nil {
+			relay.log.Error(err)
+		}
+	}
+	relay.log.Infof("Output: %d packets sent, %d dropped (overflow policy: %s)\n",
+		relay.output.sent.Load(), relay.output.dropped.Load(), relay.output.policy)
+	if relay.invalidPackets.Load() > 0 {
+		relay.log.Infof("Output: %d invalid packets dropped\n", relay.invalidPackets.Load())
+	}
+	if relay.parser.discardedSysEx > 0 {
+		relay.log.Infof("Input: %d incomplete SysEx discarded\n", relay.parser.discardedSysEx)
+	}
+	if relay.parser.malformedBytes > 0 {
+		relay.log.Infof("Input: %d malformed bytes discarded\n", relay.parser.malformedBytes)
+	}
+	relay.sendCleanup()
+	relay.sendOnDisconnect()
+	relay.closeRecorder()
+	relay.closeDevices()
+	relay.closeRules()
+}
+
+func (relay *MIDIRouter) closeDevices() {
+	if relay.osc != nil {
+		if err := relay.osc.Close(); err != nil {
+			relay.log.Error(err)
+		}
+	}
+	if relay.remoteSource != nil {
+		relay.remoteSource.Close()
+	}
+	if relay.remoteDestination != nil {
+		relay.remoteDestination.Close()
+	}
+	for _, session := range []*rtpmidi.Session{relay.rtpSource, relay.rtpDestination} {
+		if session != nil {
+			session.Close()
+		}
+	}
+	for _, d := range []*bleDevice{relay.bleSource, relay.bleDestination} {
+		if d != nil {
+			d.close()
+		}
+	}
+	relay.closeDestinationBackends()
+	if err := relay.backend.Close(); err != nil {
+		relay.log.Error(err)
+	}
+}
+
+// Stop what the rules run (processes, plugins...), once devices are closed
+func (relay *MIDIRouter) closeRules() {
+	relay.rulesMutex.RLock()
+	defer relay.rulesMutex.RUnlock()
+
+	for _, r := range relay.rules {
+		r.Close()
+	}
+}
+
+// Enable or disable a rule by name. Notes started by a disabled rule are
+// released right away.
+func (relay *MIDIRouter) SetRuleEnabled(name string, enabled bool) error {
+	relay.rulesMutex.RLock()
+	defer relay.rulesMutex.RUnlock()
+	for _, r := range relay.rules {
+		if r.Name() == name {
+			if noteOffs := r.SetEnabled(enabled); len(noteOffs) > 0 {
+				relay.sendBatch(noteOffs)
+			}
+			return nil
+		}
+	}
+	return errors.New("No such rule: " + name)
 }
 
 func (relay *MIDIRouter) AddRule(rule *rule.Rule) {
+	rule.SetClock(relay.clock)
+	rule.SetOutput(relay.ruleOutput(rule))
+	relay.addOSCOutput(rule.OSC())
 	relay.rules = append(relay.rules, rule)
-	fmt.Println(rule)
+	relay.index.add(rule)
+	relay.log.Info(rule)
+}
+
+// Send function of the packets a rule schedules on its own, to its destination
+func (relay *MIDIRouter) ruleOutput(r *rule.Rule) func(packet midi.Packet) {
+	destination, route := r.Destination(), r.OSC()
+	return func(packet midi.Packet) {
+		relay.ruleQueue(destination, route).push(packet)
+	}
 }
 
-// Method to schedule and send noise packets
-func (relay *MIDIRouter) scheduleNoisePacket(packet coremidi.Packet, delayMs time.Duration) {
+// Send packets generated for later (see generatorinterface.TimedGeneratorInterface)
+func (relay *MIDIRouter) scheduleDelayed(delayed []generatorinterface.TimedPacket, output *outputQueue) {
+	for _, t := range delayed {
+		packet := t.Packet
+		relay.pending.schedule(packet, t.Delay)
+		relay.clock.AfterFunc(t.Delay, func() {
+			output.push(packet)
+		})
+	}
+}
+
+// Method to schedule and send noise packets, dropped when sent less than
+// sendLimit after the previous message
+func (relay *MIDIRouter) scheduleNoisePacket(packet midi.Packet, delayMs time.Duration, sendLimit time.Duration, output *outputQueue, log *logger.Logger) {
 	// For zero or negative delay, send immediately without a goroutine
 	if delayMs <= 0 {
 		// Check if we're within the send limit
-		if time.Since(relay.lastMIDIMsg) <= relay.sendLimit {
-			if relay.verbose {
-				fmt.Println("Ignoring noise MIDI message (send limit)")
-			}
+		if clock.Since(relay.clock, relay.lastMIDIMsg) <= sendLimit {
+			log.DebugDim("Ignoring noise MIDI message (send limit)")
 			return
 		}
 
-		if relay.verbose {
-			fmt.Printf("Sending noise packet immediately after original message: %v\n",
+		if log.Enabled(logger.LevelDebug) {
+			log.Debugf("Sending noise packet immediately after original message: %v\n",
 				hex.EncodeToString(packet.Data))
 		}
 
 		// Send the noise packet directly
-		packet.Send(&relay.destPort, &relay.destination)
-		relay.lastMIDIMsg = time.Now()
+		output.push(packet)
+		relay.lastMIDIMsg = relay.clock.Now()
 		return
 	}
 
-	// For positive delays, use a goroutine
-	go func() {
-		// Use the specified delay
-		time.Sleep(delayMs)
-
+	// For positive delays, use a timer (no goroutine is parked while waiting)
+	relay.clock.AfterFunc(delayMs, func() {
 		// Check if we're within the send limit
-		if time.Since(relay.lastMIDIMsg) <= relay.sendLimit {
-			if relay.verbose {
-				fmt.Println("Ignoring noise MIDI message (send limit)")
-			}
+		if clock.Since(relay.clock, relay.lastMIDIMsg) <= sendLimit {
+			log.DebugDim("Ignoring noise MIDI message (send limit)")
 			return
 		}
 
-		if relay.verbose {
-			fmt.Printf("Sending noise packet after %v delay: %v\n",
+		if log.Enabled(logger.LevelDebug) {
+			log.Debugf("Sending noise packet after %v delay: %v\n",
 				delayMs,
 				hex.EncodeToString(packet.Data))
 		}
 
 		// Send the noise packet
-		packet.Send(&relay.destPort, &relay.destination)
-		relay.lastMIDIMsg = time.Now()
-	}()
+		output.push(packet)
+		relay.lastMIDIMsg = relay.clock.Now()
+	})
 }
 
-func (relay *MIDIRouter) onPacket(source coremidi.Source, packet coremidi.Packet) {
-	if relay.verbose {
-		fmt.Printf(
-			"device: %v, manufacturer: %v, source: %v, data: %v\n",
-			source.Entity().Device().Name(),
-			source.Manufacturer(),
-			source.Name(),
-			hex.EncodeToString(packet.Data),
-		)
+func (relay *MIDIRouter) onPacket(packet midi.Packet) {
+	packets := []midi.Packet{packet}
+	if relay.umpInput {
+		packets = relay.fromUMP(packet)
 	}
-
-	// if it's a SysEx message, handle it directly without splitting
-	if len(packet.Data) > 0 && packet.Data[0] == 0xF0 {
-		relay.handleSinglePacket(packet)
-		return
+	for _, p := range packets {
+		if relay.verboseTag == "" {
+			relay.log.DebugMessages("in", p.Data)
+		}
+		relay.receive(p)
 	}
+}
+
+// Handle a packet received from the source
+func (relay *MIDIRouter) receive(packet midi.Packet) {
+	relay.trackReceived(packet)
+	relay.trackTempo(packet)
 
-	// For non-SysEx messages, proceed with splitting if needed
-	if len(packet.Data) > 3 {
-		// Only split if packet is longer than max standard MIDI message
-		messages := splitMIDIData(packet.Data)
-		for _, msg := range messages {
-			relay.handleSinglePacket(coremidi.Packet{Data: msg})
+	// Split packet into messages, SysEx being reassembled across packets
+	messages := relay.parser.parse(packet)
+	if packet.HasHighRes && (len(messages) == 1) {
+		messages[0].HighRes, messages[0].HasHighRes = packet.HighRes, true
+	}
+	for _, msg := range messages {
+		relay.recordIncoming(msg)
+		relay.captureIncoming(msg)
+		if !relay.events.onReceived(msg) {
+			continue
+		}
+		for _, p := range relay.collapseMPE(msg) {
+			relay.handleSinglePacket(p)
 		}
-	} else {
-		// Single short message - process directly
-		relay.handleSinglePacket(packet)
 	}
 }
 
-func (relay *MIDIRouter) handleSinglePacket(packet coremidi.Packet) {
+func (relay *MIDIRouter) handleSinglePacket(packet midi.Packet) {
+	if len(packet.Data) > 0 {
+		relay.route(packet)
+	}
+}
+
+// Route a message: the system policies, tap tempo and snapshot triggers, the
+// passthrough mode, sustain, keyboard zones and the rules decide what is sent.
+// Returns what was decided, see Evaluate.
+func (relay *MIDIRouter) route(packet midi.Packet) (e Evaluation) {
+	e.Message = packet.Data
+	log := relay.ruleLog(nil)
+
+	if relay.handleSystemPacket(packet) {
+		e.Handled = HandledSystem
+		return e
+	}
+
+	if relay.noteOffInput {
+		packet = normalizeNoteOff(packet)
+	}
+
+	relay.rulesMutex.RLock()
+	defer relay.rulesMutex.RUnlock()
+
+	relay.trackModifiers(packet)
+	if relay.handleTap(packet) {
+		e.Handled = HandledTap
+		return e
+	}
+	if relay.handleSnapshot(packet) {
+		e.Handled = HandledSnapshot
+		return e
+	}
+
 	if relay.defaultPassThrough == true {
-		if time.Since(relay.lastMIDIMsg) <= relay.sendLimit {
-			fmt.Println("Ignoring midi message (send limit)")
-			return
+		e.Handled = HandledPassthrough
+		if clock.Since(relay.clock, relay.lastMIDIMsg) <= relay.sendLimit {
+			log.DebugDim("Ignoring midi message (send limit)")
+			e.Handled = HandledSendLimit
+			return e
+		}
+		if relay.watchdog != nil {
+			relay.watchdog.noteOn([]midi.Packet{packet}, "passthrough")
 		}
-		packet.Send(&relay.destPort, &relay.destination)
+		relay.output.push(packet)
+		e.Output = []midi.Packet{packet}
 
-		if len(packet.Data) > 0 && packet.Data[0] == 0xFC { // Stop message
-			relay.sendAllNotesOffAndResetControllers()
+		if packet.Data[0] == 0xFC { // Stop message
+			for _, p := range relay.cleanupPackets() {
+				relay.output.push(p)
+			}
 		}
 
-		relay.lastMIDIMsg = time.Now()
-		return
+		relay.lastMIDIMsg = relay.clock.Now()
+		return e
 	}
 
-	ruleMatched := false
-	for _, r := range relay.rules {
-		if len(packet.Data) == 0 {
-			continue
+	// Pedal state is tracked in any case for rule conditions, Note Off
+	// messages are only held when sustain aware
+	if released := relay.sustain.input(packet); len(released) > 0 {
+		relay.sendBatch(released)
+	}
+
+	// Notes played in keyboard zones skip the rules
+	if packets, handled := relay.routeZones(packet); handled {
+		if relay.sustainAware {
+			packets = relay.sustain.output(packet.Data[0]&0x0F, packets)
+		}
+		if relay.watchdog != nil {
+			relay.watchdog.noteOn(packets, "zones")
 		}
+		relay.sendBatch(packets)
+		e.Handled = HandledZones
+		e.Output = packets
+		return e
+	}
 
-		// Get match result from rule
-		matchResult := r.Match(packet, relay.verbose)
+	// Get match result from the first matching rule
+	matchResult, r := relay.matchingRule(packet)
+	ruleMatched := r != nil
+	log = relay.ruleLog(r)
+	e.Matched = ruleMatched
+	e.Result = matchResult
+
+	if ruleMatched && !relay.events.onMatched(matchResult) {
+		log.DebugDim("-> Rule output vetoed")
+		e.Handled = HandledVetoed
+		return e
+	}
+	output := relay.ruleQueue(matchResult.Destination, matchResult.OSC)
+	relay.scheduleDelayed(matchResult.Delayed, output)
 
-		if matchResult.Result == rule.RuleMatchResultMatchInject {
-			if relay.verbose {
-				fmt.Println("-> Sending generated packet :")
-				fmt.Println(hex.Dump(matchResult.MainPacket.Data))
+	if matchResult.Result == rule.RuleMatchResultMatchInject {
+		packets := append([]midi.Packet{matchResult.MainPacket}, matchResult.ExtraPackets...)
+		if relay.sustainAware && (packet.Data[0] < 0xF0) {
+			packets = relay.sustain.output(packet.Data[0]&0x0F, packets)
+		}
+		packets = relay.holdNoteOffs(packets)
+		if log.Enabled(logger.LevelDebug) {
+			for _, p := range packets {
+				log.DebugMessages("out", p.Data)
 			}
+		}
 
-			if time.Since(relay.lastMIDIMsg) <= relay.sendLimit {
-				fmt.Println("Ignoring midi message (send limit)")
-				return
-			}
+		// Rules may override the router send limit
+		sendLimit := relay.sendLimit
+		if matchResult.SendLimit != nil {
+			sendLimit = *matchResult.SendLimit
+		}
+		if clock.Since(relay.clock, relay.lastMIDIMsg) <= sendLimit {
+			log.DebugDim("Ignoring midi message (send limit)")
+			e.Handled = HandledSendLimit
+			return e
+		}
 
-			// Send the main packet
-			matchResult.MainPacket.Send(&relay.destPort, &relay.destination)
-			relay.lastMIDIMsg = time.Now()
+		if relay.watchdog != nil {
+			relay.watchdog.noteOn(packets, "rule '"+matchResult.Rule+"'")
+		}
 
-			// Handle noise packet if present
-			if matchResult.NoisePacket != nil {
-				// Schedule/send noise packet after the main packet is sent
-				relay.scheduleNoisePacket(*matchResult.NoisePacket, matchResult.NoiseDelayMs)
+		// Send the generated packets in a single batch, unless the rule
+		// asked for every message to travel on its own
+		if matchResult.NoMerge {
+			for _, p := range packets {
+				output.push(p)
 			}
+		} else {
+			relay.sendBatchTo(output, packets)
+		}
+		e.Output = packets
+		relay.lastMIDIMsg = relay.clock.Now()
 
-			ruleMatched = true
-			break
-		} else if matchResult.Result == rule.RuleMatchResultMatchNoInject {
-			ruleMatched = true
-			break
+		// Schedule/send noise packets after the main packet is sent
+		for _, t := range matchResult.Noise {
+			relay.scheduleNoisePacket(t.Packet, t.Delay, sendLimit, output, log)
 		}
 	}
 
-	if (ruleMatched == false) && (relay.verbose == true) {
-		fmt.Println("-> No match")
+	if ruleMatched == false {
+		log.DebugDim("-> No match")
+	}
+	return e
+}
+
+// Maximum data length of a single CoreMIDI MIDIPacket
+const maxPacketDataLength = 256
+
+// Send several generated packets with as few Send calls as possible: consecutive
+// packets sharing a timestamp are merged into a single MIDIPacket (a packet may
+// carry several complete messages), preserving order. SysEx is never merged.
+func (relay *MIDIRouter) sendBatch(packets []midi.Packet) {
+	relay.sendBatchTo(relay.output, packets)
+}
+
+func (relay *MIDIRouter) sendBatchTo(output *outputQueue, packets []midi.Packet) {
+	for _, p := range mergePackets(packets) {
+		output.push(p)
+	}
+}
+
+// Send a packet to the destination device right away (output queue sender)
+func (relay *MIDIRouter) sendNow(packet midi.Packet) {
+	if err := relay.send(packet); err != nil {
+		relay.logSendError(err)
+	}
+}
+
+func mergePackets(packets []midi.Packet) []midi.Packet {
+	var merged []midi.Packet
+
+	for _, p := range packets {
+		if len(p.Data) == 0 {
+			continue
+		}
+		n := len(merged)
+		if n > 0 {
+			last := &merged[n-1]
+			if last.TimeStamp == p.TimeStamp && last.Data[0] != 0xF0 && p.Data[0] != 0xF0 &&
+				!last.HasHighRes && !p.HasHighRes && len(last.Data)+len(p.Data) <= maxPacketDataLength {
+				last.Data = append(last.Data, p.Data...)
+				continue
+			}
+		}
+		copied := p
+		copied.Data = append([]byte{}, p.Data...)
+		merged = append(merged, copied)
 	}
+
+	return merged
 }
 
-func splitMIDIData(data []byte) [][]byte {
-	var messages [][]byte
+// Split data into single messages. Real-time bytes interleaved within a
+// message are returned on their own, before the message they interrupted.
+// Malformed data (stray data bytes, messages truncated by another status
+// byte) is returned as discarded, parsing resuming on the next status byte.
+func splitMIDIData(data []byte) (messages [][]byte, discarded []byte) {
 	for i := 0; i < len(data); {
 		status := data[i]
+		if isRealTime(status) {
+			messages = append(messages, data[i:i+1])
+			i++
+			continue
+		}
+		if (status < 0x80) || (status == 0xF7) {
+			//Not a status byte: resync on the next one
+			discarded = append(discarded, status)
+			i++
+			continue
+		}
+
 		length := midiMessageLength(status)
-		if i+length > len(data) {
-			break
+		var msg []byte // Only copied when real-time bytes are interleaved
+		n := 1
+		end := i + 1
+		for (n < length) && (end < len(data)) {
+			if isRealTime(data[end]) {
+				if msg == nil {
+					msg = append([]byte{}, data[i:end]...)
+				}
+				messages = append(messages, data[end:end+1])
+			} else if data[end] >= 0x80 {
+				//Interrupted by another message
+				break
+			} else {
+				if msg != nil {
+					msg = append(msg, data[end])
+				}
+				n++
+			}
+			end++
+		}
+		if msg == nil {
+			msg = data[i:end]
+		}
+		if n < length {
+			discarded = append(discarded, msg...)
+			i = end
+			continue
 		}
-		messages = append(messages, data[i:i+length])
-		i += length
+		messages = append(messages, msg)
+		i = end
 	}
-	return messages
+	return messages, discarded
 }
 
 func midiMessageLength(status byte) int {
@@ -248,15 +716,3 @@ func midiMessageLength(status byte) int {
 		return 1
 	}
 }
-
-func (relay *MIDIRouter) sendAllNotesOffAndResetControllers() {
-	for ch := 0; ch < 16; ch++ {
-		// All notes off
-		packet := coremidi.Packet{Data: []byte{0xB0 | byte(ch), 123, 0}}
-		packet.Send(&relay.destPort, &relay.destination)
-
-		// Reset all controllers
-		packet = coremidi.Packet{Data: []byte{0xB0 | byte(ch), 121, 0}}
-		packet.Send(&relay.destPort, &relay.destination)
-	}
-}
@@ -0,0 +1,230 @@
+package router
+
+import (
+	"MIDIRouter/backend"
+	"MIDIRouter/filter"
+	"MIDIRouter/filtercontrolchange"
+	"MIDIRouter/filternoteon"
+	"MIDIRouter/gencontrolchange"
+	"MIDIRouter/gennoteon"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"MIDIRouter/rule"
+	"bytes"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+)
+
+// Offline router and its backend
+func newTestRouter(tb testing.TB) (*MIDIRouter, *backend.Memory) {
+	m := backend.NewMemory()
+	relay, err := NewWithBackend("test", "in", "out", m)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	relay.log.SetLevel(logger.LevelError)
+	tb.Cleanup(relay.Cleanup)
+	return relay, m
+}
+
+// Control Change from on channel 1 to Control Change to
+func newCCRule(tb testing.TB, name string, from string, to string) *rule.Rule {
+	r, err := rule.New(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	f, err := filtercontrolchange.New(filter.FilterChannel1, json.RawMessage(`{"ControllerNumber": "`+from+`", "Value": "*"}`))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := r.SetFilter(f); err != nil {
+		tb.Fatal(err)
+	}
+	g, err := gencontrolchange.New(filter.FilterChannel1, json.RawMessage(`{"ControllerNumber": "`+to+`", "Value": "*"}`))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := r.SetGenerator(g); err != nil {
+		tb.Fatal(err)
+	}
+	return r
+}
+
+// Inject packets into the router source, then stop it: returns the data sent
+// to the destination, cleanup sequence left out (packets may be merged)
+func routed(relay *MIDIRouter, m *backend.Memory, packets ...[]byte) []byte {
+	relay.SetCleanup(CleanupSettings{})
+	for _, data := range packets {
+		m.Inject(midi.NewPacket(data, 0))
+	}
+	relay.Cleanup()
+	return sentData(m)
+}
+
+func sentData(m *backend.Memory) []byte {
+	var sent []byte
+	for _, p := range m.Sent() {
+		sent = append(sent, p.Data...)
+	}
+	return sent
+}
+
+func expectSent(t *testing.T, sent []byte, expected ...byte) {
+	t.Helper()
+	if !bytes.Equal(sent, expected) {
+		t.Fatalf("Sent % X, expected % X", sent, expected)
+	}
+}
+
+func TestRouteRule(t *testing.T) {
+	relay, m := newTestRouter(t)
+	relay.AddRule(newCCRule(t, "volume", "7", "74"))
+
+	sent := routed(relay, m, []byte{0xB0, 7, 64})
+	expectSent(t, sent, 0xB0, 74, 64)
+}
+
+// Messages no rule matches are dropped, unless in passthrough mode
+func TestRouteNoMatch(t *testing.T) {
+	relay, m := newTestRouter(t)
+	relay.AddRule(newCCRule(t, "volume", "7", "74"))
+
+	sent := routed(relay, m, []byte{0xB0, 1, 64}, []byte{0xB1, 7, 64}, []byte{0x90, 60, 100})
+	expectSent(t, sent)
+}
+
+func TestRoutePassthrough(t *testing.T) {
+	relay, m := newTestRouter(t)
+	relay.SetPassthrough(true)
+
+	sent := routed(relay, m, []byte{0x90, 60, 100}, []byte{0xF0, 0x43, 0x10, 0xF7})
+	expectSent(t, sent, 0x90, 60, 100, 0xF0, 0x43, 0x10, 0xF7)
+}
+
+// The first rule matching a message in configuration order wins
+func TestRouteFirstMatch(t *testing.T) {
+	relay, m := newTestRouter(t)
+	relay.AddRule(newCCRule(t, "first", "7", "74"))
+	relay.AddRule(newCCRule(t, "second", "7", "75"))
+	relay.AddRule(newCCRule(t, "other", "1", "2"))
+
+	sent := routed(relay, m, []byte{0xB0, 7, 64}, []byte{0xB0, 1, 10})
+	expectSent(t, sent, 0xB0, 74, 64, 0xB0, 2, 10)
+}
+
+// Packets are split into messages, SysEx being reassembled across packets
+func TestRouteParsing(t *testing.T) {
+	relay, m := newTestRouter(t)
+	relay.AddRule(newCCRule(t, "volume", "7", "74"))
+
+	sent := routed(relay, m, []byte{0xB0, 7, 1, 0xB0, 7, 2}, []byte{0xF0, 0x43}, []byte{0x10, 0xF7, 0xB0, 7, 3})
+	expectSent(t, sent, 0xB0, 74, 1, 0xB0, 74, 2, 0xB0, 74, 3)
+}
+
+func TestRouteDisabledRule(t *testing.T) {
+	relay, m := newTestRouter(t)
+	relay.AddRule(newCCRule(t, "first", "7", "74"))
+	relay.AddRule(newCCRule(t, "second", "7", "75"))
+	if err := relay.SetRuleEnabled("first", false); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := routed(relay, m, []byte{0xB0, 7, 64})
+	expectSent(t, sent, 0xB0, 75, 64)
+}
+
+// The cleanup sequence is sent on exit, on the channels messages were sent on
+func TestCleanupSequence(t *testing.T) {
+	relay, m := newTestRouter(t)
+	relay.AddRule(newCCRule(t, "volume", "7", "74"))
+	relay.SetCleanup(CleanupSettings{AllNotesOff: true, UsedChannelsOnly: true})
+
+	m.Inject(midi.NewPacket([]byte{0xB0, 7, 64}, 0))
+	relay.Cleanup()
+	relay.Cleanup()
+	expectSent(t, sentData(m), 0xB0, 74, 64, 0xB0, 123, 0)
+}
+
+// Notes on channel 1 played on channel 2
+func newNoteRule(tb testing.TB, name string) *rule.Rule {
+	r, err := rule.New(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	f, err := filternoteon.New(filter.FilterChannel1, json.RawMessage(`{"Note": "*", "Velocity": "*"}`))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := r.SetFilter(f); err != nil {
+		tb.Fatal(err)
+	}
+	g, err := gennoteon.New(filter.FilterChannel2, json.RawMessage(`{"Note": "*", "Velocity": "*"}`))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := r.SetGenerator(g); err != nil {
+		tb.Fatal(err)
+	}
+	return r
+}
+
+func TestReloadDroppedRule(t *testing.T) {
+	relay, m := newTestRouter(t)
+	relay.SetCleanup(CleanupSettings{})
+	relay.AddRule(newNoteRule(t, "notes"))
+	m.Inject(midi.NewPacket([]byte{0x90, 0x3C, 0x64}, 0))
+
+	relay.Reload(ReloadSettings{Rules: []*rule.Rule{newCCRule(t, "volume", "7", "74")}})
+	relay.Cleanup()
+	expectSent(t, sentData(m), 0x91, 0x3C, 0x64, 0x81, 0x3C, 0x40)
+}
+
+func TestReloadReplacedRule(t *testing.T) {
+	relay, m := newTestRouter(t)
+	relay.SetCleanup(CleanupSettings{})
+	relay.AddRule(newNoteRule(t, "notes"))
+	m.Inject(midi.NewPacket([]byte{0x90, 0x3C, 0x64}, 0))
+
+	relay.Reload(ReloadSettings{Rules: []*rule.Rule{newNoteRule(t, "notes")}})
+	relay.Cleanup()
+	expectSent(t, sentData(m), 0x91, 0x3C, 0x64)
+}
+
+// Send path alone: validation, tracking, events and the backend
+func BenchmarkSend(b *testing.B) {
+	relay, m := newTestRouter(b)
+	m.OnSend(func(packet midi.Packet) {})
+	packet := midi.NewPacket([]byte{0xB0, 74, 64}, 0)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := relay.send(packet); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Input to output: parsing, rule matching, output queue and send path
+func BenchmarkRoute(b *testing.B) {
+	relay, m := newTestRouter(b)
+	for i := 0; i < 32; i++ {
+		relay.AddRule(newCCRule(b, "", "20", "21"))
+	}
+	relay.AddRule(newCCRule(b, "", "7", "74"))
+	var sent atomic.Int64
+	done := make(chan struct{})
+	m.OnSend(func(packet midi.Packet) {
+		if sent.Add(1) == int64(b.N) {
+			close(done)
+		}
+	})
+	packet := midi.NewPacket([]byte{0xB0, 7, 64}, 0)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Inject(packet)
+	}
+	<-done
+}
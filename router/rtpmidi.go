@@ -0,0 +1,73 @@
+package router
+
+import (
+	"MIDIRouter/backend"
+	"MIDIRouter/midi"
+	"MIDIRouter/rtpmidi"
+	"errors"
+	"net"
+	"strings"
+)
+
+// Devices named "rtpmidi://<host>:<port>" are RTP-MIDI network sessions
+// (macOS "Network" MIDI, rtpMIDI on Windows, network MIDI interfaces): the
+// router invites the session listening on that address. Named
+// "rtpmidi://:<port>", the router is the session, other computers joining it.
+// Either way the session can be the source or the destination.
+const rtpMIDIPrefix = "rtpmidi://"
+
+func isRTPMIDIDevice(device string) bool {
+	return strings.HasPrefix(device, rtpMIDIPrefix)
+}
+
+func (relay *MIDIRouter) openRTPMIDISession(device string, receive func(data []byte)) (*rtpmidi.Session, error) {
+	address := strings.TrimPrefix(device, rtpMIDIPrefix)
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.New("Invalid RTP-MIDI session address '" + address + "': expected host:port")
+	}
+	name := relay.name
+	if name == "" {
+		name = "MIDIRouter"
+	}
+	if host == "" {
+		session, err := rtpmidi.Listen(address, name, receive)
+		if err == nil {
+			relay.log.Infof("RTP-MIDI session '%s' listening on %s\n", name, address)
+		}
+		return session, err
+	}
+	session, err := rtpmidi.Dial(address, name, receive)
+	if err == nil {
+		relay.log.Infof("RTP-MIDI session '%s' inviting %s\n", name, address)
+	}
+	return session, err
+}
+
+func (relay *MIDIRouter) setupRTPMIDISource() error {
+	//Offline routers are fed by replays and self-tests
+	if _, offline := relay.backend.(*backend.Memory); offline {
+		return nil
+	}
+	session, err := relay.openRTPMIDISession(relay.sourceDevice, func(data []byte) {
+		relay.onPacket(midi.NewPacket(data, 0))
+	})
+	if err != nil {
+		return err
+	}
+	relay.rtpSource = session
+	return nil
+}
+
+func (relay *MIDIRouter) setupRTPMIDIDestination() error {
+	if _, offline := relay.backend.(*backend.Memory); offline {
+		return nil
+	}
+	//Messages sent back by the participants are ignored
+	session, err := relay.openRTPMIDISession(relay.destinationDevice, func(data []byte) {})
+	if err != nil {
+		return err
+	}
+	relay.rtpDestination = session
+	return nil
+}
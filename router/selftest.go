@@ -0,0 +1,131 @@
+package router
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/midi"
+	"MIDIRouter/rule"
+	"fmt"
+	"strings"
+)
+
+// Outcome of the self-test for a rule
+type SelfTestResult struct {
+	Index     int // Position in the rules (1 based)
+	Rule      string
+	Enabled   bool
+	Matched   int      // Test messages the rule matched first
+	Consumed  int      // Matched messages the rule generates nothing for by design (actions, variables...)
+	Generated int      // Messages generated for those
+	Malformed int      // Generated messages with invalid data
+	Types     []string // Types of generated messages
+}
+
+// Whether the rule produced valid output for some test message, or matched
+// messages it is meant to consume
+func (res SelfTestResult) Passed() bool {
+	return ((res.Generated > 0) || (res.Consumed > 0)) && (res.Malformed == 0)
+}
+
+func (res SelfTestResult) String() string {
+	rule := fmt.Sprintf("Rule #%d '%s'", res.Index, res.Rule)
+	switch {
+	case !res.Enabled:
+		return rule + ": disabled"
+	case res.Matched == 0:
+		return rule + ": FAIL, never matched (filter unreachable or shadowed by an earlier rule)"
+	case (res.Generated == 0) && (res.Consumed == 0):
+		return fmt.Sprintf("%s: FAIL, matched %d messages but generated nothing", rule, res.Matched)
+	case res.Malformed > 0:
+		return fmt.Sprintf("%s: FAIL, generated %d malformed messages", rule, res.Malformed)
+	case res.Generated == 0:
+		return fmt.Sprintf("%s: OK, matched %d messages, without output", rule, res.Matched)
+	}
+	return fmt.Sprintf("%s: OK, matched %d messages, generated %d (%s)",
+		rule, res.Matched, res.Generated, strings.Join(res.Types, ", "))
+}
+
+// Test messages: every channel message type on every channel, with every
+// first data byte and a range of second data byte values, then transport
+// and clock messages
+func selfTestPackets() []midi.Packet {
+	var packets []midi.Packet
+
+	for status := 0x80; status < 0xF0; status++ {
+		for data1 := byte(0); data1 < 0x80; data1++ {
+			if (status&0xF0 == 0xC0) || (status&0xF0 == 0xD0) {
+				packets = append(packets, midi.NewPacket([]byte{byte(status), data1}, 0))
+				continue
+			}
+			for _, data2 := range []byte{0, 1, 64, 127} {
+				packets = append(packets, midi.NewPacket([]byte{byte(status), data1, data2}, 0))
+			}
+		}
+	}
+
+	// Transport and clock
+	for _, status := range []byte{0xFA, 0xF8, 0xF8, 0xFB, 0xFC} {
+		packets = append(packets, midi.NewPacket([]byte{status}, 0))
+	}
+	return packets
+}
+
+// Push test messages through the rules, reporting for each rule (in priority
+// order) the messages it matched and what it generated. Nothing is sent.
+func (relay *MIDIRouter) SelfTest() []SelfTestResult {
+	results := make(map[*rule.Rule]*SelfTestResult)
+	types := make(map[*SelfTestResult]map[string]bool) // Types already in results
+	for i, r := range relay.rules {
+		results[r] = &SelfTestResult{Index: i + 1, Rule: r.Name(), Enabled: r.Enabled()}
+		types[results[r]] = make(map[string]bool)
+	}
+
+	for _, packet := range selfTestPackets() {
+		matchResult, r := relay.matchingRule(packet)
+		res, ok := results[r]
+		if !ok {
+			continue
+		}
+		res.Matched++
+		if matchResult.Result == rule.RuleMatchResultMatchNoInject {
+			res.Consumed++
+			continue
+		}
+
+		for _, p := range append([]midi.Packet{matchResult.MainPacket}, matchResult.ExtraPackets...) {
+			if len(p.Data) == 0 {
+				continue
+			}
+			messages, discarded := splitMIDIData(p.Data)
+			if len(discarded) > 0 {
+				res.Malformed++
+			}
+			for _, msg := range messages {
+				res.Generated++
+				if invalidStatus, invalidData := checkMessages(msg); (invalidStatus >= 0) || (invalidData >= 0) {
+					res.Malformed++
+				}
+				name := messageTypeName(msg[0])
+				if !types[res][name] {
+					types[res][name] = true
+					res.Types = append(res.Types, name)
+				}
+			}
+		}
+	}
+
+	var report []SelfTestResult
+	for _, r := range relay.rules {
+		report = append(report, *results[r])
+	}
+	return report
+}
+
+func messageTypeName(status byte) string {
+	if status == 0xF0 {
+		return "SysEx"
+	}
+	if status > 0xF0 {
+		return fmt.Sprintf("System %02X", status)
+	}
+	return fmt.Sprintf("%s ch%d", filter.FilterMsgType(status>>4), status&0x0F+1)
+}
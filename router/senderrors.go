@@ -0,0 +1,37 @@
+package router
+
+import (
+	"sync"
+	"time"
+)
+
+// Send failures are logged at most once per second: a lost destination (a
+// remote router going down...) fails every packet
+const sendErrorDelay = time.Second
+
+type sendErrors struct {
+	mutex      sync.Mutex
+	lastLogged time.Time
+	suppressed int // Failures not logged since lastLogged
+}
+
+func (relay *MIDIRouter) logSendError(err error) {
+	s := &relay.sendErrors
+	now := relay.clock.Now()
+
+	s.mutex.Lock()
+	if now.Sub(s.lastLogged) < sendErrorDelay {
+		s.suppressed++
+		s.mutex.Unlock()
+		return
+	}
+	suppressed := s.suppressed
+	s.lastLogged, s.suppressed = now, 0
+	s.mutex.Unlock()
+
+	if suppressed > 0 {
+		relay.log.Errorf("Failed to send MIDI packet: %v (%d more failures)\n", err, suppressed)
+	} else {
+		relay.log.Error("Failed to send MIDI packet:", err)
+	}
+}
@@ -1,78 +1,53 @@
 package router
 
-import (
-	"errors"
-	"fmt"
-
-	"github.com/youpy/go-coremidi"
-)
-
 func (relay *MIDIRouter) setupSource() error {
-	source, err := findSource(relay.sourceDevice)
-	if err != nil {
-		return err
+	if isFileSource(relay.sourceDevice) {
+		return relay.setupFileSource()
 	}
-	relay.srcPort, err = coremidi.NewInputPort(relay.midiClient, relay.sourceDevice+" input port",
-		func(source coremidi.Source, packet coremidi.Packet) {
-			relay.onPacket(source, packet)
-		})
-	if err != nil {
-		return err
+	if isRemoteDevice(relay.sourceDevice) {
+		return relay.setupRemoteSource()
 	}
-
-	_, err = relay.srcPort.Connect(source)
+	if isRTPMIDIDevice(relay.sourceDevice) {
+		return relay.setupRTPMIDISource()
+	}
+	if isVirtualDevice(relay.sourceDevice) {
+		return relay.setupVirtualSource()
+	}
+	if isBLEDevice(relay.sourceDevice) {
+		return relay.setupBLESource()
+	}
+	name, err := relay.resolveDevice(relay.sourceDevice, true)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return relay.backend.OpenSource(name, relay.onPacket)
 }
 
 func (relay *MIDIRouter) setupDestination() error {
-	destination, err := findDestination(relay.destinationDevice)
-	if err != nil {
-		return err
+	if isOSCDestination(relay.destinationDevice) {
+		return relay.setupOSCDestination()
 	}
-
-	relay.destPort, err = coremidi.NewOutputPort(relay.midiClient, relay.destinationDevice+" output port")
-	if err != nil {
-		return err
+	if isRemoteDevice(relay.destinationDevice) {
+		return relay.setupRemoteDestination()
 	}
-
-	relay.destination = destination
-	fmt.Println("Destination device: ", destination.Name(), "(", destination.Manufacturer(), ")")
-
-	return nil
-}
-
-func findSource(key string) (coremidi.Source, error) {
-	sources, err := coremidi.AllSources()
-	if err != nil {
-		return coremidi.Source{}, err
+	if isRTPMIDIDevice(relay.destinationDevice) {
+		return relay.setupRTPMIDIDestination()
 	}
-
-	for _, s := range sources {
-		dk := s.Entity().Device().Name() + "/" + s.Manufacturer() + "/" + s.Name()
-		if dk == key {
-			return s, nil
-		}
+	if isVirtualDevice(relay.destinationDevice) {
+		return relay.setupVirtualDestination()
 	}
-
-	return coremidi.Source{}, errors.New("MIDI source not found: " + key)
-}
-
-func findDestination(key string) (coremidi.Destination, error) {
-	dest, err := coremidi.AllDestinations()
+	if isBLEDevice(relay.destinationDevice) {
+		return relay.setupBLEDestination()
+	}
+	name, err := relay.resolveDevice(relay.destinationDevice, false)
 	if err != nil {
-		return coremidi.Destination{}, err
+		return err
 	}
-
-	for _, d := range dest {
-		dk := d.Manufacturer() + "/" + d.Name()
-		if dk == key {
-			return d, nil
-		}
+	err = relay.backend.OpenDestination(name)
+	if err != nil {
+		return err
 	}
+	relay.log.Info("Destination device: ", name)
 
-	return coremidi.Destination{}, errors.New("MIDI destination not found: " + key)
+	return nil
 }
@@ -0,0 +1,122 @@
+package router
+
+import (
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
+	"sync"
+)
+
+// Last Control Change values sent to the destination
+type controllerCache struct {
+	mutex  sync.Mutex
+	values [16][128]uint8
+	known  [16][2]uint64 // Bitmask of controllers sent at least once
+}
+
+func (c *controllerCache) track(packet midi.Packet) {
+	messages, _ := splitMIDIData(packet.Data)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, msg := range messages {
+		//Channel mode messages (120-127) are not controller values
+		if (len(msg) != 3) || (msg[0]&0xF0 != 0xB0) || (msg[1] >= 120) {
+			continue
+		}
+		channel, controller := msg[0]&0x0F, msg[1]
+		c.values[channel][controller] = msg[2]
+		c.known[channel][controller>>6] |= 1 << (controller & 63)
+	}
+}
+
+func (c *controllerCache) get(channel uint8, controller uint8) (uint8, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.known[channel][controller>>6]&(1<<(controller&63)) == 0 {
+		return 0, false
+	}
+	return c.values[channel][controller], true
+}
+
+// Control Change messages with the last value of every controller sent
+func (c *controllerCache) packets() []midi.Packet {
+	var packets []midi.Packet
+	for channel := uint8(0); channel < 16; channel++ {
+		for controller := uint8(0); controller < 128; controller++ {
+			if value, ok := c.get(channel, controller); ok {
+				packets = append(packets, midi.NewPacket([]byte{0xB0 | channel, controller, value}, 0))
+			}
+		}
+	}
+	return packets
+}
+
+// Last value of a controller (0-127) sent on a channel (0-15) to the destination
+func (relay *MIDIRouter) ControllerValue(channel uint8, controller uint8) (uint8, bool) {
+	return relay.controllers.get(channel&0x0F, controller&0x7F)
+}
+
+// Controller values saved and resent on trigger messages
+type Snapshot struct {
+	Name        string
+	Channels    []uint8 // 0-15
+	Controllers []uint8
+	Save        filterinterface.FilterInterface // Trigger saving the current values
+	Recall      filterinterface.FilterInterface // Trigger resending the saved values
+
+	mutex sync.Mutex
+	saved []midi.Packet
+}
+
+func (relay *MIDIRouter) AddSnapshot(s *Snapshot) {
+	relay.snapshots = append(relay.snapshots, s)
+}
+
+// Save the last values sent for the snapshot controllers. Controllers never
+// sent are left out.
+func (s *Snapshot) save(cache *controllerCache) int {
+	var saved []midi.Packet
+	for _, channel := range s.Channels {
+		for _, controller := range s.Controllers {
+			if value, ok := cache.get(channel, controller); ok {
+				saved = append(saved, midi.NewPacket([]byte{0xB0 | channel, controller, value}, 0))
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.saved = saved
+	return len(saved)
+}
+
+func (s *Snapshot) recall() []midi.Packet {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]midi.Packet{}, s.saved...)
+}
+
+// Reports whether the packet was a snapshot trigger
+func (relay *MIDIRouter) handleSnapshot(packet midi.Packet) bool {
+	for _, s := range relay.snapshots {
+		if matched, pressed := matchTrigger(s.Save, packet); matched {
+			if pressed {
+				relay.log.Infof("Snapshot '%s': %d controllers saved\n", s.Name, s.save(&relay.controllers))
+			}
+			return true
+		}
+		if matched, pressed := matchTrigger(s.Recall, packet); matched {
+			if pressed {
+				packets := s.recall()
+				relay.log.Infof("Snapshot '%s': %d controllers recalled\n", s.Name, len(packets))
+				relay.sendBatch(packets)
+			}
+			return true
+		}
+	}
+	return false
+}
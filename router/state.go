@@ -0,0 +1,12 @@
+package router
+
+// Router state of a MIDI channel (0-15), as seen by rule conditions
+func (relay *MIDIRouter) ChannelState(channel uint8) map[string]interface{} {
+	return map[string]interface{}{
+		"sustain":   relay.sustain.isDown(channel),
+		"tempo":     relay.Tempo(),
+		"running":   relay.Running(),
+		"vars":      relay.Variables(),
+		"modifiers": relay.Modifiers(),
+	}
+}
@@ -0,0 +1,137 @@
+package router
+
+import (
+	"MIDIRouter/midi"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// Router state saved on exit and restored on startup
+type savedState struct {
+	Controllers []string                   // Last Control Change messages sent, as hex strings
+	Variables   map[string]int             `json:",omitempty"`
+	Snapshots   map[string][]string        `json:",omitempty"` // Snapshot name => saved messages
+	Rules       map[string]json.RawMessage `json:",omitempty"` // Rule name => transform state
+	Bluetooth   map[string]string          `json:",omitempty"` // "ble:" device => peripheral connected last
+}
+
+// Save the router state to this file on exit. See RestoreState.
+func (relay *MIDIRouter) SetStateFile(path string) {
+	relay.stateFile = path
+}
+
+func toHex(packets []midi.Packet) []string {
+	messages := []string{}
+	for _, p := range packets {
+		messages = append(messages, hex.EncodeToString(p.Data))
+	}
+	return messages
+}
+
+func fromHex(messages []string) ([]midi.Packet, error) {
+	var packets []midi.Packet
+	for _, m := range messages {
+		data, err := hex.DecodeString(m)
+		if err != nil {
+			return nil, errors.New("Invalid message '" + m + "'")
+		}
+		packets = append(packets, midi.NewPacket(data, 0))
+	}
+	return packets, nil
+}
+
+func (relay *MIDIRouter) saveState() error {
+	state := savedState{
+		Controllers: toHex(relay.controllers.packets()),
+		Snapshots:   make(map[string][]string),
+		Rules:       make(map[string]json.RawMessage),
+		Bluetooth:   make(map[string]string),
+	}
+	for _, d := range []*bleDevice{relay.bleSource, relay.bleDestination} {
+		if (d != nil) && (d.lastDevice() != "") {
+			state.Bluetooth[blePrefix+d.name] = d.lastDevice()
+		}
+	}
+	relay.variables.mutex.RLock()
+	defer relay.variables.mutex.RUnlock()
+	state.Variables = relay.variables.values
+
+	for _, s := range relay.snapshots {
+		state.Snapshots[s.Name] = toHex(s.recall())
+	}
+	for _, r := range relay.rules {
+		if data := r.SaveState(); data != nil {
+			state.Rules[r.Name()] = data
+		}
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.New("Failed to save state: " + err.Error())
+	}
+	//Write then rename, so that a crash never leaves a truncated file
+	tmp := relay.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return errors.New("Failed to save state: " + err.Error())
+	}
+	if err := os.Rename(tmp, relay.stateFile); err != nil {
+		return errors.New("Failed to save state: " + err.Error())
+	}
+	return nil
+}
+
+// Restore the state saved on the last exit, if any: variables, snapshots and
+// rule transforms (toggles) get their values back, and controller values are
+// sent again to the destination. Call once rules and snapshots are added.
+func (relay *MIDIRouter) RestoreState() error {
+	if relay.stateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(relay.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errors.New("Failed to read state file: " + err.Error())
+	}
+
+	var state savedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return errors.New("Failed to parse state file: " + err.Error())
+	}
+
+	for name, value := range state.Variables {
+		relay.SetVariable(name, value)
+	}
+	for _, d := range []*bleDevice{relay.bleSource, relay.bleDestination} {
+		if d != nil {
+			d.setLastDevice(state.Bluetooth[blePrefix+d.name])
+		}
+	}
+	for _, s := range relay.snapshots {
+		packets, err := fromHex(state.Snapshots[s.Name])
+		if err != nil {
+			return errors.New("Failed to restore snapshot '" + s.Name + "': " + err.Error())
+		}
+		s.mutex.Lock()
+		s.saved = packets
+		s.mutex.Unlock()
+	}
+	for _, r := range relay.rules {
+		if data, found := state.Rules[r.Name()]; found {
+			if err := r.RestoreState(data); err != nil {
+				return errors.New("Rule '" + r.Name() + "': " + err.Error())
+			}
+		}
+	}
+
+	packets, err := fromHex(state.Controllers)
+	if err != nil {
+		return errors.New("Failed to restore controllers: " + err.Error())
+	}
+	relay.log.Infof("State restored from %s: sending %d controller values\n", relay.stateFile, len(packets))
+	relay.sendBatch(packets)
+	return nil
+}
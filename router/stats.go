@@ -0,0 +1,25 @@
+package router
+
+// Match count of a rule
+type RuleStats struct {
+	Name    string
+	Tags    []string
+	Enabled bool
+	Matches uint64
+}
+
+// Match counts of the rules tagged with tag ("song:intro"), or of all rules
+// if tag is ""
+func (relay *MIDIRouter) RuleStats(tag string) []RuleStats {
+	relay.rulesMutex.RLock()
+	defer relay.rulesMutex.RUnlock()
+
+	var stats []RuleStats
+	for _, r := range relay.rules {
+		if (tag != "") && !r.HasTag(tag) {
+			continue
+		}
+		stats = append(stats, RuleStats{Name: r.Name(), Tags: r.Tags(), Enabled: r.Enabled(), Matches: r.Matches()})
+	}
+	return stats
+}
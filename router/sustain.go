@@ -0,0 +1,109 @@
+package router
+
+import (
+	"MIDIRouter/midi"
+	"sync"
+)
+
+const sustainController = 64
+
+// Holds generated Note Off messages while the sustain pedal of the input
+// channel they come from is down, and releases them with the pedal. Rules
+// re-channeling or transposing notes then behave as if the destination
+// received the sustain pedal, whatever happens to the CC64 messages.
+type sustainTracker struct {
+	mutex   sync.Mutex
+	down    [16]bool
+	pending [16][]midi.Packet // Held Note Off messages, by input channel
+}
+
+func (relay *MIDIRouter) SetSustainAware(enabled bool) {
+	relay.sustainAware = enabled
+}
+
+// Update the pedal state from an incoming message. Returns held Note Off
+// messages to be sent when the pedal is released.
+func (t *sustainTracker) input(packet midi.Packet) []midi.Packet {
+	if (len(packet.Data) != 3) || (packet.Data[0]&0xF0 != 0xB0) || (packet.Data[1] != sustainController) {
+		return nil
+	}
+	channel := packet.Data[0] & 0x0F
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.down[channel] = packet.Data[2] >= 64
+	if t.down[channel] {
+		return nil
+	}
+	released := t.pending[channel]
+	t.pending[channel] = nil
+	return released
+}
+
+// Whether the pedal of the channel is down
+func (t *sustainTracker) isDown(channel byte) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.down[channel&0x0F]
+}
+
+// Filter generated messages for a message received on inputChannel: Note Off
+// messages are held while the pedal is down. A held note struck again is
+// released first.
+func (t *sustainTracker) output(inputChannel byte, packets []midi.Packet) []midi.Packet {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var send []midi.Packet
+	for _, p := range packets {
+		if (len(p.Data) != 3) || ((p.Data[0]&0xF0 != 0x80) && (p.Data[0]&0xF0 != 0x90)) {
+			send = append(send, p)
+			continue
+		}
+
+		noteOff := (p.Data[0]&0xF0 == 0x80) || (p.Data[2] == 0)
+		if noteOff && t.down[inputChannel] {
+			t.pending[inputChannel] = append(t.pending[inputChannel], p)
+			continue
+		}
+		if !noteOff {
+			send = append(send, t.releaseHeld(p.Data[0]&0x0F, p.Data[1])...)
+		}
+		send = append(send, p)
+	}
+	return send
+}
+
+// Remove held Note Off messages for an output note, returning them
+func (t *sustainTracker) releaseHeld(channel byte, note byte) []midi.Packet {
+	var released []midi.Packet
+
+	for ch := range t.pending {
+		kept := t.pending[ch][:0]
+		for _, p := range t.pending[ch] {
+			if (p.Data[0]&0x0F == channel) && (p.Data[1] == note) {
+				released = append(released, p)
+			} else {
+				kept = append(kept, p)
+			}
+		}
+		t.pending[ch] = kept
+	}
+	return released
+}
+
+// Returns all held Note Off messages
+func (t *sustainTracker) flush() []midi.Packet {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var released []midi.Packet
+	for ch := range t.pending {
+		released = append(released, t.pending[ch]...)
+		t.pending[ch] = nil
+		t.down[ch] = false
+	}
+	return released
+}
@@ -0,0 +1,55 @@
+package router
+
+import (
+	"MIDIRouter/midi"
+	"errors"
+)
+
+type SystemPolicy uint8
+
+const (
+	SystemPolicyDefault = iota // Passthrough setting and rules apply
+	SystemPolicyForward = iota // Always forwarded as is
+	SystemPolicyDrop    = iota // Never forwarded
+)
+
+// System common and real-time messages, by status byte
+var systemMessageNames = map[string]byte{
+	"MTC Quarter Frame": 0xF1,
+	"Song Position":     0xF2,
+	"Song Select":       0xF3,
+	"Tune Request":      0xF6,
+	"Clock":             0xF8,
+	"Start":             0xFA,
+	"Continue":          0xFB,
+	"Stop":              0xFC,
+	"Active Sensing":    0xFE,
+	"Reset":             0xFF,
+}
+
+// Set how a system common or real-time message is handled, by name
+func (relay *MIDIRouter) SetSystemPolicy(name string, policy SystemPolicy) error {
+	status, ok := systemMessageNames[name]
+	if !ok {
+		return errors.New("Unknown system message: " + name)
+	}
+	relay.systemPolicies[status&0x0F] = policy
+	return nil
+}
+
+// Apply system message policies. Returns true if the packet was handled.
+func (relay *MIDIRouter) handleSystemPacket(packet midi.Packet) bool {
+	status := packet.Data[0]
+	if (status <= 0xF0) || (status == 0xF7) {
+		return false
+	}
+
+	switch relay.systemPolicies[status&0x0F] {
+	case SystemPolicyForward:
+		relay.output.push(packet)
+		return true
+	case SystemPolicyDrop:
+		return true
+	}
+	return false
+}
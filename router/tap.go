@@ -0,0 +1,28 @@
+package router
+
+import (
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
+)
+
+// Messages matching the filter (with a value above 0, e.g. footswitch pressed)
+// tap the tempo. They are not processed any further.
+func (relay *MIDIRouter) SetTapTempo(f filterinterface.FilterInterface) {
+	relay.tapFilter = f
+}
+
+// Reports whether the packet was a tap
+func (relay *MIDIRouter) handleTap(packet midi.Packet) bool {
+	matched, pressed := matchTrigger(relay.tapFilter, packet)
+	if !matched {
+		return false
+	}
+
+	if pressed {
+		if bpm, ok := relay.tap.Tap(relay.clock.Now()); ok {
+			relay.SetTempo(bpm)
+			relay.log.Infof("Tap tempo: %.1f BPM\n", bpm)
+		}
+	}
+	return true
+}
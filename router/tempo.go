@@ -0,0 +1,92 @@
+package router
+
+import (
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"MIDIRouter/rule"
+	"MIDIRouter/tempo"
+	"time"
+)
+
+// Set the tempo used for musical durations and the master clock when no MIDI
+// clock is received. Can be changed while running (tap tempo).
+func (relay *MIDIRouter) SetTempo(bpm float64) {
+	relay.tempoMutex.Lock()
+	defer relay.tempoMutex.Unlock()
+
+	relay.fallbackTempo = bpm
+}
+
+// Current tempo in BPM: from the incoming MIDI clock, or the configured
+// (or tapped) tempo
+func (relay *MIDIRouter) Tempo() float64 {
+	if bpm := relay.tempo.BPM(relay.clock.Now()); bpm > 0 {
+		return bpm
+	}
+
+	relay.tempoMutex.Lock()
+	defer relay.tempoMutex.Unlock()
+
+	if relay.fallbackTempo > 0 {
+		return relay.fallbackTempo
+	}
+	return rule.DefaultTempo
+}
+
+// Moments less than this fraction of the grid late are on the grid line
+const quantizeLate = 0.125
+
+// Delay from now to the next grid line of a note value (fraction of a whole
+// note), following the song position of the clock. Reports false when no
+// clock is running.
+func (relay *MIDIRouter) UntilGrid(note float64) (time.Duration, bool) {
+	interval := time.Duration(float64(time.Minute) / (relay.Tempo() * tempo.ClockTicksPerBeat))
+	return relay.position.Until(note*4*tempo.ClockTicksPerBeat, interval, quantizeLate, relay.clock.Now())
+}
+
+// Follow the song position from transport messages and clock ticks
+func (relay *MIDIRouter) trackPosition(data []byte, now time.Time) {
+	switch {
+	case (len(data) == 3) && (data[0] == statusPosition):
+		//Song position is in 16th notes, 6 clock ticks each
+		relay.position.Locate((int64(data[1]) | int64(data[2])<<7) * 6)
+	case len(data) != 1:
+	case data[0] == tempo.ClockTick:
+		relay.position.Tick(now)
+	case data[0] == statusStart:
+		relay.position.Start()
+	case data[0] == statusContinue:
+		relay.position.Continue()
+	case data[0] == statusStop:
+		relay.position.Stop()
+	}
+}
+
+// Update the estimate with clock ticks of an incoming packet, logging changes
+// in verbose mode. Unless the router is the clock master, the song position
+// follows incoming transport messages.
+func (relay *MIDIRouter) trackTempo(packet midi.Packet) {
+	if !relay.masterClock() {
+		messages, _ := splitMIDIData(packet.Data)
+		for _, msg := range messages {
+			relay.trackPosition(msg, relay.clock.Now())
+		}
+	}
+
+	for _, b := range packet.Data {
+		if b != tempo.ClockTick {
+			continue
+		}
+		now := relay.clock.Now()
+		relay.tempo.Tick(now)
+		if !relay.log.Enabled(logger.LevelDebug) {
+			continue
+		}
+		relay.tempoMutex.Lock()
+		bpm, changed := relay.tempoChanges.Changed(relay.tempo.BPM(now))
+		relay.tempoMutex.Unlock()
+		if changed {
+			relay.log.Debugf("Tempo: %d BPM\n", bpm)
+		}
+	}
+}
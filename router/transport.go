@@ -0,0 +1,130 @@
+package router
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/midi"
+	"MIDIRouter/tempo"
+	"sync"
+	"time"
+)
+
+const (
+	statusStart    = 0xFA
+	statusContinue = 0xFB
+	statusStop     = 0xFC
+	statusPosition = 0xF2
+)
+
+// Transport state of the destination, followed from the Start, Continue and
+// Stop messages sent to it. As clock master, the router sends clock ticks
+// while running.
+type transport struct {
+	mutex   sync.Mutex
+	running bool
+	master  bool
+	stop    chan struct{} // Stops the master clock, nil when not ticking
+}
+
+// Act as clock master: from the Start or Continue message sent to the
+// destination (typically generated by a rule) until Stop, the router sends
+// clock ticks at Tempo(). Continue is preceded by the Song Position Pointer
+// of the clock.
+func (relay *MIDIRouter) SetMasterClock(master bool) {
+	relay.transport.mutex.Lock()
+	defer relay.transport.mutex.Unlock()
+
+	relay.transport.master = master
+}
+
+// Whether the destination was started (Start or Continue) and not stopped since
+func (relay *MIDIRouter) Running() bool {
+	relay.transport.mutex.Lock()
+	defer relay.transport.mutex.Unlock()
+
+	return relay.transport.running
+}
+
+func (relay *MIDIRouter) masterClock() bool {
+	relay.transport.mutex.Lock()
+	defer relay.transport.mutex.Unlock()
+
+	return relay.transport.master
+}
+
+func (relay *MIDIRouter) transportLayer(packet midi.Packet, next func(midi.Packet) error) error {
+	if (len(packet.Data) == 0) || (packet.Data[0] < statusPosition) || (packet.Data[0] == tempo.ClockTick) {
+		return next(packet)
+	}
+
+	t := &relay.transport
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	//As master, the song position follows what the destination is sent
+	if t.master {
+		relay.trackPosition(packet.Data, relay.clock.Now())
+	}
+	if (len(packet.Data) != 1) || (packet.Data[0] < statusStart) || (packet.Data[0] > statusStop) {
+		return next(packet)
+	}
+
+	//Stop ticking before Stop is sent, start after Start
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+	t.running = packet.Data[0] != statusStop
+
+	//Slaves resume from the master position
+	if t.master && (packet.Data[0] == statusContinue) {
+		sixteenth := relay.position.Ticks() / 6
+		if sixteenth > 0x3FFF {
+			sixteenth = 0x3FFF
+		}
+		relay.position.Locate(sixteenth * 6)
+		if err := next(midi.Packet{Data: []byte{statusPosition, byte(sixteenth & 0x7F), byte(sixteenth >> 7)}}); err != nil {
+			return err
+		}
+	}
+
+	err := next(packet)
+	if t.running && t.master {
+		t.stop = make(chan struct{})
+		go relay.runMasterClock(t.stop)
+		relay.log.Debugf("Master clock started at %.1f BPM\n", relay.Tempo())
+	}
+	return err
+}
+
+// Send clock ticks until stop is closed, following tempo changes
+func (relay *MIDIRouter) runMasterClock(stop chan struct{}) {
+	next := relay.clock.Now()
+	tick := make(chan struct{}, 1)
+	for {
+		relay.position.Tick(relay.clock.Now())
+		relay.output.push(midi.Packet{Data: []byte{tempo.ClockTick}})
+
+		next = next.Add(time.Duration(float64(time.Minute) / (relay.Tempo() * tempo.ClockTicksPerBeat)))
+		timer := relay.clock.AfterFunc(clock.Until(relay.clock, next), func() { tick <- struct{}{} })
+		select {
+		case <-relay.quit:
+			timer.Stop()
+			return
+		case <-stop:
+			timer.Stop()
+			return
+		case <-tick:
+		}
+	}
+}
+
+// Stop slaved devices on exit, when running as clock master
+func (relay *MIDIRouter) stopMasterClock() {
+	relay.transport.mutex.Lock()
+	ticking := relay.transport.stop != nil
+	relay.transport.mutex.Unlock()
+
+	if ticking {
+		relay.output.push(midi.Packet{Data: []byte{statusStop}})
+	}
+}
@@ -0,0 +1,24 @@
+package router
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/filterinterface"
+	"MIDIRouter/midi"
+)
+
+// Match an incoming message against a trigger filter (tap tempo, snapshots).
+// Reports whether the filter matched, and whether it was a press (value above
+// 0), releases being matched but ignored.
+func matchTrigger(f filterinterface.FilterInterface, packet midi.Packet) (matched bool, pressed bool) {
+	if f == nil {
+		return false, false
+	}
+	if !f.QuickMatch(filter.FilterMsgType(packet.Data[0]>>4), filter.FilterChannel(packet.Data[0]&0x0F)) {
+		return false, false
+	}
+	result, value := f.Match(packet)
+	if result == filterinterface.FilterMatchResult_NoMatch {
+		return false, false
+	}
+	return true, value > 0
+}
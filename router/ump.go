@@ -0,0 +1,68 @@
+package router
+
+import (
+	"MIDIRouter/backend"
+	"MIDIRouter/midi"
+	"MIDIRouter/ump"
+	"errors"
+)
+
+// MIDI protocol spoken by a device
+type Protocol int
+
+const (
+	ProtocolMIDI1 Protocol = iota // MIDI 1.0 byte stream
+	ProtocolMIDI2                 // Universal MIDI Packets, MIDI 2.0 channel voice messages
+)
+
+// The source device sends Universal MIDI Packets: they are converted to MIDI
+// 1.0 before being handled, rules matching 7 bits (14 bits for Pitch Wheel)
+// values
+func (relay *MIDIRouter) SetSourceProtocol(p Protocol) {
+	relay.umpInput = p == ProtocolMIDI2
+}
+
+// The destination device expects Universal MIDI Packets: messages are
+// converted to MIDI 2.0 channel voice messages on group 1, values scaled up
+// to 16 or 32 bits. MIDI devices need a backend sending UMP (CoreMIDI event
+// lists); OSC servers, remote routers and RTP-MIDI sessions get MIDI 1.0.
+func (relay *MIDIRouter) SetDestinationProtocol(p Protocol) error {
+	relay.umpOutput = false
+	if p != ProtocolMIDI2 {
+		return nil
+	}
+	if (relay.osc != nil) || (relay.remoteDestination != nil) || (relay.rtpDestination != nil) {
+		return nil
+	}
+	if isVirtualDevice(relay.destinationDevice) {
+		return errors.New("MIDI 2.0 is not supported by virtual destinations")
+	}
+	if _, ok := relay.backend.(backend.UMPBackend); !ok {
+		return errors.New("MIDI 2.0 destinations require CoreMIDI (macOS 11 or later)")
+	}
+	relay.umpOutput = true
+	return nil
+}
+
+// Send Universal MIDI Packets to the destination device
+func (relay *MIDIRouter) sendUMP(packet midi.Packet) error {
+	return relay.backend.(backend.UMPBackend).SendUMP(toUMP(packet))
+}
+
+// One packet per UMP message, keeping the MIDI 2.0 values for the filters
+// with a 16 bits Resolution
+func (relay *MIDIRouter) fromUMP(packet midi.Packet) []midi.Packet {
+	packets, err := ump.ToPackets(packet.Data, packet.TimeStamp)
+	if err != nil {
+		relay.log.Error(err)
+	}
+	return packets
+}
+
+// Messages generated with a MIDI 2.0 value keep it
+func toUMP(packet midi.Packet) midi.Packet {
+	if packet.HasHighRes {
+		return midi.NewPacket(ump.FromMIDI1Value(packet.Data, 0, packet.HighRes), packet.TimeStamp)
+	}
+	return midi.NewPacket(ump.FromMIDI1(packet.Data, 0), packet.TimeStamp)
+}
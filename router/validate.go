@@ -0,0 +1,132 @@
+package router
+
+import (
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"encoding/hex"
+	"fmt"
+)
+
+type ValidationMode uint8
+
+const (
+	ValidationModeClamp = iota // Clamp data bytes to 0x7F, drop packets with invalid status bytes
+	ValidationModeDrop  = iota // Drop invalid packets
+	ValidationModeLog   = iota // Log invalid packets, send them anyway
+	ValidationModeNone  = iota // No validation
+)
+
+func (relay *MIDIRouter) SetValidation(mode ValidationMode) {
+	relay.validation = mode
+}
+
+// Check status and data bytes of an outgoing packet. Returns the packet to
+// send (possibly sanitized), or false if it must be dropped.
+func (relay *MIDIRouter) validate(packet midi.Packet) (midi.Packet, bool) {
+	if relay.validation == ValidationModeNone {
+		return packet, true
+	}
+
+	invalidStatus, invalidData := checkMessages(packet.Data)
+	if (invalidStatus < 0) && (invalidData < 0) {
+		return packet, true
+	}
+
+	switch relay.validation {
+	case ValidationModeLog:
+		relay.log.Error("Sending invalid MIDI data:", hex.EncodeToString(packet.Data))
+		return packet, true
+	case ValidationModeClamp:
+		if invalidStatus < 0 {
+			data := append([]byte{}, packet.Data...)
+			clampDataBytes(data)
+			if relay.log.Enabled(logger.LevelDebug) {
+				relay.log.Debug(fmt.Sprintf("Clamped invalid data bytes: %s -> %s",
+					hex.EncodeToString(packet.Data), hex.EncodeToString(data)))
+			}
+			return midi.NewPacket(data, packet.TimeStamp), true
+		}
+	}
+
+	relay.invalidPackets.Add(1)
+	if relay.log.Enabled(logger.LevelDebug) {
+		relay.log.DebugDim("Dropped invalid MIDI data:", hex.EncodeToString(packet.Data))
+	}
+	return packet, false
+}
+
+// Returns the index of the first invalid status byte and of the first invalid
+// data byte (data byte above 0x7F) in data, -1 if none.
+func checkMessages(data []byte) (invalidStatus int, invalidData int) {
+	invalidStatus, invalidData = -1, -1
+
+	for i := 0; i < len(data); {
+		status := data[i]
+		if (status < 0x80) || (status == 0xF7) {
+			return i, invalidData
+		}
+
+		var end int
+		if status == 0xF0 {
+			end = i + 1
+			for (end < len(data)) && (data[end] != 0xF7) {
+				end++
+			}
+			if end == len(data) {
+				//SysEx continued in a next packet
+				end--
+			}
+		} else {
+			end = i + midiMessageLength(status) - 1
+			if end >= len(data) {
+				return i, invalidData
+			}
+		}
+
+		for j := i + 1; j <= end; j++ {
+			if (data[j] > 0x7F) && !((status == 0xF0) && (data[j] == 0xF7)) && (invalidData < 0) {
+				invalidData = j
+			}
+		}
+		i = end + 1
+	}
+	return invalidStatus, invalidData
+}
+
+// Clamp data bytes (everything but status bytes) to 0x7F
+func clampDataBytes(data []byte) {
+	for i := 0; i < len(data); {
+		status := data[i]
+		end := i + midiMessageLength(status) - 1
+		if status == 0xF0 {
+			end = i + 1
+			for (end < len(data)) && (data[end] != 0xF7) {
+				end++
+			}
+			end--
+		}
+		for j := i + 1; (j <= end) && (j < len(data)); j++ {
+			if data[j] > 0x7F {
+				data[j] = 0x7F
+			}
+		}
+		if status == 0xF0 {
+			end++ //F7
+		}
+		i = end + 1
+	}
+}
+
+func (m ValidationMode) String() string {
+	switch m {
+	case ValidationModeClamp:
+		return "Clamp"
+	case ValidationModeDrop:
+		return "Drop"
+	case ValidationModeLog:
+		return "Log"
+	case ValidationModeNone:
+		return "None"
+	}
+	return "Unknown"
+}
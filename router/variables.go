@@ -0,0 +1,40 @@
+package router
+
+import "sync"
+
+// Router-level variables, written by rules (SetVariable) and read by rule
+// conditions and generators
+type variables struct {
+	mutex  sync.RWMutex
+	values map[string]int
+}
+
+func (relay *MIDIRouter) SetVariable(name string, value int) {
+	relay.variables.mutex.Lock()
+	defer relay.variables.mutex.Unlock()
+
+	if relay.variables.values == nil {
+		relay.variables.values = make(map[string]int)
+	}
+	relay.variables.values[name] = value
+}
+
+func (relay *MIDIRouter) Variable(name string) (int, bool) {
+	relay.variables.mutex.RLock()
+	defer relay.variables.mutex.RUnlock()
+
+	value, found := relay.variables.values[name]
+	return value, found
+}
+
+// Copy of all variables, as seen by expressions
+func (relay *MIDIRouter) Variables() map[string]interface{} {
+	relay.variables.mutex.RLock()
+	defer relay.variables.mutex.RUnlock()
+
+	vars := make(map[string]interface{}, len(relay.variables.values))
+	for name, value := range relay.variables.values {
+		vars[name] = value
+	}
+	return vars
+}
@@ -0,0 +1,51 @@
+package router
+
+import (
+	"MIDIRouter/backend"
+	"errors"
+	"strings"
+)
+
+// Devices named "virtual:<name>" are endpoints the router creates, instead of
+// connecting to an existing device: as source, other applications send to a
+// destination named <name>; as destination, they receive from a source named
+// <name>.
+const virtualPrefix = "virtual:"
+
+func isVirtualDevice(device string) bool {
+	return strings.HasPrefix(device, virtualPrefix)
+}
+
+func (relay *MIDIRouter) virtualBackend() (backend.VirtualBackend, error) {
+	b, ok := relay.backend.(backend.VirtualBackend)
+	if !ok {
+		return nil, errors.New("Failed to create virtual MIDI endpoint: not supported by the MIDI system")
+	}
+	return b, nil
+}
+
+func (relay *MIDIRouter) setupVirtualSource() error {
+	b, err := relay.virtualBackend()
+	if err != nil {
+		return err
+	}
+	name := strings.TrimPrefix(relay.sourceDevice, virtualPrefix)
+	if err := b.OpenVirtualSource(name, relay.onPacket); err != nil {
+		return err
+	}
+	relay.log.Info("Source: virtual destination '" + name + "'")
+	return nil
+}
+
+func (relay *MIDIRouter) setupVirtualDestination() error {
+	b, err := relay.virtualBackend()
+	if err != nil {
+		return err
+	}
+	name := strings.TrimPrefix(relay.destinationDevice, virtualPrefix)
+	if err := b.OpenVirtualDestination(name); err != nil {
+		return err
+	}
+	relay.log.Info("Destination: virtual source '" + name + "'")
+	return nil
+}
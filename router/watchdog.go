@@ -0,0 +1,110 @@
+package router
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/midi"
+	"sync"
+	"time"
+)
+
+// A note sounding on the destination: when it started, and what produced it
+type soundingNote struct {
+	since  time.Time
+	origin string
+}
+
+// Note On/Off balance of the messages sent to the destination, by channel and note
+type noteWatchdog struct {
+	clock clock.Clock
+	mutex sync.Mutex
+	notes map[uint16]soundingNote // channel << 7 | note
+}
+
+// Release notes sounding longer than maxDuration with a Note Off, logging the
+// rule which produced them: a safety net for generator bugs. 0 disables it.
+func (relay *MIDIRouter) SetStuckNoteWatchdog(maxDuration time.Duration) {
+	if maxDuration <= 0 {
+		return
+	}
+	relay.watchdog = &noteWatchdog{clock: relay.clock, notes: make(map[uint16]soundingNote)}
+	go relay.watchStuckNotes(maxDuration)
+}
+
+// Record Note On messages about to be sent, produced by origin
+func (w *noteWatchdog) noteOn(packets []midi.Packet, origin string) {
+	now := w.clock.Now()
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, p := range packets {
+		for i := 0; i+2 < len(p.Data); i++ {
+			if ((p.Data[i] & 0xF0) == 0x90) && (p.Data[i+1] < 0x80) && (p.Data[i+2] != 0) {
+				key := uint16(p.Data[i]&0x0F)<<7 | uint16(p.Data[i+1])
+				if _, ok := w.notes[key]; !ok {
+					w.notes[key] = soundingNote{since: now, origin: origin}
+				}
+				i += 2
+			}
+		}
+	}
+}
+
+// Forget notes released by a packet sent to the destination
+func (w *noteWatchdog) noteOff(packet midi.Packet) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for i := 0; i+2 < len(packet.Data); i++ {
+		status := packet.Data[i] & 0xF0
+		if ((status == 0x80) || ((status == 0x90) && (packet.Data[i+2] == 0))) && (packet.Data[i+1] < 0x80) {
+			delete(w.notes, uint16(packet.Data[i]&0x0F)<<7|uint16(packet.Data[i+1]))
+			i += 2
+		} else if (status == 0xB0) && ((packet.Data[i+1] == 0x78) || (packet.Data[i+1] == 0x7B)) {
+			//All Sound Off / All Notes Off
+			channel := uint16(packet.Data[i] & 0x0F)
+			for key := range w.notes {
+				if key>>7 == channel {
+					delete(w.notes, key)
+				}
+			}
+			i += 2
+		}
+	}
+}
+
+// Remove and return notes sounding for longer than maxDuration
+func (w *noteWatchdog) expired(maxDuration time.Duration) map[uint16]soundingNote {
+	stuck := make(map[uint16]soundingNote)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for key, n := range w.notes {
+		if clock.Since(w.clock, n.since) > maxDuration {
+			stuck[key] = n
+			delete(w.notes, key)
+		}
+	}
+	return stuck
+}
+
+func (relay *MIDIRouter) watchStuckNotes(maxDuration time.Duration) {
+	ticker := time.NewTicker(maxDuration / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-relay.quit:
+			return
+		case <-ticker.C:
+			for key, n := range relay.watchdog.expired(maxDuration) {
+				channel := byte(key >> 7)
+				note := byte(key & 0x7F)
+				relay.log.Infof("Stuck note watchdog: releasing note %d on channel %d, sounding for %v (from %s)\n",
+					note, channel+1, clock.Since(relay.clock, n.since).Round(time.Millisecond), n.origin)
+				relay.output.push(midi.NewPacket([]byte{0x80 | channel, note, 0x40}, 0))
+			}
+		}
+	}
+}
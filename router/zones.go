@@ -0,0 +1,139 @@
+package router
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/midi"
+	"math"
+	"strings"
+	"sync"
+)
+
+// A note range of the keyboard played on its own channel, transposed and with
+// its own velocity curve. Overlapping zones layer.
+type Zone struct {
+	Name          string
+	Channels      []uint8 // Input channels, 0-15
+	Low, High     uint8   // Note range
+	OutputChannel filter.FilterChannel
+	Transpose     int
+	VelocityCurve float64 // Velocity exponent: 1 linear, below 1 louder, above 1 softer
+	While         string  // Modifier which must be active ("shift") or inactive ("!shift"), "" for always
+}
+
+// Notes played in zones, and what was sent for them
+type zones struct {
+	mutex    sync.Mutex
+	list     []*Zone
+	sounding map[uint16][]midi.Packet // Input channel<<8 | note => Note On sent
+}
+
+func (relay *MIDIRouter) AddZone(z *Zone) {
+	relay.zones.mutex.Lock()
+	defer relay.zones.mutex.Unlock()
+
+	relay.zones.list = append(relay.zones.list, z)
+}
+
+func (z *Zone) active(channel uint8, note uint8, modifiers map[string]interface{}) bool {
+	if (note < z.Low) || (note > z.High) {
+		return false
+	}
+	if z.While != "" {
+		name := strings.TrimPrefix(z.While, "!")
+		if active, _ := modifiers[name].(bool); active == (name != z.While) {
+			return false
+		}
+	}
+	for _, c := range z.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func (z *Zone) noteOn(channel uint8, note uint8, velocity uint8, timestamp uint64) (midi.Packet, bool) {
+	transposed := int(note) + z.Transpose
+	if (transposed < 0) || (transposed > 127) {
+		return midi.Packet{}, false
+	}
+	if z.OutputChannel != filter.FilterChannelAny {
+		channel = uint8(z.OutputChannel)
+	}
+	if (z.VelocityCurve > 0) && (z.VelocityCurve != 1) {
+		velocity = uint8(math.Round(127 * math.Pow(float64(velocity)/127, z.VelocityCurve)))
+		if velocity == 0 {
+			velocity = 1
+		}
+	}
+	return midi.NewPacket([]byte{0x90 | channel, uint8(transposed), velocity}, timestamp), true
+}
+
+// Route a note message through the zones. Note Off and Polyphonic Aftertouch
+// follow their Note On, even if zones changed since it was played. Reports
+// whether the message belongs to zones, rules handling it otherwise.
+func (relay *MIDIRouter) routeZones(packet midi.Packet) ([]midi.Packet, bool) {
+	if len(packet.Data) != 3 {
+		return nil, false
+	}
+	status, channel := packet.Data[0]&0xF0, packet.Data[0]&0x0F
+	if (status != 0x80) && (status != 0x90) && (status != 0xA0) {
+		return nil, false
+	}
+	noteOn := (status == 0x90) && (packet.Data[2] > 0)
+	var modifiers map[string]interface{}
+	if noteOn {
+		modifiers = relay.Modifiers()
+	}
+	key := uint16(channel)<<8 | uint16(packet.Data[1])
+
+	relay.zones.mutex.Lock()
+	defer relay.zones.mutex.Unlock()
+
+	if len(relay.zones.list) == 0 {
+		return nil, false
+	}
+	played, found := relay.zones.sounding[key]
+
+	if status == 0xA0 {
+		var packets []midi.Packet
+		for _, p := range played {
+			packets = append(packets, midi.NewPacket([]byte{0xA0 | p.Data[0]&0x0F, p.Data[1], packet.Data[2]}, packet.TimeStamp))
+		}
+		return packets, found
+	}
+
+	var packets []midi.Packet
+	release := byte(0x40)
+	if status == 0x80 {
+		release = packet.Data[2]
+	}
+	//Release what was played, a note struck again included
+	for _, p := range played {
+		packets = append(packets, midi.NewPacket([]byte{0x80 | p.Data[0]&0x0F, p.Data[1], release}, packet.TimeStamp))
+	}
+	delete(relay.zones.sounding, key)
+	if !noteOn {
+		return packets, found
+	}
+
+	inZone := false
+	played = nil
+	for _, z := range relay.zones.list {
+		if !z.active(channel, packet.Data[1], modifiers) {
+			continue
+		}
+		inZone = true
+		if p, ok := z.noteOn(channel, packet.Data[1], packet.Data[2], packet.TimeStamp); ok {
+			packets = append(packets, p)
+			played = append(played, p)
+		}
+	}
+	if len(played) > 0 {
+		if relay.zones.sounding == nil {
+			relay.zones.sounding = make(map[uint16][]midi.Packet)
+		}
+		relay.zones.sounding[key] = played
+	}
+	return packets, inZone || found
+}
@@ -0,0 +1,175 @@
+package rtpmidi
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// RTP-MIDI packets (RFC 6295): RTP header, then the MIDI command section.
+// Sent packets have no journal and use full status bytes.
+const (
+	rtpVersion     = 0x80
+	rtpPayloadType = 0x61
+	rtpHeader      = 12
+	maxListLength  = 0x0FFF
+)
+
+// RTP packet carrying one or more complete MIDI messages
+func encodeMIDI(data []byte, sequence uint16, timestamp uint32, ssrc uint32) ([]byte, error) {
+	var list []byte
+	for i, message := range splitMessages(data) {
+		//Delta time of 0 before every message but the first one
+		if i > 0 {
+			list = append(list, 0x00)
+		}
+		list = append(list, message...)
+	}
+	if len(list) > maxListLength {
+		return nil, errors.New("Failed to send RTP-MIDI packet: too much data")
+	}
+
+	buf := []byte{rtpVersion, rtpPayloadType}
+	buf = binary.BigEndian.AppendUint16(buf, sequence)
+	buf = binary.BigEndian.AppendUint32(buf, timestamp)
+	buf = binary.BigEndian.AppendUint32(buf, ssrc)
+	if len(list) <= 0x0F {
+		buf = append(buf, byte(len(list)))
+	} else {
+		//Long header (B flag), 12 bits length
+		buf = append(buf, 0x80|byte(len(list)>>8), byte(len(list)))
+	}
+	return append(buf, list...), nil
+}
+
+// MIDI bytes of the command section of an RTP packet, with full status bytes.
+// Delta times are dropped: messages are handled as they arrive.
+func decodeMIDI(packet []byte) ([]byte, error) {
+	if (len(packet) < rtpHeader+1) || (packet[0]&0xC0 != rtpVersion) {
+		return nil, errors.New("Invalid RTP-MIDI packet")
+	}
+	p := rtpHeader + 4*int(packet[0]&0x0F) //CSRC list
+	if p >= len(packet) {
+		return nil, errors.New("Invalid RTP-MIDI packet: too short")
+	}
+	flags := packet[p]
+	length := int(flags & 0x0F)
+	p++
+	if flags&0x80 != 0 {
+		if p >= len(packet) {
+			return nil, errors.New("Invalid RTP-MIDI packet: too short")
+		}
+		length = length<<8 | int(packet[p])
+		p++
+	}
+	if p+length > len(packet) {
+		return nil, errors.New("Invalid RTP-MIDI packet: command section too long")
+	}
+	list := packet[p : p+length]
+	//Z flag: the first message has a delta time too
+	hasDelta := flags&0x20 != 0
+
+	var data []byte
+	var status byte
+	for i := 0; i < len(list); {
+		if hasDelta {
+			for n := 0; (i < len(list)) && (n < 4); n++ {
+				i++
+				if list[i-1]&0x80 == 0 {
+					break
+				}
+			}
+			if i >= len(list) {
+				break
+			}
+		}
+		hasDelta = true
+
+		b := list[i]
+		switch {
+		case (b == 0xF0) || (b == 0xF7):
+			//SysEx, possibly a segment: F0 ... F0 (first), F7 ... F0 (middle),
+			//F7 ... F7 (last), ... F4 (cancelled)
+			end := i + 1
+			for (end < len(list)) && (list[end] != 0xF0) && (list[end] != 0xF7) && (list[end] != 0xF4) {
+				end++
+			}
+			if end >= len(list) {
+				return data, errors.New("Invalid RTP-MIDI packet: unterminated SysEx")
+			}
+			if list[end] != 0xF4 {
+				if b == 0xF0 {
+					data = append(data, 0xF0)
+				}
+				data = append(data, list[i+1:end]...)
+				if list[end] == 0xF7 {
+					data = append(data, 0xF7)
+				}
+			}
+			status = 0
+			i = end + 1
+		case b >= 0xF8:
+			//Real-time, running status unchanged
+			data = append(data, b)
+			i++
+		case b >= 0x80:
+			n := messageLength(b)
+			if i+n > len(list) {
+				return data, errors.New("Invalid RTP-MIDI packet: truncated message")
+			}
+			data = append(data, list[i:i+n]...)
+			status = 0
+			if b < 0xF0 {
+				status = b
+			}
+			i += n
+		default:
+			if status == 0 {
+				return data, errors.New("Invalid RTP-MIDI packet: data byte without status")
+			}
+			n := messageLength(status) - 1
+			if i+n > len(list) {
+				return data, errors.New("Invalid RTP-MIDI packet: truncated message")
+			}
+			data = append(data, status)
+			data = append(data, list[i:i+n]...)
+			i += n
+		}
+	}
+	return data, nil
+}
+
+// Complete messages of data, SysEx included
+func splitMessages(data []byte) [][]byte {
+	var messages [][]byte
+	for i := 0; i < len(data); {
+		n := 1
+		if data[i] == 0xF0 {
+			for (i+n < len(data)) && (data[i+n-1] != 0xF7) {
+				n++
+			}
+		} else if data[i] >= 0x80 {
+			n = messageLength(data[i])
+		}
+		if i+n > len(data) {
+			n = len(data) - i
+		}
+		messages = append(messages, data[i:i+n])
+		i += n
+	}
+	return messages
+}
+
+// Length of the message starting with status, status byte included
+func messageLength(status byte) int {
+	switch {
+	case status < 0xC0, (status >= 0xE0) && (status < 0xF0):
+		return 3
+	case status < 0xE0:
+		return 2
+	case (status == 0xF1) || (status == 0xF3):
+		return 2
+	case status == 0xF2:
+		return 3
+	}
+	return 1
+}
@@ -0,0 +1,385 @@
+package rtpmidi
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AppleMIDI session commands, on the control port and the data port (control
+// port + 1): signature 0xFFFF, then the command
+const (
+	commandSignature = 0xFFFF
+	protocolVersion  = 2
+	inviteDelay      = time.Second
+	syncDelay        = 10 * time.Second
+)
+
+var (
+	commandInvite = [2]byte{'I', 'N'}
+	commandAccept = [2]byte{'O', 'K'}
+	commandReject = [2]byte{'N', 'O'}
+	commandBye    = [2]byte{'B', 'Y'}
+	commandSync   = [2]byte{'C', 'K'}
+)
+
+// RTP-MIDI (AppleMIDI) network session, as macOS "Network" MIDI, rtpMIDI on
+// Windows and network MIDI interfaces have them. Data sent goes to every
+// participant; receive is called with the MIDI bytes of every packet they
+// send.
+type Session struct {
+	name    string
+	ssrc    uint32
+	start   time.Time
+	control *net.UDPConn
+	data    *net.UDPConn
+	receive func(data []byte)
+	remote  *net.UDPAddr // Invited session (control port), nil when listening
+
+	mutex        sync.Mutex
+	participants map[uint32]*participant
+	sequence     uint16
+	greeting     [][]byte // Sent first to every new participant
+	closed       bool
+	done         chan struct{}
+}
+
+type participant struct {
+	name    string
+	control *net.UDPAddr
+	data    *net.UDPAddr
+}
+
+func newSession(name string, control *net.UDPConn, data *net.UDPConn, receive func(data []byte)) *Session {
+	return &Session{
+		name:         name,
+		ssrc:         rand.Uint32(),
+		start:        time.Now(),
+		control:      control,
+		data:         data,
+		receive:      receive,
+		participants: make(map[uint32]*participant),
+		done:         make(chan struct{}),
+	}
+}
+
+// Accept invitations on address (":port" or "host:port", the control port),
+// as the session named name
+func Listen(address string, name string, receive func(data []byte)) (*Session, error) {
+	controlAddress, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, errors.New("Failed to listen for RTP-MIDI sessions on " + address + ": " + err.Error())
+	}
+	dataAddress := *controlAddress
+	dataAddress.Port++
+
+	control, err := net.ListenUDP("udp", controlAddress)
+	if err != nil {
+		return nil, errors.New("Failed to listen for RTP-MIDI sessions on " + address + ": " + err.Error())
+	}
+	data, err := net.ListenUDP("udp", &dataAddress)
+	if err != nil {
+		control.Close()
+		return nil, errors.New("Failed to listen for RTP-MIDI sessions on " + address + ": " + err.Error())
+	}
+	s := newSession(name, control, data, receive)
+	go s.serve(control, false)
+	go s.serve(data, true)
+	return s, nil
+}
+
+// Invite the session listening on address ("host:port", the control port),
+// as the session named name. Invitations are sent until accepted, and again
+// when the invited session leaves.
+func Dial(address string, name string, receive func(data []byte)) (*Session, error) {
+	remote, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, errors.New("Failed to invite RTP-MIDI session " + address + ": " + err.Error())
+	}
+	control, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, errors.New("Failed to invite RTP-MIDI session " + address + ": " + err.Error())
+	}
+	data, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		control.Close()
+		return nil, errors.New("Failed to invite RTP-MIDI session " + address + ": " + err.Error())
+	}
+	s := newSession(name, control, data, receive)
+	s.remote = remote
+	go s.serve(control, false)
+	go s.serve(data, true)
+	go s.invite()
+	return s, nil
+}
+
+// Address of the control port
+func (s *Session) Addr() net.Addr {
+	return s.control.LocalAddr()
+}
+
+// Names of the sessions taking part
+func (s *Session) Participants() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	names := []string{}
+	for _, p := range s.participants {
+		if p.data != nil {
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
+
+// Data sent first to every participant joining
+func (s *Session) SetGreeting(messages [][]byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.greeting = messages
+}
+
+func (s *Session) Send(data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sent := false
+	for _, p := range s.participants {
+		if p.data == nil {
+			continue
+		}
+		if err := s.sendMIDI(p, data); err != nil {
+			return err
+		}
+		sent = true
+	}
+	if !sent {
+		return errors.New("Failed to send to RTP-MIDI session " + s.name + ": no participant")
+	}
+	return nil
+}
+
+// Called with the mutex held
+func (s *Session) sendMIDI(p *participant, data []byte) error {
+	s.sequence++
+	packet, err := encodeMIDI(data, s.sequence, s.timestamp(), s.ssrc)
+	if err != nil {
+		return err
+	}
+	if _, err := s.data.WriteToUDP(packet, p.data); err != nil {
+		return errors.New("Failed to send to RTP-MIDI participant " + p.name + ": " + err.Error())
+	}
+	return nil
+}
+
+// Leave the session, saying goodbye to the participants
+func (s *Session) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for _, p := range s.participants {
+		s.control.WriteToUDP(s.command(commandBye, 0), p.control)
+	}
+	s.participants = make(map[uint32]*participant)
+	s.mutex.Unlock()
+
+	err := s.control.Close()
+	if e := s.data.Close(); e != nil {
+		err = e
+	}
+	return err
+}
+
+// Session time, in units of 100µs
+func (s *Session) timestamp() uint32 {
+	return uint32(time.Since(s.start) / (100 * time.Microsecond))
+}
+
+func (s *Session) timestamp64() uint64 {
+	return uint64(time.Since(s.start) / (100 * time.Microsecond))
+}
+
+// Invitation, acceptance, rejection or goodbye
+func (s *Session) command(command [2]byte, token uint32) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, commandSignature)
+	buf = append(buf, command[:]...)
+	buf = binary.BigEndian.AppendUint32(buf, protocolVersion)
+	buf = binary.BigEndian.AppendUint32(buf, token)
+	buf = binary.BigEndian.AppendUint32(buf, s.ssrc)
+	if command != commandBye {
+		buf = append(buf, s.name...)
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+func (s *Session) syncCommand(count byte, timestamps [3]uint64) []byte {
+	buf := binary.BigEndian.AppendUint16(nil, commandSignature)
+	buf = append(buf, commandSync[:]...)
+	buf = binary.BigEndian.AppendUint32(buf, s.ssrc)
+	buf = append(buf, count, 0, 0, 0)
+	for _, t := range timestamps {
+		buf = binary.BigEndian.AppendUint64(buf, t)
+	}
+	return buf
+}
+
+// Invite the remote session until it accepts, then keep clocks in sync
+func (s *Session) invite() {
+	dataAddress := *s.remote
+	dataAddress.Port++
+	token := rand.Uint32()
+
+	for {
+		s.mutex.Lock()
+		joined := false
+		for _, p := range s.participants {
+			joined = joined || (p.data != nil)
+		}
+		s.mutex.Unlock()
+
+		if joined {
+			s.data.WriteToUDP(s.syncCommand(0, [3]uint64{s.timestamp64()}), &dataAddress)
+		} else {
+			//The data port is invited once the control port accepted
+			s.control.WriteToUDP(s.command(commandInvite, token), s.remote)
+		}
+
+		delay := inviteDelay
+		if joined {
+			delay = syncDelay
+		}
+		select {
+		case <-s.done:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (s *Session) serve(conn *net.UDPConn, isData bool) {
+	buf := make([]byte, 1500)
+	for {
+		n, address, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		packet := buf[:n]
+		if (n >= 4) && (binary.BigEndian.Uint16(packet) == commandSignature) {
+			s.handleCommand(conn, isData, packet, address)
+			continue
+		}
+		if !isData {
+			continue
+		}
+		//Malformed packets are dropped, keeping what could be decoded
+		data, _ := decodeMIDI(packet)
+		if len(data) > 0 {
+			s.receive(data)
+		}
+	}
+}
+
+func (s *Session) handleCommand(conn *net.UDPConn, isData bool, packet []byte, address *net.UDPAddr) {
+	command := [2]byte{packet[2], packet[3]}
+	switch command {
+	case commandInvite, commandAccept, commandReject, commandBye:
+		if len(packet) < 16 {
+			return
+		}
+	case commandSync:
+		if len(packet) < 36 {
+			return
+		}
+		s.handleSync(conn, packet, address)
+		return
+	default:
+		//Receiver feedback (journal), and unknown commands
+		return
+	}
+	token := binary.BigEndian.Uint32(packet[8:])
+	ssrc := binary.BigEndian.Uint32(packet[12:])
+	name := strconv.Itoa(int(ssrc))
+	if len(packet) > 16 {
+		name = string(packet[16:])
+		for i := range name {
+			if name[i] == 0 {
+				name = name[:i]
+				break
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+
+	switch command {
+	case commandInvite:
+		conn.WriteToUDP(s.command(commandAccept, token), address)
+		s.join(ssrc, name, isData, address)
+	case commandAccept:
+		if (s.remote == nil) || !address.IP.Equal(s.remote.IP) {
+			return
+		}
+		if !isData {
+			dataAddress := *address
+			dataAddress.Port++
+			s.data.WriteToUDP(s.command(commandInvite, token), &dataAddress)
+		}
+		s.join(ssrc, name, isData, address)
+	case commandBye:
+		delete(s.participants, ssrc)
+	}
+}
+
+// Called with the mutex held. Participants take part once their data port
+// joined too.
+func (s *Session) join(ssrc uint32, name string, isData bool, address *net.UDPAddr) {
+	p, found := s.participants[ssrc]
+	if !found {
+		p = &participant{name: name}
+		s.participants[ssrc] = p
+	}
+	if !isData {
+		p.control = address
+		return
+	}
+	if p.control == nil {
+		control := *address
+		control.Port--
+		p.control = &control
+	}
+	newParticipant := p.data == nil
+	p.data = address
+	if newParticipant {
+		for _, data := range s.greeting {
+			s.sendMIDI(p, data)
+		}
+	}
+}
+
+// Clock synchronization: answer CK0 with CK1, CK1 with CK2
+func (s *Session) handleSync(conn *net.UDPConn, packet []byte, address *net.UDPAddr) {
+	count := packet[8]
+	var timestamps [3]uint64
+	for i := range timestamps {
+		timestamps[i] = binary.BigEndian.Uint64(packet[12+8*i:])
+	}
+	if count > 1 {
+		return
+	}
+	timestamps[count+1] = s.timestamp64()
+	conn.WriteToUDP(s.syncCommand(count+1, timestamps), address)
+}
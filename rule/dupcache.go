@@ -0,0 +1,75 @@
+package rule
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/midi"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	dupCacheChannels = 16
+	dupCacheKeys     = 128
+
+	//Note Off, Note On, Poly Aftertouch and Control Change are keyed on data1
+	dupCacheKeyedSlots = 4 * dupCacheChannels * dupCacheKeys
+	//Program Change, Channel Aftertouch, Pitch Wheel and system messages are not
+	dupCacheSlots = dupCacheKeyedSlots + 4*dupCacheChannels
+)
+
+// Last transformed values, keyed by (status, data1) of the filtered message, so
+// that a rule matching several notes, controllers or message types suppresses
+// each of them independently, with its own timeout.
+// The key space is bounded, so slots are preallocated and updated with atomic
+// compare-and-swap: concurrent matches never lock, and stale entries are evicted
+// simply by being overwritten once their timeout has elapsed.
+//
+// A slot packs (microseconds since epoch + 1) << 16 | value, 0 meaning empty.
+type dupCache struct {
+	clock clock.Clock
+	epoch time.Time
+	slots [dupCacheSlots]atomic.Uint64
+}
+
+func newDupCache(c clock.Clock) *dupCache {
+	return &dupCache{clock: c, epoch: c.Now()}
+}
+
+// Returns the cache slot index of a filtered packet
+func dupCacheKey(packet midi.Packet) int {
+	status := int(packet.Data[0])
+	channel := status & 0x0F
+
+	switch status & 0xF0 {
+	case 0x80, 0x90, 0xA0, 0xB0:
+		key := 0
+		if len(packet.Data) > 1 {
+			key = int(packet.Data[1] & 0x7F)
+		}
+		msgType := (status >> 4) - 0x8
+		return (msgType*dupCacheChannels+channel)*dupCacheKeys + key
+	}
+	msgType := (status >> 4) - 0xC
+	return dupCacheKeyedSlots + msgType*dupCacheChannels + channel
+}
+
+// Reports whether value was already seen for key less than timeout ago.
+// Otherwise, value is recorded as the last one for key.
+func (c *dupCache) checkAndStore(key int, value uint16, timeout time.Duration) bool {
+	slot := &c.slots[key]
+	now := uint64(clock.Since(c.clock, c.epoch).Microseconds()) + 1
+
+	for {
+		old := slot.Load()
+		if old != 0 {
+			lastValue := uint16(old & 0xFFFF)
+			lastTs := old >> 16
+			if (lastValue == value) && (time.Duration(now-lastTs)*time.Microsecond < timeout) {
+				return true
+			}
+		}
+		if slot.CompareAndSwap(old, now<<16|uint64(value)) {
+			return false
+		}
+	}
+}
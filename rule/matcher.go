@@ -0,0 +1,32 @@
+package rule
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/filterinterface"
+)
+
+// Set of status bytes accepted by a rule filter, compiled once when the filter
+// is set so that quick matching is a single bit test instead of decoding the
+// message type and channel behind an interface call.
+type statusMask [4]uint64
+
+func compileStatusMask(f filterinterface.FilterInterface) statusMask {
+	var mask statusMask
+
+	for status := 0; status < 256; status++ {
+		msgType := filter.FilterMsgType(status >> 4)
+		channel := filter.FilterChannel(status & 0x0F)
+		if f.QuickMatch(msgType, channel) {
+			mask[status>>6] |= 1 << (uint(status) & 63)
+		}
+	}
+	return mask
+}
+
+func (m *statusMask) accepts(status byte) bool {
+	return m[status>>6]&(1<<(status&63)) != 0
+}
+
+func (m *statusMask) add(status byte) {
+	m[status>>6] |= 1 << (status & 63)
+}
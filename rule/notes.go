@@ -0,0 +1,55 @@
+package rule
+
+import (
+	"MIDIRouter/midi"
+	"sync"
+)
+
+// Notes currently sounding on the destination because of a rule, by channel
+type noteSet struct {
+	mutex sync.Mutex
+	notes [16][2]uint64
+}
+
+// Update the set from generated messages: Note On adds, Note Off (or Note
+// On with velocity 0) removes.
+func (s *noteSet) track(packets []midi.Packet) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, p := range packets {
+		for i := 0; i+2 < len(p.Data); i++ {
+			status := p.Data[i] & 0xF0
+			if ((status != 0x80) && (status != 0x90)) || (p.Data[i+1] > 0x7F) {
+				continue
+			}
+			channel := p.Data[i] & 0x0F
+			note := p.Data[i+1]
+			bit := uint64(1) << (note & 63)
+			if (status == 0x90) && (p.Data[i+2] != 0) {
+				s.notes[channel][note>>6] |= bit
+			} else {
+				s.notes[channel][note>>6] &^= bit
+			}
+			i += 2
+		}
+	}
+}
+
+// Returns Note Off messages for all sounding notes, and empties the set
+func (s *noteSet) flush(timeStamp uint64) []midi.Packet {
+	var packets []midi.Packet
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for channel := 0; channel < 16; channel++ {
+		for note := 0; note < 128; note++ {
+			if s.notes[channel][note>>6]&(1<<(note&63)) != 0 {
+				packets = append(packets, midi.NewPacket([]byte{0x80 | byte(channel), byte(note), 0x40}, timeStamp))
+			}
+		}
+		s.notes[channel] = [2]uint64{}
+	}
+	return packets
+}
@@ -0,0 +1,44 @@
+package rule
+
+import (
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/midi"
+	"time"
+)
+
+// Delay from now to the next grid line of a note value (fraction of a whole
+// note), false when there is no grid to follow (clock stopped)
+type GridFunc func(note float64) (time.Duration, bool)
+
+// Delays generated Note On messages to the next grid line
+type quantizer struct {
+	note float64
+	grid GridFunc
+}
+
+// Delay generated Note On messages to the next note value of the clock grid
+// (0.0625 for 1/16)
+func (r *Rule) SetQuantize(note float64, grid GridFunc) {
+	if note <= 0 {
+		r.quantize = nil
+		return
+	}
+	r.quantize = &quantizer{note: note, grid: grid}
+}
+
+// Split packets into the ones sent now and the ones moved to the grid
+func (q *quantizer) apply(packets []midi.Packet) (now []midi.Packet, delayed []generatorinterface.TimedPacket) {
+	delay, ok := q.grid(q.note)
+	if !ok || (delay <= 0) {
+		return packets, nil
+	}
+
+	for _, p := range packets {
+		if (len(p.Data) == 3) && (p.Data[0]&0xF0 == 0x90) && (p.Data[2] != 0) {
+			delayed = append(delayed, generatorinterface.TimedPacket{Packet: p, Delay: delay})
+		} else {
+			now = append(now, p)
+		}
+	}
+	return now, delayed
+}
@@ -1,15 +1,25 @@
 package rule
 
 import (
-	"MIDIRouter/filter"
+	"MIDIRouter/actioninterface"
+	"MIDIRouter/clock"
 	"MIDIRouter/filterinterface"
 	"MIDIRouter/generatorinterface"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"MIDIRouter/osc"
+	"MIDIRouter/scriptinterface"
+	"MIDIRouter/transforminterface"
+	"MIDIRouter/transformlinear"
+	"MIDIRouter/transformtoggle"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
+	"strings"
+	"sync/atomic"
 	"time"
-
-	"github.com/youpy/go-coremidi"
 )
 
 type RuleMatchResult int
@@ -23,81 +33,188 @@ const (
 type TransformMode uint8
 
 const (
-	TransformModeNone             = iota
-	TransformModeLinear           = iota
-	TransformModeLinearDrop       = iota
-	TransformModeNoise            = iota
-	TransformModePreventRunStatus = iota // New mode to prevent MIDI running status
+	TransformModeNone       = iota
+	TransformModeLinear     = iota
+	TransformModeLinearDrop = iota
+	TransformModeCustom     = iota // Value computed by a TransformInterface, see SetTransformer
+	TransformModeToggle     = iota // Alternates between toMin and toMax per note or controller
 )
 
-// Define a new NoiseSettings struct
-type NoiseSettings struct {
-	MsgType    filter.FilterMsgType // MIDI message type for noise
-	Channel    filter.FilterChannel // MIDI channel for noise
-	MinValue   uint8                // Minimum noise value
-	MaxValue   uint8                // Maximum noise value
-	DelayMsMin uint16               // Minimum delay in milliseconds
-	DelayMsMax uint16               // Maximum delay in milliseconds
-}
+// Tempo used for delays in musical units when the rule has no tempo source
+const DefaultTempo = 120.0
 
 type Transform struct {
-	mode          TransformMode
-	fromMin       uint32
-	fromMax       uint32
-	toMin         uint32
-	toMax         uint32
-	noiseSettings NoiseSettings // Field for noise settings
+	mode        TransformMode
+	transformer transforminterface.TransformInterface // nil in None mode
 }
 
 // Define a new struct to represent the match result
 type MatchResult struct {
 	Result       RuleMatchResult
-	MainPacket   coremidi.Packet
-	NoisePacket  *coremidi.Packet // Pointer so it can be nil if no noise
-	NoiseDelayMs time.Duration    // Delay in ms for noise packet
+	MainPacket   midi.Packet
+	ExtraPackets []midi.Packet                    // Additional generated messages, sent along with MainPacket
+	NoMerge      bool                             // Packets must be sent on their own, not merged with others
+	Delayed      []generatorinterface.TimedPacket // Generated messages to send later
+	Rule         string                           // Name of the matching rule
+	Value        uint16                           // Value extracted by the filter
+	Transformed  uint16                           // Value after transformation
+	SendLimit    *time.Duration                   // Send limit of the rule, nil for the router one
+	Noise        []generatorinterface.TimedPacket // Messages sent by the transform (noise), delays from the match
+	Destination  string                           // Destination of the packets, "" for all of them
+	OSC          *osc.Route                       // OSC translation of the packets, nil for the default one
 }
 
 type Rule struct {
 	name                  string
 	filter                filterinterface.FilterInterface
+	statuses              statusMask
 	transform             Transform
 	dropDuplicates        bool
 	dropDuplicatesTimeout time.Duration
 
 	generator generatorinterface.GeneratorInterface
-
-	lastValue    uint16
-	lastValueTs  time.Time
-	lastMsgType  filter.FilterMsgType // Track last message type for RunStatus prevention
-	lastChannel  filter.FilterChannel // Track last channel for RunStatus prevention
-	lastMsgCount uint32               // Count messages for RunStatus prevention
+	condition Condition
+	script    scriptinterface.ScriptInterface
+
+	lastValues *dupCache
+	clock      clock.Clock
+
+	rng          *rand.Rand     // Per rule random source (transforms), seedable for reproducible runs
+	keepOriginal bool           // Filtered message sent before the generated ones
+	tempo        func() float64 // Current tempo in BPM, for delays in musical units
+	quantize     *quantizer     // Note On messages moved to the clock grid, nil if disabled
+	split        *velocitySplit // Alternate generator for hard Note On, nil if disabled
+	variable     string         // Router variable set to the transformed value
+	setVariable  func(name string, value int)
+	action       actioninterface.ActionInterface // Run on every match, nil if none
+	sendLimit    *time.Duration                  // Override of the router send limit, nil if none
+	tags         []string                        // Labels for troubleshooting ("song:intro", "device:organ")
+	destination  string                          // Router destination of the generated packets, "" for all
+	osc          *osc.Route                      // OSC translation of the generated messages, nil for the default one
+
+	disabled    atomic.Bool
+	matches     atomic.Uint64 // Messages matched, see CountMatch
+	activeNotes noteSet       // Notes sent by this rule and not released yet
 }
 
 func New(ruleName string) (*Rule, error) {
 	var r Rule
 
 	r.name = ruleName
-	r.lastValue = 0xFFFF
+	r.clock = clock.Wall
+	r.lastValues = newDupCache(r.clock)
 	r.transform.mode = TransformModeNone
-	r.lastMsgType = filter.FilterMsgTypeUnknown
-	r.lastChannel = filter.FilterChannelAny
-	r.lastMsgCount = 0
+	r.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
 	return &r, nil
 }
 
+// Expression checked once the filter matched, see the condition package
+type Condition interface {
+	Eval(data []byte, value uint16) (bool, error)
+	String() string
+}
+
+// Only match messages for which the condition holds
+func (r *Rule) SetCondition(condition Condition) {
+	r.condition = condition
+}
+
+// Set user logic run after the filter matched and after the transformation
+func (r *Rule) SetScript(script scriptinterface.ScriptInterface) {
+	r.script = script
+}
+
+// Drop the output of the rule when sent less than limit after the previous
+// message, instead of the router send limit. 0 never drops.
+func (r *Rule) SetSendLimit(limit time.Duration) {
+	r.sendLimit = &limit
+}
+
+// Send the filtered message, unchanged, before the generated messages
+func (r *Rule) SetKeepOriginal(keep bool) {
+	r.keepOriginal = keep
+}
+
+// Store the transformed value of every match in a router variable
+func (r *Rule) SetVariable(name string, set func(name string, value int)) {
+	r.variable = name
+	r.setVariable = set
+}
+
+// Run an action on every match, along with the generated messages
+func (r *Rule) SetAction(action actioninterface.ActionInterface) {
+	r.action = action
+}
+
+// Release what the filter, generators, script and action of the rule hold
+// (child processes, plugins, background workers). The rule must no longer be
+// used.
+func (r *Rule) Close() {
+	parts := []interface{}{r.filter, r.generator, r.script, r.action}
+	if r.split != nil {
+		parts = append(parts, r.split.generator)
+	}
+	for _, part := range parts {
+		if closer, ok := part.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+// Set the source of the current tempo (BPM), for delays in musical units
+func (r *Rule) SetTempo(tempo func() float64) {
+	r.tempo = tempo
+	r.bindTransformer()
+}
+
+// Reseed the rule random source, so noise patterns and humanized notes can
+// be reproduced
+func (r *Rule) SetSeed(seed int64) {
+	r.rng = rand.New(rand.NewSource(seed))
+	r.bindTransformer()
+	r.bindGenerators()
+}
+
 func (r *Rule) SetTransform(mode TransformMode, fromMin uint32, fromMax uint32, toMin uint32, toMax uint32) {
-	r.transform = Transform{
-		mode:    mode,
-		fromMin: fromMin,
-		fromMax: fromMax,
-		toMin:   toMin,
-		toMax:   toMax,
+	r.transform = Transform{mode: mode}
+
+	switch mode {
+	case TransformModeLinear:
+		r.transform.transformer = transformlinear.New(fromMin, fromMax, toMin, toMax, false)
+	case TransformModeLinearDrop:
+		r.transform.transformer = transformlinear.New(fromMin, fromMax, toMin, toMax, true)
+	case TransformModeToggle:
+		r.transform.transformer = transformtoggle.New(toMin, toMax)
 	}
 }
 
-// Method to set noise settings
-func (r *Rule) SetNoiseSettings(noiseSettings NoiseSettings) {
-	r.transform.noiseSettings = noiseSettings
+// Use a transform implemented outside of the rule package
+func (r *Rule) SetTransformer(t transforminterface.TransformInterface) {
+	r.transform = Transform{mode: TransformModeCustom, transformer: t}
+	r.bindTransformer()
+}
+
+// Share the random source and tempo of the rule with its transform
+func (r *Rule) bindTransformer() {
+	if t, ok := r.transform.transformer.(transforminterface.RandomTransformInterface); ok {
+		t.SetRand(r.rng)
+	}
+	if t, ok := r.transform.transformer.(transforminterface.TempoTransformInterface); ok && (r.tempo != nil) {
+		t.SetTempo(r.tempo)
+	}
+}
+
+// Share the random source of the rule with its generators
+func (r *Rule) bindGenerators() {
+	generators := []generatorinterface.GeneratorInterface{r.generator}
+	if r.split != nil {
+		generators = append(generators, r.split.generator)
+	}
+	for _, g := range generators {
+		if rg, ok := g.(generatorinterface.RandomGeneratorInterface); ok {
+			rg.SetRand(r.rng)
+		}
+	}
 }
 
 func (r *Rule) SetFilter(f filterinterface.FilterInterface) error {
@@ -105,9 +222,156 @@ func (r *Rule) SetFilter(f filterinterface.FilterInterface) error {
 		return errors.New("Filter already set")
 	}
 	r.filter = f
+	r.statuses = compileStatusMask(f)
+	return nil
+}
+
+func (r *Rule) Name() string {
+	return r.name
+}
+
+// Enable or disable the rule. When disabled, Note Off messages are returned
+// for notes the rule started and did not release yet, so that none get stuck.
+func (r *Rule) SetEnabled(enabled bool) []midi.Packet {
+	r.disabled.Store(!enabled)
+	if enabled {
+		return nil
+	}
+	return r.activeNotes.flush(0)
+}
+
+func (r *Rule) Enabled() bool {
+	return !r.disabled.Load()
+}
+
+// Time source of DropDuplicates, and of the filter and generators timing
+// messages on their own, clock.Wall by default. Duplicates seen before are
+// forgotten.
+func (r *Rule) SetClock(c clock.Clock) {
+	r.clock = c
+	r.lastValues = newDupCache(c)
+
+	if f, ok := r.filter.(filterinterface.ClockFilterInterface); ok {
+		f.SetClock(c)
+	}
+	generators := []generatorinterface.GeneratorInterface{r.generator}
+	if r.split != nil {
+		generators = append(generators, r.split.generator)
+	}
+	for _, g := range generators {
+		if cg, ok := g.(generatorinterface.ClockGeneratorInterface); ok {
+			cg.SetClock(c)
+		}
+	}
+}
+
+// Send function of the packets the generators schedule on their own (see
+// generatorinterface.OutputGeneratorInterface)
+func (r *Rule) SetOutput(send func(packet midi.Packet)) {
+	generators := []generatorinterface.GeneratorInterface{r.generator}
+	if r.split != nil {
+		generators = append(generators, r.split.generator)
+	}
+	for _, g := range generators {
+		if o, ok := g.(generatorinterface.OutputGeneratorInterface); ok {
+			o.SetOutput(send)
+		}
+	}
+}
+
+// Send the generated packets to the router destination named name only
+func (r *Rule) SetDestination(name string) {
+	r.destination = name
+}
+
+func (r *Rule) Destination() string {
+	return r.destination
+}
+
+// Translate the generated messages to OSC with route, when the router
+// destination is an OSC server
+func (r *Rule) SetOSC(route *osc.Route) {
+	r.osc = route
+}
+
+func (r *Rule) OSC() *osc.Route {
+	return r.osc
+}
+
+func (r *Rule) SetTags(tags []string) {
+	r.tags = tags
+}
+
+func (r *Rule) Tags() []string {
+	return r.tags
+}
+
+func (r *Rule) HasTag(tag string) bool {
+	for _, t := range r.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Count a message matched by the rule, once the router routed it there
+func (r *Rule) CountMatch() {
+	r.matches.Add(1)
+}
+
+// Messages matched since the rule was created
+func (r *Rule) Matches() uint64 {
+	return r.matches.Load()
+}
+
+// Carry over the state of the rule it replaces on a configuration reload:
+// notes started, transform state and match count. Note Off messages are
+// returned for the notes taken over when the rule is disabled.
+func (r *Rule) TakeOver(old *Rule) []midi.Packet {
+	old.activeNotes.mutex.Lock()
+	notes := old.activeNotes.notes
+	old.activeNotes.mutex.Unlock()
+	r.activeNotes.mutex.Lock()
+	r.activeNotes.notes = notes
+	r.activeNotes.mutex.Unlock()
+
+	//A transform changed meanwhile may not accept the state, and starts afresh
+	if state := old.SaveState(); state != nil {
+		r.RestoreState(state)
+	}
+	r.matches.Store(old.matches.Load())
+	if !r.Enabled() {
+		return r.activeNotes.flush(0)
+	}
 	return nil
 }
 
+// Returns Note Off messages for notes the rule started and did not release yet
+func (r *Rule) FlushNotes() []midi.Packet {
+	return r.activeNotes.flush(0)
+}
+
+// State of the transform (e.g. toggles), nil if it keeps none
+func (r *Rule) SaveState() json.RawMessage {
+	if t, ok := r.transform.transformer.(transforminterface.StatefulTransformInterface); ok {
+		return t.SaveState()
+	}
+	return nil
+}
+
+func (r *Rule) RestoreState(state json.RawMessage) error {
+	if t, ok := r.transform.transformer.(transforminterface.StatefulTransformInterface); ok {
+		return t.RestoreState(state)
+	}
+	return nil
+}
+
+// Reports whether the rule filter may match messages with this status byte
+func (r *Rule) QuickMatch(status byte) bool {
+	return r.statuses.accepts(status)
+}
+
 func (r *Rule) EnableDropDuplicates(enable bool, timeout time.Duration) {
 	r.dropDuplicates = enable
 	r.dropDuplicatesTimeout = timeout
@@ -118,207 +382,254 @@ func (r *Rule) SetGenerator(g generatorinterface.GeneratorInterface) error {
 		return errors.New("Generator already set")
 	}
 	r.generator = g
+	r.bindGenerators()
 	return nil
 }
 
-// Function to generate a noise packet
-func (r *Rule) generateNoisePacket(packet coremidi.Packet, value uint16) coremidi.Packet {
-	// Get random values for noise
-	ns := r.transform.noiseSettings
-
-	// Generate random value between MinValue and MaxValue
-	randVal := ns.MinValue
-	if ns.MaxValue > ns.MinValue {
-		randVal = ns.MinValue + uint8(rand.Intn(int(ns.MaxValue-ns.MinValue+1)))
+// Check the rule is consistent once filter, transform and generator are set
+func (r *Rule) Validate() error {
+	if r.filter == nil {
+		return errors.New("Rule '" + r.name + "' has no filter")
 	}
-
-	// Create status byte based on message type and channel
-	msgType := byte(ns.MsgType)
-	channel := byte(ns.Channel)
-	statusByte := byte((msgType << 4) | channel)
-
-	// Create MIDI message based on message type
-	var data []byte
-	switch ns.MsgType {
-	case filter.FilterMsgTypeNoteOn, filter.FilterMsgTypeNoteOff, filter.FilterMsgTypeAftertouch,
-		filter.FilterMsgTypeControlChange, filter.FilterMsgTypePitchWheel:
-		// Two data bytes (e.g., note/control number and velocity/value)
-		data = []byte{statusByte, byte(value & 0x7F), randVal}
-	case filter.FilterMsgTypeProgramChange, filter.FilterMsgTypeChannelPressure:
-		// One data byte (e.g., program number or pressure value)
-		data = []byte{statusByte, randVal}
-	default:
-		// Default to a simple message with just the random value
-		data = []byte{statusByte, randVal}
+	if r.generator == nil {
+		return errors.New("Rule '" + r.name + "' has no generator")
 	}
 
-	return coremidi.NewPacket(data, packet.TimeStamp)
+	//Transformed values must fit into the generated message (7 or 14 bits)
+	if t, ok := r.transform.transformer.(transforminterface.RangeTransformInterface); ok {
+		min, max := t.OutputRange()
+		generatorMax := uint32(r.generator.MaxValue())
+		if (min > generatorMax) || (max > generatorMax) {
+			return fmt.Errorf("Rule '%s': transform range [%d, %d] exceeds generator value range [0, %d]",
+				r.name, min, max, generatorMax)
+		}
+	}
+	return nil
 }
 
 // Updated Match method that returns MatchResult
-func (r *Rule) Match(packet coremidi.Packet, verbose bool) MatchResult {
-	msgType := filter.FilterMsgType((packet.Data[0] & 0xF0) >> 4)
-	channel := filter.FilterChannel(packet.Data[0] & 0x0F)
-
-	if r.filter.QuickMatch(msgType, channel) == false {
+func (r *Rule) Match(packet midi.Packet, log *logger.Logger) MatchResult {
+	if (len(packet.Data) == 0) || (r.statuses.accepts(packet.Data[0]) == false) || r.disabled.Load() {
 		return MatchResult{Result: RuleMatchResultNoMatch, MainPacket: packet}
 	}
 
+	if res, ok := r.splitRelease(packet); ok {
+		return res
+	}
+
 	result, value := r.filter.Match(packet)
 	if result == filterinterface.FilterMatchResult_NoMatch {
 		return MatchResult{Result: RuleMatchResultNoMatch, MainPacket: packet}
 	}
 
 	if result == filterinterface.FilterMatchResult_MatchNoValue {
-		if verbose {
-			fmt.Println("Filter match (no value)")
-		}
-		return MatchResult{Result: RuleMatchResultMatchNoInject, MainPacket: packet}
+		log.Debug("Filter match (no value)")
+		return MatchResult{Result: RuleMatchResultMatchNoInject, MainPacket: packet, Rule: r.name}
 	}
 
 	if result != filterinterface.FilterMatchResult_Match {
 		return MatchResult{Result: RuleMatchResultNoMatch, MainPacket: packet}
 	}
 
-	if verbose {
-		fmt.Println("Filter", r.String(), "matched. Extracted value:", value)
-		fmt.Println("-> Extracted value:", value)
+	if r.condition != nil {
+		ok, err := r.condition.Eval(packet.Data, value)
+		if err != nil {
+			log.Error("Rule '"+r.name+"':", err)
+		}
+		if !ok {
+			return MatchResult{Result: RuleMatchResultNoMatch, MainPacket: packet}
+		}
 	}
 
-	// Transform the value based on transform mode
-	transformedValue := value
-	var noisePacket *coremidi.Packet
-	var noiseDelayMs time.Duration
-
-	switch r.transform.mode {
-	case TransformModeLinear:
-		// Linear transformation logic
-		a := float64(r.transform.toMax-r.transform.toMin) / float64(r.transform.fromMax-r.transform.fromMin)
-		b := float64(r.transform.toMin) - a*float64(r.transform.fromMin)
-		transformedValue = uint16(a*float64(value) + float64(b))
-
-	case TransformModeLinearDrop:
-		// Check bounds and apply linear transformation
-		if (uint32(value) > r.transform.fromMax) || (uint32(value) < r.transform.fromMin) {
-			fmt.Println("-> Transform dropped out of bounds input value")
+	if r.script != nil {
+		ok, v, err := r.script.Match(packet.Data, value)
+		if err != nil {
+			log.Error("Rule '"+r.name+"':", err)
+		}
+		if !ok {
 			return MatchResult{Result: RuleMatchResultNoMatch, MainPacket: packet}
 		}
-		a := float64(r.transform.toMax-r.transform.toMin) / float64(r.transform.fromMax-r.transform.fromMin)
-		b := float64(r.transform.toMin) - a*float64(r.transform.fromMin)
-		v := uint16(a*float64(value) + float64(b))
-		if (uint32(v) > r.transform.toMax) || (uint32(v) < r.transform.toMin) {
-			fmt.Println("-> Transform dropped out of bounds output value")
+		value = v
+	}
+
+	if log.Enabled(logger.LevelDebug) {
+		log.Debug("Filter", r.String(), "matched. Extracted value:", value)
+		log.Debug("-> Extracted value:", value)
+	}
+
+	// Transform the value
+	transformedValue := value
+	var noise []generatorinterface.TimedPacket
+
+	if r.transform.transformer != nil {
+		result, v := r.transform.transformer.Transform(packet, value)
+		switch result {
+		case transforminterface.TransformResult_NoMatch:
+			log.DebugDim("-> Transform rejected value")
 			return MatchResult{Result: RuleMatchResultNoMatch, MainPacket: packet}
+		case transforminterface.TransformResult_Drop:
+			log.DebugDim("-> Transform dropped value")
+			return MatchResult{Result: RuleMatchResultMatchNoInject, MainPacket: packet, Rule: r.name, Value: value}
 		}
 		transformedValue = v
 
-	case TransformModeNoise:
-		// Apply normal linear transformation first
-		a := float64(r.transform.toMax-r.transform.toMin) / float64(r.transform.fromMax-r.transform.fromMin)
-		b := float64(r.transform.toMin) - a*float64(r.transform.fromMin)
-		transformedValue = uint16(a*float64(value) + float64(b))
+		if t, ok := r.transform.transformer.(transforminterface.EmitterTransformInterface); ok {
+			log.Debug("-> Generating noise packet")
+			noise = t.Emit(packet, value)
+		}
+	}
 
-		// Generate noise packet
-		if verbose {
-			fmt.Println("-> Generating noise packet")
+	if r.script != nil {
+		ok, v, err := r.script.Transform(packet.Data, transformedValue)
+		if err != nil {
+			log.Error("Rule '"+r.name+"':", err)
 		}
-		np := r.generateNoisePacket(packet, value)
-		noisePacket = &np
-
-		// Calculate delay for noise packet
-		ns := r.transform.noiseSettings
-		delayValue := ns.DelayMsMin
-		if ns.DelayMsMax > ns.DelayMsMin {
-			delayValue = ns.DelayMsMin + uint16(rand.Intn(int(ns.DelayMsMax-ns.DelayMsMin+1)))
+		if !ok {
+			log.DebugDim("-> Script dropped value")
+			return MatchResult{Result: RuleMatchResultMatchNoInject, MainPacket: packet, Rule: r.name, Value: value}
 		}
-		noiseDelayMs = time.Duration(delayValue) * time.Millisecond
+		transformedValue = v
 	}
 
-	if verbose {
-		fmt.Println("-> Transformed value:", transformedValue)
+	if log.Enabled(logger.LevelDebug) {
+		log.Debug("-> Transformed value:", transformedValue)
 	}
 
 	// Apply duplicate check
-	if r.dropDuplicates && (r.lastValue == transformedValue) && (time.Since(r.lastValueTs) < r.dropDuplicatesTimeout) {
-		fmt.Println("-> Ignored duplicate")
-		return MatchResult{Result: RuleMatchResultMatchNoInject, MainPacket: packet}
+	if r.dropDuplicates && r.lastValues.checkAndStore(dupCacheKey(packet), transformedValue, r.dropDuplicatesTimeout) {
+		log.DebugDim("-> Ignored duplicate")
+		return MatchResult{Result: RuleMatchResultMatchNoInject, MainPacket: packet, Rule: r.name,
+			Value: value, Transformed: transformedValue}
+	}
+
+	if r.setVariable != nil {
+		r.setVariable(r.variable, int(transformedValue))
+	}
+	if r.action != nil {
+		if err := r.action.Run(transformedValue); err != nil {
+			log.Error("Rule '"+r.name+"':", err)
+		}
 	}
-	r.lastValue = transformedValue
-	r.lastValueTs = time.Now()
 
 	// Generate output
-	newPacket, err := r.output(packet, transformedValue)
+	packets, delayed, err := r.output(packet, transformedValue)
+	if r.keepOriginal && ((err == nil) || errors.Is(err, generatorinterface.ErrNoOutput)) {
+		packets = append([]midi.Packet{packet}, packets...)
+		err = nil
+	}
+	if errors.Is(err, generatorinterface.ErrNoOutput) || ((err == nil) && (len(packets) == 0)) {
+		log.Debug("-> Generator produced no immediate message")
+		return MatchResult{Result: RuleMatchResultMatchNoInject, MainPacket: packet, Rule: r.name,
+			Value: value, Transformed: transformedValue, Delayed: delayed}
+	}
 	if err != nil {
-		fmt.Println(err)
-		return MatchResult{Result: RuleMatchResultMatchInject, MainPacket: packet}
+		log.Error(err)
+		return MatchResult{Result: RuleMatchResultMatchInject, MainPacket: packet, Rule: r.name}
 	}
+	r.activeNotes.track(packets)
 
-	// Apply PreventRunningStatus mode if enabled
-	if r.transform.mode == TransformModePreventRunStatus {
-		newPacket = r.preventRunningStatus(newPacket, msgType, channel)
+	// Rewrite the generated packets (PreventRunningStatus), sent on their own
+	noMerge := false
+	if t, ok := r.transform.transformer.(transforminterface.OutputTransformInterface); ok {
+		packets = t.Output(packets)
+		noMerge = true
+	}
+
+	if r.quantize != nil {
+		var later []generatorinterface.TimedPacket
+		packets, later = r.quantize.apply(packets)
+		delayed = append(delayed, later...)
+		if len(packets) == 0 {
+			log.Debug("-> Generated messages quantized")
+			return MatchResult{Result: RuleMatchResultMatchNoInject, MainPacket: packet, Rule: r.name,
+				Value: value, Transformed: transformedValue, Delayed: delayed}
+		}
 	}
 
 	return MatchResult{
 		Result:       RuleMatchResultMatchInject,
-		MainPacket:   newPacket,
-		NoisePacket:  noisePacket,
-		NoiseDelayMs: noiseDelayMs,
+		MainPacket:   packets[0],
+		ExtraPackets: packets[1:],
+		Noise:        noise,
+		NoMerge:      noMerge,
+		Delayed:      delayed,
+		Rule:         r.name,
+		Value:        value,
+		Transformed:  transformedValue,
+		SendLimit:    r.sendLimit,
 	}
 }
 
-// Method to prevent running status
-func (r *Rule) preventRunningStatus(packet coremidi.Packet, msgType filter.FilterMsgType, channel filter.FilterChannel) coremidi.Packet {
-	// Always force the full status byte to be included in each message
-	// This prevents MIDI running status optimization where status byte is omitted
-	// for consecutive messages of the same type/channel
-
-	// No modification needed - the MIDIRouter already creates a new packet with
-	// full status byte for each message. The core issue with running status happens
-	// when devices try to optimize by not sending status bytes.
-
-	// We're just tracking the message sequence for logging/debugging
-	r.lastMsgCount++
-	r.lastMsgType = msgType
-	r.lastChannel = channel
+func (r *Rule) output(packet midi.Packet, value uint16) (newPackets []midi.Packet, delayed []generatorinterface.TimedPacket, err error) {
+	generator := r.generatorFor(packet)
+	if g, ok := generator.(generatorinterface.TimedGeneratorInterface); ok {
+		timed, err := g.GenerateTimed(packet, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, t := range timed {
+			if t.Delay > 0 {
+				delayed = append(delayed, t)
+			} else {
+				newPackets = append(newPackets, t.Packet)
+			}
+		}
+		return newPackets, delayed, nil
+	}
 
-	return packet
-}
+	if g, ok := generator.(generatorinterface.MultiGeneratorInterface); ok {
+		newPackets, err = g.GenerateMulti(packet, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(newPackets) == 0 {
+			return nil, nil, errors.New("Generator produced no message")
+		}
+		return newPackets, nil, nil
+	}
 
-func (r *Rule) output(packet coremidi.Packet, value uint16) (newPacket coremidi.Packet, err error) {
-	newPacket, err = r.generator.Generate(packet, value)
+	newPacket, err := generator.Generate(packet, value)
 	if err != nil {
-		return packet, err
+		return nil, nil, err
 	}
 
-	return newPacket, nil
+	return []midi.Packet{newPacket}, nil, nil
 }
 
-func (r Rule) String() string {
+func (r *Rule) String() string {
 	var str string
 	str += "***** Rule '" + r.name + "' *****\n"
+	if len(r.tags) > 0 {
+		str += "  Tags     : " + strings.Join(r.tags, ", ") + "\n"
+	}
 	str += "  Match    : " + r.filter.String() + "\n"
+	if r.condition != nil {
+		str += "  Condition: " + r.condition.String() + "\n"
+	}
 	str += "  Transform: " + r.transform.String() + "\n"
 	str += "  Output   : " + r.generator.String()
+	if r.split != nil {
+		str += fmt.Sprintf("\n  Velocity >= %d: %s", r.split.threshold, r.split.generator.String())
+	}
+	if r.quantize != nil {
+		str += fmt.Sprintf("\n  Quantize : %g whole note", r.quantize.note)
+	}
+	if r.destination != "" {
+		str += "\n  Send to  : " + r.destination
+	}
+	if r.variable != "" {
+		str += "\n  Variable : " + r.variable
+	}
+	if r.action != nil {
+		str += "\n  Action   : " + r.action.String()
+	}
 
 	return str
 }
 
 func (t Transform) String() string {
-	switch t.mode {
-	case TransformModeNone:
+	if t.transformer == nil {
 		return "None"
-	case TransformModeLinear:
-		return fmt.Sprintf("Linear from [%d, %d] to [%d, %d]", t.fromMin, t.fromMax, t.toMin, t.toMax)
-	case TransformModeLinearDrop:
-		return fmt.Sprintf("Linear from [%d, %d] to [%d, %d] (drop out of range values)", t.fromMin, t.fromMax, t.toMin, t.toMax)
-	case TransformModeNoise:
-		return fmt.Sprintf("Noise from [%d, %d] to [%d, %d] with noise (channel %s, msgType %s, value range [%d, %d], delay [%d, %d]ms)",
-			t.fromMin, t.fromMax, t.toMin, t.toMax,
-			t.noiseSettings.Channel.String(), t.noiseSettings.MsgType.String(),
-			t.noiseSettings.MinValue, t.noiseSettings.MaxValue,
-			t.noiseSettings.DelayMsMin, t.noiseSettings.DelayMsMax)
-	case TransformModePreventRunStatus:
-		return "Prevent MIDI Running Status"
-	}
-	return "?"
+	}
+	return t.transformer.String()
 }
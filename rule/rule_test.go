@@ -0,0 +1,138 @@
+package rule_test
+
+import (
+	"MIDIRouter/clock"
+	"MIDIRouter/filter"
+	"MIDIRouter/filtercontrolchange"
+	"MIDIRouter/filternoteon"
+	"MIDIRouter/gencontrolchange"
+	"MIDIRouter/gennoteon"
+	"MIDIRouter/logger"
+	"MIDIRouter/midi"
+	"MIDIRouter/rule"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Control Change 7 on channel 1 to Control Change 74, value scaled to 0-100
+func newCCRule(tb testing.TB) *rule.Rule {
+	r, err := rule.New("cc")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	f, err := filtercontrolchange.New(filter.FilterChannel1, json.RawMessage(`{"ControllerNumber": "7", "Value": "*"}`))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := r.SetFilter(f); err != nil {
+		tb.Fatal(err)
+	}
+	g, err := gencontrolchange.New(filter.FilterChannel1, json.RawMessage(`{"ControllerNumber": "74", "Value": "*"}`))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := r.SetGenerator(g); err != nil {
+		tb.Fatal(err)
+	}
+	r.SetTransform(rule.TransformModeLinear, 0, 127, 0, 100)
+	return r
+}
+
+func TestDropDuplicatesTimeout(t *testing.T) {
+	r := newCCRule(t)
+	c := clock.NewManual(time.Unix(0, 0))
+	r.SetClock(c)
+	r.EnableDropDuplicates(true, 100*time.Millisecond)
+	log := logger.New(logger.LevelInfo)
+
+	steps := []struct {
+		advance time.Duration
+		value   byte
+		result  rule.RuleMatchResult
+	}{
+		{0, 64, rule.RuleMatchResultMatchInject},
+		{50 * time.Millisecond, 64, rule.RuleMatchResultMatchNoInject}, // Duplicate
+		{10 * time.Millisecond, 65, rule.RuleMatchResultMatchInject},   // Other value
+		{10 * time.Millisecond, 65, rule.RuleMatchResultMatchNoInject}, // Duplicate
+		{100 * time.Millisecond, 65, rule.RuleMatchResultMatchInject},  // Timed out
+	}
+	for i, step := range steps {
+		c.Advance(step.advance)
+		if res := r.Match(midi.NewPacket([]byte{0xB0, 7, step.value}, 0), log); res.Result != step.result {
+			t.Errorf("Step %d: got result %d, expected %d", i, res.Result, step.result)
+		}
+	}
+}
+
+// Note On with a humanized velocity, the random source seeded
+func newHumanizedRule(tb testing.TB, seed int64) *rule.Rule {
+	r, err := rule.New("humanized")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	r.SetSeed(seed)
+	f, err := filternoteon.New(filter.FilterChannel1, json.RawMessage(`{"Note": "*", "Velocity": "*"}`))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := r.SetFilter(f); err != nil {
+		tb.Fatal(err)
+	}
+	g, err := gennoteon.New(filter.FilterChannel1, json.RawMessage(`{"Note": "*", "Velocity": "*", "Humanize": {"Velocity": 20}}`))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := r.SetGenerator(g); err != nil {
+		tb.Fatal(err)
+	}
+	return r
+}
+
+// Rules seeded alike humanize notes alike
+func TestSeedHumanize(t *testing.T) {
+	r1 := newHumanizedRule(t, 42)
+	r2 := newHumanizedRule(t, 42)
+	log := logger.New(logger.LevelInfo)
+
+	varied := false
+	for i := 0; i < 20; i++ {
+		packet := midi.NewPacket([]byte{0x90, 60, 100}, 0)
+		v1 := r1.Match(packet, log).MainPacket.Data[2]
+		v2 := r2.Match(packet, log).MainPacket.Data[2]
+		if v1 != v2 {
+			t.Fatalf("Note %d: velocity %d and %d with the same seed", i, v1, v2)
+		}
+		varied = varied || (v1 != 100)
+	}
+	if !varied {
+		t.Error("Velocity never humanized")
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	r := newCCRule(b)
+	log := logger.New(logger.LevelInfo)
+	packet := midi.NewPacket([]byte{0xB0, 7, 64}, 0)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		packet.Data[2] = byte(i & 0x7F)
+		if res := r.Match(packet, log); res.Result == rule.RuleMatchResultNoMatch {
+			b.Fatal("No match")
+		}
+	}
+}
+
+func BenchmarkMatchMiss(b *testing.B) {
+	r := newCCRule(b)
+	log := logger.New(logger.LevelInfo)
+	packet := midi.NewPacket([]byte{0xB0, 8, 64}, 0)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if res := r.Match(packet, log); res.Result != rule.RuleMatchResultNoMatch {
+			b.Fatal("Unexpected match")
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package rule
+
+import (
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/midi"
+	"errors"
+	"sync"
+)
+
+// Note On messages with a velocity of at least threshold are sent by another
+// generator. The release of these notes goes to that generator as well.
+type velocitySplit struct {
+	threshold uint8
+	generator generatorinterface.GeneratorInterface
+	mutex     sync.Mutex
+	played    [16][2]uint64 // Input notes sent by the split generator and not released yet
+}
+
+// Send Note On messages with a velocity of at least threshold with g instead
+// of the rule generator. Their Note Off messages are matched by the rule, even
+// if the filter does not match them, and sent with g too. Call once the
+// filter is set.
+func (r *Rule) SetVelocitySplit(threshold uint8, g generatorinterface.GeneratorInterface) error {
+	if r.filter == nil {
+		return errors.New("Velocity split requires a filter")
+	}
+	r.split = &velocitySplit{threshold: threshold, generator: g}
+	r.bindGenerators()
+	for channel := byte(0); channel < 16; channel++ {
+		if r.statuses.accepts(0x90 | channel) {
+			r.statuses.add(0x80 | channel)
+		}
+	}
+	return nil
+}
+
+func isRelease(data []byte) bool {
+	return (len(data) == 3) && ((data[0]&0xF0 == 0x80) || ((data[0]&0xF0 == 0x90) && (data[2] == 0)))
+}
+
+// Reports whether the packet is a Note On played with the split generator, or
+// the release of such a note. Releases forget the note.
+func (s *velocitySplit) choose(packet midi.Packet) bool {
+	data := packet.Data
+	if (len(data) != 3) || ((data[0]&0xF0 != 0x80) && (data[0]&0xF0 != 0x90)) {
+		return false
+	}
+	channel, note := data[0]&0x0F, data[1]
+	bit := uint64(1) << (note & 63)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if isRelease(data) {
+		hard := s.played[channel][note>>6]&bit != 0
+		s.played[channel][note>>6] &^= bit
+		return hard
+	}
+	hard := data[2] >= s.threshold
+	if hard {
+		s.played[channel][note>>6] |= bit
+	} else {
+		s.played[channel][note>>6] &^= bit
+	}
+	return hard
+}
+
+// Whether the release of a note played with the split generator is pending
+func (s *velocitySplit) playing(data []byte) bool {
+	channel, note := data[0]&0x0F, data[1]
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.played[channel][note>>6]&(1<<(note&63)) != 0
+}
+
+// Generator of the output for a filtered message
+func (r *Rule) generatorFor(packet midi.Packet) generatorinterface.GeneratorInterface {
+	if (r.split != nil) && r.split.choose(packet) {
+		return r.split.generator
+	}
+	return r.generator
+}
+
+// Release of a note played with the split generator: the Note On messages it
+// generates are turned into Note Off messages
+func (r *Rule) splitRelease(packet midi.Packet) (MatchResult, bool) {
+	if (r.split == nil) || !isRelease(packet.Data) || !r.split.playing(packet.Data) {
+		return MatchResult{}, false
+	}
+
+	velocity := uint16(packet.Data[2])
+	packets, _, err := r.output(packet, velocity)
+	if (err != nil) || (len(packets) == 0) {
+		return MatchResult{Result: RuleMatchResultMatchNoInject, MainPacket: packet, Rule: r.name}, true
+	}
+	for i, p := range packets {
+		if (len(p.Data) == 3) && (p.Data[0]&0xF0 == 0x90) {
+			packets[i] = midi.NewPacket([]byte{0x80 | p.Data[0]&0x0F, p.Data[1], packet.Data[2]}, p.TimeStamp)
+		}
+	}
+	r.activeNotes.track(packets)
+	return MatchResult{
+		Result:       RuleMatchResultMatchInject,
+		MainPacket:   packets[0],
+		ExtraPackets: packets[1:],
+		Rule:         r.name,
+		Value:        velocity,
+		Transformed:  velocity,
+	}, true
+}
@@ -0,0 +1,8 @@
+package scriptinterface
+
+// User logic of a rule. Both functions return whether the message goes on,
+// and the value to use from then on.
+type ScriptInterface interface {
+	Match(data []byte, value uint16) (ok bool, newValue uint16, err error)     // After the filter matched
+	Transform(data []byte, value uint16) (ok bool, newValue uint16, err error) // After the transformation
+}
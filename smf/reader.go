@@ -0,0 +1,180 @@
+package smf
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"sort"
+	"time"
+)
+
+// A MIDI message of a file, at its time from the start of the song
+type Event struct {
+	At   time.Duration
+	Data []byte
+}
+
+// Event of a track, with its position in ticks. Tempo changes have no data.
+type trackEvent struct {
+	tick  uint64
+	data  []byte
+	tempo uint32
+}
+
+// Read a Standard MIDI File (format 0 or 1), returning the MIDI messages of all
+// tracks merged in time order. Tempo changes are applied, other meta events
+// are skipped.
+func ReadFile(path string) ([]Event, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("Failed to read MIDI file: " + err.Error())
+	}
+	if (len(content) < 14) || (string(content[0:4]) != "MThd") {
+		return nil, errors.New("Not a Standard MIDI File: " + path)
+	}
+	headerLength := binary.BigEndian.Uint32(content[4:8])
+	format := binary.BigEndian.Uint16(content[8:10])
+	division := binary.BigEndian.Uint16(content[12:14])
+	if format > 1 {
+		return nil, errors.New("Unsupported MIDI file format (sequential tracks)")
+	}
+	if division == 0 {
+		return nil, errors.New("Invalid MIDI file division")
+	}
+
+	var events []trackEvent
+	chunks := content[8+min(int(headerLength), len(content)-8):]
+	for len(chunks) >= 8 {
+		length := int(binary.BigEndian.Uint32(chunks[4:8]))
+		if length > len(chunks)-8 {
+			return nil, errors.New("Truncated MIDI file")
+		}
+		if string(chunks[0:4]) == "MTrk" {
+			trackEvents, err := parseTrack(chunks[8 : 8+length])
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, trackEvents...)
+		}
+		chunks = chunks[8+length:]
+	}
+
+	//Merge tracks, keeping track order for simultaneous events
+	sort.SliceStable(events, func(i, j int) bool { return events[i].tick < events[j].tick })
+
+	var result []Event
+	var at, lastTick uint64 // at in nanoseconds
+	tempo := uint64(DefaultTempo)
+	for _, e := range events {
+		if division&0x8000 != 0 {
+			//SMPTE: frames per second (negative) and ticks per frame
+			fps := uint64(-int8(division >> 8))
+			if fps == 29 {
+				at += (e.tick - lastTick) * 1000000000 * 1001 / (30000 * uint64(division&0xFF))
+			} else {
+				at += (e.tick - lastTick) * 1000000000 / (fps * uint64(division&0xFF))
+			}
+		} else {
+			at += (e.tick - lastTick) * tempo * 1000 / uint64(division)
+		}
+		lastTick = e.tick
+
+		if e.data == nil {
+			tempo = uint64(e.tempo)
+			continue
+		}
+		result = append(result, Event{At: time.Duration(at), Data: e.data})
+	}
+	return result, nil
+}
+
+func parseTrack(data []byte) ([]trackEvent, error) {
+	var events []trackEvent
+	var tick uint64
+	var status byte
+	truncated := errors.New("Truncated MIDI file track")
+
+	for i := 0; i < len(data); {
+		delta, n := readVarLen(data[i:])
+		if n == 0 {
+			return nil, truncated
+		}
+		tick += uint64(delta)
+		i += n
+		if i >= len(data) {
+			return nil, truncated
+		}
+
+		b := data[i]
+		switch {
+		case (b == 0xF0) || (b == 0xF7):
+			//SysEx (F0 omitted from data) or escaped data
+			length, n := readVarLen(data[i+1:])
+			start := i + 1 + n
+			end := start + int(length)
+			if (n == 0) || (end > len(data)) {
+				return nil, truncated
+			}
+			message := append([]byte(nil), data[start:end]...)
+			if b == 0xF0 {
+				message = append([]byte{0xF0}, message...)
+			}
+			if len(message) > 0 {
+				events = append(events, trackEvent{tick: tick, data: message})
+			}
+			status = 0
+			i = end
+		case b == 0xFF:
+			//Meta event
+			if i+1 >= len(data) {
+				return nil, truncated
+			}
+			metaType := data[i+1]
+			length, n := readVarLen(data[i+2:])
+			start := i + 2 + n
+			end := start + int(length)
+			if (n == 0) || (end > len(data)) {
+				return nil, truncated
+			}
+			if (metaType == 0x51) && (length == 3) {
+				tempo := uint32(data[start])<<16 | uint32(data[start+1])<<8 | uint32(data[start+2])
+				events = append(events, trackEvent{tick: tick, tempo: tempo})
+			}
+			if metaType == 0x2F {
+				return events, nil
+			}
+			i = end
+		default:
+			//Channel message, possibly using running status
+			if b >= 0x80 {
+				status = b
+				i++
+			} else if status == 0 {
+				return nil, errors.New("Invalid MIDI file track: data byte without status")
+			}
+			length := 2
+			if (status&0xF0 == 0xC0) || (status&0xF0 == 0xD0) {
+				length = 1
+			}
+			if i+length > len(data) {
+				return nil, truncated
+			}
+			message := append([]byte{status}, data[i:i+length]...)
+			events = append(events, trackEvent{tick: tick, data: message})
+			i += length
+		}
+	}
+	return events, nil
+}
+
+// Read a variable-length quantity, returning its value and size (0 if invalid)
+func readVarLen(data []byte) (uint32, int) {
+	var value uint32
+	for i := 0; (i < len(data)) && (i < 4); i++ {
+		value = value<<7 | uint32(data[i]&0x7F)
+		if data[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
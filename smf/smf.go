@@ -0,0 +1,159 @@
+package smf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// Ticks per quarter note. With the default 120 BPM tempo, a tick is 0.5ms.
+	Division     = 1000
+	DefaultTempo = 500000 // Microseconds per quarter note
+)
+
+// A timestamped MIDI message
+type event struct {
+	at   time.Duration
+	data []byte
+}
+
+type track struct {
+	name   string
+	events []event
+}
+
+// Standard MIDI File (format 1) recorder. Messages are timestamped on arrival
+// and kept in memory, the file being written on Close.
+type Recorder struct {
+	path   string
+	start  time.Time
+	mutex  sync.Mutex
+	tracks []track
+	closed bool
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	//Fail early rather than losing a whole session on Close
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.New("Failed to create MIDI file: " + err.Error())
+	}
+	f.Close()
+	return &Recorder{path: path, start: time.Now()}, nil
+}
+
+// Add a named track, returning its index for Record
+func (rec *Recorder) AddTrack(name string) int {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	rec.tracks = append(rec.tracks, track{name: name})
+	return len(rec.tracks) - 1
+}
+
+// Record a single complete MIDI message on a track
+func (rec *Recorder) Record(trackIndex int, message []byte) {
+	if len(message) == 0 {
+		return
+	}
+	data := append([]byte(nil), message...)
+
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	at := time.Since(rec.start)
+
+	if rec.closed || (trackIndex < 0) || (trackIndex >= len(rec.tracks)) {
+		return
+	}
+	rec.tracks[trackIndex].events = append(rec.tracks[trackIndex].events, event{at: at, data: data})
+}
+
+// Write the file. Further messages are ignored.
+func (rec *Recorder) Close() error {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	if rec.closed {
+		return nil
+	}
+	rec.closed = true
+
+	f, err := os.Create(rec.path)
+	if err != nil {
+		return errors.New("Failed to create MIDI file: " + err.Error())
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	header := []byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 1}
+	header = binary.BigEndian.AppendUint16(header, uint16(len(rec.tracks)+1))
+	header = binary.BigEndian.AppendUint16(header, Division)
+	w.Write(header)
+
+	//Conductor track: tempo only
+	conductor := []byte{0x00, 0xFF, 0x51, 0x03, (DefaultTempo >> 16) & 0xFF, (DefaultTempo >> 8) & 0xFF, DefaultTempo & 0xFF}
+	writeChunk(w, append(conductor, 0x00, 0xFF, 0x2F, 0x00))
+
+	for _, t := range rec.tracks {
+		writeChunk(w, t.encode())
+	}
+
+	if err := w.Flush(); err != nil {
+		return errors.New("Failed to write MIDI file: " + err.Error())
+	}
+	return nil
+}
+
+func writeChunk(w *bufio.Writer, data []byte) {
+	chunk := []byte{'M', 'T', 'r', 'k'}
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(len(data)))
+	w.Write(chunk)
+	w.Write(data)
+}
+
+// Track chunk data: name, events and end of track
+func (t *track) encode() []byte {
+	data := []byte{0x00, 0xFF, 0x03}
+	data = appendVarLen(data, uint32(len(t.name)))
+	data = append(data, t.name...)
+
+	var lastTick uint32
+	for _, e := range t.events {
+		tick := uint32(e.at.Microseconds() * Division / DefaultTempo)
+		data = appendVarLen(data, tick-lastTick)
+		lastTick = tick
+
+		switch {
+		case e.data[0] == 0xF0:
+			//SysEx: length of the message after F0, including F7
+			data = append(data, 0xF0)
+			data = appendVarLen(data, uint32(len(e.data)-1))
+			data = append(data, e.data[1:]...)
+		case e.data[0] > 0xF0:
+			//Other system messages can only be stored as escaped data
+			data = append(data, 0xF7)
+			data = appendVarLen(data, uint32(len(e.data)))
+			data = append(data, e.data...)
+		default:
+			data = append(data, e.data...)
+		}
+	}
+	return append(data, 0x00, 0xFF, 0x2F, 0x00)
+}
+
+// Append a variable-length quantity
+func appendVarLen(data []byte, value uint32) []byte {
+	var buf [5]byte
+	i := len(buf) - 1
+	buf[i] = byte(value & 0x7F)
+	for value >>= 7; value > 0; value >>= 7 {
+		i--
+		buf[i] = byte(value&0x7F) | 0x80
+	}
+	return append(data, buf[i:]...)
+}
@@ -0,0 +1,71 @@
+package tempo
+
+import (
+	"sync"
+	"time"
+)
+
+// Regenerates clock ticks from a smoothed estimate of the incoming tempo and
+// phase, to clean up jittery clock. Responsiveness (0 to 1) is the weight of
+// each incoming tick in the estimate: low values give a steadier clock,
+// following tempo changes more slowly.
+type PLL struct {
+	Responsiveness float64
+
+	mutex   sync.Mutex
+	last    time.Time     // Last incoming tick
+	phase   time.Time     // Smoothed time of the last incoming tick
+	period  time.Duration // Smoothed interval between ticks
+	lastOut time.Time
+}
+
+// Time at which the tick received at now should be sent again. Ticks are
+// delayed by half a period to absorb jitter, and never sent before now.
+func (p *PLL) Tick(now time.Time) time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	elapsed := now.Sub(p.last)
+	p.last = now
+	if p.phase.IsZero() || (elapsed >= clockTimeout) {
+		p.phase = now
+		p.period = 0
+		p.lastOut = now
+		return now
+	}
+
+	if p.period == 0 {
+		p.period = elapsed
+	} else {
+		p.period += time.Duration(p.Responsiveness * float64(elapsed-p.period))
+	}
+	predicted := p.phase.Add(p.period)
+	p.phase = predicted.Add(time.Duration(p.Responsiveness * float64(now.Sub(predicted))))
+
+	out := p.phase.Add(p.period / 2)
+	if out.Before(now) {
+		out = now
+	}
+	if out.Before(p.lastOut) {
+		out = p.lastOut
+	}
+	p.lastOut = out
+	return out
+}
+
+// Smoothed interval between ticks, 0 until two ticks were received
+func (p *PLL) Period() time.Duration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.period
+}
+
+// Forget the estimate, when the clock restarts
+func (p *PLL) Reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.phase = time.Time{}
+	p.period = 0
+}
@@ -0,0 +1,86 @@
+package tempo
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Song position followed from MIDI clock and transport messages, to find the
+// beat grid
+type Position struct {
+	mutex    sync.Mutex
+	running  bool
+	ticks    int64 // Ticks received since Start, the first one being on the downbeat
+	lastTick time.Time
+}
+
+// Start from the beginning of the song
+func (p *Position) Start() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.running = true
+	p.ticks = 0
+}
+
+func (p *Position) Continue() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.running = true
+}
+
+func (p *Position) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.running = false
+}
+
+// Move to a position in clock ticks (Song Position Pointer)
+func (p *Position) Locate(ticks int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.ticks = ticks
+}
+
+// Position in clock ticks
+func (p *Position) Ticks() int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.ticks
+}
+
+// Account for a clock tick received at now
+func (p *Position) Tick(now time.Time) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.running {
+		p.ticks++
+		p.lastTick = now
+	}
+}
+
+// Time from now until the next multiple of grid ticks, interval being the
+// current tick interval. Moments less than late after a grid line are on it.
+// Reports false when the clock is not running.
+func (p *Position) Until(grid float64, interval time.Duration, late float64, now time.Time) (time.Duration, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	elapsed := now.Sub(p.lastTick)
+	if !p.running || (p.ticks == 0) || (interval <= 0) || (elapsed >= clockTimeout) {
+		return 0, false
+	}
+
+	position := float64(p.ticks-1) + float64(elapsed)/float64(interval)
+	next := math.Ceil(position/grid) * grid
+	if position-(next-grid) < late*grid {
+		return 0, true
+	}
+	return time.Duration((next - position) * float64(interval)), true
+}
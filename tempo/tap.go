@@ -0,0 +1,44 @@
+package tempo
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	tapTimeout = 2 * time.Second // Taps further apart start a new count
+	maxTaps    = 5               // Intervals averaged over the last taps
+	MinBPM     = 20
+	MaxBPM     = 300
+)
+
+// Tempo tapped on a footswitch or pad
+type Tap struct {
+	mutex sync.Mutex
+	taps  []time.Time
+}
+
+// Account for a tap at now. Returns the tempo from the last taps, once at
+// least two were received.
+func (t *Tap) Tap(now time.Time) (float64, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if (len(t.taps) > 0) && (now.Sub(t.taps[len(t.taps)-1]) >= tapTimeout) {
+		t.taps = t.taps[:0]
+	}
+	t.taps = append(t.taps, now)
+	if len(t.taps) > maxTaps {
+		t.taps = t.taps[1:]
+	}
+	if len(t.taps) < 2 {
+		return 0, false
+	}
+
+	interval := t.taps[len(t.taps)-1].Sub(t.taps[0]) / time.Duration(len(t.taps)-1)
+	bpm := 60 / interval.Seconds()
+	if (bpm < MinBPM) || (bpm > MaxBPM) {
+		return 0, false
+	}
+	return bpm, true
+}
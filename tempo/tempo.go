@@ -0,0 +1,66 @@
+package tempo
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	ClockTicksPerBeat = 24
+	ClockTick         = 0xF8
+	clockTimeout      = time.Second // Clock considered stopped after this delay without tick
+	smoothing         = 0.1         // Weight of the last tick interval in the estimate
+	settleTicks       = 12          // Ticks before the estimate is reported
+)
+
+// Tempo estimated from MIDI clock ticks, smoothed against jitter
+type Tracker struct {
+	mutex    sync.Mutex
+	lastTick time.Time
+	interval time.Duration // Smoothed interval between ticks
+	ticks    int           // Ticks since the clock (re)started
+}
+
+// Account for a clock tick received at now
+func (t *Tracker) Tick(now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	elapsed := now.Sub(t.lastTick)
+	if elapsed >= clockTimeout {
+		t.interval = 0
+		t.ticks = 0
+	} else if t.interval == 0 {
+		t.interval = elapsed
+	} else {
+		t.interval += time.Duration(smoothing * float64(elapsed-t.interval))
+	}
+	t.lastTick = now
+	t.ticks++
+}
+
+// Tempo in BPM, 0 when no clock is running or the estimate did not settle yet
+func (t *Tracker) BPM(now time.Time) float64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if (t.interval <= 0) || (t.ticks < settleTicks) || (now.Sub(t.lastTick) >= clockTimeout) {
+		return 0
+	}
+	return 60 / (t.interval.Seconds() * ClockTicksPerBeat)
+}
+
+// Reports tempo changes of at least one BPM, ignoring jitter around a value
+type ChangeDetector struct {
+	reported float64
+}
+
+// Returns the rounded tempo and whether it should be reported
+func (d *ChangeDetector) Changed(bpm float64) (uint16, bool) {
+	if (bpm <= 0) || (math.Abs(bpm-d.reported) < 0.75) {
+		return uint16(math.Round(d.reported)), false
+	}
+	d.reported = math.Round(bpm)
+	return uint16(d.reported), true
+}
@@ -0,0 +1,58 @@
+package transforminterface
+
+import (
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/midi"
+	"encoding/json"
+	"math/rand"
+)
+
+type TransformResult int
+
+const (
+	TransformResult_Value   = iota
+	TransformResult_NoMatch = iota // Value rejected, later rules are evaluated
+	TransformResult_Drop    = iota // Rule matched, nothing is generated
+)
+
+type TransformInterface interface {
+	Transform(packet midi.Packet, value uint16) (result TransformResult, newValue uint16)
+	String() string
+}
+
+// Optional interface for transforms knowing the range of the values they
+// produce, checked against the generator when the rule is validated
+type RangeTransformInterface interface {
+	OutputRange() (min uint32, max uint32)
+}
+
+// Optional interface for transforms keeping state across messages (e.g.
+// toggles), saved to the router state file
+type StatefulTransformInterface interface {
+	SaveState() json.RawMessage
+	RestoreState(state json.RawMessage) error
+}
+
+// Optional interface for transforms sending messages of their own (e.g.
+// noise), given the value extracted by the filter. Delays are from the match.
+type EmitterTransformInterface interface {
+	Emit(packet midi.Packet, value uint16) []generatorinterface.TimedPacket
+}
+
+// Optional interface for transforms rewriting the generated packets (e.g.
+// running status prevention). Rewritten packets are sent on their own, never
+// merged with other messages.
+type OutputTransformInterface interface {
+	Output(packets []midi.Packet) []midi.Packet
+}
+
+// Optional interface for transforms using random numbers, given the random
+// source of their rule so that runs can be reproduced
+type RandomTransformInterface interface {
+	SetRand(rng *rand.Rand)
+}
+
+// Optional interface for transforms following the tempo (BPM)
+type TempoTransformInterface interface {
+	SetTempo(tempo func() float64)
+}
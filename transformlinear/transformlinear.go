@@ -0,0 +1,57 @@
+package transformlinear
+
+import (
+	"MIDIRouter/midi"
+	"MIDIRouter/transforminterface"
+	"fmt"
+)
+
+// Transpose values from [fromMin, fromMax] to [toMin, toMax]. toMin may be
+// larger than toMax to invert the range.
+type TransformLinear struct {
+	fromMin uint32
+	fromMax uint32
+	toMin   uint32
+	toMax   uint32
+	drop    bool // Reject out of range input and output values
+}
+
+func New(fromMin uint32, fromMax uint32, toMin uint32, toMax uint32, drop bool) *TransformLinear {
+	return &TransformLinear{fromMin: fromMin, fromMax: fromMax, toMin: toMin, toMax: toMax, drop: drop}
+}
+
+func (t *TransformLinear) scale(value uint16) uint16 {
+	a := (float64(t.toMax) - float64(t.toMin)) / (float64(t.fromMax) - float64(t.fromMin))
+	b := float64(t.toMin) - a*float64(t.fromMin)
+	return uint16(a*float64(value) + float64(b))
+}
+
+func (t *TransformLinear) Transform(packet midi.Packet, value uint16) (result transforminterface.TransformResult, newValue uint16) {
+	if !t.drop {
+		return transforminterface.TransformResult_Value, t.scale(value)
+	}
+
+	if (uint32(value) > t.fromMax) || (uint32(value) < t.fromMin) {
+		return transforminterface.TransformResult_NoMatch, 0
+	}
+	v := t.scale(value)
+	if min, max := t.OutputRange(); (uint32(v) > max) || (uint32(v) < min) {
+		return transforminterface.TransformResult_NoMatch, 0
+	}
+	return transforminterface.TransformResult_Value, v
+}
+
+func (t *TransformLinear) OutputRange() (min uint32, max uint32) {
+	if t.toMin > t.toMax {
+		return t.toMax, t.toMin
+	}
+	return t.toMin, t.toMax
+}
+
+func (t *TransformLinear) String() string {
+	str := fmt.Sprintf("Linear from [%d, %d] to [%d, %d]", t.fromMin, t.fromMax, t.toMin, t.toMax)
+	if t.drop {
+		str += " (drop out of range values)"
+	}
+	return str
+}
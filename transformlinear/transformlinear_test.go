@@ -0,0 +1,46 @@
+package transformlinear
+
+import (
+	"MIDIRouter/midi"
+	"MIDIRouter/transforminterface"
+	"testing"
+)
+
+func TestTransform(t *testing.T) {
+	packet := midi.NewPacket([]byte{0xB0, 7, 0}, 0)
+	tests := []struct {
+		name      string
+		transform *TransformLinear
+		value     uint16
+		result    transforminterface.TransformResult
+		expected  uint16
+	}{
+		{"identity", New(0, 127, 0, 127, false), 64, transforminterface.TransformResult_Value, 64},
+		{"scale down", New(0, 127, 0, 100, false), 127, transforminterface.TransformResult_Value, 100},
+		{"scale up", New(0, 127, 0, 16383, false), 127, transforminterface.TransformResult_Value, 16383},
+		{"inverted", New(0, 127, 127, 0, false), 0, transforminterface.TransformResult_Value, 127},
+		{"inverted max", New(0, 127, 127, 0, false), 127, transforminterface.TransformResult_Value, 0},
+		{"offset", New(64, 127, 0, 63, false), 100, transforminterface.TransformResult_Value, 36},
+		{"extrapolated", New(0, 63, 0, 63, false), 100, transforminterface.TransformResult_Value, 100},
+		{"drop in range", New(10, 20, 0, 100, true), 15, transforminterface.TransformResult_Value, 50},
+		{"drop below", New(10, 20, 0, 100, true), 9, transforminterface.TransformResult_NoMatch, 0},
+		{"drop above", New(10, 20, 0, 100, true), 21, transforminterface.TransformResult_NoMatch, 0},
+		{"drop inverted", New(0, 127, 127, 0, true), 127, transforminterface.TransformResult_Value, 0},
+	}
+
+	for _, test := range tests {
+		result, value := test.transform.Transform(packet, test.value)
+		if (result != test.result) || (value != test.expected) {
+			t.Errorf("%s: %d gave (%d, %d), expected (%d, %d)", test.name, test.value, result, value, test.result, test.expected)
+		}
+	}
+}
+
+func TestOutputRange(t *testing.T) {
+	if min, max := New(0, 127, 100, 20, false).OutputRange(); (min != 20) || (max != 100) {
+		t.Errorf("Inverted range gave [%d, %d], expected [20, 100]", min, max)
+	}
+	if min, max := New(0, 127, 0, 16383, false).OutputRange(); (min != 0) || (max != 16383) {
+		t.Errorf("Range gave [%d, %d], expected [0, 16383]", min, max)
+	}
+}
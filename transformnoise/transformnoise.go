@@ -0,0 +1,155 @@
+package transformnoise
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/generatorinterface"
+	"MIDIRouter/midi"
+	"MIDIRouter/transforminterface"
+	"MIDIRouter/transformlinear"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Tempo used for delays in musical units when no tempo source is set
+const DefaultTempo = 120.0
+
+type Settings struct {
+	MsgType    filter.FilterMsgType // MIDI message type for noise
+	Channel    filter.FilterChannel // MIDI channel for noise
+	MinValue   uint8                // Minimum noise value
+	MaxValue   uint8                // Maximum noise value
+	DelayMsMin uint16               // Minimum delay in milliseconds
+	DelayMsMax uint16               // Maximum delay in milliseconds
+
+	// Delays as fractions of a whole note (0.125 for an eighth note), used
+	// instead of milliseconds when set
+	DelayNoteMin float64
+	DelayNoteMax float64
+
+	Count         uint8  // Noise packets per match (burst), 1 if 0
+	IntervalMsMin uint16 // Minimum delay between the packets of a burst
+	IntervalMsMax uint16 // Maximum delay between the packets of a burst
+}
+
+// Linear scale of the value, along with random messages sent after random
+// delays. Instances are not shared between rules: the random source belongs
+// to the rule, see SetRand.
+type TransformNoise struct {
+	linear   *transformlinear.TransformLinear
+	from     [2]uint32 // Linear scale input and output ranges, for String
+	to       [2]uint32
+	settings Settings
+	rng      *rand.Rand
+	tempo    func() float64 // Current tempo in BPM, for delays in musical units
+}
+
+func New(fromMin uint32, fromMax uint32, toMin uint32, toMax uint32, settings Settings) *TransformNoise {
+	return &TransformNoise{
+		linear:   transformlinear.New(fromMin, fromMax, toMin, toMax, false),
+		from:     [2]uint32{fromMin, fromMax},
+		to:       [2]uint32{toMin, toMax},
+		settings: settings,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Use the random source of the rule, seedable for reproducible runs
+func (t *TransformNoise) SetRand(rng *rand.Rand) {
+	t.rng = rng
+}
+
+// Set the source of the current tempo (BPM), for delays in musical units
+func (t *TransformNoise) SetTempo(tempo func() float64) {
+	t.tempo = tempo
+}
+
+func (t *TransformNoise) Transform(packet midi.Packet, value uint16) (result transforminterface.TransformResult, newValue uint16) {
+	return t.linear.Transform(packet, value)
+}
+
+// Noise packets of a match: the first one after a random delay, the next
+// ones of a burst at random intervals
+func (t *TransformNoise) Emit(packet midi.Packet, value uint16) []generatorinterface.TimedPacket {
+	first := t.generate(packet, value)
+	delay := t.delay()
+	noise := []generatorinterface.TimedPacket{{Packet: first, Delay: delay}}
+	for i := 1; i < int(t.settings.Count); i++ {
+		interval := t.settings.IntervalMsMin
+		if t.settings.IntervalMsMax > t.settings.IntervalMsMin {
+			interval = t.settings.IntervalMsMin + uint16(t.rng.Intn(int(t.settings.IntervalMsMax-t.settings.IntervalMsMin+1)))
+		}
+		delay += time.Duration(interval) * time.Millisecond
+		noise = append(noise, generatorinterface.TimedPacket{Packet: t.generate(packet, value), Delay: delay})
+	}
+	return noise
+}
+
+// Random delay of the first noise packet, in musical units resolved against
+// the current tempo when set
+func (t *TransformNoise) delay() time.Duration {
+	ns := t.settings
+
+	if ns.DelayNoteMax > 0 {
+		note := ns.DelayNoteMin
+		if ns.DelayNoteMax > ns.DelayNoteMin {
+			note += t.rng.Float64() * (ns.DelayNoteMax - ns.DelayNoteMin)
+		}
+		bpm := DefaultTempo
+		if t.tempo != nil {
+			bpm = t.tempo()
+		}
+		return time.Duration(note * 4 * 60 / bpm * float64(time.Second))
+	}
+
+	delayValue := ns.DelayMsMin
+	if ns.DelayMsMax > ns.DelayMsMin {
+		delayValue = ns.DelayMsMin + uint16(t.rng.Intn(int(ns.DelayMsMax-ns.DelayMsMin+1)))
+	}
+	return time.Duration(delayValue) * time.Millisecond
+}
+
+// A noise packet, with a random value between MinValue and MaxValue
+func (t *TransformNoise) generate(packet midi.Packet, value uint16) midi.Packet {
+	ns := t.settings
+
+	randVal := ns.MinValue
+	if ns.MaxValue > ns.MinValue {
+		randVal = ns.MinValue + uint8(t.rng.Intn(int(ns.MaxValue-ns.MinValue+1)))
+	}
+
+	statusByte := byte(ns.MsgType)<<4 | byte(ns.Channel)
+
+	var data []byte
+	switch ns.MsgType {
+	case filter.FilterMsgTypeNoteOn, filter.FilterMsgTypeNoteOff, filter.FilterMsgTypeAftertouch,
+		filter.FilterMsgTypeControlChange, filter.FilterMsgTypePitchWheel:
+		// Two data bytes (e.g., note/control number and velocity/value)
+		data = []byte{statusByte, byte(value & 0x7F), randVal}
+	default:
+		// One data byte (e.g., program number or pressure value)
+		data = []byte{statusByte, randVal}
+	}
+
+	return midi.NewPacket(data, packet.TimeStamp)
+}
+
+func (t *TransformNoise) OutputRange() (min uint32, max uint32) {
+	return t.linear.OutputRange()
+}
+
+func (t *TransformNoise) String() string {
+	ns := t.settings
+	str := fmt.Sprintf("Noise from [%d, %d] to [%d, %d]", t.from[0], t.from[1], t.to[0], t.to[1])
+	if ns.DelayNoteMax > 0 {
+		str += fmt.Sprintf(" with noise (channel %s, msgType %s, value range [%d, %d], delay [%g, %g] whole note)",
+			ns.Channel.String(), ns.MsgType.String(), ns.MinValue, ns.MaxValue, ns.DelayNoteMin, ns.DelayNoteMax)
+	} else {
+		str += fmt.Sprintf(" with noise (channel %s, msgType %s, value range [%d, %d], delay [%d, %d]ms)",
+			ns.Channel.String(), ns.MsgType.String(), ns.MinValue, ns.MaxValue, ns.DelayMsMin, ns.DelayMsMax)
+	}
+	if ns.Count > 1 {
+		str += fmt.Sprintf(", bursts of %d packets every [%d, %d]ms", ns.Count, ns.IntervalMsMin, ns.IntervalMsMax)
+	}
+	return str
+}
@@ -0,0 +1,65 @@
+package transformnoise
+
+import (
+	"MIDIRouter/filter"
+	"MIDIRouter/midi"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newNoise(seed int64, settings Settings) *TransformNoise {
+	t := New(0, 127, 0, 100, settings)
+	t.SetRand(rand.New(rand.NewSource(seed)))
+	return t
+}
+
+func TestEmit(t *testing.T) {
+	settings := Settings{MsgType: filter.FilterMsgTypeControlChange, Channel: filter.FilterChannel2,
+		MinValue: 10, MaxValue: 20, DelayMsMin: 5, DelayMsMax: 10, Count: 3, IntervalMsMin: 1, IntervalMsMax: 4}
+	packet := midi.NewPacket([]byte{0xB0, 7, 64}, 0)
+
+	noise := newNoise(1, settings).Emit(packet, 64)
+	if len(noise) != 3 {
+		t.Fatalf("Got %d noise packets, expected 3", len(noise))
+	}
+	previous := time.Duration(0)
+	for i, n := range noise {
+		d := n.Packet.Data
+		if (len(d) != 3) || (d[0] != 0xB1) || (d[1] != 64) || (d[2] < 10) || (d[2] > 20) {
+			t.Errorf("Packet %d: unexpected % X", i, d)
+		}
+		if (i == 0) && ((n.Delay < 5*time.Millisecond) || (n.Delay > 10*time.Millisecond)) {
+			t.Errorf("First delay %v out of [5, 10]ms", n.Delay)
+		}
+		if (i > 0) && ((n.Delay-previous < time.Millisecond) || (n.Delay-previous > 4*time.Millisecond)) {
+			t.Errorf("Interval %v out of [1, 4]ms", n.Delay-previous)
+		}
+		previous = n.Delay
+	}
+
+	//Same seed, same noise
+	if again := newNoise(1, settings).Emit(packet, 64); !reflect.DeepEqual(noise, again) {
+		t.Errorf("Seeded noise differs: %v then %v", noise, again)
+	}
+}
+
+func TestDelayFollowsTempo(t *testing.T) {
+	n := newNoise(1, Settings{MsgType: filter.FilterMsgTypeProgramChange, DelayNoteMin: 0.25, DelayNoteMax: 0.25})
+	n.SetTempo(func() float64 { return 60 })
+
+	noise := n.Emit(midi.NewPacket([]byte{0x90, 60, 100}, 0), 100)
+	if (len(noise) != 1) || (noise[0].Delay != time.Second) {
+		t.Fatalf("Got %v, expected one packet after a quarter note at 60 BPM", noise)
+	}
+	if len(noise[0].Packet.Data) != 2 {
+		t.Errorf("Program Change noise % X, expected 2 bytes", noise[0].Packet.Data)
+	}
+}
+
+func TestTransformScales(t *testing.T) {
+	if _, v := newNoise(1, Settings{}).Transform(midi.NewPacket([]byte{0xB0, 7, 127}, 0), 127); v != 100 {
+		t.Errorf("127 scaled to %d, expected 100", v)
+	}
+}
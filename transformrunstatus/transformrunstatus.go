@@ -0,0 +1,114 @@
+package transformrunstatus
+
+import (
+	"MIDIRouter/midi"
+	"MIDIRouter/transforminterface"
+	"fmt"
+)
+
+// Value unchanged, every generated message carries its status byte and is
+// never merged with others
+type TransformRunStatus struct {
+	spacer []byte // Byte inserted between messages, none if empty
+}
+
+func New(spacer []byte) *TransformRunStatus {
+	return &TransformRunStatus{spacer: spacer}
+}
+
+func (t *TransformRunStatus) Transform(packet midi.Packet, value uint16) (result transforminterface.TransformResult, newValue uint16) {
+	return transforminterface.TransformResult_Value, value
+}
+
+// Force a status byte on every message of the packets, so that receivers
+// can't mistake them for running status. Devices merging consecutive messages
+// anyway get a spacer byte between messages, when set.
+func (t *TransformRunStatus) Output(packets []midi.Packet) []midi.Packet {
+	for i, p := range packets {
+		packets[i] = midi.NewPacket(forceStatusBytes(p.Data, t.spacer), p.TimeStamp)
+	}
+	return packets
+}
+
+func (t *TransformRunStatus) String() string {
+	if len(t.spacer) > 0 {
+		return fmt.Sprintf("Prevent MIDI Running Status (spacer %X)", t.spacer)
+	}
+	return "Prevent MIDI Running Status"
+}
+
+// Number of bytes of a message, from its status byte (SysEx excluded)
+func messageLength(status byte) int {
+	switch status & 0xF0 {
+	case 0x80, 0x90, 0xA0, 0xB0, 0xE0:
+		return 3
+	case 0xC0, 0xD0:
+		return 2
+	case 0xF0:
+		switch status {
+		case 0xF1, 0xF3:
+			return 2
+		case 0xF2:
+			return 3
+		}
+	}
+	return 1
+}
+
+// Rebuild data so that every message carries its own status byte (running
+// status is expanded), optionally separating messages with spacer bytes.
+// Data bytes with no status to refer to are dropped.
+func forceStatusBytes(data []byte, spacer []byte) []byte {
+	var out []byte
+	var status byte
+
+	for i := 0; i < len(data); {
+		b := data[i]
+		if b >= 0xF8 {
+			//Real-time: no effect on running status
+			out = append(out, b)
+			i++
+			continue
+		}
+		if b >= 0x80 {
+			status = b
+			i++
+		} else if (status == 0) || (status >= 0xF0) {
+			i++
+			continue
+		}
+
+		if len(out) > 0 {
+			out = append(out, spacer...)
+		}
+		out = append(out, status)
+
+		if status == 0xF0 {
+			for (i < len(data)) && (data[i] != 0xF7) {
+				out = append(out, data[i])
+				i++
+			}
+			if i < len(data) {
+				out = append(out, 0xF7)
+				i++
+			}
+			status = 0
+			continue
+		}
+
+		for n := 1; (n < messageLength(status)) && (i < len(data)); i++ {
+			if data[i] < 0x80 {
+				n++
+			} else if data[i] < 0xF8 {
+				break
+			}
+			//Real-time bytes within the message are kept in place
+			out = append(out, data[i])
+		}
+		if status >= 0xF0 {
+			//System common messages cancel running status
+			status = 0
+		}
+	}
+	return out
+}
@@ -0,0 +1,35 @@
+package transformrunstatus
+
+import (
+	"MIDIRouter/midi"
+	"bytes"
+	"testing"
+)
+
+func TestOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		spacer   []byte
+		data     []byte
+		expected []byte
+	}{
+		{"running status", nil, []byte{0xB0, 0x07, 0x10, 0x27, 0x05}, []byte{0xB0, 0x07, 0x10, 0xB0, 0x27, 0x05}},
+		{"spacer", []byte{0xFD}, []byte{0xB0, 0x07, 0x10, 0x27, 0x05}, []byte{0xB0, 0x07, 0x10, 0xFD, 0xB0, 0x27, 0x05}},
+		{"real-time kept", nil, []byte{0x90, 0x3C, 0xF8, 0x40, 0x3E, 0x40}, []byte{0x90, 0x3C, 0xF8, 0x40, 0x90, 0x3E, 0x40}},
+		{"SysEx", nil, []byte{0xF0, 0x43, 0x10, 0xF7, 0xC0, 0x05}, []byte{0xF0, 0x43, 0x10, 0xF7, 0xC0, 0x05}},
+		{"orphan data dropped", nil, []byte{0x10, 0xF1, 0x20, 0x30}, []byte{0xF1, 0x20}},
+	}
+
+	for _, test := range tests {
+		packets := New(test.spacer).Output([]midi.Packet{midi.NewPacket(test.data, 0)})
+		if (len(packets) != 1) || !bytes.Equal(packets[0].Data, test.expected) {
+			t.Errorf("%s: got %v, expected % X", test.name, packets, test.expected)
+		}
+	}
+}
+
+func TestTransformKeepsValue(t *testing.T) {
+	if _, v := New(nil).Transform(midi.NewPacket([]byte{0x90, 0x3C, 0x40}, 0), 64); v != 64 {
+		t.Errorf("Value changed to %d", v)
+	}
+}
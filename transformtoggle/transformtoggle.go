@@ -0,0 +1,91 @@
+package transformtoggle
+
+import (
+	"MIDIRouter/midi"
+	"MIDIRouter/transforminterface"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Alternates between two values on each press, with an independent state per
+// key: channel and first data byte (note or controller number) of the
+// filtered message. Releases (value 0, Note Off) are dropped.
+type TransformToggle struct {
+	off uint32
+	on  uint32
+
+	mutex sync.Mutex
+	state map[uint16]bool // Key => on
+}
+
+func New(off uint32, on uint32) *TransformToggle {
+	return &TransformToggle{off: off, on: on, state: make(map[uint16]bool)}
+}
+
+func key(data []byte) uint16 {
+	k := uint16(data[0]&0x0F) << 8
+	if len(data) > 1 {
+		k |= uint16(data[1])
+	}
+	return k
+}
+
+func (t *TransformToggle) Transform(packet midi.Packet, value uint16) (result transforminterface.TransformResult, newValue uint16) {
+	if (len(packet.Data) == 0) || (value == 0) || (packet.Data[0]&0xF0 == 0x80) {
+		return transforminterface.TransformResult_Drop, 0
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	k := key(packet.Data)
+	t.state[k] = !t.state[k]
+	if t.state[k] {
+		return transforminterface.TransformResult_Value, uint16(t.on)
+	}
+	return transforminterface.TransformResult_Value, uint16(t.off)
+}
+
+// Keys currently on
+func (t *TransformToggle) SaveState() json.RawMessage {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	keys := []uint16{}
+	for k, on := range t.state {
+		if on {
+			keys = append(keys, k)
+		}
+	}
+	data, _ := json.Marshal(keys)
+	return data
+}
+
+func (t *TransformToggle) RestoreState(state json.RawMessage) error {
+	var keys []uint16
+	if err := json.Unmarshal(state, &keys); err != nil {
+		return errors.New("Failed to restore toggle state: " + err.Error())
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.state = make(map[uint16]bool)
+	for _, k := range keys {
+		t.state[k] = true
+	}
+	return nil
+}
+
+func (t *TransformToggle) OutputRange() (min uint32, max uint32) {
+	if t.off < t.on {
+		return t.off, t.on
+	}
+	return t.on, t.off
+}
+
+func (t *TransformToggle) String() string {
+	return fmt.Sprintf("Toggle between %d and %d per key", t.off, t.on)
+}
@@ -0,0 +1,342 @@
+package ump
+
+import (
+	"MIDIRouter/midi"
+	"encoding/binary"
+	"errors"
+)
+
+// Universal MIDI Packets (MIDI 2.0): messages of one to four 32 bits words,
+// big endian, the high nibble of the first byte being the message type and
+// the low one the group.
+const (
+	typeUtility   = 0x0
+	typeSystem    = 0x1
+	typeMIDI1     = 0x2 // MIDI 1.0 channel voice
+	typeSysEx7    = 0x3
+	typeMIDI2     = 0x4 // MIDI 2.0 channel voice
+	sysExComplete = 0x0
+	sysExStart    = 0x1
+	sysExContinue = 0x2
+	sysExEnd      = 0x3
+	maxSysExBytes = 6
+)
+
+// Words of the messages of type mt
+func wordCount(mt byte) int {
+	switch mt {
+	case 0x0, 0x1, 0x2, 0x6, 0x7:
+		return 1
+	case 0x3, 0x4, 0x8, 0x9, 0xA:
+		return 2
+	case 0xB, 0xC:
+		return 3
+	}
+	return 4
+}
+
+// Convert UMP data to MIDI 1.0 bytes. MIDI 2.0 values are scaled down to 7 or
+// 14 bits, bank select and RPN/NRPN messages become Control Change sequences.
+// Utility messages, per-note messages and 128 bits data messages are dropped.
+func ToMIDI1(data []byte) ([]byte, error) {
+	var out []byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return out, errors.New("Invalid UMP data: incomplete word")
+		}
+		mt := data[0] >> 4
+		n := 4 * wordCount(mt)
+		if len(data) < n {
+			return out, errors.New("Invalid UMP data: incomplete message")
+		}
+		out = append(out, toMIDI1(data[:n])...)
+		data = data[n:]
+	}
+	return out, nil
+}
+
+// Convert UMP data to MIDI 1.0 packets, one per UMP message. Channel voice
+// messages scaled down to a single MIDI 1.0 message keep their MIDI 2.0 value
+// (see midi.Packet HighRes).
+func ToPackets(data []byte, timeStamp uint64) ([]midi.Packet, error) {
+	var packets []midi.Packet
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return packets, errors.New("Invalid UMP data: incomplete word")
+		}
+		mt := data[0] >> 4
+		n := 4 * wordCount(mt)
+		if len(data) < n {
+			return packets, errors.New("Invalid UMP data: incomplete message")
+		}
+		m := data[:n]
+		data = data[n:]
+		converted := toMIDI1(m)
+		if len(converted) == 0 {
+			continue
+		}
+		packet := midi.NewPacket(converted, timeStamp)
+		if (mt == typeMIDI2) && (len(converted) == messageLength(converted[0])) {
+			switch ValueBits(converted[0]) {
+			case 16:
+				packet.HighRes, packet.HasHighRes = uint32(binary.BigEndian.Uint16(m[4:])), true
+			case 32:
+				packet.HighRes, packet.HasHighRes = binary.BigEndian.Uint32(m[4:]), true
+			}
+		}
+		packets = append(packets, packet)
+	}
+	return packets, nil
+}
+
+func toMIDI1(m []byte) []byte {
+	switch m[0] >> 4 {
+	case typeSystem:
+		return m[1 : 1+messageLength(m[1])]
+	case typeMIDI1:
+		if m[1] < 0x80 {
+			return nil
+		}
+		return m[1 : 1+messageLength(m[1])]
+	case typeSysEx7:
+		count := int(m[1] & 0x0F)
+		if count > maxSysExBytes {
+			count = maxSysExBytes
+		}
+		var out []byte
+		status := m[1] >> 4
+		if (status == sysExComplete) || (status == sysExStart) {
+			out = append(out, 0xF0)
+		}
+		out = append(out, m[2:2+count]...)
+		if (status == sysExComplete) || (status == sysExEnd) {
+			out = append(out, 0xF7)
+		}
+		return out
+	case typeMIDI2:
+		return midi2ToMIDI1(m)
+	}
+	return nil
+}
+
+func midi2ToMIDI1(m []byte) []byte {
+	status, channel := m[1]&0xF0, m[1]&0x0F
+	value := binary.BigEndian.Uint32(m[4:])
+	switch status {
+	case 0x80:
+		return []byte{0x80 | channel, m[2], byte(value >> 25)}
+	case 0x90:
+		velocity := byte(value >> 25)
+		//Velocity 0 is not a Note Off in MIDI 2.0
+		if velocity == 0 {
+			velocity = 1
+		}
+		return []byte{0x90 | channel, m[2], velocity}
+	case 0xA0, 0xB0:
+		return []byte{status | channel, m[2], byte(value >> 25)}
+	case 0xC0:
+		var out []byte
+		//Bank valid flag
+		if m[3]&0x01 != 0 {
+			out = append(out, 0xB0|channel, 0x00, m[6], 0xB0|channel, 0x20, m[7])
+		}
+		return append(out, 0xC0|channel, m[4])
+	case 0xD0:
+		return []byte{0xD0 | channel, byte(value >> 25)}
+	case 0xE0:
+		bend := value >> 18
+		return []byte{0xE0 | channel, byte(bend & 0x7F), byte(bend >> 7)}
+	case 0x20, 0x30:
+		//Registered (RPN) and assignable (NRPN) controllers
+		msb, lsb := byte(101), byte(100)
+		if status == 0x30 {
+			msb, lsb = 99, 98
+		}
+		data := value >> 18
+		cc := 0xB0 | channel
+		return []byte{cc, msb, m[2], cc, lsb, m[3], cc, 0x06, byte(data >> 7), cc, 0x26, byte(data & 0x7F)}
+	}
+	return nil
+}
+
+// Convert MIDI 1.0 bytes (complete messages) to UMP, with MIDI 2.0 channel
+// voice messages on group. Values are scaled up to 16 or 32 bits, Note On with
+// velocity 0 becomes Note Off.
+func FromMIDI1(data []byte, group byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		b := data[i]
+		if b == 0xF0 {
+			end := i + 1
+			for (end < len(data)) && (data[end] != 0xF7) {
+				end++
+			}
+			out = append(out, sysEx7(data[i+1:end], group)...)
+			i = end + 1
+			continue
+		}
+		if b < 0x80 {
+			//Stray data byte
+			i++
+			continue
+		}
+		n := messageLength(b)
+		if i+n > len(data) {
+			break
+		}
+		msg := data[i : i+n]
+		i += n
+
+		if b >= 0xF0 {
+			word := [4]byte{typeSystem<<4 | group}
+			copy(word[1:], msg)
+			out = append(out, word[:]...)
+			continue
+		}
+		out = append(out, midi1ToMIDI2(msg, group)...)
+	}
+	return out
+}
+
+func midi1ToMIDI2(msg []byte, group byte) []byte {
+	status, channel := msg[0]&0xF0, msg[0]&0x0F
+	m := []byte{typeMIDI2<<4 | group, msg[0], 0, 0, 0, 0, 0, 0}
+	switch status {
+	case 0x80, 0x90:
+		m[2] = msg[1]
+		velocity := ScaleUp(uint32(msg[2]), 7, 16)
+		if (status == 0x90) && (msg[2] == 0) {
+			m[1] = 0x80 | channel
+			velocity = 0
+		}
+		binary.BigEndian.PutUint16(m[4:], uint16(velocity))
+	case 0xA0, 0xB0:
+		m[2] = msg[1]
+		binary.BigEndian.PutUint32(m[4:], ScaleUp(uint32(msg[2]), 7, 32))
+	case 0xC0:
+		m[4] = msg[1]
+	case 0xD0:
+		binary.BigEndian.PutUint32(m[4:], ScaleUp(uint32(msg[1]), 7, 32))
+	case 0xE0:
+		bend := uint32(msg[1]) | uint32(msg[2])<<7
+		binary.BigEndian.PutUint32(m[4:], ScaleUp(bend, 14, 32))
+	}
+	return m
+}
+
+// Convert a MIDI 1.0 channel voice message to UMP on group, value being its
+// MIDI 2.0 value (ValueBits bits) instead of the MIDI 1.0 one scaled up
+func FromMIDI1Value(msg []byte, group byte, value uint32) []byte {
+	if (len(msg) == 0) || (len(msg) != messageLength(msg[0])) || (msg[0] >= 0xF0) {
+		return FromMIDI1(msg, group)
+	}
+	m := midi1ToMIDI2(msg, group)
+	switch ValueBits(msg[0]) {
+	case 16:
+		//Note On with velocity 0 stays a Note Off
+		if (msg[0]&0xF0 == 0x80) || (msg[2] != 0) {
+			binary.BigEndian.PutUint16(m[4:], uint16(value))
+		}
+	case 32:
+		binary.BigEndian.PutUint32(m[4:], value)
+	}
+	return m
+}
+
+// Bits of the MIDI 2.0 value of the channel voice messages of status: 16 for
+// note velocities, 32 for controllers, pressure and pitch bend, 0 for the
+// messages without a scaled value (Program Change)
+func ValueBits(status byte) uint {
+	switch status & 0xF0 {
+	case 0x80, 0x90:
+		return 16
+	case 0xA0, 0xB0, 0xD0, 0xE0:
+		return 32
+	}
+	return 0
+}
+
+// Value of a MIDI 1.0 channel voice message, and its bits (7, 14 for pitch
+// bend), 0 bits for the messages without a scaled value
+func MIDI1Value(msg []byte) (value uint32, bits uint) {
+	if (len(msg) == 0) || (len(msg) != messageLength(msg[0])) {
+		return 0, 0
+	}
+	switch msg[0] & 0xF0 {
+	case 0x80, 0x90, 0xA0, 0xB0:
+		return uint32(msg[2]), 7
+	case 0xD0:
+		return uint32(msg[1]), 7
+	case 0xE0:
+		return uint32(msg[1]) | uint32(msg[2])<<7, 14
+	}
+	return 0, 0
+}
+
+// SysEx data, without F0 and F7, as 7 bits SysEx messages
+func sysEx7(data []byte, group byte) []byte {
+	var out []byte
+	first := true
+	for {
+		n := len(data)
+		if n > maxSysExBytes {
+			n = maxSysExBytes
+		}
+		last := n == len(data)
+		status := byte(sysExContinue)
+		switch {
+		case first && last:
+			status = sysExComplete
+		case first:
+			status = sysExStart
+		case last:
+			status = sysExEnd
+		}
+		m := [8]byte{typeSysEx7<<4 | group, status<<4 | byte(n)}
+		copy(m[2:], data[:n])
+		out = append(out, m[:]...)
+		data = data[n:]
+		first = false
+		if last {
+			return out
+		}
+	}
+}
+
+// Min-center-max scaling of the MIDI 2.0 specification: the minimum, center
+// and maximum values stay the minimum, center and maximum values
+func ScaleUp(value uint32, srcBits uint, dstBits uint) uint32 {
+	scaleBits := dstBits - srcBits
+	shifted := value << scaleBits
+	center := uint32(1) << (srcBits - 1)
+	if value <= center {
+		return shifted
+	}
+	repeatBits := srcBits - 1
+	repeat := value & ((uint32(1) << repeatBits) - 1)
+	if scaleBits > repeatBits {
+		repeat <<= scaleBits - repeatBits
+	} else {
+		repeat >>= repeatBits - scaleBits
+	}
+	for repeat != 0 {
+		shifted |= repeat
+		repeat >>= repeatBits
+	}
+	return shifted
+}
+
+// Length of the MIDI 1.0 message starting with status, status byte included
+func messageLength(status byte) int {
+	switch {
+	case (status >= 0x80) && (status < 0xC0), (status >= 0xE0) && (status < 0xF0):
+		return 3
+	case (status >= 0xC0) && (status < 0xE0):
+		return 2
+	case (status == 0xF1) || (status == 0xF3):
+		return 2
+	case status == 0xF2:
+		return 3
+	}
+	return 1
+}
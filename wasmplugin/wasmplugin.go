@@ -0,0 +1,202 @@
+package wasmplugin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Plugin ABI. Messages are exchanged through a buffer of the module memory:
+//
+//	midirouter_buffer() -> i32                    address of a buffer of at least BufferSize bytes
+//	midirouter_match(len i32) -> i32              message in buffer; value (0-65535) or negative to reject
+//	midirouter_generate(len i32, value i32) -> i32  message in buffer; output written to buffer, returns its length
+const (
+	BufferSize     = 256
+	exportBuffer   = "midirouter_buffer"
+	exportMatch    = "midirouter_match"
+	exportGenerate = "midirouter_generate"
+)
+
+const (
+	maxRunTime  = 20 * time.Millisecond // Of a call, so a runaway loop can't stall routing
+	maxLoadTime = time.Second           // Of the module initialization
+)
+
+// A WebAssembly plugin instance. Calls are serialized, instances are not
+// shared between rules.
+type Plugin struct {
+	path     string
+	mutex    sync.Mutex
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	module   api.Module // nil after a call timed out, until instantiated again
+	buffer   uint32
+	export   map[string]bool
+}
+
+// Load and instantiate a plugin. WASI is available, for modules built by
+// toolchains which require it.
+func Load(path string) (*Plugin, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("Failed to read plugin: " + err.Error())
+	}
+
+	//Modules running past the deadline of a call are closed
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+
+	compiled, err := runtime.CompileModule(ctx, code)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, errors.New("Failed to load plugin " + path + ": " + err.Error())
+	}
+
+	p := &Plugin{path: path, runtime: runtime, compiled: compiled, export: make(map[string]bool)}
+	for name := range compiled.ExportedFunctions() {
+		p.export[name] = true
+	}
+	if !p.export[exportBuffer] || (len(compiled.ExportedMemories()) == 0) {
+		runtime.Close(ctx)
+		return nil, errors.New("Invalid plugin " + path + ": " + exportBuffer + " or memory not exported")
+	}
+
+	if err := p.instantiate(); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	return p, nil
+}
+
+// Instantiate the module, with a fresh memory
+func (p *Plugin) instantiate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), maxLoadTime)
+	defer cancel()
+
+	module, err := p.runtime.InstantiateModule(ctx, p.compiled,
+		wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return errors.New("Failed to load plugin " + p.path + ": " + err.Error())
+	}
+	res, err := module.ExportedFunction(exportBuffer).Call(ctx)
+	if err != nil {
+		module.Close(context.Background())
+		return errors.New("Invalid plugin " + p.path + ": " + err.Error())
+	}
+	p.module = module
+	p.buffer = uint32(res[0])
+	return nil
+}
+
+// Call an exported function, for up to maxRunTime. A module running past
+// the deadline is closed, and instantiated again on the next call: its state
+// is lost.
+func (p *Plugin) call(name string, params ...uint64) ([]uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), maxRunTime)
+	defer cancel()
+
+	res, err := p.module.ExportedFunction(name).Call(ctx, params...)
+	if (err != nil) && (ctx.Err() != nil) {
+		p.module = nil
+		return nil, errors.New("call timed out")
+	}
+	return res, err
+}
+
+// Make sure the module is instantiated before using it
+func (p *Plugin) ready() error {
+	if p.module != nil {
+		return nil
+	}
+	return p.instantiate()
+}
+
+func (p *Plugin) write(data []byte) bool {
+	return p.module.Memory().Write(p.buffer, data)
+}
+
+func (p *Plugin) read(n uint32) ([]byte, bool) {
+	return p.module.Memory().Read(p.buffer, n)
+}
+
+// Release the runtime
+func (p *Plugin) Close() error {
+	return p.runtime.Close(context.Background())
+}
+
+func (p *Plugin) Path() string {
+	return p.path
+}
+
+// Whether the plugin can be used as filter / generator
+func (p *Plugin) CanMatch() bool {
+	return p.export[exportMatch]
+}
+
+func (p *Plugin) CanGenerate() bool {
+	return p.export[exportGenerate]
+}
+
+// Returns the value extracted from a message, or false if the plugin rejects it
+func (p *Plugin) Match(data []byte) (uint16, bool, error) {
+	if len(data) > BufferSize {
+		return 0, false, nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.ready(); err != nil {
+		return 0, false, err
+	}
+	if !p.write(data) {
+		return 0, false, errors.New("Plugin " + p.path + ": buffer out of memory")
+	}
+	res, err := p.call(exportMatch, uint64(len(data)))
+	if err != nil {
+		return 0, false, errors.New("Plugin " + p.path + ": " + err.Error())
+	}
+	value := int32(res[0])
+	if (value < 0) || (value > 0xFFFF) {
+		return 0, false, nil
+	}
+	return uint16(value), true, nil
+}
+
+// Returns the bytes generated for a filtered message and its value
+func (p *Plugin) Generate(data []byte, value uint16) ([]byte, error) {
+	if len(data) > BufferSize {
+		return nil, errors.New("Plugin " + p.path + ": message too long")
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.ready(); err != nil {
+		return nil, err
+	}
+	if !p.write(data) {
+		return nil, errors.New("Plugin " + p.path + ": buffer out of memory")
+	}
+	res, err := p.call(exportGenerate, uint64(len(data)), uint64(value))
+	if err != nil {
+		return nil, errors.New("Plugin " + p.path + ": " + err.Error())
+	}
+	n := int32(res[0])
+	if (n < 0) || (n > BufferSize) {
+		return nil, errors.New("Plugin " + p.path + ": generation failed")
+	}
+	out, ok := p.read(uint32(n))
+	if !ok {
+		return nil, errors.New("Plugin " + p.path + ": buffer out of memory")
+	}
+	return append([]byte(nil), out...), nil
+}